@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/allinone"
+	"github.com/getz-devs/librakeeper-server/internal/allinone/config"
+	"github.com/getz-devs/librakeeper-server/lib/prettylog"
+	"log/slog"
+	"os"
+)
+
+const usage = `usage: librakeeper all-in-one [--config path]
+
+Runs the server, the searcher and the searcher agent in one process.
+`
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "all-in-one" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.MustLoad(os.Args[2:])
+	log := prettylog.SetupLogger(cfg.Env)
+	log.Info("starting librakeeper all-in-one", slog.String("env", cfg.Env), slog.Int("port", cfg.Server.Port))
+
+	application, err := allinone.New(cfg, log)
+	if err != nil {
+		log.Error("failed to initialize", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	if err := application.Run(); err != nil {
+		log.Error("server error", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	log.Info("application fully stopped")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	searcherconfig "github.com/getz-devs/librakeeper-server/internal/searcher/config"
+	mongostorage "github.com/getz-devs/librakeeper-server/internal/searcher/storage/mongo"
+	"github.com/getz-devs/librakeeper-server/internal/server/config"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/storage"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/mongo"
+	"github.com/getz-devs/librakeeper-server/lib/prettylog"
+	"log/slog"
+	"os"
+)
+
+// migrate applies the pending MongoDB migrations of the server or the
+// searcher: index builds and data conversions.
+func main() {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	service := flags.String("service", "server", "whose database to migrate: server or searcher")
+	configPath := flags.String("config", "", "Path to the config file")
+	_ = flags.Parse(os.Args[1:])
+
+	if *configPath == "" {
+		*configPath = os.Getenv("CONFIG_PATH")
+	}
+	if *configPath == "" {
+		fmt.Fprintln(os.Stderr, "no config file path provided")
+		os.Exit(2)
+	}
+
+	var err error
+	switch *service {
+	case "server":
+		err = migrateServer(*configPath)
+	case "searcher":
+		err = migrateSearcher(*configPath)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown service %q\n", *service)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migration failed:", err)
+		os.Exit(1)
+	}
+}
+
+func migrateServer(configPath string) error {
+	cfg := config.MustLoadByPath(configPath)
+	log := prettylog.SetupLogger(cfg.Env)
+	log.Info("starting librakeeper migration", slog.String("env", cfg.Env))
+
+	if cfg.Database.Driver != config.DriverMongo {
+		log.Info("nothing to migrate, the embedded database migrates itself when opened",
+			slog.String("driver", cfg.Database.Driver))
+		return nil
+	}
+
+	db, err := storage.Initialize(cfg, log)
+	if err != nil {
+		return err
+	}
+
+	return mongo.Migrate(context.Background(), db, log)
+}
+
+func migrateSearcher(configPath string) error {
+	cfg := searcherconfig.MustLoadByPath(configPath)
+	log := prettylog.SetupLogger(cfg.Env)
+	log.Info("starting searcher migration", slog.String("env", cfg.Env))
+
+	if cfg.Database.Driver != searcherconfig.DriverMongo {
+		log.Info("nothing to migrate, the embedded database migrates itself when opened",
+			slog.String("driver", cfg.Database.Driver))
+		return nil
+	}
+
+	s := mongostorage.New(mongostorage.DatabaseMongoConfig{
+		ConnectUrl: cfg.DatabaseMongo.ConnectURL,
+		Database:   cfg.DatabaseMongo.DatabaseName,
+		Collection: cfg.DatabaseMongo.CollectionName,
+	})
+	defer s.Close()
+
+	return s.Migrate(context.Background(), log)
+}
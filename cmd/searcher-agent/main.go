@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/app"
+	app_rabbit "github.com/getz-devs/librakeeper-server/internal/searcher-agent/app/rabbit"
 	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/config"
 	mongostorage "github.com/getz-devs/librakeeper-server/internal/searcher-agent/storage/mongo"
 	"github.com/getz-devs/librakeeper-server/lib/prettylog"
@@ -34,8 +35,14 @@ func main() {
 		Collection: cfg.DatabaseMongo.CollectionName,
 	}
 
-	application := app.New(cfg.ConnectUrl, cfg.QueueName, databaseMongoConfig, log)
+	workerConfig := app_rabbit.WorkerConfig{
+		Workers:    cfg.Workers.Count,
+		JobTimeout: cfg.Workers.JobTimeout,
+	}
+
+	application := app.New(cfg.ConnectUrl, cfg.QueueName, databaseMongoConfig, workerConfig, cfg.Providers, cfg.HealthPort, log)
 	go application.AppRabbit.MustRun()
+	go application.Health.MustRun()
 
 	// --------------------------- Register stop signal ---------------------------
 	stop := make(chan os.Signal, 1)
@@ -48,7 +55,9 @@ func main() {
 		slog.String("signal", sign.String()),
 	)
 
+	// Drain the jobs in flight before the storage they write to goes away.
 	application.AppRabbit.Close()
+	application.Health.Stop()
 	application.Storage.Close()
 
 	//application.
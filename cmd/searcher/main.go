@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	boltstorage "github.com/getz-devs/librakeeper-server/internal/searcher-shared/storage/bolt"
 	"github.com/getz-devs/librakeeper-server/internal/searcher/app"
 	"github.com/getz-devs/librakeeper-server/internal/searcher/config"
 	"github.com/getz-devs/librakeeper-server/internal/searcher/rabbitProvider"
+	"github.com/getz-devs/librakeeper-server/internal/searcher/services/searcher"
 	mongostorage "github.com/getz-devs/librakeeper-server/internal/searcher/storage/mongo"
 	"github.com/getz-devs/librakeeper-server/lib/prettylog"
 	"log/slog"
@@ -23,20 +26,29 @@ func main() {
 		slog.Int("port", cfg.GRPC.Port),
 	)
 
-	databaseMongoConfig := mongostorage.DatabaseMongoConfig{
-		ConnectUrl: cfg.DatabaseMongo.ConnectURL,
-		Database:   cfg.DatabaseMongo.DatabaseName,
-		Collection: cfg.DatabaseMongo.CollectionName,
-	}
-
 	rabbitConfig := rabbitProvider.RabbitConfig{
 		RabbitUrl: cfg.Rabbit.URL,
 		QueueName: cfg.Rabbit.QueueName,
 	}
 
+	retryPolicy := searcher_service.RetryPolicy{
+		MaxAttempts: cfg.Retry.MaxAttempts,
+		BaseDelay:   cfg.Retry.BaseDelay,
+		MaxDelay:    cfg.Retry.MaxDelay,
+	}
+
+	freshness := searcher_service.FreshnessPolicy{
+		TTL:            cfg.Freshness.TTL,
+		RefreshTimeout: cfg.Freshness.RefreshTimeout,
+		PopularMinHits: cfg.Freshness.PopularMinHits,
+		PopularWindow:  cfg.Freshness.PopularWindow,
+		SweepBatch:     cfg.Freshness.SweepBatch,
+	}
+
 	// --------------------------- Start Application server -----------------------
-	application := app.New(log, cfg.GRPC.Port, databaseMongoConfig, rabbitConfig)
+	application := app.New(log, cfg.GRPC.Port, mustOpenStorage(cfg, log), rabbitConfig, retryPolicy, freshness, cfg.Freshness.SweepInterval)
 	go application.GRPCSrv.MustRun()
+	go application.Sweeper.Run()
 
 	// --------------------------- Register stop signal ---------------------------
 	stop := make(chan os.Signal, 1)
@@ -50,8 +62,35 @@ func main() {
 	)
 
 	application.GRPCSrv.Stop()
+	application.Sweeper.Stop()
+	application.Rabbit.Close()
 
 	application.Storage.Close()
 
 	log.Info("application fully stopped")
 }
+
+// mustOpenStorage opens the search request storage selected by database.driver.
+func mustOpenStorage(cfg *config.Config, log *slog.Logger) app.Storage {
+	if cfg.Database.Driver == config.DriverBolt {
+		// The agent completes the requests in the same storage, so it has to
+		// run in this process.
+		storage, err := boltstorage.New(cfg.Database.Path, log)
+		if err != nil {
+			panic(err)
+		}
+		return storage
+	}
+
+	storage := mongostorage.New(mongostorage.DatabaseMongoConfig{
+		ConnectUrl: cfg.DatabaseMongo.ConnectURL,
+		Database:   cfg.DatabaseMongo.DatabaseName,
+		Collection: cfg.DatabaseMongo.CollectionName,
+	})
+	if cfg.Database.MigrateOnStartup {
+		if err := storage.Migrate(context.Background(), log); err != nil {
+			panic(err)
+		}
+	}
+	return storage
+}
@@ -0,0 +1,85 @@
+// Command validate-scrapers checks scraper definitions for the searcher-agent.
+//
+// With no arguments it validates the builtin definitions; otherwise it
+// validates the given files. With -isbn it also runs each valid definition
+// against the live site and prints the offers it finds.
+//
+//	go run ./cmd/validate-scrapers ./config/searcher-agent/scrapers/shop.yaml
+//	go run ./cmd/validate-scrapers -isbn 9785446120581
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/providers"
+	"log/slog"
+	"os"
+	"time"
+)
+
+func main() {
+	isbn := flag.String("isbn", "", "scrape this ISBN with each valid definition")
+	timeout := flag.Duration("timeout", time.Minute, "timeout of a scrape")
+	flag.Parse()
+
+	type source struct {
+		name string
+		load func() (*providers.Definition, error)
+	}
+
+	var sources []source
+	if flag.NArg() == 0 {
+		for _, name := range providers.BuiltinDefinitionNames() {
+			sources = append(sources, source{"builtin " + name, func() (*providers.Definition, error) {
+				return providers.BuiltinDefinition(name)
+			}})
+		}
+	}
+	for _, path := range flag.Args() {
+		sources = append(sources, source{path, func() (*providers.Definition, error) {
+			return providers.LoadDefinition(path)
+		}})
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	failed := false
+	for _, src := range sources {
+		def, err := src.load()
+		if err != nil {
+			fmt.Printf("FAIL %s\n%v\n", src.name, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("ok   %s\n", src.name)
+
+		if *isbn == "" {
+			continue
+		}
+		if err := scrape(def, *isbn, *timeout, log); err != nil {
+			fmt.Printf("FAIL %s: scrape: %v\n", src.name, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func scrape(def *providers.Definition, isbn string, timeout time.Duration, log *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	books, err := providers.NewScraperFromDefinition(def, log).SearchByISBN(ctx, isbn)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	fmt.Printf("     %d offers for %s\n", len(books), isbn)
+	return encoder.Encode(books)
+}
@@ -0,0 +1,178 @@
+// Package allinone runs the server, the searcher and the searcher-agent in one
+// process, for small self-hosted deployments. The server reaches the searcher
+// over an in-process gRPC listener and the searcher hands jobs to the agent
+// through an in-process queue, so neither RabbitMQ nor a gRPC port is needed.
+package allinone
+
+import (
+	"context"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/allinone/config"
+	agentapp "github.com/getz-devs/librakeeper-server/internal/searcher-agent/app"
+	app_rabbit "github.com/getz-devs/librakeeper-server/internal/searcher-agent/app/rabbit"
+	agentstorage "github.com/getz-devs/librakeeper-server/internal/searcher-agent/storage/mongo"
+	boltstorage "github.com/getz-devs/librakeeper-server/internal/searcher-shared/storage/bolt"
+	searcherapp "github.com/getz-devs/librakeeper-server/internal/searcher/app"
+	searcherconfig "github.com/getz-devs/librakeeper-server/internal/searcher/config"
+	searcher_service "github.com/getz-devs/librakeeper-server/internal/searcher/services/searcher"
+	mongostorage "github.com/getz-devs/librakeeper-server/internal/searcher/storage/mongo"
+	"github.com/getz-devs/librakeeper-server/internal/server"
+	"github.com/getz-devs/librakeeper-server/lib/rabbit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"log/slog"
+	"net"
+)
+
+const (
+	// queueName is the in-process queue of the search jobs.
+	queueName = "searcher"
+	// listenerBuffer is the size of the in-process gRPC connection buffer.
+	listenerBuffer = 1 << 20
+)
+
+type App struct {
+	log      *slog.Logger
+	Server   *server.Server
+	Searcher *searcherapp.App
+	Agent    *agentapp.App
+
+	listener *bufconn.Listener
+	conn     *grpc.ClientConn
+}
+
+// New wires the three services together. The searcher and the agent share the
+// search request storage selected by searcher.database.
+func New(cfg *config.Config, log *slog.Logger) (*App, error) {
+	searcherStorage, agentStorage, err := openRequestStorage(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search request storage: %w", err)
+	}
+
+	broker := rabbit.NewMemoryBroker()
+
+	retryPolicy := searcher_service.RetryPolicy{
+		MaxAttempts: cfg.Searcher.Retry.MaxAttempts,
+		BaseDelay:   cfg.Searcher.Retry.BaseDelay,
+		MaxDelay:    cfg.Searcher.Retry.MaxDelay,
+	}
+	freshness := searcher_service.FreshnessPolicy{
+		TTL:            cfg.Searcher.Freshness.TTL,
+		RefreshTimeout: cfg.Searcher.Freshness.RefreshTimeout,
+		PopularMinHits: cfg.Searcher.Freshness.PopularMinHits,
+		PopularWindow:  cfg.Searcher.Freshness.PopularWindow,
+		SweepBatch:     cfg.Searcher.Freshness.SweepBatch,
+	}
+	searcher := searcherapp.NewWithPublisher(log, searcherStorage, broker, queueName, retryPolicy, freshness, cfg.Searcher.Freshness.SweepInterval)
+
+	workerConfig := app_rabbit.WorkerConfig{
+		Workers:    cfg.Agent.Workers.Count,
+		JobTimeout: cfg.Agent.Workers.JobTimeout,
+	}
+	agent, err := agentapp.NewWithBroker(broker, queueName, agentStorage, workerConfig, cfg.Agent.Providers, log)
+	if err != nil {
+		searcherStorage.Close()
+		return nil, err
+	}
+
+	listener := bufconn.Listen(listenerBuffer)
+	conn, err := grpc.NewClient("passthrough:///searcher",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		searcherStorage.Close()
+		return nil, fmt.Errorf("failed to create searcher client: %w", err)
+	}
+
+	return &App{
+		log:      log,
+		Server:   server.NewServerWithSearcher(&cfg.Config, log, conn),
+		Searcher: searcher,
+		Agent:    agent,
+		listener: listener,
+		conn:     conn,
+	}, nil
+}
+
+// openRequestStorage opens the search request storage for the searcher and
+// for the agent. With the bolt driver both use the same Storage, since only
+// one can open the file.
+func openRequestStorage(cfg *config.Config, log *slog.Logger) (searcherapp.Storage, agentapp.Storage, error) {
+	if cfg.Searcher.Database.Driver == searcherconfig.DriverBolt {
+		storage, err := boltstorage.New(cfg.Searcher.Database.Path, log)
+		if err != nil {
+			return nil, nil, err
+		}
+		return storage, sharedStorage{storage}, nil
+	}
+
+	mongo := cfg.Searcher.DatabaseMongo
+	searcher := mongostorage.New(mongostorage.DatabaseMongoConfig{
+		ConnectUrl: mongo.ConnectURL,
+		Database:   mongo.DatabaseName,
+		Collection: mongo.CollectionName,
+	})
+	if cfg.Searcher.Database.MigrateOnStartup {
+		if err := searcher.Migrate(context.Background(), log); err != nil {
+			searcher.Close()
+			return nil, nil, err
+		}
+	}
+	agent := agentstorage.New(agentstorage.DatabaseMongoConfig{
+		ConnectUrl: mongo.ConnectURL,
+		Database:   mongo.DatabaseName,
+		Collection: mongo.CollectionName,
+	})
+	return searcher, agent, nil
+}
+
+// sharedStorage hands the searcher's storage to the agent. The searcher owns
+// it, so closing it through the agent does nothing.
+type sharedStorage struct {
+	*boltstorage.Storage
+}
+
+func (sharedStorage) Close() {}
+
+// Run starts the searcher and the agent and serves the API until the process
+// is told to stop. Then it stops the services in the reverse order: the agent
+// finishes the jobs in flight before the storage is closed.
+func (a *App) Run() error {
+	a.Start()
+	err := a.Server.Run()
+
+	a.log.Info("shutting down searcher and agent ...")
+	a.Stop()
+	return err
+}
+
+// Start starts the searcher and the agent. The in-process queue starts empty,
+// so the searches left pending by the previous run are enqueued again first;
+// otherwise they would stay pending forever.
+func (a *App) Start() {
+	go func() {
+		if err := a.Searcher.GRPCSrv.Serve(a.listener); err != nil {
+			a.log.Error("searcher stopped", slog.Any("error", err))
+		}
+	}()
+	go a.Searcher.Sweeper.Run()
+
+	if _, err := a.Searcher.Service.ResumePending(context.Background()); err != nil {
+		a.log.Error("failed to resume pending searches", slog.Any("error", err))
+	}
+	go a.Agent.AppRabbit.MustRun()
+}
+
+// Stop stops the searcher and the agent and closes their storage.
+func (a *App) Stop() {
+	_ = a.conn.Close()
+	a.Searcher.GRPCSrv.Stop()
+	a.Searcher.Sweeper.Stop()
+	a.Agent.AppRabbit.Close()
+	a.Agent.Storage.Close()
+	a.Searcher.Storage.Close()
+}
@@ -0,0 +1,74 @@
+package allinone
+
+import (
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/allinone/config"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/providers"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	boltstorage "github.com/getz-devs/librakeeper-server/internal/searcher-shared/storage/bolt"
+	searcherconfig "github.com/getz-devs/librakeeper-server/internal/searcher/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const isbn = "9785446120581"
+
+// newFindBookServer serves a recorded findbook page with two offers for isbn.
+func newFindBookServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search/d1", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("isbn") != isbn {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeFile(w, r, "../searcher-agent/providers/testdata/findbook/single.html")
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestStart_ResumesPendingSearches(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "searcher.db")
+
+	// A previous run stopped with the search still queued in memory.
+	storage, err := boltstorage.New(path, log)
+	require.NoError(t, err)
+	_, created, err := storage.FindOrCreateRequest(context.Background(), isbn)
+	require.NoError(t, err)
+	require.True(t, created)
+	storage.Close()
+
+	cfg := &config.Config{}
+	cfg.Searcher.Database = searcherconfig.DatabaseConfig{Driver: searcherconfig.DriverBolt, Path: path}
+	cfg.Agent.Workers.Count = 1
+	cfg.Agent.Workers.JobTimeout = 5 * time.Second
+	cfg.Agent.Providers = []providers.Config{{Type: providers.FindBookType, BaseURL: newFindBookServer(t).URL}}
+
+	app, err := New(cfg, log)
+	require.NoError(t, err)
+	app.Start()
+	defer app.Stop()
+
+	var request bookModels.SearchRequest
+	require.Eventually(t, func() bool {
+		request, _, err = app.Searcher.Storage.FindOrCreateRequest(context.Background(), isbn)
+		require.NoError(t, err)
+		return request.Status != bookModels.Pending
+	}, 5*time.Second, 10*time.Millisecond, "the pending search is resumed")
+
+	assert.Equal(t, bookModels.Success, request.Status)
+	assert.Len(t, request.Books, 2)
+}
@@ -0,0 +1,93 @@
+// Package config loads the configuration of the all-in-one mode. It is the
+// server configuration with a section for the searcher and one for the
+// searcher-agent; RabbitMQ and the gRPC address are not needed.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	agentconfig "github.com/getz-devs/librakeeper-server/internal/searcher-agent/config"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/providers"
+	searcherconfig "github.com/getz-devs/librakeeper-server/internal/searcher/config"
+	serverconfig "github.com/getz-devs/librakeeper-server/internal/server/config"
+	"github.com/ilyakaznacheev/cleanenv"
+	"os"
+)
+
+type Config struct {
+	serverconfig.Config `yaml:",inline"`
+
+	Searcher SearcherConfig `yaml:"searcher"`
+	Agent    AgentConfig    `yaml:"agent"`
+}
+
+// SearcherConfig configures the searcher like its own config file does.
+type SearcherConfig struct {
+	Database      searcherconfig.DatabaseConfig      `yaml:"database"`
+	DatabaseMongo searcherconfig.DatabaseMongoConfig `yaml:"database_mongo"`
+	Retry         searcherconfig.RetryConfig         `yaml:"retry"`
+	Freshness     searcherconfig.FreshnessConfig     `yaml:"freshness"`
+}
+
+// AgentConfig configures the searcher-agent like its own config file does.
+type AgentConfig struct {
+	Workers agentconfig.WorkersConfig `yaml:"workers"`
+
+	// Providers are the book sources to search; findbook alone when empty.
+	Providers []providers.Config `yaml:"providers"`
+}
+
+// MustLoad loads the configuration from the path given by the --config flag
+// in args, or by CONFIG_PATH.
+func MustLoad(args []string) *Config {
+	path, err := fetchConfigPath(args)
+	if err != nil {
+		panic(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// Load reads and validates the configuration file.
+func Load(path string) (*Config, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, errors.New("config file doesn't exist: " + path)
+	}
+
+	var cfg Config
+	if err := cleanenv.ReadConfig(path, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	searcher := searcherconfig.Config{Database: cfg.Searcher.Database, DatabaseMongo: cfg.Searcher.DatabaseMongo}
+	if err := searcher.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid searcher config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+func fetchConfigPath(args []string) (string, error) {
+	var path string
+	flags := flag.NewFlagSet("all-in-one", flag.ContinueOnError)
+	flags.StringVar(&path, "config", "", "path to config file")
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+
+	if path == "" {
+		path = os.Getenv("CONFIG_PATH")
+	}
+	if path == "" {
+		return "", errors.New("no config file path provided")
+	}
+	return path, nil
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLoadExample(t *testing.T) {
+	cfg, err := Load("../../../config/all-in-one/config.example.yaml")
+	require.NoError(t, err)
+
+	assert.Equal(t, 8080, cfg.Server.Port)
+	assert.Equal(t, "bolt", cfg.Database.Driver)
+	assert.Equal(t, "./data/librakeeper.db", cfg.Database.Path)
+	assert.Equal(t, "firebase.json", cfg.Auth.ConfigPath)
+	assert.Equal(t, "bolt", cfg.Searcher.Database.Driver)
+	assert.Equal(t, "./data/searcher.db", cfg.Searcher.Database.Path)
+	assert.Equal(t, 5, cfg.Searcher.Retry.MaxAttempts)
+	assert.Equal(t, 10*time.Minute, cfg.Searcher.Freshness.RefreshTimeout, "defaults apply to the sections")
+	assert.Equal(t, 4, cfg.Agent.Workers.Count)
+}
@@ -1,29 +1,74 @@
 package app
 
 import (
+	"fmt"
+	healthapp "github.com/getz-devs/librakeeper-server/internal/searcher-agent/app/health"
 	app_rabbit "github.com/getz-devs/librakeeper-server/internal/searcher-agent/app/rabbit"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/providers"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/rabbit"
 	mongostorage "github.com/getz-devs/librakeeper-server/internal/searcher-agent/storage/mongo"
 	"log/slog"
 )
 
 type App struct {
 	AppRabbit *app_rabbit.RabbitApp
-	Storage   *mongostorage.Storage
+	Health    *healthapp.App
+	Storage   Storage
+}
+
+// Storage completes the search requests: the searcher-agent's mongostorage,
+// or the storage of a searcher running in the same process.
+type Storage interface {
+	rabbit.RequestStorage
+	Close()
 }
 
 func New(
 	rabbitUrl string,
 	queueName string,
 	databaseMongoConfig mongostorage.DatabaseMongoConfig,
+	workerConfig app_rabbit.WorkerConfig,
+	providerConfigs []providers.Config,
+	healthPort int,
 	log *slog.Logger,
 ) *App {
 
 	storage := mongostorage.New(databaseMongoConfig)
 
-	appRabbit := app_rabbit.New(rabbitUrl, queueName, log, storage)
+	registry, err := providers.NewRegistry(providerConfigs, log)
+	if err != nil {
+		panic("failed to create providers: " + err.Error())
+	}
+
+	health := healthapp.New(log, healthPort)
+	appRabbit := app_rabbit.New(rabbitUrl, queueName, workerConfig, log, storage, registry.Enabled(), health.SetRabbitState)
 
 	return &App{
 		AppRabbit: appRabbit,
+		Health:    health,
 		Storage:   storage,
 	}
 }
+
+// NewWithBroker creates an App that consumes jobs from the given broker, e.g.
+// an in-process one, instead of dialing RabbitMQ. The health server is
+// disabled, since the broker cannot disconnect.
+func NewWithBroker(
+	broker app_rabbit.Broker,
+	queueName string,
+	storage Storage,
+	workerConfig app_rabbit.WorkerConfig,
+	providerConfigs []providers.Config,
+	log *slog.Logger,
+) (*App, error) {
+	registry, err := providers.NewRegistry(providerConfigs, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create providers: %w", err)
+	}
+
+	return &App{
+		AppRabbit: app_rabbit.NewWithBroker(broker, queueName, workerConfig, log, storage, registry.Enabled()),
+		Health:    healthapp.New(log, 0),
+		Storage:   storage,
+	}, nil
+}
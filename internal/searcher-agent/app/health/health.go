@@ -0,0 +1,87 @@
+package healthapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/lib/rabbit"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// App serves the health of the agent over HTTP. GET /health answers 200 while
+// the agent is connected to RabbitMQ and 503 otherwise.
+type App struct {
+	log    *slog.Logger
+	server *http.Server
+	rabbit atomic.Int32
+}
+
+// New creates a new App listening on the given port. A zero port disables it.
+func New(log *slog.Logger, port int) *App {
+	a := &App{log: log}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", a.handle)
+	if port != 0 {
+		a.server = &http.Server{
+			Addr:              fmt.Sprintf(":%d", port),
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+	}
+	return a
+}
+
+// SetRabbitState records the state of the RabbitMQ connection.
+func (a *App) SetRabbitState(state rabbit.State) {
+	a.rabbit.Store(int32(state))
+}
+
+func (a *App) handle(w http.ResponseWriter, _ *http.Request) {
+	state := rabbit.State(a.rabbit.Load())
+	code, status := http.StatusOK, "OK"
+	if state != rabbit.Connected {
+		code, status = http.StatusServiceUnavailable, "DOWN"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": status, "rabbit": state.String()})
+}
+
+// MustRun runs the server and panics if it fails.
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// Run serves health checks until Stop is called.
+func (a *App) Run() error {
+	const op = "healthapp.App.Run"
+	if a.server == nil {
+		return nil
+	}
+
+	a.log.With(slog.String("op", op)).Info("health server is running", slog.String("address", a.server.Addr))
+	if err := a.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Stop shuts the server down.
+func (a *App) Stop() {
+	if a.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.server.Shutdown(ctx); err != nil {
+		a.log.Error("failed to stop health server", slog.Any("error", err))
+	}
+}
@@ -2,8 +2,10 @@ package config
 
 import (
 	"flag"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/providers"
 	"github.com/ilyakaznacheev/cleanenv"
 	"os"
+	"time"
 )
 
 type Config struct {
@@ -12,7 +14,22 @@ type Config struct {
 	QueueName  string `yaml:"queue_name" env:"QUEUE_NAME" env-default:"searcher"`
 	ConnectUrl string `yaml:"connect_url" env:"CONNECT_URL" env-required:"true"`
 
+	// HealthPort is the port of the HTTP health check; 0 disables it.
+	HealthPort int `yaml:"health_port" env:"HEALTH_PORT" env-default:"0"`
+
 	DatabaseMongo DatabaseMongoConfig `yaml:"database_mongo"`
+
+	Workers WorkersConfig `yaml:"workers"`
+
+	// Providers are the book sources to search; findbook alone when empty.
+	Providers []providers.Config `yaml:"providers"`
+}
+
+// WorkersConfig sets the concurrency of the agent. The prefetch count of the
+// consumer equals Count.
+type WorkersConfig struct {
+	Count      int           `yaml:"count" env:"WORKERS" env-default:"4"`
+	JobTimeout time.Duration `yaml:"job_timeout" env:"JOB_TIMEOUT" env-default:"2m"`
 }
 
 type DatabaseMongoConfig struct {
@@ -0,0 +1,203 @@
+package providers
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/andybalholm/cascadia"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ISBNPlaceholder is replaced with the ISBN in Definition.SearchPath.
+const ISBNPlaceholder = "{isbn}"
+
+// ErrInvalidDefinition occurs when a scraper definition fails validation.
+var ErrInvalidDefinition = errors.New("invalid scraper definition")
+
+//go:embed scrapers/*.yaml
+var builtinDefinitions embed.FS
+
+// Definition describes how to scrape book offers from a site.
+type Definition struct {
+	Name           string        `yaml:"name"`
+	BaseURL        string        `yaml:"base_url"`
+	SearchPath     string        `yaml:"search_path"` // contains ISBNPlaceholder
+	UserAgent      string        `yaml:"user_agent"`
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+
+	Results    ResultSelectors `yaml:"results"`
+	Fields     FieldSelectors  `yaml:"fields"`
+	Pagination Pagination      `yaml:"pagination"`
+
+	// PlaceholderImages are image URLs the site shows instead of a cover.
+	PlaceholderImages []string `yaml:"placeholder_images"`
+
+	// RetryOn repeats a request whose response has the given header value.
+	RetryOn RetryRule `yaml:"retry_on"`
+}
+
+// ResultSelectors locate the offers on a results page.
+type ResultSelectors struct {
+	// Container wraps the result list; Item matches one offer inside it.
+	Container string `yaml:"container"`
+	Item      string `yaml:"item"`
+}
+
+// FieldSelectors extract the fields of an offer, relative to its item.
+type FieldSelectors struct {
+	Title      FieldSelector `yaml:"title"`
+	Author     FieldSelector `yaml:"author"`
+	Publishing FieldSelector `yaml:"publishing"`
+	ImgURL     FieldSelector `yaml:"img_url"`
+	ShopName   FieldSelector `yaml:"shop_name"`
+}
+
+// Pagination follows the links to further result pages.
+type Pagination struct {
+	// Next matches the link to the next page; empty disables pagination.
+	Next     string `yaml:"next"`
+	MaxPages int    `yaml:"max_pages"`
+}
+
+// RetryRule repeats a request whose response header has the given value.
+type RetryRule struct {
+	Header     string        `yaml:"header"`
+	Value      string        `yaml:"value"`
+	MaxRetries int           `yaml:"max_retries"`
+	Delay      time.Duration `yaml:"delay"`
+}
+
+// FieldSelector selects the text of an element, or one of its attributes.
+type FieldSelector struct {
+	Selector string `yaml:"selector"`
+	Attr     string `yaml:"attr"`
+}
+
+// ParseDefinition decodes and validates a scraper definition. Unknown keys
+// are rejected so that typos do not silently disable a field.
+func ParseDefinition(data []byte) (*Definition, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	def := &Definition{}
+	if err := decoder.Decode(def); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDefinition, err)
+	}
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// LoadDefinition reads a scraper definition from a file.
+func LoadDefinition(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scraper definition: %w", err)
+	}
+	def, err := ParseDefinition(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// BuiltinDefinition returns a definition shipped with the agent, by name.
+func BuiltinDefinition(name string) (*Definition, error) {
+	data, err := builtinDefinitions.ReadFile("scrapers/" + name + ".yaml")
+	if err != nil {
+		return nil, fmt.Errorf("no builtin scraper definition %q", name)
+	}
+	return ParseDefinition(data)
+}
+
+// BuiltinDefinitionNames lists the definitions shipped with the agent.
+func BuiltinDefinitionNames() []string {
+	entries, _ := builtinDefinitions.ReadDir("scrapers")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".yaml"))
+	}
+	return names
+}
+
+// Validate checks that the definition is complete and its selectors compile.
+// All problems are reported at once.
+func (d *Definition) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if d.Name == "" {
+		fail("name is required")
+	}
+	if u, err := url.Parse(d.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		fail("base_url must be an absolute URL")
+	}
+	if !strings.Contains(d.SearchPath, ISBNPlaceholder) {
+		fail("search_path must contain %s", ISBNPlaceholder)
+	}
+	if d.RequestTimeout < 0 {
+		fail("request_timeout must not be negative")
+	}
+
+	selectors := []struct {
+		key      string
+		value    string
+		required bool
+	}{
+		{"results.container", d.Results.Container, false},
+		{"results.item", d.Results.Item, true},
+		{"fields.title.selector", d.Fields.Title.Selector, true},
+		{"fields.author.selector", d.Fields.Author.Selector, false},
+		{"fields.publishing.selector", d.Fields.Publishing.Selector, false},
+		{"fields.img_url.selector", d.Fields.ImgURL.Selector, false},
+		{"fields.shop_name.selector", d.Fields.ShopName.Selector, false},
+		{"pagination.next", d.Pagination.Next, false},
+	}
+	for _, s := range selectors {
+		if s.value == "" {
+			if s.required {
+				fail("%s is required", s.key)
+			}
+			continue
+		}
+		if _, err := cascadia.ParseGroup(s.value); err != nil {
+			fail("%s: %w", s.key, err)
+		}
+	}
+
+	if d.Pagination.Next != "" && d.Pagination.MaxPages < 1 {
+		fail("pagination.max_pages must be at least 1")
+	}
+	if d.RetryOn.Header != "" && d.RetryOn.MaxRetries < 1 {
+		fail("retry_on.max_retries must be at least 1")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w %q: %w", ErrInvalidDefinition, d.Name, errors.Join(errs...))
+	}
+	return nil
+}
+
+// SearchURL returns the URL of the search results for an ISBN.
+func (d *Definition) SearchURL(isbn string) string {
+	return strings.TrimSuffix(d.BaseURL, "/") + strings.ReplaceAll(d.SearchPath, ISBNPlaceholder, url.QueryEscape(isbn))
+}
+
+// IsPlaceholderImage reports whether an image URL stands for a missing cover.
+// Placeholders match relative and absolute forms of the URL.
+func (d *Definition) IsPlaceholderImage(src string) bool {
+	for _, placeholder := range d.PlaceholderImages {
+		if src == placeholder || strings.HasSuffix(src, placeholder) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package providers
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBuiltinDefinitions(t *testing.T) {
+	names := BuiltinDefinitionNames()
+	require.Contains(t, names, FindBookType)
+
+	for _, name := range names {
+		_, err := BuiltinDefinition(name)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestParseDefinition_Invalid(t *testing.T) {
+	_, err := ParseDefinition([]byte(`
+name: broken
+base_url: "example.com"
+search_path: "/search"
+results:
+  item: "div[["
+`))
+
+	assert.ErrorIs(t, err, ErrInvalidDefinition)
+	assert.ErrorContains(t, err, "base_url must be an absolute URL")
+	assert.ErrorContains(t, err, "search_path must contain {isbn}")
+	assert.ErrorContains(t, err, "results.item")
+	assert.ErrorContains(t, err, "fields.title.selector is required")
+}
+
+func TestParseDefinition_UnknownField(t *testing.T) {
+	_, err := ParseDefinition([]byte(`
+name: typo
+fields:
+  titel:
+    selector: "h1"
+`))
+
+	assert.ErrorIs(t, err, ErrInvalidDefinition)
+	assert.ErrorContains(t, err, "titel")
+}
+
+func TestDefinition_SearchURLAndPlaceholders(t *testing.T) {
+	def, err := BuiltinDefinition(FindBookType)
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://www.findbook.ru/search/d1?isbn=9785446120581&r=0&s=1&viewsize=15&startidx=0", def.SearchURL("9785446120581"))
+	assert.True(t, def.IsPlaceholderImage("/images/camera.png"))
+	assert.True(t, def.IsPlaceholderImage("https://www.findbook.ru/images/camera.png"))
+	assert.False(t, def.IsPlaceholderImage("https://shop.example/cover.jpg"))
+}
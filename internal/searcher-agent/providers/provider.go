@@ -0,0 +1,43 @@
+// Package providers holds the book sources the searcher-agent scrapes and the
+// registry that builds them from the agent config.
+package providers
+
+import (
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+)
+
+// Provider is a source of book offers.
+type Provider interface {
+	// Name identifies the provider; it tags the books it returns.
+	Name() string
+	// Capabilities describes what the provider's results contain.
+	Capabilities() Capabilities
+	// SearchByISBN returns the offers for an ISBN-13. No offers is not an error.
+	SearchByISBN(ctx context.Context, isbn string) ([]*bookModels.BookInShop, error)
+}
+
+// Capabilities describes what a provider can return.
+type Capabilities struct {
+	Pagination  bool // follows result pages beyond the first one
+	CoverImages bool // fills BookInShop.ImgUrl
+	ShopNames   bool // fills BookInShop.ShopName
+}
+
+// Config configures one provider in the agent YAML.
+type Config struct {
+	// Name tags the results; it defaults to Type.
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// Enabled defaults to true.
+	Enabled *bool `yaml:"enabled"`
+	// Definition is the path of a scraper definition file.
+	Definition string `yaml:"definition"`
+	// BaseURL overrides the address of the source, e.g. for a mirror.
+	BaseURL string `yaml:"base_url"`
+}
+
+// IsEnabled reports whether the provider should be used.
+func (c Config) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
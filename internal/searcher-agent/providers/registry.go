@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrUnknownType occurs when the config names a provider type that is not registered.
+var ErrUnknownType = errors.New("unknown provider type")
+
+// ErrNoProviders occurs when the config enables no provider.
+var ErrNoProviders = errors.New("no providers enabled")
+
+// ErrDuplicateName occurs when two configured providers have the same name.
+var ErrDuplicateName = errors.New("duplicate provider name")
+
+// Factory builds a provider from its config.
+type Factory func(cfg Config, log *slog.Logger) (Provider, error)
+
+// factories are the provider types the agent knows, by Config.Type.
+var factories = map[string]Factory{
+	FindBookType: NewFindBook,
+	ScraperType:  NewScraper,
+}
+
+// DefaultConfig is used when the agent config lists no providers.
+var DefaultConfig = []Config{{Name: FindBookType, Type: FindBookType}}
+
+// Registry holds the enabled providers.
+type Registry struct {
+	providers []Provider
+}
+
+// NewRegistry builds the enabled providers from the config.
+func NewRegistry(configs []Config, log *slog.Logger) (*Registry, error) {
+	if len(configs) == 0 {
+		configs = DefaultConfig
+	}
+
+	r := &Registry{}
+	seen := map[string]bool{}
+	for _, cfg := range configs {
+		if cfg.Name == "" {
+			cfg.Name = cfg.Type
+		}
+		if seen[cfg.Name] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateName, cfg.Name)
+		}
+		seen[cfg.Name] = true
+
+		factory, ok := factories[cfg.Type]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownType, cfg.Type)
+		}
+		if !cfg.IsEnabled() {
+			continue
+		}
+
+		provider, err := factory(cfg, log.With(slog.String("provider", cfg.Name)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create provider %s: %w", cfg.Name, err)
+		}
+		r.providers = append(r.providers, provider)
+	}
+
+	if len(r.providers) == 0 {
+		return nil, ErrNoProviders
+	}
+	return r, nil
+}
+
+// Enabled returns the enabled providers in config order.
+func (r *Registry) Enabled() []Provider {
+	return r.providers
+}
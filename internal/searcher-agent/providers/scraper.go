@@ -0,0 +1,175 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	"github.com/gocolly/colly"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Provider types.
+const (
+	// ScraperType scrapes a site described by the definition file in Config.Definition.
+	ScraperType = "scraper"
+	// FindBookType scrapes findbook.ru with the builtin definition, unless
+	// Config.Definition points to another one.
+	FindBookType = "findbook"
+)
+
+// Scraper is a provider that scrapes a site following a Definition.
+type Scraper struct {
+	name string
+	def  *Definition
+	log  *slog.Logger
+}
+
+// NewScraper creates a scraper from the definition file in the config.
+func NewScraper(cfg Config, log *slog.Logger) (Provider, error) {
+	if cfg.Definition == "" {
+		return nil, fmt.Errorf("%w: definition is required", ErrInvalidDefinition)
+	}
+	def, err := LoadDefinition(cfg.Definition)
+	if err != nil {
+		return nil, err
+	}
+	return newScraper(cfg, def, log), nil
+}
+
+// NewFindBook creates the findbook.ru scraper.
+func NewFindBook(cfg Config, log *slog.Logger) (Provider, error) {
+	if cfg.Definition != "" {
+		return NewScraper(cfg, log)
+	}
+	def, err := BuiltinDefinition(FindBookType)
+	if err != nil {
+		return nil, err
+	}
+	return newScraper(cfg, def, log), nil
+}
+
+// NewScraperFromDefinition creates a scraper from a loaded definition.
+func NewScraperFromDefinition(def *Definition, log *slog.Logger) *Scraper {
+	return newScraper(Config{}, def, log)
+}
+
+func newScraper(cfg Config, def *Definition, log *slog.Logger) *Scraper {
+	if cfg.BaseURL != "" {
+		def.BaseURL = cfg.BaseURL
+	}
+	name := cfg.Name
+	if name == "" {
+		name = def.Name
+	}
+	return &Scraper{name: name, def: def, log: log}
+}
+
+func (p *Scraper) Name() string {
+	return p.name
+}
+
+func (p *Scraper) Capabilities() Capabilities {
+	return Capabilities{
+		Pagination:  p.def.Pagination.Next != "",
+		CoverImages: p.def.Fields.ImgURL.Selector != "",
+		ShopNames:   p.def.Fields.ShopName.Selector != "",
+	}
+}
+
+func (p *Scraper) SearchByISBN(ctx context.Context, isbn string) ([]*bookModels.BookInShop, error) {
+	const op = "providers.Scraper.SearchByISBN"
+	log := p.log.With(slog.String("op", op), slog.String("isbn", isbn))
+	def := p.def
+	preparedUrl := def.SearchURL(isbn)
+	books := []*bookModels.BookInShop{}
+
+	c := colly.NewCollector(
+		colly.AllowURLRevisit(),
+	)
+
+	//Ignore the robot.txt
+	c.IgnoreRobotsTxt = true
+	if def.RequestTimeout > 0 {
+		c.SetRequestTimeout(def.RequestTimeout)
+	}
+	if def.UserAgent != "" {
+		c.UserAgent = def.UserAgent
+	}
+
+	retryCount := 0
+	if def.RetryOn.Header != "" {
+		c.OnResponse(func(r *colly.Response) {
+			if r.Headers.Get(def.RetryOn.Header) != def.RetryOn.Value || retryCount >= def.RetryOn.MaxRetries {
+				return
+			}
+			select {
+			case <-time.After(def.RetryOn.Delay):
+			case <-ctx.Done():
+				return
+			}
+			retryCount++
+			r.Request.Visit(r.Request.URL.String())
+		})
+	}
+
+	results := def.Results.Item
+	if def.Results.Container != "" {
+		results = def.Results.Container + " " + def.Results.Item
+	}
+	c.OnHTML(results, func(e *colly.HTMLElement) {
+		book := &bookModels.BookInShop{
+			Title:      field(e, def.Fields.Title),
+			Author:     field(e, def.Fields.Author),
+			Publishing: field(e, def.Fields.Publishing),
+			ImgUrl:     field(e, def.Fields.ImgURL),
+			ShopName:   field(e, def.Fields.ShopName),
+		}
+		if def.IsPlaceholderImage(book.ImgUrl) {
+			book.ImgUrl = ""
+		}
+		books = append(books, book)
+	})
+
+	pages := 1
+	if def.Pagination.Next != "" {
+		c.OnHTML(def.Pagination.Next, func(e *colly.HTMLElement) {
+			if pages >= def.Pagination.MaxPages {
+				return
+			}
+			pages++
+			e.Request.Visit(e.Request.AbsoluteURL(e.Attr("href")))
+		})
+	}
+
+	c.OnRequest(func(r *colly.Request) {
+		if ctx.Err() != nil {
+			r.Abort()
+			return
+		}
+		log.Info("visiting", slog.String("url", r.URL.String()))
+	})
+
+	err := c.Visit(preparedUrl)
+	c.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("scraping stopped: %w", err)
+	}
+
+	return books, nil
+}
+
+// field extracts one field of an offer.
+func field(e *colly.HTMLElement, f FieldSelector) string {
+	if f.Selector == "" {
+		return ""
+	}
+	if f.Attr != "" {
+		return strings.TrimSpace(e.ChildAttr(f.Selector, f.Attr))
+	}
+	return e.ChildText(f.Selector)
+}
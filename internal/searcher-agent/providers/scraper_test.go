@@ -0,0 +1,167 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+const (
+	isbnSingle    = "9785446120581"
+	isbnPaginated = "9780306406157"
+	isbnEmpty     = "9785171183660"
+	isbnPending   = "9785041057282"
+)
+
+// newFindBookServer serves the recorded findbook pages. The first search for
+// isbnPending answers with the "Pragma: no-cache" page findbook shows while it
+// collects offers. It returns the server and the number of requests it got.
+func newFindBookServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests, pending atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search/d1", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		fixture := ""
+		switch isbn := r.URL.Query().Get("isbn"); {
+		case isbn == isbnSingle:
+			fixture = "single.html"
+		case isbn == isbnPaginated && r.URL.Query().Get("startidx") == "15":
+			fixture = "page2.html"
+		case isbn == isbnPaginated:
+			fixture = "page1.html"
+		case isbn == isbnEmpty:
+			fixture = "empty.html"
+		case isbn == isbnPending && pending.Add(1) == 1:
+			w.Header().Set("Pragma", "no-cache")
+			fixture = "pending.html"
+		case isbn == isbnPending:
+			fixture = "single.html"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeFile(w, r, filepath.Join("testdata", "findbook", fixture))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// newTestFindBook creates the builtin findbook scraper pointed at the fixture server.
+func newTestFindBook(t *testing.T, baseURL string) *Scraper {
+	t.Helper()
+
+	provider, err := NewFindBook(Config{Name: FindBookType, BaseURL: baseURL}, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	require.NoError(t, err)
+
+	scraper := provider.(*Scraper)
+	scraper.def.RetryOn.Delay = 10 * time.Millisecond
+	return scraper
+}
+
+// assertGolden compares the books with testdata/golden/<name>.json.
+// Run the tests with -update to rewrite the file.
+func assertGolden(t *testing.T, name string, books []*bookModels.BookInShop) {
+	t.Helper()
+
+	got, err := json.MarshalIndent(books, "", "  ")
+	require.NoError(t, err)
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		require.NoError(t, os.WriteFile(path, got, 0o644))
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run the tests with -update to create the golden file")
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestFindBook_SinglePage(t *testing.T) {
+	server, _ := newFindBookServer(t)
+	scraper := newTestFindBook(t, server.URL)
+
+	books, err := scraper.SearchByISBN(context.Background(), isbnSingle)
+
+	require.NoError(t, err)
+	assert.Empty(t, books[1].ImgUrl, "placeholder image is dropped")
+	assertGolden(t, "single", books)
+}
+
+func TestFindBook_Pagination(t *testing.T) {
+	server, requests := newFindBookServer(t)
+	scraper := newTestFindBook(t, server.URL)
+
+	books, err := scraper.SearchByISBN(context.Background(), isbnPaginated)
+
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+	assertGolden(t, "paginated", books)
+}
+
+func TestFindBook_MaxPages(t *testing.T) {
+	server, requests := newFindBookServer(t)
+	scraper := newTestFindBook(t, server.URL)
+	scraper.def.Pagination.MaxPages = 1
+
+	books, err := scraper.SearchByISBN(context.Background(), isbnPaginated)
+
+	require.NoError(t, err)
+	assert.Len(t, books, 1)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestFindBook_Empty(t *testing.T) {
+	server, _ := newFindBookServer(t)
+	scraper := newTestFindBook(t, server.URL)
+
+	books, err := scraper.SearchByISBN(context.Background(), isbnEmpty)
+
+	require.NoError(t, err)
+	assert.NotNil(t, books)
+	assertGolden(t, "empty", books)
+}
+
+func TestFindBook_RetriesPendingResponse(t *testing.T) {
+	server, requests := newFindBookServer(t)
+	scraper := newTestFindBook(t, server.URL)
+
+	books, err := scraper.SearchByISBN(context.Background(), isbnPending)
+
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+	assertGolden(t, "single", books)
+}
+
+func TestFindBook_ContextCanceled(t *testing.T) {
+	server, requests := newFindBookServer(t)
+	scraper := newTestFindBook(t, server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := scraper.SearchByISBN(ctx, isbnSingle)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int32(0), requests.Load())
+}
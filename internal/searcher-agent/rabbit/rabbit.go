@@ -2,126 +2,131 @@ package rabbit
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/providers"
 	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
 	rabbitDefines "github.com/getz-devs/librakeeper-server/lib/rabbit/getz.rabbitProto.v1"
-	"github.com/gocolly/colly"
 	"github.com/golang/protobuf/proto"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"log/slog"
+	"sync"
 	"time"
 )
 
+// ErrMalformedMessage occurs when a delivery is not an ISBN message. Such a
+// message can never succeed and should be dead-lettered.
+var ErrMalformedMessage = errors.New("malformed message")
+
 type Handler struct {
 	log            *slog.Logger
 	requestStorage RequestStorage
+	providers      []providers.Provider
 }
 
-func New(log *slog.Logger, requestStorage RequestStorage) *Handler {
+func New(log *slog.Logger, requestStorage RequestStorage, sources []providers.Provider) *Handler {
 	return &Handler{
 		log:            log,
 		requestStorage: requestStorage,
+		providers:      sources,
 	}
 }
 
 type RequestStorage interface {
 	CompleteRequest(ctx context.Context, isbn string, books []*bookModels.BookInShop) error
-	RejectRequest(ctx context.Context, isbn string) error
+	RejectRequest(ctx context.Context, isbn string, reason string) error
 }
 
+// storeTimeout bounds the write of a result, which runs even when the job's
+// context has expired so that a timed out scrape is still recorded.
+const storeTimeout = 10 * time.Second
+
+// Handle searches all providers for the ISBN in the delivery and stores the
+// result. A failed search is recorded on the request and is not an error;
+// errors mean the result could not be stored or the message is malformed.
+// Searching stops when ctx is done.
 func (h *Handler) Handle(ctx context.Context, delivery amqp.Delivery) error {
 	const op = "rabbit.Handler.Handle"
 	log := h.log.With(slog.String("op", op))
 
 	msg := &rabbitDefines.ISBNMessage{}
 	if err := proto.Unmarshal(delivery.Body, msg); err != nil {
-		log.Error("Error unmarshaling", err)
-		return err
+		log.Error("Error unmarshaling", slog.Any("error", err))
+		return fmt.Errorf("%w: %w", ErrMalformedMessage, err)
+	}
+	if msg.GetIsbn() == "" {
+		return fmt.Errorf("%w: isbn is empty", ErrMalformedMessage)
 	}
 
-	books, err := h.scrapISBNFindBook(msg.GetIsbn())
+	books, err := h.search(ctx, msg.GetIsbn())
+
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+
 	if err != nil {
-		if err := h.requestStorage.RejectRequest(ctx, msg.GetIsbn()); err != nil {
-			log.Error("Error rejecting request", err)
+		log.Warn("Scraping failed", slog.Any("error", err))
+		if rejectErr := h.requestStorage.RejectRequest(storeCtx, msg.GetIsbn(), err.Error()); rejectErr != nil {
+			log.Error("Error rejecting request", slog.Any("error", rejectErr))
+			return rejectErr
 		}
-		return err
+		return nil
 	}
 
-	if err := h.requestStorage.CompleteRequest(ctx, msg.GetIsbn(), books); err != nil {
-		log.Error("Error completing request", err)
+	if err := h.requestStorage.CompleteRequest(storeCtx, msg.GetIsbn(), books); err != nil {
+		log.Error("Error completing request", slog.Any("error", err))
 		return err
 	}
 
 	return nil
 }
 
-const findBookUrlTemplate = "https://www.findbook.ru/search/d1?isbn=%s&r=0&s=1&viewsize=15&startidx=0"
-
-func (h *Handler) scrapISBNFindBook(isbn string) ([]*bookModels.BookInShop, error) {
-	const op = "rabbit.Handler.scrapISBNFindBook"
+// search asks every provider at once and merges their offers, tagged with the
+// provider name. It fails only when all providers fail; partial failures are
+// logged.
+func (h *Handler) search(ctx context.Context, isbn string) ([]*bookModels.BookInShop, error) {
+	const op = "rabbit.Handler.search"
 	log := h.log.With(slog.String("op", op), slog.String("isbn", isbn))
-	preparedUrl := fmt.Sprintf(findBookUrlTemplate, isbn)
-	var books []*bookModels.BookInShop
-
-	c := colly.NewCollector(
-		colly.AllowURLRevisit(),
-		//colly.Async(true),
-	)
-
-	//Ignore the robot.txt
-	c.IgnoreRobotsTxt = true
-	// Time-out after 20 seconds.
-	c.SetRequestTimeout(20 * time.Second)
-
-	c.UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/111.0.0.0 Safari/537.36"
-
-	retryCount := 0
-	maxRetryCount := 3
-
-	c.OnResponse(func(r *colly.Response) {
-		// print all headers
-		if r.Headers.Get("Pragma") == "no-cache" && retryCount < maxRetryCount {
-			time.Sleep(1 * time.Second)
-			retryCount++
-			r.Request.Visit(preparedUrl)
-		}
-	})
-
-	c.OnHTML(
-		"section.container.results",
-		func(e *colly.HTMLElement) {
-			e.ForEach("div.row.results__line", func(_ int, e *colly.HTMLElement) {
-				book := &bookModels.BookInShop{}
-				err := e.Unmarshal(book)
-				if err != nil {
-					return
-				}
-				if book.ImgUrl == "/images/camera.png" {
-					book.ImgUrl = ""
-				}
 
-				books = append(books, book)
-			})
-		},
-	)
-	c.OnHTML("div.pagination__pages a:has(i.icon-angle-right)", func(e *colly.HTMLElement) {
-		e.Request.Visit(e.Request.AbsoluteURL(e.Attr("href")))
-	})
-	c.OnRequest(func(r *colly.Request) {
-		log.Info("visiting", slog.String("url", r.URL.String()))
-	})
-
-	err := c.Visit(preparedUrl)
-	c.Wait()
-	if err != nil {
-		return nil, err
+	results := make([][]*bookModels.BookInShop, len(h.providers))
+	errs := make([]error, len(h.providers))
+
+	var wg sync.WaitGroup
+	for i, provider := range h.providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if p := recover(); p != nil {
+					errs[i] = fmt.Errorf("%s: panicked: %v", provider.Name(), p)
+				}
+			}()
+
+			books, err := provider.SearchByISBN(ctx, isbn)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", provider.Name(), err)
+				return
+			}
+			for _, book := range books {
+				book.Provider = provider.Name()
+			}
+			results[i] = books
+		}()
+	}
+	wg.Wait()
+
+	books := []*bookModels.BookInShop{}
+	failed := 0
+	for i := range h.providers {
+		if errs[i] != nil {
+			failed++
+			log.Warn("provider failed", slog.Any("error", errs[i]))
+			continue
+		}
+		books = append(books, results[i]...)
 	}
 
-	//for _, p := range books {
-	//	fmt.Printf("%+v\n\n", p)
-	//}
-	if len(books) == 0 {
-		return []*bookModels.BookInShop{}, nil
+	if failed == len(h.providers) {
+		return nil, errors.Join(errs...)
 	}
 	return books, nil
 }
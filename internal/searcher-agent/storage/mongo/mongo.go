@@ -43,9 +43,9 @@ func (s *Storage) Close() {
 
 func (s *Storage) FindOrCreateRequest(ctx context.Context, isbn string) (bookModels.SearchRequest, bool, error) {
 	// insert if not exist (upsert)
-	filter := bson.D{{"isbn", isbn}}
+	filter := bson.D{{Key: "isbn", Value: isbn}}
 	insertValue := bookModels.New(isbn)
-	value := bson.D{{"$setOnInsert", insertValue}}
+	value := bson.D{{Key: "$setOnInsert", Value: insertValue}}
 	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
 	var result bookModels.SearchRequest
@@ -60,23 +60,43 @@ func (s *Storage) FindOrCreateRequest(ctx context.Context, isbn string) (bookMod
 }
 
 func (s *Storage) CompleteRequest(ctx context.Context, isbn string, books []*bookModels.BookInShop) error {
-	filter := bson.D{{"isbn", isbn}}
-	values := bson.D{{"$set", bson.D{
-		{"books", books},
-		{"status", bookModels.Success},
-		{"updated_at", time.Now()},
-	}}}
+	filter := bson.D{{Key: "isbn", Value: isbn}}
+	now := time.Now()
+	values := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "books", Value: books},
+			{Key: "status", Value: bookModels.Success},
+			{Key: "updated_at", Value: now},
+			{Key: "last_scraped_at", Value: now},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: "failure_reason", Value: ""}}},
+	}
 	if _, err := s.col.UpdateOne(ctx, filter, values); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *Storage) RejectRequest(ctx context.Context, isbn string) error {
-	filter := bson.D{{"isbn", isbn}}
-	values := bson.D{{"$set", bson.D{
-		{"status", bookModels.Failed},
-		{"updated_at", time.Now()},
+// RejectRequest marks a request as failed. A refresh of a request that already
+// has books keeps serving them and only records the reason.
+func (s *Storage) RejectRequest(ctx context.Context, isbn string, reason string) error {
+	refresh := bson.D{{Key: "isbn", Value: isbn}, {Key: "status", Value: bookModels.Success}}
+	res, err := s.col.UpdateOne(ctx, refresh, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "failure_reason", Value: reason},
+		{Key: "updated_at", Value: time.Now()},
+	}}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	filter := bson.D{{Key: "isbn", Value: isbn}}
+	values := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: bookModels.Failed},
+		{Key: "failure_reason", Value: reason},
+		{Key: "updated_at", Value: time.Now()},
 	}}}
 	if _, err := s.col.UpdateOne(ctx, filter, values); err != nil {
 		return err
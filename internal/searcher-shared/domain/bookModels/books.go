@@ -5,12 +5,15 @@ import (
 	"time"
 )
 
+// BookInShop is an offer of a book found by a provider of the searcher-agent.
 type BookInShop struct {
-	Title      string `selector:"div.results__book-name > a" bson:"title,omitempty"`
-	Author     string `selector:"div.results__authors" bson:"author,omitempty"`
-	Publishing string `selector:"div.results__publishing" bson:"publishing,omitempty"`
-	ImgUrl     string `selector:"a.results__image > img" attr:"src" bson:"img_url"`
-	ShopName   string `selector:"div.results__shop-name > a" bson:"shop_name"`
+	Title      string `bson:"title,omitempty" json:"title,omitempty"`
+	Author     string `bson:"author,omitempty" json:"author,omitempty"`
+	Publishing string `bson:"publishing,omitempty" json:"publishing,omitempty"`
+	ImgUrl     string `bson:"img_url" json:"img_url"`
+	ShopName   string `bson:"shop_name" json:"shop_name"`
+	// Provider is the name of the source the offer was scraped from.
+	Provider string `bson:"provider,omitempty" json:"provider,omitempty"`
 }
 
 type RequestStatus int
@@ -29,6 +32,29 @@ type SearchRequest struct {
 	Books     []*BookInShop      `bson:"books,omitempty"`
 	CreatedAt primitive.DateTime `bson:"created_at,omitempty"`
 	UpdatedAt primitive.DateTime `bson:"updated_at,omitempty"`
+
+	// Attempts counts the searches enqueued for the request, including the first one.
+	Attempts int `bson:"attempts"`
+	// FailureReason explains why the last attempt failed. It is cleared on retry.
+	FailureReason string `bson:"failure_reason,omitempty"`
+
+	// LastScrapedAt is when the books were last scraped from the shops.
+	// UpdatedAt also moves when a refresh is enqueued.
+	LastScrapedAt primitive.DateTime `bson:"last_scraped_at,omitempty"`
+	// Hits counts the lookups that created the request or were served its
+	// books, not the polls while it is pending; popular ISBNs are refreshed
+	// ahead of time.
+	Hits            int                `bson:"hits,omitempty"`
+	LastRequestedAt primitive.DateTime `bson:"last_requested_at,omitempty"`
+}
+
+// RefreshQuery selects successful requests whose books should be scraped again.
+type RefreshQuery struct {
+	ScrapedBefore  time.Time // books scraped before this time are stale
+	UpdatedBefore  time.Time // skips requests with a refresh in flight
+	RequestedAfter time.Time // only requests looked up since this time
+	MinHits        int
+	Limit          int
 }
 
 // New creates a new SearchRequest with the provided ISBN, current time, and initial values.
@@ -49,5 +75,6 @@ func New(isbn string) SearchRequest {
 		UpdatedAt: currentTime,
 		Status:    Pending,
 		Books:     []*BookInShop{},
+		Attempts:  1,
 	}
 }
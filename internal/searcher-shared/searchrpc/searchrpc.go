@@ -0,0 +1,59 @@
+// Package searchrpc holds the parts of the Searcher gRPC contract that
+// librakeeper-protos v0.0.3 does not describe yet. They travel as an extra
+// enum value and as metadata, so clients built against the published protos
+// keep working as long as they treat unknown statuses as failures; the
+// contract is described in docs/searcher/README.MD.
+package searchrpc
+
+import (
+	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
+	"google.golang.org/grpc/metadata"
+	"strconv"
+)
+
+// StatusFailed is the FAILED value of SearchByISBNResponse.Status. The search
+// gave up after its retries; the reason is sent in the FailureReasonKey header.
+const StatusFailed searcherv1.SearchByISBNResponse_Status = 2
+
+// KnownStatus reports whether a status is SUCCESS, PROCESSING or FAILED.
+func KnownStatus(status searcherv1.SearchByISBNResponse_Status) bool {
+	switch status {
+	case searcherv1.SearchByISBNResponse_SUCCESS, searcherv1.SearchByISBNResponse_PROCESSING, StatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+const (
+	// ForceRetryKey is the request metadata key that asks the searcher to
+	// re-run a failed search immediately, ignoring the backoff and the
+	// attempts already made.
+	ForceRetryKey = "x-force-retry"
+
+	// FailureReasonKey is the response header key with the reason of a failed search.
+	FailureReasonKey = "x-failure-reason"
+)
+
+// WithForceRetry returns metadata asking the searcher to retry a failed search.
+func WithForceRetry() metadata.MD {
+	return metadata.Pairs(ForceRetryKey, "true")
+}
+
+// ForceRetry reports whether the incoming metadata asks for a forced retry.
+func ForceRetry(md metadata.MD) bool {
+	values := md.Get(ForceRetryKey)
+	if len(values) == 0 {
+		return false
+	}
+	force, _ := strconv.ParseBool(values[0])
+	return force
+}
+
+// FailureReason returns the failure reason sent in the response header.
+func FailureReason(header metadata.MD) string {
+	if values := header.Get(FailureReasonKey); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,232 @@
+// Package boltstorage keeps search requests in an embedded bbolt database
+// file, keyed by ISBN. Like the MongoDB collection, one Storage serves both the
+// searcher and the searcher-agent, so both must run in the process that opened
+// the file.
+package boltstorage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	"github.com/getz-devs/librakeeper-server/lib/boltdb"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// requestsBucket holds the search requests: isbn -> request.
+const requestsBucket = "search_requests"
+
+// migrations are the schema versions of the database, oldest first. Only
+// append to the list.
+var migrations = []boltdb.Migration{
+	{Name: "create search requests", Up: boltdb.CreateBuckets(requestsBucket)},
+}
+
+type Storage struct {
+	db *bbolt.DB
+}
+
+// New opens the database file, creating it if needed, and migrates its schema.
+func New(path string, log *slog.Logger) (*Storage, error) {
+	db, err := boltdb.Open(path, migrations, log)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{db: db}, nil
+}
+
+func (s *Storage) Close() {
+	if err := s.db.Close(); err != nil {
+		panic(err)
+	}
+}
+
+func now() primitive.DateTime {
+	return primitive.NewDateTimeFromTime(time.Now())
+}
+
+// update applies change to the stored request for the ISBN and saves it when
+// change reports true. It reports whether the request was saved.
+func (s *Storage) update(isbn string, change func(request *bookModels.SearchRequest, found bool) bool) (bool, error) {
+	saved := false
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(requestsBucket))
+
+		var request bookModels.SearchRequest
+		found, err := boltdb.Get(b, isbn, &request)
+		if err != nil {
+			return err
+		}
+		if !change(&request, found) {
+			return nil
+		}
+		saved = true
+		return boltdb.Put(b, isbn, request)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update search request: %w", err)
+	}
+	return saved, nil
+}
+
+func (s *Storage) FindOrCreateRequest(ctx context.Context, isbn string) (bookModels.SearchRequest, bool, error) {
+	var result bookModels.SearchRequest
+	var created bool
+	_, err := s.update(isbn, func(request *bookModels.SearchRequest, found bool) bool {
+		if !found {
+			*request = bookModels.New(isbn)
+			created = true
+		}
+		// Polling a pending or failed request is no hit.
+		if created || request.Status == bookModels.Success {
+			request.Hits++
+		}
+		request.LastRequestedAt = now()
+		result = *request
+		return true
+	})
+	if err != nil || created {
+		return bookModels.SearchRequest{}, created, err
+	}
+	return result, false, nil
+}
+
+// RetryRequest moves a failed request back to pending and sets its attempts
+// counter, unless the request has changed since it was read. It reports
+// whether this caller claimed the retry.
+func (s *Storage) RetryRequest(ctx context.Context, request bookModels.SearchRequest, attempts int) (bool, error) {
+	return s.update(request.Isbn, func(stored *bookModels.SearchRequest, found bool) bool {
+		if !found || stored.Status != bookModels.Failed || stored.UpdatedAt != request.UpdatedAt {
+			return false
+		}
+		stored.Status = bookModels.Pending
+		stored.Attempts = attempts
+		stored.UpdatedAt = now()
+		stored.FailureReason = ""
+		return true
+	})
+}
+
+// ClaimRefresh marks a successful request as being refreshed by moving its
+// updated_at, unless the request has changed since it was read. It reports
+// whether this caller claimed the refresh.
+func (s *Storage) ClaimRefresh(ctx context.Context, request bookModels.SearchRequest) (bool, error) {
+	return s.update(request.Isbn, func(stored *bookModels.SearchRequest, found bool) bool {
+		if !found || stored.Status != bookModels.Success || stored.UpdatedAt != request.UpdatedAt {
+			return false
+		}
+		updatedAt := now()
+		if updatedAt == stored.UpdatedAt {
+			// The update would not modify the document.
+			return false
+		}
+		stored.UpdatedAt = updatedAt
+		return true
+	})
+}
+
+// FindStaleRequests returns the successful requests matching the query, most
+// popular first, without their books. Requests scraped before last_scraped_at
+// existed count as scraped at updated_at. It reads every request, which is
+// fine for the size of a self-hosted library.
+func (s *Storage) FindStaleRequests(ctx context.Context, query bookModels.RefreshQuery) ([]bookModels.SearchRequest, error) {
+	scrapedBefore := primitive.NewDateTimeFromTime(query.ScrapedBefore)
+	updatedBefore := primitive.NewDateTimeFromTime(query.UpdatedBefore)
+	requestedAfter := primitive.NewDateTimeFromTime(query.RequestedAfter)
+
+	var requests []bookModels.SearchRequest
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(requestsBucket)).ForEach(func(isbn, data []byte) error {
+			var request bookModels.SearchRequest
+			if err := bson.Unmarshal(data, &request); err != nil {
+				return fmt.Errorf("failed to decode %s: %w", isbn, err)
+			}
+			scrapedAt := request.LastScrapedAt
+			if scrapedAt == 0 {
+				scrapedAt = request.UpdatedAt
+			}
+			if request.Status != bookModels.Success ||
+				request.UpdatedAt >= updatedBefore ||
+				request.Hits < query.MinHits ||
+				request.LastRequestedAt < requestedAfter ||
+				scrapedAt >= scrapedBefore {
+				return nil
+			}
+			request.Books = nil
+			requests = append(requests, request)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stale requests: %w", err)
+	}
+
+	slices.SortStableFunc(requests, func(a, b bookModels.SearchRequest) int { return b.Hits - a.Hits })
+	if query.Limit > 0 && len(requests) > query.Limit {
+		requests = requests[:query.Limit]
+	}
+	return requests, nil
+}
+
+// FindPendingRequests returns the requests waiting for the agent, least
+// recently updated first, without their books.
+func (s *Storage) FindPendingRequests(ctx context.Context) ([]bookModels.SearchRequest, error) {
+	var requests []bookModels.SearchRequest
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(requestsBucket)).ForEach(func(isbn, data []byte) error {
+			var request bookModels.SearchRequest
+			if err := bson.Unmarshal(data, &request); err != nil {
+				return fmt.Errorf("failed to decode %s: %w", isbn, err)
+			}
+			if request.Status != bookModels.Pending {
+				return nil
+			}
+			request.Books = nil
+			requests = append(requests, request)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pending requests: %w", err)
+	}
+
+	slices.SortStableFunc(requests, func(a, b bookModels.SearchRequest) int { return cmp.Compare(a.UpdatedAt, b.UpdatedAt) })
+	return requests, nil
+}
+
+func (s *Storage) CompleteRequest(ctx context.Context, isbn string, books []*bookModels.BookInShop) error {
+	_, err := s.update(isbn, func(request *bookModels.SearchRequest, found bool) bool {
+		if !found {
+			return false
+		}
+		request.Books = books
+		request.Status = bookModels.Success
+		request.UpdatedAt = now()
+		request.LastScrapedAt = request.UpdatedAt
+		request.FailureReason = ""
+		return true
+	})
+	return err
+}
+
+// RejectRequest marks a request as failed. A refresh of a request that already
+// has books keeps serving them and only records the reason.
+func (s *Storage) RejectRequest(ctx context.Context, isbn string, reason string) error {
+	_, err := s.update(isbn, func(request *bookModels.SearchRequest, found bool) bool {
+		if !found {
+			return false
+		}
+		if request.Status != bookModels.Success {
+			request.Status = bookModels.Failed
+		}
+		request.FailureReason = reason
+		request.UpdatedAt = now()
+		return true
+	})
+	return err
+}
@@ -0,0 +1,21 @@
+package boltstorage
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		s, err := New(filepath.Join(t.TempDir(), "searcher.db"), log)
+		require.NoError(t, err)
+		t.Cleanup(s.Close)
+		return s
+	})
+}
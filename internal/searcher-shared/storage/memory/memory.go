@@ -0,0 +1,194 @@
+// Package memorystorage keeps search requests in process memory. One Storage
+// serves both the searcher and the searcher-agent, like the MongoDB collection
+// they share; nothing is persisted.
+package memorystorage
+
+import (
+	"cmp"
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Storage struct {
+	mu       sync.Mutex
+	requests map[string]bookModels.SearchRequest // by isbn
+}
+
+func New() *Storage {
+	return &Storage{requests: map[string]bookModels.SearchRequest{}}
+}
+
+func now() primitive.DateTime {
+	return primitive.NewDateTimeFromTime(time.Now())
+}
+
+func (s *Storage) FindOrCreateRequest(ctx context.Context, isbn string) (bookModels.SearchRequest, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[isbn]
+	if !ok {
+		request = bookModels.New(isbn)
+	}
+	// Polling a pending or failed request is no hit.
+	if !ok || request.Status == bookModels.Success {
+		request.Hits++
+	}
+	request.LastRequestedAt = now()
+	s.requests[isbn] = request
+
+	if !ok {
+		return bookModels.SearchRequest{}, true, nil
+	}
+	return clone(request), false, nil
+}
+
+// RetryRequest moves a failed request back to pending and sets its attempts
+// counter, unless the request has changed since it was read. It reports
+// whether this caller claimed the retry.
+func (s *Storage) RetryRequest(ctx context.Context, request bookModels.SearchRequest, attempts int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.requests[request.Isbn]
+	if !ok || stored.Status != bookModels.Failed || stored.UpdatedAt != request.UpdatedAt {
+		return false, nil
+	}
+	stored.Status = bookModels.Pending
+	stored.Attempts = attempts
+	stored.UpdatedAt = now()
+	stored.FailureReason = ""
+	s.requests[request.Isbn] = stored
+	return true, nil
+}
+
+// ClaimRefresh marks a successful request as being refreshed by moving its
+// updated_at, unless the request has changed since it was read. It reports
+// whether this caller claimed the refresh.
+func (s *Storage) ClaimRefresh(ctx context.Context, request bookModels.SearchRequest) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.requests[request.Isbn]
+	if !ok || stored.Status != bookModels.Success || stored.UpdatedAt != request.UpdatedAt {
+		return false, nil
+	}
+	updatedAt := now()
+	if updatedAt == stored.UpdatedAt {
+		// The update would not modify the document.
+		return false, nil
+	}
+	stored.UpdatedAt = updatedAt
+	s.requests[request.Isbn] = stored
+	return true, nil
+}
+
+// FindStaleRequests returns the successful requests matching the query, most
+// popular first, without their books. Requests scraped before last_scraped_at
+// existed count as scraped at updated_at.
+func (s *Storage) FindStaleRequests(ctx context.Context, query bookModels.RefreshQuery) ([]bookModels.SearchRequest, error) {
+	scrapedBefore := primitive.NewDateTimeFromTime(query.ScrapedBefore)
+	updatedBefore := primitive.NewDateTimeFromTime(query.UpdatedBefore)
+	requestedAfter := primitive.NewDateTimeFromTime(query.RequestedAfter)
+
+	s.mu.Lock()
+	var requests []bookModels.SearchRequest
+	for _, request := range s.requests {
+		scrapedAt := request.LastScrapedAt
+		if scrapedAt == 0 {
+			scrapedAt = request.UpdatedAt
+		}
+		if request.Status != bookModels.Success ||
+			request.UpdatedAt >= updatedBefore ||
+			request.Hits < query.MinHits ||
+			request.LastRequestedAt < requestedAfter ||
+			scrapedAt >= scrapedBefore {
+			continue
+		}
+		request.Books = nil
+		requests = append(requests, request)
+	}
+	s.mu.Unlock()
+
+	slices.SortStableFunc(requests, func(a, b bookModels.SearchRequest) int { return b.Hits - a.Hits })
+	if query.Limit > 0 && len(requests) > query.Limit {
+		requests = requests[:query.Limit]
+	}
+	return requests, nil
+}
+
+// FindPendingRequests returns the requests waiting for the agent, least
+// recently updated first, without their books.
+func (s *Storage) FindPendingRequests(ctx context.Context) ([]bookModels.SearchRequest, error) {
+	s.mu.Lock()
+	var requests []bookModels.SearchRequest
+	for _, request := range s.requests {
+		if request.Status != bookModels.Pending {
+			continue
+		}
+		request.Books = nil
+		requests = append(requests, request)
+	}
+	s.mu.Unlock()
+
+	slices.SortStableFunc(requests, func(a, b bookModels.SearchRequest) int { return cmp.Compare(a.UpdatedAt, b.UpdatedAt) })
+	return requests, nil
+}
+
+func (s *Storage) CompleteRequest(ctx context.Context, isbn string, books []*bookModels.BookInShop) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[isbn]
+	if !ok {
+		return nil
+	}
+	request.Books = cloneBooks(books)
+	request.Status = bookModels.Success
+	request.UpdatedAt = now()
+	request.LastScrapedAt = request.UpdatedAt
+	request.FailureReason = ""
+	s.requests[isbn] = request
+	return nil
+}
+
+// RejectRequest marks a request as failed. A refresh of a request that already
+// has books keeps serving them and only records the reason.
+func (s *Storage) RejectRequest(ctx context.Context, isbn string, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[isbn]
+	if !ok {
+		return nil
+	}
+	if request.Status != bookModels.Success {
+		request.Status = bookModels.Failed
+	}
+	request.FailureReason = reason
+	request.UpdatedAt = now()
+	s.requests[isbn] = request
+	return nil
+}
+
+// clone copies a request so callers never share its books with the storage.
+func clone(request bookModels.SearchRequest) bookModels.SearchRequest {
+	request.Books = cloneBooks(request.Books)
+	return request
+}
+
+func cloneBooks(books []*bookModels.BookInShop) []*bookModels.BookInShop {
+	if books == nil {
+		return nil
+	}
+	cloned := make([]*bookModels.BookInShop, len(books))
+	for i, book := range books {
+		b := *book
+		cloned[i] = &b
+	}
+	return cloned
+}
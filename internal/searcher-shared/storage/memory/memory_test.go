@@ -0,0 +1,12 @@
+package memorystorage
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/storage/storagetest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		return New()
+	})
+}
@@ -0,0 +1,257 @@
+// Package storagetest is a conformance suite for the search request storage.
+// The searcher and the searcher-agent write to the same requests, so a backend
+// implements both of their storage interfaces and is tested as one.
+package storagetest
+
+import (
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/rabbit"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	searcher_service "github.com/getz-devs/librakeeper-server/internal/searcher/services/searcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// Storage is a search request storage as seen by the searcher and the agent.
+type Storage interface {
+	searcher_service.RequestStorage
+	rabbit.RequestStorage
+}
+
+// Factory returns a storage over a fresh, empty collection.
+type Factory func(t *testing.T) Storage
+
+const isbn = "9785446120581"
+
+// Run runs the whole suite against a backend.
+func Run(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("FindOrCreateRequest", func(t *testing.T) {
+		s := newStorage(t)
+
+		request, created, err := s.FindOrCreateRequest(ctx, isbn)
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Zero(t, request.Isbn, "a new request is not returned")
+
+		request, created, err = s.FindOrCreateRequest(ctx, isbn)
+		require.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, isbn, request.Isbn)
+		assert.Equal(t, bookModels.Pending, request.Status)
+		assert.Equal(t, 1, request.Attempts)
+		assert.Equal(t, 1, request.Hits, "polling a pending request is no hit")
+		assert.NotZero(t, request.CreatedAt)
+		assert.NotZero(t, request.LastRequestedAt)
+
+		require.NoError(t, s.RejectRequest(ctx, isbn, "shop is unavailable"))
+		assert.Equal(t, 1, get(t, s, isbn).Hits, "polling a failed request is no hit")
+
+		require.NoError(t, s.CompleteRequest(ctx, isbn, []*bookModels.BookInShop{{Title: "Title"}}))
+		assert.Equal(t, 2, get(t, s, isbn).Hits, "serving the books is a hit")
+		assert.Equal(t, 3, get(t, s, isbn).Hits)
+	})
+
+	t.Run("CompleteRequest", func(t *testing.T) {
+		s := newStorage(t)
+		create(t, s, isbn)
+		books := []*bookModels.BookInShop{{Title: "Title", ShopName: "Shop", ImgUrl: "cover.jpg", Provider: "fixture"}}
+
+		require.NoError(t, s.RejectRequest(ctx, isbn, "shop is unavailable"))
+		require.NoError(t, s.CompleteRequest(ctx, isbn, books))
+
+		request := get(t, s, isbn)
+		assert.Equal(t, bookModels.Success, request.Status)
+		assert.Equal(t, books, request.Books)
+		assert.Empty(t, request.FailureReason)
+		assert.NotZero(t, request.LastScrapedAt)
+		assert.Equal(t, request.UpdatedAt, request.LastScrapedAt)
+
+		// The stored books are a copy.
+		books[0].Title = "Changed"
+		assert.Equal(t, "Title", get(t, s, isbn).Books[0].Title)
+	})
+
+	t.Run("CompleteUnknownRequest", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CompleteRequest(ctx, isbn, nil))
+		require.NoError(t, s.RejectRequest(ctx, isbn, "reason"))
+
+		_, created, err := s.FindOrCreateRequest(ctx, isbn)
+		require.NoError(t, err)
+		assert.True(t, created, "results for unknown requests are dropped")
+	})
+
+	t.Run("RejectRequest", func(t *testing.T) {
+		s := newStorage(t)
+		create(t, s, isbn)
+
+		require.NoError(t, s.RejectRequest(ctx, isbn, "shop is unavailable"))
+		request := get(t, s, isbn)
+		assert.Equal(t, bookModels.Failed, request.Status)
+		assert.Equal(t, "shop is unavailable", request.FailureReason)
+	})
+
+	t.Run("RejectRefresh", func(t *testing.T) {
+		s := newStorage(t)
+		create(t, s, isbn)
+		books := []*bookModels.BookInShop{{Title: "Title", ShopName: "Shop"}}
+		require.NoError(t, s.CompleteRequest(ctx, isbn, books))
+
+		require.NoError(t, s.RejectRequest(ctx, isbn, "shop is unavailable"))
+		request := get(t, s, isbn)
+		assert.Equal(t, bookModels.Success, request.Status, "stale books keep being served")
+		assert.Equal(t, books, request.Books)
+		assert.Equal(t, "shop is unavailable", request.FailureReason)
+	})
+
+	t.Run("RetryRequest", func(t *testing.T) {
+		s := newStorage(t)
+		create(t, s, isbn)
+		require.NoError(t, s.RejectRequest(ctx, isbn, "shop is unavailable"))
+		failed := get(t, s, isbn)
+
+		claimed, err := s.RetryRequest(ctx, failed, 2)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+
+		claimed, err = s.RetryRequest(ctx, failed, 2)
+		require.NoError(t, err)
+		assert.False(t, claimed, "a retry is claimed once")
+
+		request := get(t, s, isbn)
+		assert.Equal(t, bookModels.Pending, request.Status)
+		assert.Equal(t, 2, request.Attempts)
+		assert.Empty(t, request.FailureReason)
+
+		claimed, err = s.RetryRequest(ctx, request, 3)
+		require.NoError(t, err)
+		assert.False(t, claimed, "only failed requests are retried")
+	})
+
+	t.Run("ClaimRefresh", func(t *testing.T) {
+		s := newStorage(t)
+		create(t, s, isbn)
+		require.NoError(t, s.CompleteRequest(ctx, isbn, nil))
+		request := get(t, s, isbn)
+
+		// updated_at has millisecond precision.
+		time.Sleep(2 * time.Millisecond)
+		claimed, err := s.ClaimRefresh(ctx, request)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+
+		claimed, err = s.ClaimRefresh(ctx, request)
+		require.NoError(t, err)
+		assert.False(t, claimed, "a refresh is claimed once")
+
+		refreshing := get(t, s, isbn)
+		assert.Greater(t, refreshing.UpdatedAt, request.UpdatedAt)
+		assert.Equal(t, request.LastScrapedAt, refreshing.LastScrapedAt)
+	})
+
+	t.Run("FindStaleRequests", func(t *testing.T) {
+		s := newStorage(t)
+		for isbn, hits := range map[string]int{"9785446120581": 3, "9785171183660": 5, "9780306406157": 1} {
+			create(t, s, isbn)
+			require.NoError(t, s.CompleteRequest(ctx, isbn, []*bookModels.BookInShop{{Title: "Title"}}))
+			for range hits - 1 {
+				_, _, err := s.FindOrCreateRequest(ctx, isbn)
+				require.NoError(t, err)
+			}
+		}
+		create(t, s, "9781861972712")
+		for range 5 {
+			_, _, err := s.FindOrCreateRequest(ctx, "9781861972712")
+			require.NoError(t, err)
+		}
+
+		now := time.Now()
+		query := bookModels.RefreshQuery{
+			ScrapedBefore:  now.Add(time.Hour),
+			UpdatedBefore:  now.Add(time.Hour),
+			RequestedAfter: now.Add(-time.Hour),
+			MinHits:        2,
+			Limit:          10,
+		}
+		requests, err := s.FindStaleRequests(ctx, query)
+		require.NoError(t, err)
+		require.Len(t, requests, 2, "pending and unpopular requests are skipped")
+		assert.Equal(t, "9785171183660", requests[0].Isbn, "most popular first")
+		assert.Equal(t, "9785446120581", requests[1].Isbn)
+		assert.Empty(t, requests[0].Books, "books are not loaded")
+
+		query.Limit = 1
+		requests, err = s.FindStaleRequests(ctx, query)
+		require.NoError(t, err)
+		require.Len(t, requests, 1)
+		assert.Equal(t, "9785171183660", requests[0].Isbn)
+
+		query.Limit = 10
+		query.ScrapedBefore = now.Add(-time.Hour)
+		requests, err = s.FindStaleRequests(ctx, query)
+		require.NoError(t, err)
+		assert.Empty(t, requests, "fresh requests are skipped")
+
+		query.ScrapedBefore = now.Add(time.Hour)
+		query.RequestedAfter = now.Add(time.Hour)
+		requests, err = s.FindStaleRequests(ctx, query)
+		require.NoError(t, err)
+		assert.Empty(t, requests, "requests nobody asked for lately are skipped")
+	})
+
+	t.Run("FindPendingRequests", func(t *testing.T) {
+		s := newStorage(t)
+		create(t, s, "9785446120581")
+		// updated_at has millisecond precision.
+		time.Sleep(2 * time.Millisecond)
+		create(t, s, "9785171183660")
+		create(t, s, "9780306406157")
+		require.NoError(t, s.CompleteRequest(ctx, "9780306406157", []*bookModels.BookInShop{{Title: "Title"}}))
+
+		requests, err := s.FindPendingRequests(ctx)
+		require.NoError(t, err)
+		require.Len(t, requests, 2, "completed requests are skipped")
+		assert.Equal(t, "9785446120581", requests[0].Isbn, "oldest first")
+		assert.Equal(t, "9785171183660", requests[1].Isbn)
+	})
+
+	t.Run("FindPendingRequests_NewAndRetried", func(t *testing.T) {
+		s := newStorage(t)
+		create(t, s, "9785446120581")
+		require.NoError(t, s.RejectRequest(ctx, "9785446120581", "shop is unavailable"))
+		claimed, err := s.RetryRequest(ctx, get(t, s, "9785446120581"), 1)
+		require.NoError(t, err)
+		require.True(t, claimed)
+		time.Sleep(2 * time.Millisecond)
+		// A request that was never handled is as pending as a retried one.
+		create(t, s, "9785171183660")
+
+		requests, err := s.FindPendingRequests(ctx)
+		require.NoError(t, err)
+		require.Len(t, requests, 2)
+		assert.Equal(t, "9785446120581", requests[0].Isbn)
+		assert.Equal(t, "9785171183660", requests[1].Isbn)
+		assert.Equal(t, bookModels.Pending, requests[1].Status)
+	})
+}
+
+// create makes a new request for an ISBN.
+func create(t *testing.T, s Storage, isbn string) {
+	t.Helper()
+	_, created, err := s.FindOrCreateRequest(context.Background(), isbn)
+	require.NoError(t, err)
+	require.True(t, created)
+}
+
+// get returns the request for an ISBN. Once the request succeeded, it counts as a hit.
+func get(t *testing.T, s Storage, isbn string) bookModels.SearchRequest {
+	t.Helper()
+	request, created, err := s.FindOrCreateRequest(context.Background(), isbn)
+	require.NoError(t, err)
+	require.False(t, created)
+	return request
+}
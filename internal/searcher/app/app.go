@@ -2,31 +2,90 @@ package app
 
 import (
 	grpcapp "github.com/getz-devs/librakeeper-server/internal/searcher/app/grpc"
+	sweeperapp "github.com/getz-devs/librakeeper-server/internal/searcher/app/sweeper"
 	"github.com/getz-devs/librakeeper-server/internal/searcher/rabbitProvider"
 	"github.com/getz-devs/librakeeper-server/internal/searcher/services/searcher"
-	mongostorage "github.com/getz-devs/librakeeper-server/internal/searcher/storage/mongo"
+	rabbitlib "github.com/getz-devs/librakeeper-server/lib/rabbit"
+	"google.golang.org/grpc/health"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
 	"log/slog"
+	"time"
 )
 
 type App struct {
 	GRPCSrv *grpcapp.App
-	Storage *mongostorage.Storage
+	Sweeper *sweeperapp.App
+	Service *searcher_service.SearcherService
+	Storage Storage
+	Rabbit  *rabbitProvider.RabbitService
+}
+
+// Storage keeps the search requests: mongostorage or boltstorage.
+type Storage interface {
+	searcher_service.RequestStorage
+	Close()
 }
 
 func New(
 	log *slog.Logger,
 	grpcPort int,
-	databaseMongoConfig mongostorage.DatabaseMongoConfig,
+	storage Storage,
 	rabbitConfig rabbitProvider.RabbitConfig,
+	retryPolicy searcher_service.RetryPolicy,
+	freshness searcher_service.FreshnessPolicy,
+	sweepInterval time.Duration,
+) *App {
+	// The searcher can answer from storage without the broker, but cannot
+	// start new searches, so it reports NOT_SERVING while RabbitMQ is down.
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthgrpc.HealthCheckResponse_NOT_SERVING)
+	rabbit := rabbitProvider.New(rabbitConfig, log, func(state rabbitlib.State) {
+		status := healthgrpc.HealthCheckResponse_NOT_SERVING
+		if state == rabbitlib.Connected {
+			status = healthgrpc.HealthCheckResponse_SERVING
+		}
+		healthServer.SetServingStatus("", status)
+	})
+
+	return newApp(log, grpcPort, storage, rabbit, healthServer, retryPolicy, freshness, sweepInterval)
+}
+
+// NewWithPublisher creates an App that enqueues searches through the given
+// publisher, e.g. an in-process broker, instead of dialing RabbitMQ. Its gRPC
+// server has no port and is started with GRPCSrv.Serve.
+func NewWithPublisher(
+	log *slog.Logger,
+	storage Storage,
+	publisher rabbitProvider.Publisher,
+	queueName string,
+	retryPolicy searcher_service.RetryPolicy,
+	freshness searcher_service.FreshnessPolicy,
+	sweepInterval time.Duration,
 ) *App {
-	storage := mongostorage.New(databaseMongoConfig)
-	rabbit := rabbitProvider.New(rabbitConfig, log)
-	searcherService := searcher_service.New(log, storage, rabbit)
-	grpcApp := grpcapp.New(log, searcherService, grpcPort)
+	rabbit := rabbitProvider.NewWithPublisher(publisher, queueName, log)
+
+	return newApp(log, 0, storage, rabbit, health.NewServer(), retryPolicy, freshness, sweepInterval)
+}
+
+func newApp(
+	log *slog.Logger,
+	grpcPort int,
+	storage Storage,
+	rabbit *rabbitProvider.RabbitService,
+	healthServer *health.Server,
+	retryPolicy searcher_service.RetryPolicy,
+	freshness searcher_service.FreshnessPolicy,
+	sweepInterval time.Duration,
+) *App {
+	searcherService := searcher_service.New(log, storage, rabbit, retryPolicy, freshness)
+	grpcApp := grpcapp.New(log, searcherService, healthServer, grpcPort)
+	sweeper := sweeperapp.New(log, searcherService, sweepInterval)
 
 	return &App{
 		GRPCSrv: grpcApp,
+		Sweeper: sweeper,
+		Service: searcherService,
 		Storage: storage,
+		Rabbit:  rabbit,
 	}
-
 }
@@ -7,6 +7,8 @@ import (
 	searcher_service "github.com/getz-devs/librakeeper-server/internal/searcher/services/searcher"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 	"log/slog"
 	"net"
@@ -25,6 +27,7 @@ type App struct {
 func New(
 	log *slog.Logger,
 	searchService *searcher_service.SearcherService,
+	healthServer *health.Server,
 	port int,
 ) *App {
 	loggingOpts := []logging.Option{
@@ -48,6 +51,7 @@ func New(
 		logging.UnaryServerInterceptor(InterceptorLogger(log), loggingOpts...),
 	))
 	searcherrpc.Register(gRPCServer, searchService, log)
+	healthgrpc.RegisterHealthServer(gRPCServer, healthServer)
 
 	return &App{
 		log:        log,
@@ -75,17 +79,20 @@ func (a *App) MustRun() {
 func (a *App) Run() error {
 	const op = "grpcapp.App.Run"
 
-	log := a.log.With(
-		slog.String("op", op),
-		slog.Int("port", a.port),
-	)
-
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
 	if err != nil {
 		return fmt.Errorf("%s ,error when creating listener: %w", op, err)
 	}
 
-	log.Info("gRPC server is running",
+	return a.Serve(listener)
+}
+
+// Serve accepts gRPC connections on the listener until Stop is called. It
+// lets the server run over any transport, e.g. an in-process bufconn.
+func (a *App) Serve(listener net.Listener) error {
+	const op = "grpcapp.App.Serve"
+
+	a.log.With(slog.String("op", op)).Info("gRPC server is running",
 		slog.String("address", listener.Addr().String()),
 	)
 
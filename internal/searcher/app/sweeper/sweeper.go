@@ -0,0 +1,68 @@
+package sweeperapp
+
+import (
+	"context"
+	searcher_service "github.com/getz-devs/librakeeper-server/internal/searcher/services/searcher"
+	"log/slog"
+	"time"
+)
+
+// App periodically refreshes the stale results of popular ISBNs.
+type App struct {
+	log             *slog.Logger
+	searcherService *searcher_service.SearcherService
+	interval        time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a new App. A zero interval disables the sweeper.
+func New(log *slog.Logger, searcherService *searcher_service.SearcherService, interval time.Duration) *App {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &App{
+		log:             log,
+		searcherService: searcherService,
+		interval:        interval,
+		ctx:             ctx,
+		cancel:          cancel,
+		done:            make(chan struct{}),
+	}
+}
+
+// Run sweeps on every tick until Stop is called.
+func (a *App) Run() {
+	const op = "sweeperapp.App.Run"
+	log := a.log.With(slog.String("op", op))
+	defer close(a.done)
+
+	if a.interval <= 0 {
+		log.Info("sweeper is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	log.Info("sweeper is running", slog.Duration("interval", a.interval))
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := a.searcherService.RefreshPopular(a.ctx); err != nil {
+				log.Error("failed to refresh popular requests", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// Stop stops a running sweeper and waits for the current sweep to finish.
+func (a *App) Stop() {
+	const op = "sweeperapp.App.Stop"
+
+	a.log.With(slog.String("op", op)).Info("stopping sweeper")
+	a.cancel()
+	<-a.done
+}
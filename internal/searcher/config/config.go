@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
 	"os"
 	"time"
@@ -12,9 +14,15 @@ type Config struct {
 
 	GRPC GRPCConfig `yaml:"grpc"`
 
+	Database DatabaseConfig `yaml:"database"`
+
 	DatabaseMongo DatabaseMongoConfig `yaml:"database_mongo"`
 
 	Rabbit RabbitConfig `yaml:"rabbit"`
+
+	Retry RetryConfig `yaml:"retry"`
+
+	Freshness FreshnessConfig `yaml:"freshness"`
 }
 
 type GRPCConfig struct {
@@ -22,10 +30,24 @@ type GRPCConfig struct {
 	Timeout time.Duration `yaml:"timeout" env-default:"10h"`
 }
 
+// Database drivers.
+const (
+	DriverMongo = "mongo"
+	DriverBolt  = "bolt" // an embedded single-file database
+)
+
+// DatabaseConfig selects where search requests are stored. The mongo driver
+// is configured by database_mongo.
+type DatabaseConfig struct {
+	Driver           string `yaml:"driver" env-default:"mongo"`
+	Path             string `yaml:"path" env-default:"data/searcher.db"`    // bolt
+	MigrateOnStartup bool   `yaml:"migrate_on_startup" env-default:"false"` // mongo; bolt always migrates
+}
+
 type DatabaseMongoConfig struct {
-	ConnectURL     string `yaml:"connect_url" env-required:"true"`
-	DatabaseName   string `yaml:"database_name" env-required:"true"`
-	CollectionName string `yaml:"collection_name_books" env-required:"true"`
+	ConnectURL     string `yaml:"connect_url"`
+	DatabaseName   string `yaml:"database_name"`
+	CollectionName string `yaml:"collection_name_books"`
 }
 
 type RabbitConfig struct {
@@ -33,6 +55,23 @@ type RabbitConfig struct {
 	QueueName string `yaml:"queue_name" env-required:"true"`
 }
 
+// RetryConfig is the policy for re-enqueuing failed search requests.
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts" env-default:"5"`
+	BaseDelay   time.Duration `yaml:"base_delay" env-default:"30s"`
+	MaxDelay    time.Duration `yaml:"max_delay" env-default:"30m"`
+}
+
+// FreshnessConfig controls when successful search results are scraped again.
+type FreshnessConfig struct {
+	TTL            time.Duration `yaml:"ttl" env-default:"24h"`
+	RefreshTimeout time.Duration `yaml:"refresh_timeout" env-default:"10m"`
+	SweepInterval  time.Duration `yaml:"sweep_interval" env-default:"1h"` // 0 disables the sweeper
+	SweepBatch     int           `yaml:"sweep_batch" env-default:"100"`
+	PopularMinHits int           `yaml:"popular_min_hits" env-default:"3"`
+	PopularWindow  time.Duration `yaml:"popular_window" env-default:"168h"`
+}
+
 func MustLoad() *Config {
 	path := fetchConfigPath()
 	if path == "" {
@@ -54,9 +93,31 @@ func MustLoadByPath(path string) *Config {
 		panic("failed to read config: " + err.Error())
 	}
 
+	if err := cfg.Validate(); err != nil {
+		panic("invalid config: " + err.Error())
+	}
+
 	return &cfg
 }
 
+// Validate checks the settings the selected database driver requires.
+func (cfg *Config) Validate() error {
+	switch cfg.Database.Driver {
+	case DriverMongo:
+		mongo := cfg.DatabaseMongo
+		if mongo.ConnectURL == "" || mongo.DatabaseName == "" || mongo.CollectionName == "" {
+			return errors.New("database_mongo is required by the mongo driver")
+		}
+	case DriverBolt:
+		if cfg.Database.Path == "" {
+			return errors.New("database.path is required by the bolt driver")
+		}
+	default:
+		return fmt.Errorf("unknown database.driver %q", cfg.Database.Driver)
+	}
+	return nil
+}
+
 // fetchConfigPath fetches config path from command line flag or environment variable
 // Priority: command line flag > environment variable > default
 func fetchConfigPath() string {
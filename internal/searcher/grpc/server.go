@@ -2,11 +2,14 @@ package searcher
 
 import (
 	"context"
+	"errors"
 	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
 	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/searchrpc"
 	searcherservice "github.com/getz-devs/librakeeper-server/internal/searcher/services/searcher"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"log/slog"
 )
@@ -28,8 +31,12 @@ func (s *serverAPI) SearchByISBN(
 	if req.GetIsbn() == "" {
 		return nil, status.Error(codes.InvalidArgument, "isbn cannot be empty")
 	}
-	results, err := s.searcherService.SearchByISBN(ctx, req.GetIsbn())
+	md, _ := metadata.FromIncomingContext(ctx)
+	results, err := s.searcherService.SearchByISBN(ctx, req.GetIsbn(), searchrpc.ForceRetry(md))
 	if err != nil {
+		if errors.Is(err, searcherservice.ErrInvalidISBN) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, err
 	}
 	s.log.Info("Results", slog.Any("results", results))
@@ -52,7 +59,11 @@ func (s *serverAPI) SearchByISBN(
 	case bookModels.Pending:
 		statusReturn = searcherv1.SearchByISBNResponse_PROCESSING
 	case bookModels.Failed:
-		statusReturn = searcherv1.SearchByISBNResponse_PROCESSING
+		statusReturn = searchrpc.StatusFailed
+		header := metadata.Pairs(searchrpc.FailureReasonKey, results.FailureReason)
+		if err := grpc.SetHeader(ctx, header); err != nil {
+			s.log.Error("failed to set failure reason", slog.Any("error", err))
+		}
 	case bookModels.Success:
 		statusReturn = searcherv1.SearchByISBNResponse_SUCCESS
 	default:
@@ -3,64 +3,68 @@ package rabbitProvider
 import (
 	"context"
 	"fmt"
+	"github.com/getz-devs/librakeeper-server/lib/rabbit"
 	rabbitDefines "github.com/getz-devs/librakeeper-server/lib/rabbit/getz.rabbitProto.v1"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"google.golang.org/protobuf/proto"
 	"log/slog"
 )
 
+// ErrNotConfirmed occurs when the broker refuses to take a published message.
+var ErrNotConfirmed = rabbit.ErrNotConfirmed
+
+// Publisher delivers messages to a queue. *rabbit.Connection publishes to
+// RabbitMQ, *rabbit.MemoryBroker within the process.
+type Publisher interface {
+	Publish(ctx context.Context, queue string, body []byte) error
+	Close() error
+}
+
 type RabbitConfig struct {
 	RabbitUrl string
 	QueueName string
 }
 
 type RabbitService struct {
-	log *slog.Logger
-	ch  *amqp.Channel
-	q   amqp.Queue
+	log       *slog.Logger
+	publisher Publisher
+	queue     string
 }
 
-func New(rabbitConfig RabbitConfig, log *slog.Logger) *RabbitService {
+// New starts connecting to RabbitMQ in the background. The connection is
+// re-established whenever the broker goes away; onStateChange, when set, is
+// told about it.
+func New(rabbitConfig RabbitConfig, log *slog.Logger, onStateChange func(rabbit.State)) *RabbitService {
 	const op = "rabbitProvider.New"
 	log = log.With(slog.String("op", op))
 
-	conn, err := amqp.Dial(rabbitConfig.RabbitUrl)
-	failOnError(err, "Failed to connect to RabbitMQ")
+	conn := rabbit.Dial(rabbitConfig.RabbitUrl, log, rabbit.Options{
+		Setup: func(ch *amqp.Channel) error {
+			if _, err := rabbit.DeclareQueue(ch, rabbitConfig.QueueName); err != nil {
+				return err
+			}
+			return ch.Confirm(false)
+		},
+		OnStateChange: onStateChange,
+	})
 
-	ch, err := conn.Channel()
-	failOnError(err, "Failed to open a channel")
-
-	q, err := ch.QueueDeclare(
-		rabbitConfig.QueueName, // name
-		false,                  // durable
-		false,                  // delete when unused
-		false,                  // exclusive
-		false,                  // no-wait
-		nil,                    // arguments
-	)
-	failOnError(err, "Failed to declare a queue")
+	return NewWithPublisher(conn, rabbitConfig.QueueName, log)
+}
 
+// NewWithPublisher creates a service that enqueues searches with the given publisher.
+func NewWithPublisher(publisher Publisher, queueName string, log *slog.Logger) *RabbitService {
 	return &RabbitService{
-		log: log,
-		ch:  ch,
-		q:   q,
+		log:       log,
+		publisher: publisher,
+		queue:     queueName,
 	}
 }
 
 func (s *RabbitService) sendMessage(ctx context.Context, message []byte) error {
 	const op = "rabbitProvider.RabbitService.SendMessage"
 	s.log.With(slog.String("op", op))
-	err := s.ch.PublishWithContext(
-		ctx,
-		"",       // exchange
-		s.q.Name, // routing key
-		false,    // mandatory
-		false,    // immediate
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        message,
-		})
-	if err != nil {
+
+	if err := s.publisher.Publish(ctx, s.queue, message); err != nil {
 		s.log.Error(err.Error())
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -84,15 +88,9 @@ func (s *RabbitService) AddRequest(ctx context.Context, isbn string) error {
 func (s *RabbitService) Close() {
 	const op = "rabbitProvider.RabbitService.Close"
 	s.log.With(slog.String("op", op))
-	err := s.ch.Close()
+	err := s.publisher.Close()
 	if err != nil {
 		s.log.Error(err.Error())
 		return
 	}
 }
-
-func failOnError(err error, msg string) {
-	if err != nil {
-		panic(fmt.Errorf("%s: %w", msg, err))
-	}
-}
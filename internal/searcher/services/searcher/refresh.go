@@ -0,0 +1,86 @@
+package searcher_service
+
+import (
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	"log/slog"
+	"time"
+)
+
+// FreshnessPolicy decides when the books of a successful search request are
+// scraped again.
+type FreshnessPolicy struct {
+	// TTL is how long scraped books stay fresh.
+	TTL time.Duration
+	// RefreshTimeout is how long a refresh may run before another one is enqueued.
+	RefreshTimeout time.Duration
+
+	// Popular requests are refreshed by RefreshPopular before anyone asks for them.
+	PopularMinHits int
+	PopularWindow  time.Duration
+	SweepBatch     int
+}
+
+// Stale reports whether the books of a request should be scraped again.
+func (p FreshnessPolicy) Stale(request bookModels.SearchRequest, now time.Time) bool {
+	scrapedAt := request.LastScrapedAt
+	if scrapedAt == 0 {
+		scrapedAt = request.UpdatedAt
+	}
+	return now.Sub(scrapedAt.Time()) >= p.TTL &&
+		now.Sub(request.UpdatedAt.Time()) >= p.RefreshTimeout
+}
+
+// refresh enqueues a new scrape of a stale request. The request keeps serving
+// its books meanwhile, so errors are only logged.
+func (s *SearcherService) refresh(ctx context.Context, request bookModels.SearchRequest) bool {
+	log := s.log.With(slog.String("isbn", request.Isbn))
+
+	claimed, err := s.requestStorage.ClaimRefresh(ctx, request)
+	if err != nil {
+		log.Error("failed to claim refresh", slog.Any("error", err))
+		return false
+	}
+	if !claimed {
+		return false
+	}
+
+	if err := s.requestExecutor.AddRequest(ctx, request.Isbn); err != nil {
+		log.Error("failed to enqueue refresh", slog.Any("error", err))
+		return false
+	}
+	log.Info("refresh enqueued")
+	return true
+}
+
+// RefreshPopular enqueues refreshes for the most requested stale ISBNs and
+// returns how many were enqueued.
+func (s *SearcherService) RefreshPopular(ctx context.Context) (int, error) {
+	const op = "searcher.SearcherService.RefreshPopular"
+	log := s.log.With(slog.String("op", op))
+
+	now := time.Now()
+	requests, err := s.requestStorage.FindStaleRequests(ctx, bookModels.RefreshQuery{
+		ScrapedBefore:  now.Add(-s.freshness.TTL),
+		UpdatedBefore:  now.Add(-s.freshness.RefreshTimeout),
+		RequestedAfter: now.Add(-s.freshness.PopularWindow),
+		MinHits:        s.freshness.PopularMinHits,
+		Limit:          s.freshness.SweepBatch,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	refreshed := 0
+	for _, request := range requests {
+		if ctx.Err() != nil {
+			break
+		}
+		if s.refresh(ctx, request) {
+			refreshed++
+		}
+	}
+
+	log.Info("popular requests refreshed", slog.Int("found", len(requests)), slog.Int("refreshed", refreshed))
+	return refreshed, nil
+}
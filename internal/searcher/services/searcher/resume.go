@@ -0,0 +1,31 @@
+package searcher_service
+
+import (
+	"context"
+	"log/slog"
+)
+
+// ResumePending enqueues the pending requests again and returns how many were
+// enqueued. A broker that keeps nothing across restarts loses the jobs queued
+// or running when the process stopped, and nothing else would ever enqueue
+// their requests again.
+func (s *SearcherService) ResumePending(ctx context.Context) (int, error) {
+	const op = "searcher.SearcherService.ResumePending"
+	log := s.log.With(slog.String("op", op))
+
+	requests, err := s.requestStorage.FindPendingRequests(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	resumed := 0
+	for _, request := range requests {
+		if err := s.requestExecutor.AddRequest(ctx, request.Isbn); err != nil {
+			return resumed, err
+		}
+		resumed++
+	}
+
+	log.Info("pending requests resumed", slog.Int("resumed", resumed))
+	return resumed, nil
+}
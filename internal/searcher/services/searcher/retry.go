@@ -0,0 +1,37 @@
+package searcher_service
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	"time"
+)
+
+// RetryPolicy decides when a failed search request is enqueued again.
+// The delay before attempt n+1 is BaseDelay * 2^(n-1), capped at MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Delay returns how long to wait after the given number of failed attempts.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Exhausted reports whether the request has used all of its attempts.
+func (p RetryPolicy) Exhausted(request bookModels.SearchRequest) bool {
+	return request.Attempts >= p.MaxAttempts
+}
+
+// Due reports whether a failed request may be retried at the given time.
+func (p RetryPolicy) Due(request bookModels.SearchRequest, now time.Time) bool {
+	failedAt := request.UpdatedAt.Time()
+	return !now.Before(failedAt.Add(p.Delay(request.Attempts)))
+}
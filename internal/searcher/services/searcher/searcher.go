@@ -2,10 +2,16 @@ package searcher_service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	isbnlib "github.com/getz-devs/librakeeper-server/lib/isbn"
 	"log/slog"
+	"time"
 )
 
+var ErrInvalidISBN = errors.New("invalid isbn")
+
 type RequestExecutor interface {
 	AddRequest(ctx context.Context, isbn string) error
 }
@@ -14,21 +20,40 @@ type SearcherService struct {
 	log             *slog.Logger
 	requestStorage  RequestStorage
 	requestExecutor RequestExecutor
+	retryPolicy     RetryPolicy
+	freshness       FreshnessPolicy
 }
 
 type RequestStorage interface {
 	FindOrCreateRequest(ctx context.Context, isbn string) (bookModels.SearchRequest, bool, error)
+	RetryRequest(ctx context.Context, request bookModels.SearchRequest, attempts int) (bool, error)
+	ClaimRefresh(ctx context.Context, request bookModels.SearchRequest) (bool, error)
+	FindStaleRequests(ctx context.Context, query bookModels.RefreshQuery) ([]bookModels.SearchRequest, error)
+	FindPendingRequests(ctx context.Context) ([]bookModels.SearchRequest, error)
 }
 
-func New(log *slog.Logger, requestStorage RequestStorage, requestExecutor RequestExecutor) *SearcherService {
+func New(
+	log *slog.Logger,
+	requestStorage RequestStorage,
+	requestExecutor RequestExecutor,
+	retryPolicy RetryPolicy,
+	freshness FreshnessPolicy,
+) *SearcherService {
 	return &SearcherService{
 		log:             log,
 		requestStorage:  requestStorage,
 		requestExecutor: requestExecutor,
+		retryPolicy:     retryPolicy,
+		freshness:       freshness,
 	}
 }
 
-func (s *SearcherService) SearchByISBN(ctx context.Context, isbn string) (bookModels.SearchRequest, error) {
+// SearchByISBN returns the search request for an ISBN, creating and enqueuing
+// it on first use. A failed request is enqueued again once its backoff has
+// passed and it has attempts left, and is reported as pending meanwhile. With
+// force set, a failed request is retried at once with a fresh attempts budget.
+// Stale books are returned as they are while a refresh is enqueued.
+func (s *SearcherService) SearchByISBN(ctx context.Context, isbn string, force bool) (bookModels.SearchRequest, error) {
 	const op = "searcher.SearcherService.SearchByISBN"
 	s.log.With(
 		slog.String("op", op),
@@ -36,6 +61,14 @@ func (s *SearcherService) SearchByISBN(ctx context.Context, isbn string) (bookMo
 	)
 	s.log.Info("searching by ISBN")
 
+	// Requests are keyed by the canonical ISBN-13, so every spelling of an ISBN
+	// shares one search request.
+	normalized, err := isbnlib.Normalize(isbn)
+	if err != nil {
+		return bookModels.SearchRequest{}, fmt.Errorf("%w: %w", ErrInvalidISBN, err)
+	}
+	isbn = normalized
+
 	data, created, err := s.requestStorage.FindOrCreateRequest(ctx, isbn)
 	if err != nil {
 		return bookModels.SearchRequest{}, err
@@ -48,9 +81,45 @@ func (s *SearcherService) SearchByISBN(ctx context.Context, isbn string) (bookMo
 		}
 	}
 
+	switch data.Status {
+	case bookModels.Failed:
+		return s.retry(ctx, data, force)
+	case bookModels.Success:
+		if s.freshness.Stale(data, time.Now()) {
+			s.refresh(ctx, data)
+		}
+	}
+
 	return data, nil
 }
 
+// retry enqueues a failed request again when the retry policy or the caller allows it.
+func (s *SearcherService) retry(ctx context.Context, data bookModels.SearchRequest, force bool) (bookModels.SearchRequest, error) {
+	attempts := data.Attempts + 1
+	switch {
+	case force:
+		attempts = 1
+	case s.retryPolicy.Exhausted(data):
+		return data, nil
+	case !s.retryPolicy.Due(data, time.Now()):
+		// A retry is scheduled; callers keep polling until it runs.
+		return bookModels.SearchRequest{Isbn: data.Isbn, Status: bookModels.Pending, Attempts: data.Attempts}, nil
+	}
+
+	claimed, err := s.requestStorage.RetryRequest(ctx, data, attempts)
+	if err != nil {
+		return bookModels.SearchRequest{}, err
+	}
+	if claimed {
+		s.log.Info("retrying request", slog.String("isbn", data.Isbn), slog.Int("attempt", attempts))
+		if err := s.requestExecutor.AddRequest(ctx, data.Isbn); err != nil {
+			return bookModels.SearchRequest{}, err
+		}
+	}
+
+	return bookModels.SearchRequest{Isbn: data.Isbn, Status: bookModels.Pending, Attempts: attempts}, nil
+}
+
 //func (s *SearcherService) FindOrCreateRequest(ctx context.Context, isbn string) (*models.BooksSearchResult, error) {
 //	const op = "searcher.SearcherService.FindOrCreateRequest"
 //	s.log.With(
@@ -0,0 +1,152 @@
+package mongostorage
+
+import (
+	"context"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/lib/isbn"
+	"github.com/getz-devs/librakeeper-server/lib/mongomigrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+)
+
+// MigrationsCollection records the migrations applied to the database.
+const MigrationsCollection = "search_migrations"
+
+// migrations returns the migrations of the search request collection, in order.
+func migrations(collection string) []mongomigrate.Migration {
+	return []mongomigrate.Migration{
+		{
+			Name: "merge duplicate requests",
+			Up: func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+				col := db.Collection(collection)
+				if err := normalizeISBNs(ctx, col, log); err != nil {
+					return err
+				}
+				return mergeDuplicates(ctx, col, log)
+			},
+		},
+		{
+			Name: "create search request indexes",
+			Up: mongomigrate.CreateIndexes(collection,
+				isbnIndex,
+				// FindStaleRequests
+				mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "hits", Value: -1}}},
+			),
+		},
+	}
+}
+
+// isbnIndex makes the ISBN of a request unique.
+var isbnIndex = mongo.IndexModel{
+	Keys:    bson.D{{Key: "isbn", Value: 1}},
+	Options: options.Index().SetUnique(true),
+}
+
+// Migrate brings the search request collection up to date.
+func (s *Storage) Migrate(ctx context.Context, log *slog.Logger) error {
+	return mongomigrate.Migrate(ctx, s.col.Database(), MigrationsCollection, migrations(s.col.Name()), log)
+}
+
+// mergeDuplicates keeps one request per ISBN, so the unique index can be
+// built. Concurrent upserts without it could insert an ISBN twice. The most
+// recently updated request is kept and gets the hits of the others.
+func mergeDuplicates(ctx context.Context, col *mongo.Collection, log *slog.Logger) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "updated_at", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$isbn"},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			{Key: "hits", Value: bson.D{{Key: "$sum", Value: "$hits"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+	}
+	cursor, err := col.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return fmt.Errorf("failed to find duplicate requests: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	merged := 0
+	for cursor.Next(ctx) {
+		var group struct {
+			Isbn string        `bson:"_id"`
+			IDs  []interface{} `bson:"ids"`
+			Hits int           `bson:"hits"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return fmt.Errorf("failed to decode duplicate requests: %w", err)
+		}
+
+		if _, err := col.UpdateByID(ctx, group.IDs[0], bson.D{{Key: "$set", Value: bson.D{{Key: "hits", Value: group.Hits}}}}); err != nil {
+			return fmt.Errorf("failed to merge requests for %s: %w", group.Isbn, err)
+		}
+		if _, err := col.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: group.IDs[1:]}}}}); err != nil {
+			return fmt.Errorf("failed to delete duplicate requests for %s: %w", group.Isbn, err)
+		}
+		merged++
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to find duplicate requests: %w", err)
+	}
+
+	log.Info("merged duplicate requests", slog.Int("isbns", merged))
+	return nil
+}
+
+// isbnFix is a request whose ISBN is not in the canonical ISBN-13 form.
+type isbnFix struct {
+	ID   interface{}
+	Isbn string // canonical form
+}
+
+// nonCanonicalISBNs returns the requests stored with an ISBN-10 or a
+// hyphenated ISBN, which lookups by the canonical ISBN-13 never find.
+// Invalid ISBNs are left as they are.
+func nonCanonicalISBNs(ctx context.Context, col *mongo.Collection) ([]isbnFix, error) {
+	cursor, err := col.Find(ctx, bson.D{}, options.Find().SetProjection(bson.D{{Key: "isbn", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find requests: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var fixes []isbnFix
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID   interface{} `bson:"_id"`
+			Isbn string      `bson:"isbn"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode request: %w", err)
+		}
+		canonical, err := isbn.Normalize(doc.Isbn)
+		if err == nil && canonical != doc.Isbn {
+			fixes = append(fixes, isbnFix{ID: doc.ID, Isbn: canonical})
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find requests: %w", err)
+	}
+	return fixes, nil
+}
+
+// normalizeISBNs rewrites the ISBNs of the requests in the canonical form.
+// Requests that then share an ISBN must be merged before the unique index is
+// built.
+func normalizeISBNs(ctx context.Context, col *mongo.Collection, log *slog.Logger) error {
+	fixes, err := nonCanonicalISBNs(ctx, col)
+	if err != nil {
+		return err
+	}
+	for _, fix := range fixes {
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "isbn", Value: fix.Isbn}}}}
+		if _, err := col.UpdateByID(ctx, fix.ID, update); err != nil {
+			return fmt.Errorf("failed to normalize the ISBN of request %v: %w", fix.ID, err)
+		}
+	}
+
+	log.Info("normalized request ISBNs", slog.Int("requests", len(fixes)))
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
 )
 
 type Storage struct {
@@ -40,20 +41,137 @@ func (s *Storage) Close() {
 	}
 }
 
+// FindOrCreateRequest returns the request for an ISBN, or creates it and
+// reports so. Creating a request and serving the books of a successful one
+// count as hits; polling a pending or failed request does not.
 func (s *Storage) FindOrCreateRequest(ctx context.Context, isbn string) (bookModels.SearchRequest, bool, error) {
 	// insert if not exist (upsert)
-	filter := bson.D{{"isbn", isbn}}
+	filter := bson.D{{Key: "isbn", Value: isbn}}
 	insertValue := bookModels.New(isbn)
-	value := bson.D{{"$setOnInsert", insertValue}}
+	insertValue.Hits = 1
+	value := bson.D{
+		{Key: "$setOnInsert", Value: insertValue},
+		{Key: "$set", Value: bson.D{{Key: "last_requested_at", Value: time.Now()}}},
+	}
 	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
 	var result bookModels.SearchRequest
 	err := s.col.FindOneAndUpdate(ctx, filter, value, opts).Decode(&result)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent upsert inserted the request first; the unique isbn
+		// index rejected ours, so this one is an update.
+		err = s.col.FindOneAndUpdate(ctx, filter, value, opts).Decode(&result)
+	}
 	if err != nil {
 		return bookModels.SearchRequest{}, false, err
 	}
 	if insertValue.ID == result.ID {
 		return bookModels.SearchRequest{}, true, nil
 	}
+
+	if result.Status == bookModels.Success {
+		hit := bson.D{{Key: "$inc", Value: bson.D{{Key: "hits", Value: 1}}}}
+		if _, err := s.col.UpdateByID(ctx, result.ID, hit); err != nil {
+			return bookModels.SearchRequest{}, false, err
+		}
+		result.Hits++
+	}
 	return result, false, nil
 }
+
+// RetryRequest moves a failed request back to pending and sets its attempts
+// counter. The update only applies while the request is unchanged since it was
+// read, so concurrent callers enqueue a single retry. It reports whether this
+// caller claimed the retry.
+func (s *Storage) RetryRequest(ctx context.Context, request bookModels.SearchRequest, attempts int) (bool, error) {
+	filter := bson.D{
+		{Key: "isbn", Value: request.Isbn},
+		{Key: "status", Value: bookModels.Failed},
+		{Key: "updated_at", Value: request.UpdatedAt},
+	}
+	values := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: bookModels.Pending},
+			{Key: "attempts", Value: attempts},
+			{Key: "updated_at", Value: time.Now()},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: "failure_reason", Value: ""}}},
+	}
+	res, err := s.col.UpdateOne(ctx, filter, values)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// ClaimRefresh marks a successful request as being refreshed by moving its
+// updated_at. Like RetryRequest, it only applies while the request is unchanged
+// since it was read, and reports whether this caller claimed the refresh.
+func (s *Storage) ClaimRefresh(ctx context.Context, request bookModels.SearchRequest) (bool, error) {
+	filter := bson.D{
+		{Key: "isbn", Value: request.Isbn},
+		{Key: "status", Value: bookModels.Success},
+		{Key: "updated_at", Value: request.UpdatedAt},
+	}
+	values := bson.D{{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}}}
+	res, err := s.col.UpdateOne(ctx, filter, values)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// FindStaleRequests returns the successful requests matching the query, most
+// popular first. Requests scraped before last_scraped_at existed count as
+// scraped at updated_at.
+func (s *Storage) FindStaleRequests(ctx context.Context, query bookModels.RefreshQuery) ([]bookModels.SearchRequest, error) {
+	filter := bson.D{
+		{Key: "status", Value: bookModels.Success},
+		{Key: "updated_at", Value: bson.D{{Key: "$lt", Value: query.UpdatedBefore}}},
+		{Key: "hits", Value: bson.D{{Key: "$gte", Value: query.MinHits}}},
+		{Key: "last_requested_at", Value: bson.D{{Key: "$gte", Value: query.RequestedAfter}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "last_scraped_at", Value: bson.D{{Key: "$lt", Value: query.ScrapedBefore}}}},
+			bson.D{
+				{Key: "last_scraped_at", Value: bson.D{{Key: "$exists", Value: false}}},
+				{Key: "updated_at", Value: bson.D{{Key: "$lt", Value: query.ScrapedBefore}}},
+			},
+		}},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "hits", Value: -1}}).
+		SetLimit(int64(query.Limit)).
+		SetProjection(bson.D{{Key: "books", Value: 0}})
+
+	cursor, err := s.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []bookModels.SearchRequest
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// FindPendingRequests returns the requests waiting for the agent, least
+// recently updated first, without their books. New requests have no status
+// field, since Pending is the zero value.
+func (s *Storage) FindPendingRequests(ctx context.Context) ([]bookModels.SearchRequest, error) {
+	filter := bson.D{{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{bookModels.Pending, nil}}}}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: 1}}).
+		SetProjection(bson.D{{Key: "books", Value: 0}})
+
+	cursor, err := s.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []bookModels.SearchRequest
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
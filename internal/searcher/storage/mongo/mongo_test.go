@@ -0,0 +1,146 @@
+package mongostorage
+
+import (
+	"context"
+	agentstorage "github.com/getz-devs/librakeeper-server/internal/searcher-agent/storage/mongo"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/storage/storagetest"
+	"github.com/getz-devs/librakeeper-server/lib/isbn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+// sharedStorage is the searcher and the agent writing to one collection, as
+// in production.
+type sharedStorage struct {
+	*Storage
+	agent *agentstorage.Storage
+}
+
+func (s sharedStorage) CompleteRequest(ctx context.Context, isbn string, books []*bookModels.BookInShop) error {
+	return s.agent.CompleteRequest(ctx, isbn, books)
+}
+
+func (s sharedStorage) RejectRequest(ctx context.Context, isbn string, reason string) error {
+	return s.agent.RejectRequest(ctx, isbn, reason)
+}
+
+// TestConformance runs against the MongoDB server at MONGO_TEST_URI, each
+// test in a database of its own that is dropped afterwards.
+func TestConformance(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		config := DatabaseMongoConfig{
+			ConnectUrl: uri,
+			Database:   "librakeeper_test_" + primitive.NewObjectID().Hex(),
+			Collection: "search_requests",
+		}
+		searcher := New(config)
+		agent := agentstorage.New(agentstorage.DatabaseMongoConfig(config))
+		t.Cleanup(func() {
+			_ = searcher.col.Database().Drop(context.Background())
+			searcher.Close()
+			agent.Close()
+		})
+		require.NoError(t, searcher.Migrate(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil))))
+		return sharedStorage{Storage: searcher, agent: agent}
+	})
+}
+
+// TestMigrate checks that requests inserted twice before the unique index
+// existed are merged.
+func TestMigrate(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+	s := New(DatabaseMongoConfig{
+		ConnectUrl: uri,
+		Database:   "librakeeper_test_" + primitive.NewObjectID().Hex(),
+		Collection: "search_requests",
+	})
+	t.Cleanup(func() {
+		_ = s.col.Database().Drop(ctx)
+		s.Close()
+	})
+
+	older := bookModels.New("9785446120581")
+	older.Hits = 2
+	newer := bookModels.New("9785446120581")
+	newer.Hits = 3
+	newer.Status = bookModels.Success
+	newer.UpdatedAt = primitive.NewDateTimeFromTime(older.UpdatedAt.Time().Add(time.Minute))
+	other := bookModels.New("9785171183660")
+	_, err := s.col.InsertMany(ctx, []interface{}{older, newer, other})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Migrate(ctx, slog.New(slog.NewTextHandler(os.Stdout, nil))))
+
+	count, err := s.col.CountDocuments(ctx, bson.D{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	request, created, err := s.FindOrCreateRequest(ctx, "9785446120581")
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, newer.ID, request.ID, "the latest request is kept")
+	assert.Equal(t, 6, request.Hits, "hits are summed, plus this lookup of a successful request")
+
+	_, err = s.col.InsertOne(ctx, bookModels.New("9785446120581"))
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+}
+
+// TestMigrate_CanonicalISBNs checks that requests stored with an ISBN-10 or a
+// hyphenated ISBN are normalized and merged, before and after the unique
+// index exists.
+func TestMigrate_CanonicalISBNs(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	s := New(DatabaseMongoConfig{
+		ConnectUrl: uri,
+		Database:   "librakeeper_test_" + primitive.NewObjectID().Hex(),
+		Collection: "search_requests",
+	})
+	t.Cleanup(func() {
+		_ = s.col.Database().Drop(ctx)
+		s.Close()
+	})
+
+	isbn10, err := isbn.To10("9785446120581")
+	require.NoError(t, err)
+	hyphenated := bookModels.New("978-5-4461-2058-1")
+	hyphenated.Hits = 2
+	short := bookModels.New(isbn10)
+	short.Hits = 3
+	invalid := bookModels.New("not-an-isbn")
+	_, err = s.col.InsertMany(ctx, []interface{}{hyphenated, short, invalid})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Migrate(ctx, log))
+
+	count, err := s.col.CountDocuments(ctx, bson.D{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count, "invalid ISBNs are kept as they are")
+	request, created, err := s.FindOrCreateRequest(ctx, "9785446120581")
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, 5, request.Hits, "hits are summed; polling a pending request is no hit")
+}
@@ -8,18 +8,35 @@ import (
 	"google.golang.org/api/option"
 )
 
-var client *auth.Client
+// TokenVerifier checks an ID token sent by a client and returns the ID of the
+// user it was issued to.
+type TokenVerifier interface {
+	VerifyIDToken(ctx context.Context, idToken string) (string, error)
+}
+
+// Firebase verifies ID tokens issued by Firebase Authentication.
+type Firebase struct {
+	client *auth.Client
+}
 
-func InitializeFirebase(credentialPath string) error {
+// NewFirebase creates a Firebase verifier from a service account credentials file.
+func NewFirebase(credentialPath string) (*Firebase, error) {
 	opt := option.WithCredentialsFile(credentialPath)
 	app, err := firebase.NewApp(context.Background(), nil, opt)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	client, err = app.Auth(context.Background())
-	return err
+	client, err := app.Auth(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &Firebase{client: client}, nil
 }
 
-func VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
-	return client.VerifyIDToken(ctx, idToken)
+func (f *Firebase) VerifyIDToken(ctx context.Context, idToken string) (string, error) {
+	token, err := f.client.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return "", err
+	}
+	return token.UID, nil
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -8,6 +9,12 @@ import (
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+// Database drivers.
+const (
+	DriverMongo = "mongo"
+	DriverBolt  = "bolt" // an embedded single-file database
+)
+
 // Config represents the application's configuration.
 
 type Config struct {
@@ -19,8 +26,11 @@ type Config struct {
 	} `yaml:"server"`
 
 	Database struct {
-		URI  string `yaml:"uri" env-required:"true"`
-		Name string `yaml:"name" env-required:"true"`
+		Driver           string `yaml:"driver" env-default:"mongo"`             // mongo or bolt
+		URI              string `yaml:"uri"`                                    // mongo
+		Name             string `yaml:"name"`                                   // mongo
+		Path             string `yaml:"path" env-default:"data/librakeeper.db"` // bolt
+		MigrateOnStartup bool   `yaml:"migrate_on_startup" env-default:"false"` // mongo; bolt always migrates
 	} `yaml:"database"`
 
 	Auth struct {
@@ -30,6 +40,13 @@ type Config struct {
 	GRPC struct {
 		Addr string `yaml:"addr" env-default:"localhost:44044"`
 	} `yaml:"grpc"`
+
+	Pagination struct {
+		CursorSecret string `yaml:"cursor_secret" env:"CURSOR_SECRET"` // required unless random secrets are allowed
+		// AllowRandomSecret lets the server start without a cursor secret, with
+		// a random one per process. For development only.
+		AllowRandomSecret bool `yaml:"allow_random_secret" env-default:"false"`
+	} `yaml:"pagination"`
 }
 
 // MustLoad loads the configuration from the specified path and environment variables.
@@ -39,6 +56,11 @@ func MustLoad() *Config {
 		panic("config path is empty")
 	}
 
+	return MustLoadByPath(configPath)
+}
+
+// MustLoadByPath loads the configuration from the given file and environment variables.
+func MustLoadByPath(configPath string) *Config {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		panic("config file doesn't exist: " + configPath)
 	}
@@ -48,9 +70,30 @@ func MustLoad() *Config {
 		panic(fmt.Errorf("failed to read config: %w", err))
 	}
 
+	if err := cfg.Validate(); err != nil {
+		panic(fmt.Errorf("invalid config: %w", err))
+	}
+
 	return &cfg
 }
 
+// Validate checks the settings the selected database driver requires.
+func (cfg *Config) Validate() error {
+	switch cfg.Database.Driver {
+	case DriverMongo:
+		if cfg.Database.URI == "" || cfg.Database.Name == "" {
+			return errors.New("database.uri and database.name are required by the mongo driver")
+		}
+	case DriverBolt:
+		if cfg.Database.Path == "" {
+			return errors.New("database.path is required by the bolt driver")
+		}
+	default:
+		return fmt.Errorf("unknown database.driver %q", cfg.Database.Driver)
+	}
+	return nil
+}
+
 // fetchConfigPath fetches the config path from command-line flags or environment variables.
 // Priority: command-line flag > environment variable.
 func fetchConfigPath() string {
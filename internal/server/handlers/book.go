@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/getz-devs/librakeeper-server/internal/server/models"
 	"github.com/getz-devs/librakeeper-server/internal/server/services/book"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/search"
 	"github.com/gin-gonic/gin"
 	"log/slog"
 	"net/http"
@@ -44,6 +45,19 @@ func (h *BookHandlers) Create(c *gin.Context) {
 
 	// Вызываем сервис с addToAll
 	if err := h.service.Create(ctx, &b); err != nil {
+		if errors.Is(err, book.ErrBookshelfNotFound) || errors.Is(err, book.ErrNotAuthorized) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, book.ErrBookAlreadyExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, book.ErrInvalidISBN) || errors.Is(err, book.ErrTitleAndAuthorRequired) ||
+			errors.Is(err, book.ErrBookshelfLimitReached) || errors.Is(err, book.ErrSmartBookshelf) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		h.log.Error("failed to create book", slog.Any("error", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book"})
 		return
@@ -56,10 +70,16 @@ func (h *BookHandlers) Create(c *gin.Context) {
 func (h *BookHandlers) GetByID(c *gin.Context) {
 	bookID := c.Param("id")
 
-	ctx := c.Request.Context()
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
 	b, err := h.service.GetByID(ctx, bookID)
 	if err != nil {
-		if errors.Is(err, book.ErrBookNotFound) {
+		if errors.Is(err, book.ErrBookNotFound) || errors.Is(err, book.ErrNotAuthorized) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
@@ -75,13 +95,23 @@ func (h *BookHandlers) GetByID(c *gin.Context) {
 func (h *BookHandlers) GetByISBN(c *gin.Context) {
 	isbn := c.Param("isbn")
 
-	ctx := c.Request.Context()
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
 	b, err := h.service.GetByISBN(ctx, isbn)
 	if err != nil {
 		if errors.Is(err, book.ErrBookNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, book.ErrInvalidISBN) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		h.log.Error("failed to get book by ISBN", slog.Any("error", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get book by ISBN"})
 		return
@@ -92,18 +122,9 @@ func (h *BookHandlers) GetByISBN(c *gin.Context) {
 
 // GetByUser retrieves books for a user.
 func (h *BookHandlers) GetByUser(c *gin.Context) {
-	pageStr := c.DefaultQuery("page", "1")
-	limitStr := c.DefaultQuery("limit", "10")
-
-	page, err := strconv.ParseInt(pageStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number"})
-		return
-	}
-
-	limit, err := strconv.ParseInt(limitStr, 10, 64)
+	opts, err := parseBookListOptions(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -113,9 +134,13 @@ func (h *BookHandlers) GetByUser(c *gin.Context) {
 		return
 	}
 
-	ctx := c.Request.Context()
-	result, err := h.service.GetByUserID(ctx, userID.(string), page, limit)
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
+	result, err := h.service.GetByUserID(ctx, userID.(string), opts)
 	if err != nil {
+		if isListError(err) || errors.Is(err, book.ErrInvalidDateRange) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		h.log.Error("failed to get books by user ID", slog.Any("error", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get books by user ID"})
 		return
@@ -128,19 +153,16 @@ func (h *BookHandlers) GetByUser(c *gin.Context) {
 func (h *BookHandlers) GetByBookshelfID(c *gin.Context) {
 	bookshelfID := c.Param("id")
 
-	pageStr := c.DefaultQuery("page", "1")
-	limitStr := c.DefaultQuery("limit", "10")
-
-	page, err := strconv.ParseInt(pageStr, 10, 64)
+	opts, err := parseBookListOptions(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	limit, err := strconv.ParseInt(limitStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
-		return
+	if v := c.Query("recursive"); v != "" {
+		if opts.Recursive, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recursive"})
+			return
+		}
 	}
 
 	userID, exists := c.Get("userID")
@@ -151,8 +173,16 @@ func (h *BookHandlers) GetByBookshelfID(c *gin.Context) {
 
 	ctx := context.WithValue(c.Request.Context(), "userID", userID)
 
-	result, err := h.service.GetByBookshelfID(ctx, bookshelfID, page, limit)
+	result, err := h.service.GetByBookshelfID(ctx, bookshelfID, opts)
 	if err != nil {
+		if isListError(err) || errors.Is(err, book.ErrInvalidDateRange) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, book.ErrBookshelfNotFound) || errors.Is(err, book.ErrNotAuthorized) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		h.log.Error("failed to get books by bookshelf ID", slog.Any("error", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get books by bookshelf ID"})
 		return
@@ -180,10 +210,23 @@ func (h *BookHandlers) Update(c *gin.Context) {
 	ctx := context.WithValue(c.Request.Context(), "userID", userID)
 
 	if err := h.service.Update(ctx, bookID, &update); err != nil {
-		if errors.Is(err, book.ErrBookNotFound) {
+		if errors.Is(err, book.ErrBookNotFound) || errors.Is(err, book.ErrNotAuthorized) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, book.ErrTargetNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, book.ErrInvalidISBN) || errors.Is(err, book.ErrBookshelfLimitReached) ||
+			errors.Is(err, book.ErrSmartBookshelf) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, book.ErrBookAlreadyExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 
 		h.log.Error(
 			"failed to update book",
@@ -198,6 +241,152 @@ func (h *BookHandlers) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Book updated successfully"})
 }
 
+// Move moves a book from one bookshelf to another, as given in the request
+// body. Without from_bookshelf_id the book leaves the only bookshelf it is on;
+// without bookshelf_id it is taken off the bookshelf.
+func (h *BookHandlers) Move(c *gin.Context) {
+	bookID := c.Param("id")
+
+	var req struct {
+		FromBookshelfID string `json:"from_bookshelf_id"`
+		BookshelfID     string `json:"bookshelf_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
+
+	b, err := h.service.Move(ctx, bookID, req.FromBookshelfID, req.BookshelfID)
+	if err != nil {
+		h.moveFailed(c, err, slog.String("bookID", bookID), slog.String("userID", fmt.Sprintf("%v", userID)))
+		return
+	}
+
+	c.JSON(http.StatusOK, b)
+}
+
+// MoveMany moves several books to one bookshelf, or off their bookshelves.
+func (h *BookHandlers) MoveMany(c *gin.Context) {
+	var move models.BookMove
+	if err := c.BindJSON(&move); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
+
+	result, err := h.service.MoveMany(ctx, &move)
+	if err != nil {
+		h.moveFailed(c, err, slog.String("userID", fmt.Sprintf("%v", userID)))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Reorder changes the manual order of the books on a bookshelf.
+func (h *BookHandlers) Reorder(c *gin.Context) {
+	bookshelfID := c.Param("id")
+
+	var order models.Reorder
+	if err := c.BindJSON(&order); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
+
+	if err := h.service.Reorder(ctx, bookshelfID, &order); err != nil {
+		switch {
+		case errors.Is(err, book.ErrBookshelfNotFound), errors.Is(err, book.ErrNotAuthorized):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, book.ErrInvalidReorder), errors.Is(err, book.ErrIncompleteList),
+			errors.Is(err, book.ErrUnknownItem), errors.Is(err, book.ErrSmartBookshelf):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.log.Error(
+				"failed to reorder books",
+				slog.Any("error", err),
+				slog.String("bookshelfID", bookshelfID),
+				slog.String("userID", fmt.Sprintf("%v", userID)),
+			)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder books"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Books reordered successfully"})
+}
+
+// AddToBookshelf puts a book on one more bookshelf.
+func (h *BookHandlers) AddToBookshelf(c *gin.Context) {
+	h.shelve(c, h.service.AddToBookshelf)
+}
+
+// RemoveFromBookshelf takes a book off a bookshelf.
+func (h *BookHandlers) RemoveFromBookshelf(c *gin.Context) {
+	h.shelve(c, h.service.RemoveFromBookshelf)
+}
+
+// shelve changes one bookshelf of a book and responds with the book.
+func (h *BookHandlers) shelve(c *gin.Context, change func(ctx context.Context, bookID, bookshelfID string) (*models.Book, error)) {
+	bookID := c.Param("id")
+	bookshelfID := c.Param("bookshelf_id")
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
+
+	b, err := change(ctx, bookID, bookshelfID)
+	if err != nil {
+		h.moveFailed(c, err, slog.String("bookID", bookID), slog.String("bookshelfID", bookshelfID), slog.String("userID", fmt.Sprintf("%v", userID)))
+		return
+	}
+
+	c.JSON(http.StatusOK, b)
+}
+
+// moveFailed responds to a failed move.
+func (h *BookHandlers) moveFailed(c *gin.Context, err error, attrs ...any) {
+	switch {
+	case errors.Is(err, book.ErrBookNotFound), errors.Is(err, book.ErrNotAuthorized), errors.Is(err, book.ErrTargetNotFound),
+		errors.Is(err, book.ErrNotOnBookshelf):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, book.ErrNoBooksToMove), errors.Is(err, book.ErrTooManyBooksToMove), errors.Is(err, book.ErrBookshelfLimitReached),
+		errors.Is(err, book.ErrAmbiguousMove), errors.Is(err, book.ErrSmartBookshelf):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, book.ErrBookAlreadyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.log.Error("failed to move books", append([]any{slog.Any("error", err)}, attrs...)...)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move books"})
+	}
+}
+
 // Delete handles the deletion of a book.
 func (h *BookHandlers) Delete(c *gin.Context) {
 	bookID := c.Param("id")
@@ -211,7 +400,7 @@ func (h *BookHandlers) Delete(c *gin.Context) {
 	ctx := context.WithValue(c.Request.Context(), "userID", userID)
 
 	if err := h.service.Delete(ctx, bookID); err != nil {
-		if errors.Is(err, book.ErrBookNotFound) {
+		if errors.Is(err, book.ErrBookNotFound) || errors.Is(err, book.ErrNotAuthorized) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
@@ -223,8 +412,10 @@ func (h *BookHandlers) Delete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Book deleted successfully"})
 }
 
+// AddAdvanced adds a book from the advanced search results to the user's library.
 func (h *BookHandlers) AddAdvanced(c *gin.Context) {
 	isbn := c.Query("isbn")
+	bookshelfID := c.Query("bookshelf_id")
 	indexStr := c.Query("index")
 	index, err := strconv.Atoi(indexStr)
 	if err != nil {
@@ -232,18 +423,32 @@ func (h *BookHandlers) AddAdvanced(c *gin.Context) {
 		return
 	}
 
-	// Вызываем сервис с addToAll
-	err = h.service.AddAdvanced(c.Request.Context(), isbn, index)
-	if errors.Is(err, book.ErrBookAlreadyExistsInALL) {
-		c.JSON(http.StatusNotModified, gin.H{"warning": err.Error()})
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
+
+	b, err := h.service.AddAdvanced(ctx, isbn, index, bookshelfID)
 	if err != nil {
-		h.log.Error("failed to add book to all from advanced search", slog.Any("error", err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book"})
+		switch {
+		case errors.Is(err, book.ErrBookshelfNotFound), errors.Is(err, book.ErrNotAuthorized), errors.Is(err, search.ErrISBNNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, book.ErrBookAlreadyExists), errors.Is(err, book.ErrSearchNotFinished),
+			errors.Is(err, book.ErrSearchFailed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, book.ErrInvalidIndex), errors.Is(err, book.ErrTitleAndAuthorRequired),
+			errors.Is(err, book.ErrBookshelfLimitReached), errors.Is(err, search.ErrISBNRequired),
+			errors.Is(err, search.ErrInvalidISBN), errors.Is(err, book.ErrSmartBookshelf):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.log.Error("failed to add book from advanced search", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"status": "ok"})
+	c.JSON(http.StatusCreated, b)
 }
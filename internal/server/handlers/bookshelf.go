@@ -9,7 +9,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"log/slog"
 	"net/http"
-	"strconv"
 )
 
 // BookshelfHandlers handles HTTP requests related to bookshelf.
@@ -42,7 +41,8 @@ func (h *BookshelfHandlers) Create(c *gin.Context) {
 
 	ctx := context.WithValue(c.Request.Context(), "userID", userID)
 	if err := h.service.Create(ctx, &b); err != nil {
-		if errors.Is(err, bookshelf.ErrNameRequired) || errors.Is(err, bookshelf.ErrBookshelfAlreadyExists) {
+		if errors.Is(err, bookshelf.ErrNameRequired) || errors.Is(err, bookshelf.ErrBookshelfAlreadyExists) || isNestingError(err) ||
+			errors.Is(err, bookshelf.ErrInvalidFilter) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -55,14 +55,20 @@ func (h *BookshelfHandlers) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, b)
 }
 
-// GetByID retrieves a bookshelf by ID.
+// GetByID retrieves a bookshelf by ID with its breadcrumbs, children and book counts.
 func (h *BookshelfHandlers) GetByID(c *gin.Context) {
 	bookshelfID := c.Param("id")
 
-	ctx := c.Request.Context()
-	b, err := h.service.GetByID(ctx, bookshelfID)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
+	b, err := h.service.Details(ctx, bookshelfID)
 	if err != nil {
-		if errors.Is(err, bookshelf.ErrBookshelfNotFound) {
+		if errors.Is(err, bookshelf.ErrBookshelfNotFound) || errors.Is(err, bookshelf.ErrNotAuthorized) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
@@ -82,24 +88,19 @@ func (h *BookshelfHandlers) GetByUser(c *gin.Context) {
 		return
 	}
 
-	pageStr := c.DefaultQuery("page", "1")
-	limitStr := c.DefaultQuery("limit", "10")
-
-	page, err := strconv.ParseInt(pageStr, 10, 64)
+	opts, err := parseBookshelfListOptions(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number"})
-		return
-	}
-
-	limit, err := strconv.ParseInt(limitStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx := c.Request.Context()
-	result, err := h.service.GetByUser(ctx, userID.(string), page, limit)
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
+	result, err := h.service.GetByUser(ctx, userID.(string), opts)
 	if err != nil {
+		if isListError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		h.log.Error("failed to get result by user id", slog.Any("error", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get bookshelf by user ID"})
 		return
@@ -131,6 +132,11 @@ func (h *BookshelfHandlers) Update(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, bookshelf.ErrBookshelfAlreadyExists) || isNestingError(err) ||
+			errors.Is(err, bookshelf.ErrInvalidFilter) || errors.Is(err, bookshelf.ErrNotSmart) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		h.log.Error(
 			"failed to update bookshelf",
@@ -157,15 +163,105 @@ func (h *BookshelfHandlers) Delete(c *gin.Context) {
 
 	ctx := context.WithValue(c.Request.Context(), "userID", userID)
 
-	if err := h.service.Delete(ctx, bookshelfID); err != nil {
-		if errors.Is(err, bookshelf.ErrBookshelfNotFound) || errors.Is(err, bookshelf.ErrNotAuthorized) {
+	opts := &models.BookshelfDeleteOptions{
+		Mode:     models.BookshelfDeleteMode(c.Query("mode")),
+		TargetID: c.Query("target"),
+	}
+
+	result, err := h.service.Delete(ctx, bookshelfID, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, bookshelf.ErrBookshelfNotFound), errors.Is(err, bookshelf.ErrNotAuthorized):
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
+		case errors.Is(err, bookshelf.ErrInvalidDeleteMode), errors.Is(err, bookshelf.ErrInvalidDeleteTarget),
+			errors.Is(err, bookshelf.ErrTargetNotFound), errors.Is(err, bookshelf.ErrSmartTarget),
+			errors.Is(err, bookshelf.ErrTargetLimitReached):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, bookshelf.ErrBookshelfNotEmpty), errors.Is(err, bookshelf.ErrBookshelfHasChildren),
+			errors.Is(err, bookshelf.ErrTargetHasBook):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			h.log.Error("failed to delete bookshelf", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bookshelf"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Move nests a bookshelf, with everything nested in it, in another one.
+func (h *BookshelfHandlers) Move(c *gin.Context) {
+	bookshelfID := c.Param("id")
+
+	var move models.BookshelfMove
+	if err := c.BindJSON(&move); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
+	b, err := h.service.Move(ctx, bookshelfID, move.ParentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, bookshelf.ErrBookshelfNotFound), errors.Is(err, bookshelf.ErrNotAuthorized):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, bookshelf.ErrBookshelfAlreadyExists), isNestingError(err):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.log.Error("failed to move bookshelf", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move bookshelf"})
 		}
-		h.log.Error("failed to delete bookshelf", slog.Any("error", err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bookshelf"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Bookshelf deleted successfully"})
+	c.JSON(http.StatusOK, b)
+}
+
+// Reorder changes the manual order of the bookshelves nested directly in a
+// bookshelf, or of the top-level bookshelves when no ID is given.
+func (h *BookshelfHandlers) Reorder(c *gin.Context) {
+	parentID := c.Param("id")
+
+	var order models.Reorder
+	if err := c.BindJSON(&order); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), "userID", userID)
+
+	if err := h.service.Reorder(ctx, parentID, &order); err != nil {
+		switch {
+		case errors.Is(err, bookshelf.ErrBookshelfNotFound), errors.Is(err, bookshelf.ErrNotAuthorized):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, bookshelf.ErrInvalidReorder), errors.Is(err, bookshelf.ErrIncompleteList),
+			errors.Is(err, bookshelf.ErrUnknownItem):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.log.Error("failed to reorder bookshelves", slog.Any("error", err), slog.String("parentID", parentID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder bookshelves"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bookshelves reordered successfully"})
+}
+
+// isNestingError reports whether a bookshelf cannot be nested where it was asked to be.
+func isNestingError(err error) bool {
+	return errors.Is(err, bookshelf.ErrParentNotFound) || errors.Is(err, bookshelf.ErrBookshelfCycle) ||
+		errors.Is(err, bookshelf.ErrTooDeep) || errors.Is(err, bookshelf.ErrSmartParent)
 }
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/pagination"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// parsePage reads the page and limit query parameters.
+func parsePage(c *gin.Context) (int64, int64, error) {
+	page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("Invalid page number")
+	}
+
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.FormatInt(pagination.DefaultLimit, 10)), 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("Invalid limit")
+	}
+
+	return page, limit, nil
+}
+
+// parseSort reads the sort and order query parameters.
+func parseSort(c *gin.Context) (string, models.SortOrder, error) {
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+		return c.Query("sort"), models.SortAsc, nil
+	case "desc":
+		return c.Query("sort"), models.SortDesc, nil
+	default:
+		return "", 0, pagination.ErrInvalidOrder
+	}
+}
+
+// parseBookListOptions reads pagination, sorting and filters of a book list.
+func parseBookListOptions(c *gin.Context) (*models.BookListOptions, error) {
+	page, limit, err := parsePage(c)
+	if err != nil {
+		return nil, err
+	}
+
+	sort, order, err := parseSort(c)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := models.BookFilter{
+		Author:    c.Query("author"),
+		Publisher: c.Query("publisher"),
+		ShopName:  c.Query("shop"),
+		Tag:       c.Query("tag"),
+	}
+
+	if v := c.Query("has_cover"); v != "" {
+		hasCover, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("Invalid has_cover")
+		}
+		filter.HasCover = &hasCover
+	}
+
+	if filter.CreatedFrom, err = parseTime(c.Query("created_from"), false); err != nil {
+		return nil, fmt.Errorf("Invalid created_from: %w", err)
+	}
+	if filter.CreatedTo, err = parseTime(c.Query("created_to"), true); err != nil {
+		return nil, fmt.Errorf("Invalid created_to: %w", err)
+	}
+
+	return &models.BookListOptions{
+		Page:   page,
+		Limit:  limit,
+		Sort:   sort,
+		Order:  order,
+		Filter: filter,
+		Cursor: c.Query("cursor"),
+	}, nil
+}
+
+// parseBookshelfListOptions reads pagination, sorting and the parent filter of
+// a bookshelf list. An empty parent_id selects the top-level bookshelves.
+func parseBookshelfListOptions(c *gin.Context) (*models.BookshelfListOptions, error) {
+	page, limit, err := parsePage(c)
+	if err != nil {
+		return nil, err
+	}
+
+	sort, order, err := parseSort(c)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &models.BookshelfListOptions{
+		Page:   page,
+		Limit:  limit,
+		Sort:   sort,
+		Order:  order,
+		Cursor: c.Query("cursor"),
+	}
+	if parentID, ok := c.GetQuery("parent_id"); ok {
+		opts.ParentID = &parentID
+	}
+	return opts, nil
+}
+
+// parseTime accepts RFC 3339 timestamps or plain dates. A plain date used as
+// the end of a range covers the whole day.
+func parseTime(v string, endOfDay bool) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse(dateLayout, v)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
+
+// isListError reports whether err was caused by invalid list parameters.
+func isListError(err error) bool {
+	return errors.Is(err, pagination.ErrInvalidPage) ||
+		errors.Is(err, pagination.ErrInvalidSort) ||
+		errors.Is(err, pagination.ErrInvalidOrder) ||
+		errors.Is(err, pagination.ErrInvalidCursor)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"log/slog"
 	"net/http"
+	"strconv"
 )
 
 // SearchHandlers handles HTTP requests related to search.
@@ -34,6 +35,10 @@ func (s *SearchHandlers) Simple(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, search.ErrISBNRequired) || errors.Is(err, search.ErrInvalidISBN) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		log.Error("failed to search", slog.Any("error", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search"})
 		return
@@ -48,13 +53,26 @@ func (s *SearchHandlers) Advanced(c *gin.Context) {
 	isbn := c.Query("isbn")
 	ctx := c.Request.Context()
 
+	advanced := s.service.Advanced
+	if retry, _ := strconv.ParseBool(c.Query("retry")); retry {
+		advanced = s.service.Retry
+	}
+
 	// Вызываем метод Advanced, который теперь возвращает models.SearchResponse
-	resp, err := s.service.Advanced(ctx, isbn)
+	resp, err := advanced(ctx, isbn)
 	if err != nil {
 		if errors.Is(err, search.ErrISBNNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, search.ErrISBNRequired) || errors.Is(err, search.ErrInvalidISBN) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, search.ErrUnknownStatus) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
 		log.Error("failed to search", slog.Any("error", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search"})
 		return
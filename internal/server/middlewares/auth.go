@@ -9,8 +9,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware is a Gin middleware for authenticating requests using Firebase
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware is a Gin middleware for authenticating requests with the given verifier
+func AuthMiddleware(verifier auth.TokenVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -28,7 +28,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		idToken := strings.TrimPrefix(authHeader, "Bearer ")
 
 		// Verify the ID token
-		token, err := auth.VerifyIDToken(context.Background(), idToken)
+		userID, err := verifier.VerifyIDToken(context.Background(), idToken)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized", "message": err.Error()})
 			c.Abort()
@@ -36,7 +36,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Set the UID in the context for further use
-		c.Set("userID", token.UID)
+		c.Set("userID", userID)
 		c.Next()
 	}
 }
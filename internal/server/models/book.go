@@ -1,14 +1,21 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
 	"time"
 )
 
-// Book represents a book in the library.
+// Book represents a book in the library. A book linked to the catalog is read
+// merged with its catalog entry: every metadata field comes from the entry,
+// except for the ones the user has overridden. The stored copy of the catalog
+// values lets lists filter and sort on indexes. A book can be on any number of
+// its owner's bookshelves.
 type Book struct {
-	ID          string `bson:"_id,omitempty" json:"id"`
-	UserID      string `bson:"user_id" json:"user_id"`
-	BookshelfID string `bson:"bookshelf_id" json:"bookshelf_id"`
+	ID           string   `bson:"_id,omitempty" json:"id"`
+	UserID       string   `bson:"user_id" json:"user_id"`
+	BookshelfIDs []string `bson:"bookshelf_ids,omitempty" json:"bookshelf_ids"`
+	CatalogID    string   `bson:"catalog_id,omitempty" json:"catalog_id,omitempty"`
 
 	ISBN        string `bson:"isbn" json:"isbn"`
 	Title       string `bson:"title" json:"title"`
@@ -18,19 +25,119 @@ type Book struct {
 	CoverImage  string `bson:"cover_image" json:"cover_image"`
 	ShopName    string `bson:"shop_name" json:"shop_name"`
 
+	// Overrides names the metadata fields the user has set on a book linked to
+	// the catalog; the others follow the catalog entry.
+	Overrides []string `bson:"overrides" json:"overrides,omitempty"`
+
+	// Tags are the user's own labels of the book.
+	Tags []string `bson:"tags,omitempty" json:"tags,omitempty"`
+
+	// Positions orders the book on each of its bookshelves: bookshelf ID ->
+	// fractional index key. The repositories put a book at the end of a
+	// bookshelf it joins.
+	Positions map[string]string `bson:"positions,omitempty" json:"positions,omitempty"`
+
+	// History lists the changes of the bookshelves of the book, oldest first.
+	History []BookEvent `bson:"history,omitempty" json:"history,omitempty"`
+
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 }
 
-// BookUpdate represents fields that can be updated in a Book.
+// Types of the events in the history of a book.
+const (
+	BookEventMoved   = "moved"   // from one bookshelf to another
+	BookEventAdded   = "added"   // to a bookshelf
+	BookEventRemoved = "removed" // from a bookshelf
+)
+
+// BookEvent is an entry in the history of a book. Added books have no
+// FromBookshelfID, removed books no ToBookshelfID.
+type BookEvent struct {
+	Type            string    `bson:"type" json:"type"`
+	FromBookshelfID string    `bson:"from_bookshelf_id" json:"from_bookshelf_id"`
+	ToBookshelfID   string    `bson:"to_bookshelf_id" json:"to_bookshelf_id"`
+	At              time.Time `bson:"at" json:"at"`
+}
+
+// BookMove is a request to move books from one bookshelf to another. Without
+// FromBookshelfID, each book leaves the only bookshelf it is on; without
+// BookshelfID, the books are taken off the bookshelf.
+type BookMove struct {
+	BookIDs         []string `json:"book_ids"`
+	FromBookshelfID string   `json:"from_bookshelf_id"`
+	BookshelfID     string   `json:"bookshelf_id"`
+}
+
+// ShelfChange takes a book off the bookshelf From and puts it on the
+// bookshelf To. Either may be empty, to only add or only remove the book.
+type ShelfChange struct {
+	BookID string
+	From   string
+	To     string
+}
+
+// BookMoveResult reports the outcome of a move.
+type BookMoveResult struct {
+	BookshelfID string   `json:"bookshelf_id"`
+	Moved       []string `json:"moved"`     // IDs of the books that changed bookshelf
+	Unchanged   []string `json:"unchanged"` // IDs of the books already on the bookshelf
+}
+
+// BookUpdate represents fields that can be updated in a Book. A metadata field
+// given as null follows the catalog entry again.
 type BookUpdate struct {
-	ISBN        *string   `bson:"isbn,omitempty" json:"isbn,omitempty"`
-	BookshelfID *string   `bson:"bookshelf_id,omitempty" json:"bookshelf_id,omitempty"`
-	Title       *string   `bson:"title,omitempty" json:"title,omitempty"`
-	Author      *string   `bson:"author,omitempty" json:"author,omitempty"`
-	Publishing  *string   `bson:"publishing" json:"publishing"`
-	Description *string   `bson:"description,omitempty" json:"description,omitempty"`
-	CoverImage  *string   `bson:"cover_image,omitempty" json:"cover_image,omitempty"`
-	ShopName    *string   `bson:"shop_name" json:"shop_name"`
-	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+	ISBN         *string       `bson:"isbn,omitempty" json:"isbn,omitempty"`
+	BookshelfIDs *[]string     `bson:"-" json:"bookshelf_ids,omitempty"` // turned into Shelves by the service
+	CatalogID    *string       `bson:"catalog_id,omitempty" json:"-"`    // set by the service
+	Title        *string       `bson:"title,omitempty" json:"title,omitempty"`
+	Author       *string       `bson:"author,omitempty" json:"author,omitempty"`
+	Publishing   *string       `bson:"publishing" json:"publishing"`
+	Description  *string       `bson:"description,omitempty" json:"description,omitempty"`
+	CoverImage   *string       `bson:"cover_image,omitempty" json:"cover_image,omitempty"`
+	ShopName     *string       `bson:"shop_name" json:"shop_name"`
+	Tags         *[]string     `bson:"tags,omitempty" json:"tags,omitempty"` // replaces all tags of the book
+	Overrides    *[]string     `bson:"overrides,omitempty" json:"-"`         // set by the service
+	Inherit      []string      `bson:"-" json:"-"`                           // the metadata fields given as null
+	Shelves      []ShelfChange `bson:"-" json:"-"`                           // applied with the other fields, all or nothing
+	UpdatedAt    time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+// UnmarshalJSON decodes an update and records the metadata fields given as
+// null in Inherit, since they would otherwise look like the ones left out.
+func (u *BookUpdate) UnmarshalJSON(data []byte) error {
+	type plain BookUpdate
+	if err := json.Unmarshal(data, (*plain)(u)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	u.Inherit = nil
+	for _, name := range MetadataFields {
+		if value, ok := fields[name]; ok && bytes.Equal(value, []byte("null")) {
+			u.Inherit = append(u.Inherit, name)
+		}
+	}
+	return nil
+}
+
+// Metadata returns the metadata fields the update sets, by name.
+func (u *BookUpdate) Metadata() map[string]*string {
+	metadata := map[string]*string{}
+	for name, value := range map[string]*string{
+		FieldTitle:       u.Title,
+		FieldAuthor:      u.Author,
+		FieldPublishing:  u.Publishing,
+		FieldDescription: u.Description,
+		FieldCoverImage:  u.CoverImage,
+		FieldShopName:    u.ShopName,
+	} {
+		if value != nil {
+			metadata[name] = value
+		}
+	}
+	return metadata
 }
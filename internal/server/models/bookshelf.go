@@ -1,20 +1,144 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
 	"time"
 )
 
-// Bookshelf represents a collection of books.
+// Bookshelf represents a collection of books. Bookshelves can be nested, like
+// the shelves of a bookcase in a room, and their names are unique among the
+// bookshelves with the same parent.
+//
+// A bookshelf with a Filter is a smart bookshelf: it holds no books and no
+// other bookshelves, and lists the books of its owner that match the filter.
 type Bookshelf struct {
-	ID        string    `bson:"_id,omitempty" json:"id"`
-	UserID    string    `bson:"user_id" json:"user_id"`
-	Name      string    `bson:"name" json:"name"`
-	CreatedAt time.Time `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+	ID        string       `bson:"_id,omitempty" json:"id"`
+	UserID    string       `bson:"user_id" json:"user_id"`
+	ParentID  string       `bson:"parent_id" json:"parent_id"` // empty for a top-level bookshelf
+	Name      string       `bson:"name" json:"name"`
+	Position  string       `bson:"position" json:"position"` // orders it among the bookshelves with the same parent
+	Filter    *SmartFilter `bson:"filter,omitempty" json:"filter,omitempty"`
+	CreatedAt time.Time    `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time    `bson:"updated_at" json:"updated_at"`
+}
+
+// IsSmart reports whether the books of the bookshelf come from its filter.
+func (b *Bookshelf) IsSmart() bool {
+	return b.Filter != nil
 }
 
 // BookshelfUpdate represents fields that can be updated in a Bookshelf.
 type BookshelfUpdate struct {
-	Name      *string   `bson:"name,omitempty" json:"name,omitempty"` // Optional field for update
-	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+	Name      *string      `bson:"name,omitempty" json:"name,omitempty"`           // Optional field for update
+	ParentID  *string      `bson:"parent_id,omitempty" json:"parent_id,omitempty"` // moves the bookshelf with everything nested in it; empty: to the top level
+	Position  *string      `bson:"position,omitempty" json:"-"`                    // set by the repository: the end of the new parent
+	Filter    *SmartFilter `bson:"filter,omitempty" json:"filter,omitempty"`       // replaces the filter of a smart bookshelf
+	UpdatedAt time.Time    `bson:"updated_at" json:"updated_at"`
+}
+
+// SmartFilter is the saved query of a smart bookshelf. A book matches when it
+// passes every condition that is set.
+type SmartFilter struct {
+	Author          string `bson:"author,omitempty" json:"author,omitempty"`                       // case-insensitive substring
+	AddedWithinDays int    `bson:"added_within_days,omitempty" json:"added_within_days,omitempty"` // added to the library in the last days
+	HasCover        *bool  `bson:"has_cover,omitempty" json:"has_cover,omitempty"`
+	ShopName        string `bson:"shop,omitempty" json:"shop,omitempty"` // exact match
+	Tag             string `bson:"tag,omitempty" json:"tag,omitempty"`   // one of the tags of the book
+}
+
+// UnmarshalJSON rejects unknown conditions, so that a misspelled one does not
+// silently widen the filter.
+func (f *SmartFilter) UnmarshalJSON(data []byte) error {
+	type plain SmartFilter
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode((*plain)(f))
+}
+
+// BookFilter returns the book list filter of the saved query, with the
+// relative dates resolved at now.
+func (f *SmartFilter) BookFilter(now time.Time) BookFilter {
+	filter := BookFilter{
+		Author:   f.Author,
+		ShopName: f.ShopName,
+		HasCover: f.HasCover,
+		Tag:      f.Tag,
+	}
+	if f.AddedWithinDays > 0 {
+		from := now.AddDate(0, 0, -f.AddedWithinDays)
+		filter.CreatedFrom = &from
+	}
+	return filter
+}
+
+// Position is the place of an item in a manually ordered list: its ID and
+// fractional index key.
+type Position struct {
+	ID  string
+	Key string
+}
+
+// Reorder is a request to change the manual order of a list: either the full
+// list of IDs in the new order, or one ID to move before or after another.
+type Reorder struct {
+	IDs    []string `json:"ids,omitempty"`
+	ID     string   `json:"id,omitempty"`
+	Before string   `json:"before,omitempty"`
+	After  string   `json:"after,omitempty"`
+}
+
+// BookshelfMove is a request to nest a bookshelf in another one.
+type BookshelfMove struct {
+	ParentID string `json:"parent_id"` // empty: to the top level
+}
+
+// BookshelfDetails is a bookshelf with its place among the nested
+// bookshelves and the number of books in it.
+type BookshelfDetails struct {
+	Bookshelf
+	Breadcrumbs  []BookshelfRef   `json:"breadcrumbs"`   // the bookshelves it is nested in, outermost first
+	Children     []BookshelfChild `json:"children"`      // the bookshelves nested directly in it
+	Books        int              `json:"books"`         // books on the bookshelf itself
+	SubtreeBooks int              `json:"subtree_books"` // books on it or on any bookshelf nested in it
+}
+
+// BookshelfRef names a bookshelf.
+type BookshelfRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// BookshelfChild is a bookshelf nested in another one, with the number of
+// books on it or on any bookshelf nested in it.
+type BookshelfChild struct {
+	BookshelfRef
+	SubtreeBooks int `json:"subtree_books"`
+}
+
+// BookshelfDeleteMode says what happens to the books on a deleted bookshelf.
+type BookshelfDeleteMode string
+
+// Bookshelf delete modes.
+const (
+	DeleteModeRefuse  BookshelfDeleteMode = "refuse"  // only an empty bookshelf is deleted
+	DeleteModeCascade BookshelfDeleteMode = "cascade" // the books are deleted along with it, unless they are on other bookshelves too
+	DeleteModeMove    BookshelfDeleteMode = "move"    // the books are moved to the target, or unshelved
+)
+
+// BookshelfDeleteOptions are the parameters of a bookshelf deletion.
+type BookshelfDeleteOptions struct {
+	Mode      BookshelfDeleteMode
+	TargetID  string // move: the bookshelf that receives the books; empty unshelves them
+	BookLimit int    // move: the most books the target may hold; zero means no limit
+}
+
+// BookshelfDeleteResult summarizes a bookshelf deletion.
+type BookshelfDeleteResult struct {
+	BookshelfID       string              `json:"bookshelf_id"`
+	Mode              BookshelfDeleteMode `json:"mode"`
+	BooksDeleted      int                 `json:"books_deleted"`
+	BooksMoved        int                 `json:"books_moved"`
+	BooksKept         int                 `json:"books_kept"` // cascade: books that are on other bookshelves too
+	TargetBookshelfID string              `json:"target_bookshelf_id,omitempty"`
 }
@@ -0,0 +1,246 @@
+package models
+
+import (
+	"github.com/getz-devs/librakeeper-server/lib/isbn"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Contributor roles.
+const (
+	RoleAuthor      = "author"
+	RoleTranslator  = "translator"
+	RoleIllustrator = "illustrator"
+	RoleEditor      = "editor"
+)
+
+// CatalogEntry is the canonical, shared record of a book. User books reference
+// it by CatalogID and hold a copy of its metadata, apart from the fields a user
+// has overridden.
+type CatalogEntry struct {
+	ID     string `bson:"_id,omitempty" json:"id"`
+	ISBN10 string `bson:"isbn10,omitempty" json:"isbn10,omitempty"` // empty for 979 ISBNs
+	ISBN13 string `bson:"isbn13" json:"isbn13"`
+
+	Title        string        `bson:"title" json:"title"`
+	Description  string        `bson:"description" json:"description"`
+	CoverImage   string        `bson:"cover_image" json:"cover_image"`
+	Contributors []Contributor `bson:"contributors" json:"contributors"`
+	Editions     []Edition     `bson:"editions" json:"editions"` // the first edition is the default one
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Contributor is a person who worked on a book.
+type Contributor struct {
+	Name string `bson:"name" json:"name"`
+	Role string `bson:"role" json:"role"`
+}
+
+// Edition is a publication of a book as offered by a publisher or shop.
+type Edition struct {
+	Publisher  string `bson:"publisher" json:"publisher"`
+	ShopName   string `bson:"shop_name" json:"shop_name"`
+	CoverImage string `bson:"cover_image,omitempty" json:"cover_image,omitempty"`
+}
+
+// NewCatalogEntry creates a catalog entry from the metadata of a book.
+// Authors separated by commas become separate contributors.
+func NewCatalogEntry(book *Book) *CatalogEntry {
+	isbn13, err := isbn.To13(book.ISBN)
+	if err != nil {
+		isbn13 = isbn.Clean(book.ISBN) // legacy records may hold invalid ISBNs
+	}
+	isbn10, _ := isbn.To10(isbn13)
+
+	entry := &CatalogEntry{
+		ISBN10:       isbn10,
+		ISBN13:       isbn13,
+		Title:        book.Title,
+		Description:  book.Description,
+		CoverImage:   book.CoverImage,
+		Contributors: []Contributor{},
+		Editions:     []Edition{},
+	}
+
+	for _, name := range strings.Split(book.Author, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			entry.Contributors = append(entry.Contributors, Contributor{Name: name, Role: RoleAuthor})
+		}
+	}
+
+	if edition := EditionOf(book); edition != (Edition{}) {
+		entry.Editions = append(entry.Editions, edition)
+	}
+
+	return entry
+}
+
+// EditionOf returns the edition described by a book.
+func EditionOf(book *Book) Edition {
+	return Edition{
+		Publisher:  book.Publishing,
+		ShopName:   book.ShopName,
+		CoverImage: book.CoverImage,
+	}
+}
+
+// Authors returns the names of the authors separated by commas.
+func (e *CatalogEntry) Authors() string {
+	var names []string
+	for _, c := range e.Contributors {
+		if c.Role == RoleAuthor {
+			names = append(names, c.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Book returns the catalog entry in the shape of a book, using its default edition.
+func (e *CatalogEntry) Book() *Book {
+	book := &Book{
+		CatalogID:   e.ID,
+		ISBN:        e.ISBN13,
+		Title:       e.Title,
+		Author:      e.Authors(),
+		Description: e.Description,
+		CoverImage:  e.CoverImage,
+		CreatedAt:   e.CreatedAt,
+		UpdatedAt:   e.UpdatedAt,
+	}
+	if len(e.Editions) > 0 {
+		book.Publishing = e.Editions[0].Publisher
+		book.ShopName = e.Editions[0].ShopName
+	}
+	return book
+}
+
+// Metadata fields of a book that a user may override, by their BSON and
+// JSON name.
+const (
+	FieldTitle       = "title"
+	FieldAuthor      = "author"
+	FieldPublishing  = "publishing"
+	FieldDescription = "description"
+	FieldCoverImage  = "cover_image"
+	FieldShopName    = "shop_name"
+)
+
+// MetadataFields lists the metadata fields of a book.
+var MetadataFields = []string{FieldTitle, FieldAuthor, FieldPublishing, FieldDescription, FieldCoverImage, FieldShopName}
+
+// LinkCatalog links the book to the catalog entry. The fields the book leaves
+// empty or has equal to the catalog values follow the entry; the others, and
+// the ones already overridden, are overrides.
+func (b *Book) LinkCatalog(entry *CatalogEntry) {
+	b.CatalogID = entry.ID
+	for _, f := range b.overridable(entry.Book()) {
+		switch {
+		case b.Overridden(f.name):
+		case *f.own == "" || *f.own == f.catalog:
+			*f.own = f.catalog
+		default:
+			b.Overrides = append(b.Overrides, f.name)
+		}
+	}
+}
+
+// Merge sets the fields the user has not overridden to the values of the
+// catalog entry, e.g. after the entry changed.
+func (b *Book) Merge(entry *CatalogEntry) {
+	b.CatalogID = entry.ID
+	for _, f := range b.overridable(entry.Book()) {
+		if !b.Overridden(f.name) {
+			*f.own = f.catalog
+		}
+	}
+}
+
+// Unlink takes the book off its catalog entry. The fields that followed the
+// entry are cleared; the overridden ones become the book's own.
+func (b *Book) Unlink() {
+	if b.CatalogID == "" {
+		return
+	}
+	for _, f := range b.overridable(&Book{}) {
+		if !b.Overridden(f.name) {
+			*f.own = ""
+		}
+	}
+	b.CatalogID = ""
+	b.Overrides = nil
+}
+
+// Overridden reports whether the user has set a metadata field of the book.
+func (b *Book) Overridden(name string) bool {
+	return slices.Contains(b.Overrides, name)
+}
+
+// ApplyMetadata applies the metadata of an update to the book, linked to the
+// entry or to none when it is nil: a field given overrides the catalog value,
+// even when it is empty, and a field given as null follows the entry again.
+// The publisher and the shop follow it too when they are not given. The book
+// must be linked to the catalog entry it had before the update.
+func (b *Book) ApplyMetadata(update *BookUpdate, entry *CatalogEntry) {
+	if entry == nil || entry.ID != b.CatalogID {
+		b.Unlink()
+		if entry != nil {
+			b.LinkCatalog(entry)
+		}
+	}
+
+	inherit := slices.Clone(update.Inherit)
+	if update.Publishing == nil {
+		inherit = append(inherit, FieldPublishing)
+	}
+	if update.ShopName == nil {
+		inherit = append(inherit, FieldShopName)
+	}
+	b.Overrides = slices.DeleteFunc(slices.Clone(b.Overrides), func(name string) bool {
+		return slices.Contains(inherit, name)
+	})
+	for _, f := range b.overridable(&Book{}) {
+		if slices.Contains(inherit, f.name) {
+			*f.own = ""
+		}
+	}
+
+	metadata := update.Metadata()
+	for _, f := range b.overridable(&Book{}) {
+		value, ok := metadata[f.name]
+		if !ok {
+			continue
+		}
+		*f.own = *value
+		if entry != nil && !b.Overridden(f.name) {
+			b.Overrides = append(b.Overrides, f.name)
+		}
+	}
+
+	if entry != nil {
+		b.Merge(entry)
+	}
+	if len(b.Overrides) == 0 {
+		b.Overrides = nil
+	}
+}
+
+type overridableField struct {
+	name    string
+	own     *string
+	catalog string
+}
+
+// overridable pairs the fields a user may override with their catalog values.
+func (b *Book) overridable(view *Book) []overridableField {
+	return []overridableField{
+		{FieldTitle, &b.Title, view.Title},
+		{FieldAuthor, &b.Author, view.Author},
+		{FieldPublishing, &b.Publishing, view.Publishing},
+		{FieldDescription, &b.Description, view.Description},
+		{FieldCoverImage, &b.CoverImage, view.CoverImage},
+		{FieldShopName, &b.ShopName, view.ShopName},
+	}
+}
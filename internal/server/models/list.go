@@ -0,0 +1,122 @@
+package models
+
+import (
+	"time"
+)
+
+// SortOrder is the direction of a sort.
+type SortOrder int
+
+const (
+	SortAsc  SortOrder = 1
+	SortDesc SortOrder = -1
+)
+
+// Sort fields accepted by list endpoints.
+const (
+	SortByTitle     = "title"
+	SortByAuthor    = "author"
+	SortByName      = "name"
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+	SortByPosition  = "position" // the manual order of a bookshelf or of the bookshelves with the same parent
+)
+
+// BookFilter represents optional filters for book lists.
+type BookFilter struct {
+	Author      string     `json:"author,omitempty"`    // case-insensitive substring
+	Publisher   string     `json:"publisher,omitempty"` // case-insensitive substring
+	ShopName    string     `json:"shop,omitempty"`      // exact match
+	HasCover    *bool      `json:"has_cover,omitempty"`
+	Tag         string     `json:"tag,omitempty"` // one of the tags of the book, exact match
+	CreatedFrom *time.Time `json:"created_from,omitempty"`
+	CreatedTo   *time.Time `json:"created_to,omitempty"`
+}
+
+// CursorPosition is a keyset position in a sorted list: the sort field value
+// and the _id of the boundary item.
+type CursorPosition struct {
+	Value    interface{}
+	ID       string
+	Backward bool // list the items before the position instead of after it
+}
+
+// BookListOptions represents pagination, sorting and filtering of a book list.
+// When Position is set it is used instead of Page.
+type BookListOptions struct {
+	Page     int64
+	Limit    int64
+	Sort     string
+	Order    SortOrder
+	Filter   BookFilter
+	Cursor   string // opaque token from the client
+	Position *CursorPosition
+	// Recursive includes, in a bookshelf list, the books on the bookshelves
+	// nested in it. A book on several of them is listed once.
+	Recursive bool
+	// ShelfFilter is the filter of a smart bookshelf. The books must pass it
+	// as well as Filter.
+	ShelfFilter *BookFilter
+}
+
+// OnBookshelf returns the options for a list of the books on a bookshelf, with
+// a sort by position turned into a sort by the positions on that bookshelf.
+func (o *BookListOptions) OnBookshelf(bookshelfID string) *BookListOptions {
+	if o.Sort != SortByPosition {
+		return o
+	}
+	opts := *o
+	opts.Sort = PositionField(bookshelfID)
+	return &opts
+}
+
+// PositionField is the field of the positions of books on a bookshelf.
+func PositionField(bookshelfID string) string {
+	return "positions." + bookshelfID
+}
+
+// BookshelfListOptions represents pagination and sorting of a bookshelf list.
+// When Position is set it is used instead of Page.
+type BookshelfListOptions struct {
+	ParentID *string // only the bookshelves nested directly in it; empty: the top level
+	Page     int64
+	Limit    int64
+	Sort     string
+	Order    SortOrder
+	Cursor   string // opaque token from the client
+	Position *CursorPosition
+}
+
+// BookPage is a page of books returned by a repository.
+type BookPage struct {
+	Books   []*Book
+	Total   int64 // all books matching the filter
+	HasMore bool  // more books follow in the listing direction
+}
+
+// BookshelfPage is a page of bookshelves returned by a repository.
+type BookshelfPage struct {
+	Bookshelves []*Bookshelf
+	Total       int64 // all bookshelves of the user
+	HasMore     bool  // more bookshelves follow in the listing direction
+}
+
+// PaginatedBookResponse is a page of books.
+type PaginatedBookResponse struct {
+	Books      []*Book `json:"books"`
+	Total      int64   `json:"total"`
+	Page       int64   `json:"page"`
+	Limit      int64   `json:"limit"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	PrevCursor string  `json:"prev_cursor,omitempty"`
+}
+
+// PaginatedBookshelfResponse is a page of bookshelves.
+type PaginatedBookshelfResponse struct {
+	Bookshelves []*Bookshelf `json:"bookshelves"`
+	Total       int64        `json:"total"`
+	Page        int64        `json:"page"`
+	Limit       int64        `json:"limit"`
+	NextCursor  string       `json:"next_cursor,omitempty"`
+	PrevCursor  string       `json:"prev_cursor,omitempty"`
+}
@@ -4,5 +4,6 @@ import searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
 
 type SearchResponse struct {
 	Status searcherv1.SearchByISBNResponse_Status `json:"status"`
+	Reason string                                 `json:"reason,omitempty"` // why a FAILED search failed
 	Books  []*Book                                `json:"books"`
 }
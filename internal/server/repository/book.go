@@ -7,13 +7,35 @@ import (
 
 // BookRepo defines the interface for book repository operations.
 type BookRepo interface {
+	// Create inserts a book and puts it at the end of its bookshelves.
 	Create(ctx context.Context, book *models.Book) error
 	GetByID(ctx context.Context, id string) (*models.Book, error)
 	GetByISBN(ctx context.Context, isbn string) (*models.Book, error)
-	GetByUserID(ctx context.Context, userID string, page int64, limit int64) ([]*models.Book, error)
-	GetByBookshelfID(ctx context.Context, bookshelfID string, page int64, limit int64) ([]*models.Book, error)
+	GetByISBNAndUser(ctx context.Context, isbn, userID string) (*models.Book, error)
+	GetByUserID(ctx context.Context, userID string, opts *models.BookListOptions) (*models.BookPage, error)
+	GetByBookshelfID(ctx context.Context, bookshelfID string, opts *models.BookListOptions) (*models.BookPage, error)
+	// GetByBookshelves returns a page of the books on any of the bookshelves.
+	GetByBookshelves(ctx context.Context, bookshelfIDs []string, opts *models.BookListOptions) (*models.BookPage, error)
 	CountInBookshelf(ctx context.Context, bookshelfID string) (int, error)
 	ExistsInBookshelf(ctx context.Context, isbn, bookshelfID string) (bool, error)
+	// Update sets the fields of a book and applies the shelf changes of the
+	// update like Reshelve, in one transaction: a failing shelf change leaves
+	// the book as it was.
 	Update(ctx context.Context, id string, update *models.BookUpdate) error
+	// SyncCatalog copies the metadata of a catalog entry to the stored books
+	// linked to it, except for the fields their users have overridden, so
+	// lists filter and sort on the new values. Reads merge the entry anyway.
+	SyncCatalog(ctx context.Context, entry *models.CatalogEntry) error
+	// Reshelve applies the shelf changes in order and records them in the
+	// history of the books. A book joining a bookshelf is put at its end.
+	// Either all of them apply or none: a missing book fails with
+	// ErrBookNotFound, an ISBN a bookshelf would hold twice with
+	// ErrBookAlreadyExists.
+	Reshelve(ctx context.Context, changes []models.ShelfChange) error
+	// Positions returns the positions of the books on a bookshelf, in order.
+	Positions(ctx context.Context, bookshelfID string) ([]models.Position, error)
+	// SetPositions sets the positions of books on a bookshelf: book ID -> key.
+	// Books that are no longer on it are skipped.
+	SetPositions(ctx context.Context, bookshelfID string, positions map[string]string) error
 	Delete(ctx context.Context, id string) error
 }
@@ -7,11 +7,36 @@ import (
 
 // BookshelfRepo defines the interface for bookshelf repository operations.
 type BookshelfRepo interface {
+	// Create inserts a bookshelf at the end of the bookshelves with the same parent.
 	Create(ctx context.Context, bookshelf *models.Bookshelf) error
 	GetByID(ctx context.Context, id string) (*models.Bookshelf, error)
-	GetByUser(ctx context.Context, userID string, page int64, limit int64) ([]*models.Bookshelf, error) // Renamed
+	GetByUser(ctx context.Context, userID string, opts *models.BookshelfListOptions) (*models.BookshelfPage, error)
 	CountByUser(ctx context.Context, userID string) (int, error)
-	ExistsByNameAndUser(ctx context.Context, name, userID string) (bool, error)
+	// ExistsByNameAndParent checks if the user has a bookshelf with the name
+	// nested in the parent; an empty parent stands for the top level.
+	ExistsByNameAndParent(ctx context.Context, name, userID, parentID string) (bool, error)
+	// GetSubtree returns the bookshelf and all bookshelves nested in it,
+	// outermost first: by depth, then by _id.
+	GetSubtree(ctx context.Context, id string) ([]*models.Bookshelf, error)
+	// CountBooks returns the number of books on any of the bookshelves.
+	CountBooks(ctx context.Context, ids []string) (int, error)
+	// CountBooksByGroup returns, for every group of bookshelves, the number
+	// of books on any of its bookshelves, in one query.
+	CountBooksByGroup(ctx context.Context, groups map[string][]string) (map[string]int, error)
+	// Update updates a bookshelf; a new parent puts it at the end of the
+	// bookshelves nested in that parent.
 	Update(ctx context.Context, id string, update *models.BookshelfUpdate) error
+	// Positions returns the positions of the bookshelves of a user nested
+	// directly in the parent, in order; an empty parent stands for the top level.
+	Positions(ctx context.Context, userID, parentID string) ([]models.Position, error)
+	// SetPositions sets the positions of bookshelves: bookshelf ID -> key.
+	// Missing bookshelves are skipped.
+	SetPositions(ctx context.Context, positions map[string]string) error
 	Delete(ctx context.Context, id string) error
+	// DeleteWithBooks deletes a bookshelf and, atomically with it, refuses,
+	// deletes or moves its books as the options say. Moving a book to a
+	// bookshelf that holds its ISBN fails with ErrBookAlreadyExists, moving
+	// more than the book limit onto it with ErrBookshelfLimitReached, and a
+	// bookshelf with nested ones is not deleted: ErrBookshelfHasChildren.
+	DeleteWithBooks(ctx context.Context, id string, opts *models.BookshelfDeleteOptions) (*models.BookshelfDeleteResult, error)
 }
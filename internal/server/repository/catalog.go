@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+)
+
+// CatalogRepo defines the interface for catalog repository operations.
+type CatalogRepo interface {
+	Create(ctx context.Context, entry *models.CatalogEntry) error
+	GetByID(ctx context.Context, id string) (*models.CatalogEntry, error)
+	GetByISBN(ctx context.Context, isbn string) (*models.CatalogEntry, error)
+	AddEdition(ctx context.Context, id string, edition models.Edition) error
+}
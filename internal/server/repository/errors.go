@@ -0,0 +1,27 @@
+package repository
+
+import "errors"
+
+// Errors returned by every implementation of the repositories.
+var (
+	// ErrBookNotFound occurs when a book is not found in the database.
+	ErrBookNotFound = errors.New("book not found")
+	// ErrBookAlreadyExists occurs when trying to create a book with an ID that already exists.
+	ErrBookAlreadyExists = errors.New("book already exists")
+
+	// ErrBookshelfNotFound occurs when a bookshelf is not found in the database.
+	ErrBookshelfNotFound = errors.New("bookshelf not found")
+	// ErrBookshelfAlreadyExists occurs when trying to create a bookshelf with an ID that already exists.
+	ErrBookshelfAlreadyExists = errors.New("bookshelf already exists")
+	// ErrBookshelfNotEmpty occurs when refusing to delete a bookshelf that holds books.
+	ErrBookshelfNotEmpty = errors.New("bookshelf is not empty")
+	// ErrBookshelfHasChildren occurs when refusing to delete a bookshelf that other bookshelves are nested in.
+	ErrBookshelfHasChildren = errors.New("bookshelf has nested bookshelves")
+	// ErrBookshelfLimitReached occurs when moving books would put more than the book limit on a bookshelf.
+	ErrBookshelfLimitReached = errors.New("bookshelf has reached the book limit")
+
+	// ErrCatalogEntryNotFound occurs when a catalog entry is not found in the database.
+	ErrCatalogEntryNotFound = errors.New("catalog entry not found")
+	// ErrCatalogEntryAlreadyExists occurs when trying to create a catalog entry for an ISBN that already exists.
+	ErrCatalogEntryAlreadyExists = errors.New("catalog entry already exists")
+)
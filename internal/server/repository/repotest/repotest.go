@@ -0,0 +1,1030 @@
+// Package repotest is a conformance suite for the repository implementations.
+// Every backend runs the same tests, so they agree on not-found errors,
+// duplicate checks, catalog merging, filtering and pagination.
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/lib/fracindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// Repos are the repositories of one backend, sharing one empty database.
+type Repos struct {
+	Books       repository.BookRepo
+	Bookshelves repository.BookshelfRepo
+	Catalog     repository.CatalogRepo
+	// CorrectCatalog overwrites a stored catalog entry behind the back of the
+	// repositories, the way an operator corrects the catalog.
+	CorrectCatalog func(t *testing.T, entry *models.CatalogEntry)
+}
+
+// Factory returns repositories over a fresh, empty database.
+type Factory func(t *testing.T) Repos
+
+// Run runs the whole suite against a backend.
+func Run(t *testing.T, newRepos Factory) {
+	t.Run("BookRepo", func(t *testing.T) { RunBookRepo(t, newRepos) })
+	t.Run("BookshelfRepo", func(t *testing.T) { RunBookshelfRepo(t, newRepos) })
+	t.Run("CatalogRepo", func(t *testing.T) { RunCatalogRepo(t, newRepos) })
+}
+
+func RunBookRepo(t *testing.T, newRepos Factory) {
+	ctx := context.Background()
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repos := newRepos(t)
+		book := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581", Title: "Title", Author: "Author"}
+
+		require.NoError(t, repos.Books.Create(ctx, book))
+		require.NotEmpty(t, book.ID)
+		assert.False(t, book.CreatedAt.IsZero())
+		assert.False(t, book.UpdatedAt.IsZero())
+
+		got, err := repos.Books.GetByID(ctx, book.ID)
+		require.NoError(t, err)
+		assert.Equal(t, book.ID, got.ID)
+		assert.Equal(t, "user1", got.UserID)
+		assert.Equal(t, []string{"shelf1"}, got.BookshelfIDs)
+		assert.Equal(t, "Title", got.Title)
+		assert.WithinDuration(t, book.CreatedAt, got.CreatedAt, time.Millisecond)
+
+		got, err = repos.Books.GetByISBN(ctx, "9785446120581")
+		require.NoError(t, err)
+		assert.Equal(t, book.ID, got.ID)
+
+		got, err = repos.Books.GetByISBNAndUser(ctx, "9785446120581", "user1")
+		require.NoError(t, err)
+		assert.Equal(t, book.ID, got.ID)
+
+		// The returned book is a copy.
+		got.Title = "Changed"
+		got, err = repos.Books.GetByID(ctx, book.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Title", got.Title)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repos := newRepos(t)
+		require.NoError(t, repos.Books.Create(ctx, &models.Book{UserID: "user1", ISBN: "9785446120581"}))
+
+		_, err := repos.Books.GetByID(ctx, "000000000000000000000000")
+		assert.ErrorIs(t, err, repository.ErrBookNotFound)
+		_, err = repos.Books.GetByISBN(ctx, "9780000000002")
+		assert.ErrorIs(t, err, repository.ErrBookNotFound)
+		_, err = repos.Books.GetByISBNAndUser(ctx, "9785446120581", "user2")
+		assert.ErrorIs(t, err, repository.ErrBookNotFound)
+
+		title := "Title"
+		err = repos.Books.Update(ctx, "000000000000000000000000", &models.BookUpdate{Title: &title})
+		assert.ErrorIs(t, err, repository.ErrBookNotFound)
+		err = repos.Books.Delete(ctx, "000000000000000000000000")
+		assert.ErrorIs(t, err, repository.ErrBookNotFound)
+	})
+
+	t.Run("SyncCatalog", func(t *testing.T) {
+		repos := newRepos(t)
+		entry := &models.CatalogEntry{
+			ISBN13:       "9785446120581",
+			Title:        "Catalog Title",
+			Description:  "Catalog Description",
+			Contributors: []models.Contributor{{Name: "First", Role: models.RoleAuthor}, {Name: "Second", Role: models.RoleAuthor}, {Name: "Editor", Role: models.RoleEditor}},
+			Editions:     []models.Edition{},
+		}
+		require.NoError(t, repos.Catalog.Create(ctx, entry))
+
+		book := &models.Book{UserID: "user1", ISBN: "9785446120581", Title: "Own Title", ShopName: "Own Shop"}
+		book.LinkCatalog(entry)
+		require.NoError(t, repos.Books.Create(ctx, book))
+		other := &models.Book{UserID: "user2", ISBN: "9785446120581"}
+		other.LinkCatalog(entry)
+		require.NoError(t, repos.Books.Create(ctx, other))
+		require.NoError(t, repos.Books.Create(ctx, &models.Book{UserID: "user3", ISBN: "9785446120581", Title: "Unlinked"}))
+
+		got, err := repos.Books.GetByID(ctx, book.ID)
+		require.NoError(t, err)
+		assert.Equal(t, entry.ID, got.CatalogID)
+		assert.Equal(t, []string{models.FieldTitle, models.FieldShopName}, got.Overrides)
+		assert.Equal(t, "Own Title", got.Title)
+		assert.Equal(t, "First, Second", got.Author)
+		assert.Equal(t, "Catalog Description", got.Description)
+
+		page, err := repos.Books.GetByUserID(ctx, "user1", &models.BookListOptions{
+			Page: 1, Limit: 10, Sort: models.SortByAuthor, Order: models.SortAsc,
+			Filter: models.BookFilter{Author: "second"},
+		})
+		require.NoError(t, err)
+		require.Len(t, page.Books, 1, "filters see the catalog values")
+
+		// The first edition fills the publisher and the shop of the books
+		// that follow the entry.
+		require.NoError(t, repos.Catalog.AddEdition(ctx, entry.ID, models.Edition{Publisher: "Publisher", ShopName: "Shop"}))
+		entry, err = repos.Catalog.GetByID(ctx, entry.ID)
+		require.NoError(t, err)
+		require.NoError(t, repos.Books.SyncCatalog(ctx, entry))
+
+		got, err = repos.Books.GetByID(ctx, book.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Own Title", got.Title)
+		assert.Equal(t, "Publisher", got.Publishing)
+		assert.Equal(t, "Own Shop", got.ShopName, "overrides are kept")
+
+		got, err = repos.Books.GetByID(ctx, other.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Catalog Title", got.Title)
+		assert.Equal(t, "Publisher", got.Publishing)
+		assert.Equal(t, "Shop", got.ShopName)
+
+		got, err = repos.Books.GetByISBNAndUser(ctx, "9785446120581", "user3")
+		require.NoError(t, err)
+		assert.Empty(t, got.Publishing, "unlinked books are left alone")
+	})
+
+	t.Run("MergesCatalogCorrections", func(t *testing.T) {
+		repos := newRepos(t)
+		entry := &models.CatalogEntry{
+			ISBN13:       "9785446120581",
+			Title:        "Catalog Title",
+			Contributors: []models.Contributor{{Name: "Author", Role: models.RoleAuthor}},
+			Editions:     []models.Edition{{Publisher: "Publisher"}},
+		}
+		require.NoError(t, repos.Catalog.Create(ctx, entry))
+		book := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581", Author: "Own Author"}
+		book.LinkCatalog(entry)
+		require.NoError(t, repos.Books.Create(ctx, book))
+
+		entry.Title = "Corrected Title"
+		entry.Contributors[0].Name = "Corrected Author"
+		entry.Editions[0].Publisher = "Corrected Publisher"
+		repos.CorrectCatalog(t, entry)
+
+		check := func(got *models.Book) {
+			t.Helper()
+			assert.Equal(t, "Corrected Title", got.Title)
+			assert.Equal(t, "Corrected Publisher", got.Publishing)
+			assert.Equal(t, "Own Author", got.Author, "overrides are kept")
+		}
+		got, err := repos.Books.GetByID(ctx, book.ID)
+		require.NoError(t, err)
+		check(got)
+		got, err = repos.Books.GetByISBNAndUser(ctx, "9785446120581", "user1")
+		require.NoError(t, err)
+		check(got)
+		opts := &models.BookListOptions{Page: 1, Limit: 10, Sort: models.SortByTitle, Order: models.SortAsc}
+		page, err := repos.Books.GetByUserID(ctx, "user1", opts)
+		require.NoError(t, err)
+		require.Len(t, page.Books, 1)
+		check(page.Books[0])
+		page, err = repos.Books.GetByBookshelfID(ctx, "shelf1", opts)
+		require.NoError(t, err)
+		require.Len(t, page.Books, 1)
+		check(page.Books[0])
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		repos := newRepos(t)
+		hasCover := true
+		noCover := false
+		create(t, repos.Books,
+			&models.Book{UserID: "user1", Title: "A", Author: "Leo Tolstoy", Publishing: "Penguin", ShopName: "Shop A", CoverImage: "a.jpg", Tags: []string{"classic", "russian"}},
+			&models.Book{UserID: "user1", Title: "B", Author: "Fyodor Dostoevsky", Publishing: "Penguin Classics", ShopName: "Shop B", Tags: []string{"russian"}},
+			&models.Book{UserID: "user1", Title: "C", Author: "Anton Chekhov", Publishing: "Vintage", ShopName: "Shop A"},
+			&models.Book{UserID: "user2", Title: "D", Author: "Leo Tolstoy"},
+		)
+
+		tests := []struct {
+			name   string
+			filter models.BookFilter
+			want   []string
+		}{
+			{"None", models.BookFilter{}, []string{"A", "B", "C"}},
+			{"Author", models.BookFilter{Author: "TOLSTOY"}, []string{"A"}},
+			{"Publisher", models.BookFilter{Publisher: "penguin"}, []string{"A", "B"}},
+			{"Shop", models.BookFilter{ShopName: "Shop A"}, []string{"A", "C"}},
+			{"ShopIsExact", models.BookFilter{ShopName: "Shop"}, nil},
+			{"HasCover", models.BookFilter{HasCover: &hasCover}, []string{"A"}},
+			{"NoCover", models.BookFilter{HasCover: &noCover}, []string{"B", "C"}},
+			{"RegexIsQuoted", models.BookFilter{Author: "Leo.*"}, nil},
+			{"Tag", models.BookFilter{Tag: "russian"}, []string{"A", "B"}},
+			{"TagIsExact", models.BookFilter{Tag: "Russian"}, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := repos.Books.GetByUserID(ctx, "user1", &models.BookListOptions{
+					Page: 1, Limit: 10, Sort: models.SortByTitle, Order: models.SortAsc, Filter: tt.filter,
+				})
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, titles(page.Books))
+				assert.EqualValues(t, len(tt.want), page.Total)
+			})
+		}
+
+		t.Run("ShelfFilter", func(t *testing.T) {
+			// The filter of a smart bookshelf and the list filter both apply,
+			// even when they set the same condition.
+			page, err := repos.Books.GetByUserID(ctx, "user1", &models.BookListOptions{
+				Page: 1, Limit: 10, Sort: models.SortByTitle, Order: models.SortAsc,
+				ShelfFilter: &models.BookFilter{Tag: "russian"},
+				Filter:      models.BookFilter{Author: "dostoevsky"},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"B"}, titles(page.Books))
+			assert.EqualValues(t, 1, page.Total)
+
+			page, err = repos.Books.GetByUserID(ctx, "user1", &models.BookListOptions{
+				Page: 1, Limit: 10, Sort: models.SortByTitle, Order: models.SortAsc,
+				ShelfFilter: &models.BookFilter{ShopName: "Shop A"},
+				Filter:      models.BookFilter{ShopName: "Shop B"},
+			})
+			require.NoError(t, err)
+			assert.Empty(t, page.Books)
+		})
+	})
+
+	t.Run("OffsetPagination", func(t *testing.T) {
+		repos := newRepos(t)
+		for _, title := range []string{"E", "C", "A", "D", "B"} {
+			create(t, repos.Books, &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, Title: title})
+		}
+
+		opts := &models.BookListOptions{Page: 1, Limit: 2, Sort: models.SortByTitle, Order: models.SortAsc}
+		page, err := repos.Books.GetByUserID(ctx, "user1", opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"A", "B"}, titles(page.Books))
+		assert.EqualValues(t, 5, page.Total)
+		assert.True(t, page.HasMore)
+
+		opts.Page = 3
+		page, err = repos.Books.GetByUserID(ctx, "user1", opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"E"}, titles(page.Books))
+		assert.False(t, page.HasMore)
+
+		opts.Page = 4
+		page, err = repos.Books.GetByUserID(ctx, "user1", opts)
+		require.NoError(t, err)
+		assert.Empty(t, page.Books)
+		assert.NotNil(t, page.Books)
+		assert.EqualValues(t, 5, page.Total)
+
+		page, err = repos.Books.GetByBookshelfID(ctx, "shelf1", &models.BookListOptions{
+			Page: 1, Limit: 3, Sort: models.SortByTitle, Order: models.SortDesc,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"E", "D", "C"}, titles(page.Books))
+		assert.True(t, page.HasMore)
+	})
+
+	t.Run("KeysetPagination", func(t *testing.T) {
+		repos := newRepos(t)
+		for _, title := range []string{"A", "B", "B", "C", "D"} {
+			create(t, repos.Books, &models.Book{UserID: "user1", Title: title})
+		}
+		all, err := repos.Books.GetByUserID(ctx, "user1", &models.BookListOptions{
+			Page: 1, Limit: 10, Sort: models.SortByTitle, Order: models.SortAsc,
+		})
+		require.NoError(t, err)
+		require.Len(t, all.Books, 5)
+
+		// After the first B, ties are broken by _id.
+		after := all.Books[1]
+		page, err := repos.Books.GetByUserID(ctx, "user1", &models.BookListOptions{
+			Limit: 2, Sort: models.SortByTitle, Order: models.SortAsc,
+			Position: &models.CursorPosition{Value: after.Title, ID: after.ID},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, ids(all.Books[2:4]), ids(page.Books))
+		assert.True(t, page.HasMore)
+		assert.EqualValues(t, 5, page.Total)
+
+		before := all.Books[3]
+		page, err = repos.Books.GetByUserID(ctx, "user1", &models.BookListOptions{
+			Limit: 2, Sort: models.SortByTitle, Order: models.SortAsc,
+			Position: &models.CursorPosition{Value: before.Title, ID: before.ID, Backward: true},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, ids(all.Books[1:3]), ids(page.Books), "backward pages keep the listing order")
+		assert.True(t, page.HasMore)
+
+		last := all.Books[4]
+		page, err = repos.Books.GetByUserID(ctx, "user1", &models.BookListOptions{
+			Limit: 2, Sort: models.SortByTitle, Order: models.SortAsc,
+			Position: &models.CursorPosition{Value: last.Title, ID: last.ID},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, page.Books)
+		assert.False(t, page.HasMore)
+
+		// Timestamps seek by time.
+		page, err = repos.Books.GetByUserID(ctx, "user1", &models.BookListOptions{
+			Limit: 10, Sort: models.SortByCreatedAt, Order: models.SortDesc,
+			Position: &models.CursorPosition{Value: all.Books[0].CreatedAt.Add(-time.Hour), ID: ""},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, page.Books)
+	})
+
+	t.Run("Bookshelves", func(t *testing.T) {
+		repos := newRepos(t)
+		create(t, repos.Books,
+			&models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581"},
+			&models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785171183660"},
+			&models.Book{UserID: "user1", BookshelfIDs: []string{"shelf2"}, ISBN: "9785446120581"},
+			&models.Book{UserID: "user1", BookshelfIDs: []string{"shelf2", "shelf1"}, ISBN: "9780306406157"},
+			&models.Book{UserID: "user1", ISBN: "9785171183660"},
+		)
+
+		count, err := repos.Books.CountInBookshelf(ctx, "shelf1")
+		require.NoError(t, err)
+		assert.Equal(t, 3, count, "a book on several bookshelves counts on each")
+		count, err = repos.Books.CountInBookshelf(ctx, "shelf3")
+		require.NoError(t, err)
+		assert.Zero(t, count)
+
+		exists, err := repos.Books.ExistsInBookshelf(ctx, "9785171183660", "shelf1")
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = repos.Books.ExistsInBookshelf(ctx, "9785171183660", "shelf2")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		exists, err = repos.Books.ExistsInBookshelf(ctx, "9780306406157", "shelf1")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		page, err := repos.Books.GetByBookshelfID(ctx, "shelf2", listAll())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"9785446120581", "9780306406157"}, isbns(page.Books))
+		page, err = repos.Books.GetByBookshelves(ctx, []string{"shelf2", "shelf3"}, listAll())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"9785446120581", "9780306406157"}, isbns(page.Books))
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repos := newRepos(t)
+		book := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581", Title: "Old", Author: "Author", Description: "Description", Publishing: "Publisher", ShopName: "Shop"}
+		create(t, repos.Books, book)
+
+		title := "New"
+		publishing := "New Publisher"
+		shop := "New Shop"
+		tags := []string{"fiction"}
+		require.NoError(t, repos.Books.Update(ctx, book.ID, &models.BookUpdate{
+			Title: &title, Publishing: &publishing, ShopName: &shop, Tags: &tags,
+		}))
+
+		got, err := repos.Books.GetByID(ctx, book.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "New", got.Title)
+		assert.Equal(t, []string{"shelf1"}, got.BookshelfIDs)
+		assert.Equal(t, "New Publisher", got.Publishing)
+		assert.Equal(t, "New Shop", got.ShopName)
+		assert.Equal(t, []string{"fiction"}, got.Tags)
+		assert.Equal(t, "Author", got.Author, "fields that are not set are kept")
+		assert.Equal(t, "Description", got.Description)
+		assert.Equal(t, "9785446120581", got.ISBN)
+		assert.False(t, got.UpdatedAt.Before(got.CreatedAt))
+	})
+
+	t.Run("UpdateWithShelves", func(t *testing.T) {
+		repos := newRepos(t)
+		book := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581", Title: "Old"}
+		other := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf3"}, ISBN: "9785171183660"}
+		create(t, repos.Books, book, other)
+
+		title := "New"
+		require.NoError(t, repos.Books.Update(ctx, book.ID, &models.BookUpdate{
+			Title: &title, Shelves: []models.ShelfChange{{BookID: book.ID, From: "shelf1", To: "shelf2"}},
+		}))
+		got, err := repos.Books.GetByID(ctx, book.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "New", got.Title)
+		assert.Equal(t, []string{"shelf2"}, got.BookshelfIDs)
+		require.Len(t, got.History, 1)
+		assert.NotEmpty(t, got.Positions["shelf2"])
+
+		// The new ISBN is already on shelf3, so nothing is written.
+		title, isbn := "Newer", "9785171183660"
+		err = repos.Books.Update(ctx, book.ID, &models.BookUpdate{
+			Title: &title, ISBN: &isbn, Shelves: []models.ShelfChange{{BookID: book.ID, To: "shelf3"}},
+		})
+		assert.ErrorIs(t, err, repository.ErrBookAlreadyExists)
+		got, err = repos.Books.GetByID(ctx, book.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "New", got.Title)
+		assert.Equal(t, "9785446120581", got.ISBN)
+		assert.Equal(t, []string{"shelf2"}, got.BookshelfIDs)
+		assert.Len(t, got.History, 1)
+	})
+
+	t.Run("Reshelve", func(t *testing.T) {
+		repos := newRepos(t)
+		a := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581"}
+		b := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785171183660"}
+		c := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf2"}, ISBN: "9785171183660"}
+		d := &models.Book{UserID: "user1"}
+		create(t, repos.Books, a, b, c, d)
+
+		require.NoError(t, repos.Books.Reshelve(ctx, []models.ShelfChange{
+			{BookID: a.ID, From: "shelf1", To: "shelf2"},
+			{BookID: d.ID, To: "shelf2"},
+			{BookID: d.ID, To: "shelf3"},
+			{BookID: b.ID, From: "shelf3"}, // not on it: nothing to record
+		}))
+		page, err := repos.Books.GetByBookshelfID(ctx, "shelf2", listAll())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{a.ID, c.ID, d.ID}, ids(page.Books))
+
+		got, err := repos.Books.GetByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"shelf2"}, got.BookshelfIDs)
+		require.Len(t, got.History, 1)
+		assert.Equal(t, models.BookEvent{Type: models.BookEventMoved, FromBookshelfID: "shelf1", ToBookshelfID: "shelf2", At: got.History[0].At}, got.History[0])
+		assert.False(t, got.History[0].At.Before(got.CreatedAt))
+		assert.Equal(t, got.History[0].At, got.UpdatedAt)
+
+		got, err = repos.Books.GetByID(ctx, d.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"shelf2", "shelf3"}, got.BookshelfIDs)
+		require.Len(t, got.History, 2)
+		assert.Equal(t, models.BookEventAdded, got.History[0].Type)
+		assert.Equal(t, "shelf3", got.History[1].ToBookshelfID)
+
+		got, err = repos.Books.GetByID(ctx, b.ID)
+		require.NoError(t, err)
+		assert.Empty(t, got.History)
+
+		require.NoError(t, repos.Books.Reshelve(ctx, []models.ShelfChange{{BookID: d.ID, From: "shelf2"}}), "a book can leave a bookshelf")
+		got, err = repos.Books.GetByID(ctx, d.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"shelf3"}, got.BookshelfIDs)
+		require.Len(t, got.History, 3)
+		assert.Equal(t, models.BookEvent{Type: models.BookEventRemoved, FromBookshelfID: "shelf2", At: got.History[2].At}, got.History[2])
+	})
+
+	t.Run("ReshelveConflict", func(t *testing.T) {
+		repos := newRepos(t)
+		a := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581"}
+		b := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785171183660"}
+		c := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf2"}, ISBN: "9785171183660"}
+		d := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf3"}, ISBN: "9785446120581"}
+		create(t, repos.Books, a, b, c, d)
+
+		err := repos.Books.Reshelve(ctx, []models.ShelfChange{{BookID: a.ID, From: "shelf1", To: "shelf2"}, {BookID: b.ID, From: "shelf1", To: "shelf2"}})
+		assert.ErrorIs(t, err, repository.ErrBookAlreadyExists)
+		err = repos.Books.Reshelve(ctx, []models.ShelfChange{{BookID: a.ID, To: "shelf2"}, {BookID: d.ID, To: "shelf2"}})
+		assert.ErrorIs(t, err, repository.ErrBookAlreadyExists, "two books with one ISBN cannot share the bookshelf")
+		err = repos.Books.Reshelve(ctx, []models.ShelfChange{{BookID: a.ID, To: "shelf2"}, {BookID: "missing", To: "shelf2"}})
+		assert.ErrorIs(t, err, repository.ErrBookNotFound)
+
+		count, err := repos.Books.CountInBookshelf(ctx, "shelf1")
+		require.NoError(t, err)
+		assert.Equal(t, 2, count, "nothing is moved")
+		count, err = repos.Books.CountInBookshelf(ctx, "shelf2")
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		got, err := repos.Books.GetByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Empty(t, got.History)
+
+		err = repos.Books.Reshelve(ctx, []models.ShelfChange{{BookID: a.ID, From: "shelf1"}, {BookID: d.ID, From: "shelf3"}})
+		require.NoError(t, err, "books without a bookshelf may share an ISBN")
+	})
+
+	t.Run("Positions", func(t *testing.T) {
+		repos := newRepos(t)
+		a := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, Title: "A"}
+		b := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1", "shelf2"}, Title: "B"}
+		c := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf2"}, Title: "C"}
+		create(t, repos.Books, a, b, c)
+
+		positions, err := repos.Books.Positions(ctx, "shelf1")
+		require.NoError(t, err)
+		require.Equal(t, []string{a.ID, b.ID}, positionIDs(positions), "new books go to the end")
+		assert.Less(t, positions[0].Key, positions[1].Key)
+
+		require.NoError(t, repos.Books.Reshelve(ctx, []models.ShelfChange{{BookID: c.ID, From: "shelf2", To: "shelf1"}}))
+		positions, err = repos.Books.Positions(ctx, "shelf1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{a.ID, b.ID, c.ID}, positionIDs(positions), "moved books go to the end")
+
+		first, err := fracindex.Between("", positions[0].Key)
+		require.NoError(t, err)
+		require.NoError(t, repos.Books.SetPositions(ctx, "shelf1", map[string]string{c.ID: first}))
+		require.NoError(t, repos.Books.SetPositions(ctx, "shelf2", map[string]string{a.ID: first}), "books off the bookshelf are skipped")
+		positions, err = repos.Books.Positions(ctx, "shelf2")
+		require.NoError(t, err)
+		assert.Equal(t, []string{b.ID}, positionIDs(positions))
+
+		opts := &models.BookListOptions{Page: 1, Limit: 10, Sort: models.SortByPosition, Order: models.SortAsc}
+		page, err := repos.Books.GetByBookshelfID(ctx, "shelf1", opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"C", "A", "B"}, titles(page.Books))
+
+		got, err := repos.Books.GetByID(ctx, a.ID)
+		require.NoError(t, err)
+		page, err = repos.Books.GetByBookshelfID(ctx, "shelf1", &models.BookListOptions{
+			Limit: 10, Sort: models.SortByPosition, Order: models.SortAsc,
+			Position: &models.CursorPosition{Value: got.Positions["shelf1"], ID: got.ID},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"B"}, titles(page.Books), "positions seek like other sort fields")
+
+		require.NoError(t, repos.Books.Reshelve(ctx, []models.ShelfChange{{BookID: a.ID, From: "shelf1"}}))
+		got, err = repos.Books.GetByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.NotContains(t, got.Positions, "shelf1", "a book leaving a bookshelf loses its position there")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repos := newRepos(t)
+		book := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}}
+		create(t, repos.Books, book)
+
+		require.NoError(t, repos.Books.Delete(ctx, book.ID))
+		_, err := repos.Books.GetByID(ctx, book.ID)
+		assert.ErrorIs(t, err, repository.ErrBookNotFound)
+		assert.ErrorIs(t, repos.Books.Delete(ctx, book.ID), repository.ErrBookNotFound)
+
+		page, err := repos.Books.GetByUserID(ctx, "user1", listAll())
+		require.NoError(t, err)
+		assert.Empty(t, page.Books)
+	})
+}
+
+func RunBookshelfRepo(t *testing.T, newRepos Factory) {
+	ctx := context.Background()
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repos := newRepos(t)
+		shelf := &models.Bookshelf{UserID: "user1", Name: "Fiction"}
+		require.NoError(t, repos.Bookshelves.Create(ctx, shelf))
+		require.NotEmpty(t, shelf.ID)
+		assert.False(t, shelf.CreatedAt.IsZero())
+
+		got, err := repos.Bookshelves.GetByID(ctx, shelf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Fiction", got.Name)
+		assert.Equal(t, "user1", got.UserID)
+		assert.WithinDuration(t, shelf.CreatedAt, got.CreatedAt, time.Millisecond)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repos := newRepos(t)
+		_, err := repos.Bookshelves.GetByID(ctx, "000000000000000000000000")
+		assert.ErrorIs(t, err, repository.ErrBookshelfNotFound)
+
+		name := "Name"
+		err = repos.Bookshelves.Update(ctx, "000000000000000000000000", &models.BookshelfUpdate{Name: &name})
+		assert.ErrorIs(t, err, repository.ErrBookshelfNotFound)
+		err = repos.Bookshelves.Delete(ctx, "000000000000000000000000")
+		assert.ErrorIs(t, err, repository.ErrBookshelfNotFound)
+	})
+
+	t.Run("Exists", func(t *testing.T) {
+		repos := newRepos(t)
+		require.NoError(t, repos.Bookshelves.Create(ctx, &models.Bookshelf{UserID: "user1", Name: "Fiction"}))
+
+		exists, err := repos.Bookshelves.ExistsByNameAndParent(ctx, "Fiction", "user1", "")
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = repos.Bookshelves.ExistsByNameAndParent(ctx, "Fiction", "user2", "")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		exists, err = repos.Bookshelves.ExistsByNameAndParent(ctx, "fiction", "user1", "")
+		require.NoError(t, err)
+		assert.False(t, exists, "names are case-sensitive")
+		exists, err = repos.Bookshelves.ExistsByNameAndParent(ctx, "Fiction", "user1", "000000000000000000000000")
+		require.NoError(t, err)
+		assert.False(t, exists, "names are unique per parent")
+	})
+
+	t.Run("Nesting", func(t *testing.T) {
+		repos := newRepos(t)
+		newShelf := func(name, parentID string) *models.Bookshelf {
+			shelf := &models.Bookshelf{UserID: "user1", ParentID: parentID, Name: name}
+			require.NoError(t, repos.Bookshelves.Create(ctx, shelf))
+			return shelf
+		}
+		room := newShelf("Room", "")
+		bookcase := newShelf("Bookcase", room.ID)
+		top := newShelf("Top", bookcase.ID)
+		bottom := newShelf("Bottom", bookcase.ID)
+		newShelf("Hall", "")
+		create(t, repos.Books,
+			&models.Book{UserID: "user1", BookshelfIDs: []string{top.ID}, ISBN: "9785446120581"},
+			&models.Book{UserID: "user1", BookshelfIDs: []string{top.ID, bottom.ID}, ISBN: "9785171183660"},
+			&models.Book{UserID: "user1", BookshelfIDs: []string{bottom.ID}, ISBN: "9780306406157"},
+			&models.Book{UserID: "user1", ISBN: "9785446120581"},
+		)
+
+		got, err := repos.Bookshelves.GetByID(ctx, top.ID)
+		require.NoError(t, err)
+		assert.Equal(t, bookcase.ID, got.ParentID)
+		exists, err := repos.Bookshelves.ExistsByNameAndParent(ctx, "Top", "user1", bookcase.ID)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		subtree, err := repos.Bookshelves.GetSubtree(ctx, room.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Room", "Bookcase", "Top", "Bottom"}, names(subtree), "outermost first, then by _id")
+		_, err = repos.Bookshelves.GetSubtree(ctx, "000000000000000000000000")
+		assert.ErrorIs(t, err, repository.ErrBookshelfNotFound)
+
+		count, err := repos.Bookshelves.CountBooks(ctx, []string{room.ID, bookcase.ID, top.ID, bottom.ID})
+		require.NoError(t, err)
+		assert.Equal(t, 3, count, "a book on several bookshelves counts once")
+		counts, err := repos.Bookshelves.CountBooksByGroup(ctx, map[string][]string{
+			"bookcase": {bookcase.ID, top.ID, bottom.ID},
+			"top":      {top.ID},
+			"room":     {room.ID},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"bookcase": 3, "top": 2, "room": 0}, counts, "a book counts once per group")
+		page, err := repos.Books.GetByBookshelves(ctx, []string{top.ID, bottom.ID}, listAll())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"9785446120581", "9785171183660", "9780306406157"}, isbns(page.Books))
+
+		_, err = repos.Bookshelves.DeleteWithBooks(ctx, bookcase.ID, &models.BookshelfDeleteOptions{Mode: models.DeleteModeCascade})
+		assert.ErrorIs(t, err, repository.ErrBookshelfHasChildren)
+
+		parent := ""
+		require.NoError(t, repos.Bookshelves.Update(ctx, bottom.ID, &models.BookshelfUpdate{ParentID: &parent}))
+		subtree, err = repos.Bookshelves.GetSubtree(ctx, room.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Room", "Bookcase", "Top"}, names(subtree), "the bookshelf was moved to the top level")
+		got, err = repos.Bookshelves.GetByID(ctx, bottom.ID)
+		require.NoError(t, err)
+		assert.Empty(t, got.ParentID)
+		assert.Equal(t, "Bottom", got.Name)
+	})
+
+	t.Run("GetByUser", func(t *testing.T) {
+		repos := newRepos(t)
+		for _, name := range []string{"C", "A", "B"} {
+			require.NoError(t, repos.Bookshelves.Create(ctx, &models.Bookshelf{UserID: "user1", Name: name}))
+		}
+		require.NoError(t, repos.Bookshelves.Create(ctx, &models.Bookshelf{UserID: "user2", Name: "D"}))
+
+		count, err := repos.Bookshelves.CountByUser(ctx, "user1")
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+
+		page, err := repos.Bookshelves.GetByUser(ctx, "user1", &models.BookshelfListOptions{
+			Page: 1, Limit: 2, Sort: models.SortByName, Order: models.SortAsc,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"A", "B"}, names(page.Bookshelves))
+		assert.EqualValues(t, 3, page.Total)
+		assert.True(t, page.HasMore)
+
+		last := page.Bookshelves[1]
+		page, err = repos.Bookshelves.GetByUser(ctx, "user1", &models.BookshelfListOptions{
+			Limit: 2, Sort: models.SortByName, Order: models.SortAsc,
+			Position: &models.CursorPosition{Value: last.Name, ID: last.ID},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"C"}, names(page.Bookshelves))
+		assert.False(t, page.HasMore)
+
+		page, err = repos.Bookshelves.GetByUser(ctx, "nobody", &models.BookshelfListOptions{
+			Page: 1, Limit: 2, Sort: models.SortByName, Order: models.SortAsc,
+		})
+		require.NoError(t, err)
+		assert.NotNil(t, page.Bookshelves)
+		assert.Empty(t, page.Bookshelves)
+		assert.Zero(t, page.Total)
+	})
+
+	t.Run("Positions", func(t *testing.T) {
+		repos := newRepos(t)
+		a := &models.Bookshelf{UserID: "user1", Name: "A"}
+		b := &models.Bookshelf{UserID: "user1", Name: "B"}
+		require.NoError(t, repos.Bookshelves.Create(ctx, a))
+		require.NoError(t, repos.Bookshelves.Create(ctx, b))
+		c := &models.Bookshelf{UserID: "user1", ParentID: a.ID, Name: "C"}
+		require.NoError(t, repos.Bookshelves.Create(ctx, c))
+		require.NoError(t, repos.Bookshelves.Create(ctx, &models.Bookshelf{UserID: "user2", Name: "D"}))
+
+		positions, err := repos.Bookshelves.Positions(ctx, "user1", "")
+		require.NoError(t, err)
+		require.Equal(t, []string{a.ID, b.ID}, positionIDs(positions), "new bookshelves go to the end")
+		positions, err = repos.Bookshelves.Positions(ctx, "user1", a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{c.ID}, positionIDs(positions))
+
+		first, err := fracindex.Between("", a.Position)
+		require.NoError(t, err)
+		require.NoError(t, repos.Bookshelves.SetPositions(ctx, map[string]string{b.ID: first}))
+
+		top := ""
+		opts := &models.BookshelfListOptions{ParentID: &top, Page: 1, Limit: 10, Sort: models.SortByPosition, Order: models.SortAsc}
+		page, err := repos.Bookshelves.GetByUser(ctx, "user1", opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"B", "A"}, names(page.Bookshelves))
+		assert.EqualValues(t, 2, page.Total, "only the bookshelves with the parent are listed")
+
+		require.NoError(t, repos.Bookshelves.Update(ctx, c.ID, &models.BookshelfUpdate{ParentID: &top}))
+		page, err = repos.Bookshelves.GetByUser(ctx, "user1", opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"B", "A", "C"}, names(page.Bookshelves), "a moved bookshelf goes to the end of its new parent")
+	})
+
+	t.Run("UpdateAndDelete", func(t *testing.T) {
+		repos := newRepos(t)
+		shelf := &models.Bookshelf{UserID: "user1", Name: "Old"}
+		require.NoError(t, repos.Bookshelves.Create(ctx, shelf))
+
+		name := "New"
+		require.NoError(t, repos.Bookshelves.Update(ctx, shelf.ID, &models.BookshelfUpdate{Name: &name}))
+		got, err := repos.Bookshelves.GetByID(ctx, shelf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "New", got.Name)
+
+		require.NoError(t, repos.Bookshelves.Update(ctx, shelf.ID, &models.BookshelfUpdate{}))
+		got, err = repos.Bookshelves.GetByID(ctx, shelf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "New", got.Name, "a missing name is kept")
+
+		require.NoError(t, repos.Bookshelves.Delete(ctx, shelf.ID))
+		_, err = repos.Bookshelves.GetByID(ctx, shelf.ID)
+		assert.ErrorIs(t, err, repository.ErrBookshelfNotFound)
+	})
+
+	t.Run("SmartFilter", func(t *testing.T) {
+		repos := newRepos(t)
+		noCover := false
+		smart := &models.Bookshelf{UserID: "user1", Name: "To photograph", Filter: &models.SmartFilter{HasCover: &noCover, AddedWithinDays: 30}}
+		require.NoError(t, repos.Bookshelves.Create(ctx, smart))
+		plain := &models.Bookshelf{UserID: "user1", Name: "Plain"}
+		require.NoError(t, repos.Bookshelves.Create(ctx, plain))
+
+		got, err := repos.Bookshelves.GetByID(ctx, smart.ID)
+		require.NoError(t, err)
+		require.True(t, got.IsSmart())
+		assert.Equal(t, models.SmartFilter{HasCover: &noCover, AddedWithinDays: 30}, *got.Filter)
+		got, err = repos.Bookshelves.GetByID(ctx, plain.ID)
+		require.NoError(t, err)
+		assert.False(t, got.IsSmart())
+
+		require.NoError(t, repos.Bookshelves.Update(ctx, smart.ID, &models.BookshelfUpdate{Filter: &models.SmartFilter{Tag: "gift"}}))
+		got, err = repos.Bookshelves.GetByID(ctx, smart.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.SmartFilter{Tag: "gift"}, *got.Filter, "the filter is replaced as a whole")
+
+		page, err := repos.Bookshelves.GetByUser(ctx, "user1", &models.BookshelfListOptions{
+			Page: 1, Limit: 10, Sort: models.SortByName, Order: models.SortAsc,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Plain", "To photograph"}, names(page.Bookshelves), "smart bookshelves are listed with the others")
+	})
+
+	t.Run("DeleteWithBooks", func(t *testing.T) {
+		// newShelf creates a bookshelf holding a book with each ISBN.
+		shelves := 0
+		newShelf := func(t *testing.T, repos Repos, isbns ...string) *models.Bookshelf {
+			shelves++
+			shelf := &models.Bookshelf{UserID: "user1", Name: fmt.Sprintf("Shelf %d", shelves)}
+			require.NoError(t, repos.Bookshelves.Create(ctx, shelf))
+			for _, isbn := range isbns {
+				create(t, repos.Books, &models.Book{UserID: "user1", BookshelfIDs: []string{shelf.ID}, ISBN: isbn})
+			}
+			return shelf
+		}
+		count := func(t *testing.T, repos Repos, bookshelfID string) int {
+			n, err := repos.Books.CountInBookshelf(ctx, bookshelfID)
+			require.NoError(t, err)
+			return n
+		}
+
+		t.Run("Refuse", func(t *testing.T) {
+			repos := newRepos(t)
+			shelf := newShelf(t, repos, "9785446120581")
+			opts := &models.BookshelfDeleteOptions{Mode: models.DeleteModeRefuse}
+
+			_, err := repos.Bookshelves.DeleteWithBooks(ctx, shelf.ID, opts)
+			assert.ErrorIs(t, err, repository.ErrBookshelfNotEmpty)
+			_, err = repos.Bookshelves.GetByID(ctx, shelf.ID)
+			require.NoError(t, err, "a bookshelf with books is kept")
+
+			empty := newShelf(t, repos)
+			result, err := repos.Bookshelves.DeleteWithBooks(ctx, empty.ID, opts)
+			require.NoError(t, err)
+			assert.Equal(t, &models.BookshelfDeleteResult{BookshelfID: empty.ID, Mode: models.DeleteModeRefuse}, result)
+
+			_, err = repos.Bookshelves.DeleteWithBooks(ctx, empty.ID, opts)
+			assert.ErrorIs(t, err, repository.ErrBookshelfNotFound)
+		})
+
+		t.Run("Cascade", func(t *testing.T) {
+			repos := newRepos(t)
+			shelf := newShelf(t, repos, "9785446120581", "9785171183660")
+			other := newShelf(t, repos, "9785446120581")
+			both := &models.Book{UserID: "user1", BookshelfIDs: []string{shelf.ID, other.ID}, ISBN: "9780306406157"}
+			create(t, repos.Books, both)
+
+			result, err := repos.Bookshelves.DeleteWithBooks(ctx, shelf.ID, &models.BookshelfDeleteOptions{Mode: models.DeleteModeCascade})
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.BooksDeleted)
+			assert.Equal(t, 1, result.BooksKept)
+			assert.Zero(t, count(t, repos, shelf.ID))
+			assert.Equal(t, 2, count(t, repos, other.ID), "books on other bookshelves are kept")
+
+			got, err := repos.Books.GetByID(ctx, both.ID)
+			require.NoError(t, err)
+			assert.Equal(t, []string{other.ID}, got.BookshelfIDs)
+			_, err = repos.Bookshelves.GetByID(ctx, shelf.ID)
+			assert.ErrorIs(t, err, repository.ErrBookshelfNotFound)
+		})
+
+		t.Run("Move", func(t *testing.T) {
+			repos := newRepos(t)
+			shelf := newShelf(t, repos, "9785446120581", "9785171183660")
+			target := newShelf(t, repos, "9780306406157")
+
+			result, err := repos.Bookshelves.DeleteWithBooks(ctx, shelf.ID, &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: target.ID})
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.BooksMoved)
+			assert.Equal(t, target.ID, result.TargetBookshelfID)
+			assert.Equal(t, 3, count(t, repos, target.ID))
+
+			exists, err := repos.Books.ExistsInBookshelf(ctx, "9785171183660", target.ID)
+			require.NoError(t, err)
+			assert.True(t, exists)
+
+			positions, err := repos.Books.Positions(ctx, target.ID)
+			require.NoError(t, err)
+			onTarget := make([]string, 0, len(positions))
+			for _, position := range positions {
+				book, err := repos.Books.GetByID(ctx, position.ID)
+				require.NoError(t, err)
+				onTarget = append(onTarget, book.ISBN)
+			}
+			assert.Equal(t, []string{"9780306406157", "9785446120581", "9785171183660"}, onTarget, "moved books keep their order behind those on the target")
+
+			book, err := repos.Books.GetByISBNAndUser(ctx, "9785171183660", "user1")
+			require.NoError(t, err)
+			require.Len(t, book.History, 1, "the move is recorded")
+			assert.Equal(t, shelf.ID, book.History[0].FromBookshelfID)
+			assert.Equal(t, target.ID, book.History[0].ToBookshelfID)
+		})
+
+		t.Run("Unshelve", func(t *testing.T) {
+			repos := newRepos(t)
+			shelf := newShelf(t, repos, "9785446120581")
+
+			result, err := repos.Bookshelves.DeleteWithBooks(ctx, shelf.ID, &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove})
+			require.NoError(t, err)
+			assert.Equal(t, 1, result.BooksMoved)
+
+			book, err := repos.Books.GetByISBNAndUser(ctx, "9785446120581", "user1")
+			require.NoError(t, err)
+			assert.Empty(t, book.BookshelfIDs)
+		})
+
+		t.Run("MoveConflict", func(t *testing.T) {
+			repos := newRepos(t)
+			shelf := newShelf(t, repos, "9785446120581", "9785171183660")
+			target := newShelf(t, repos, "9785171183660")
+
+			_, err := repos.Bookshelves.DeleteWithBooks(ctx, shelf.ID, &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: target.ID})
+			assert.ErrorIs(t, err, repository.ErrBookAlreadyExists)
+			assert.Equal(t, 2, count(t, repos, shelf.ID), "nothing is moved")
+			assert.Equal(t, 1, count(t, repos, target.ID))
+			_, err = repos.Bookshelves.GetByID(ctx, shelf.ID)
+			require.NoError(t, err, "the bookshelf is kept")
+		})
+
+		t.Run("MoveOverLimit", func(t *testing.T) {
+			repos := newRepos(t)
+			shelf := newShelf(t, repos, "9785446120581", "9785171183660")
+			target := newShelf(t, repos, "9780306406157")
+			both := &models.Book{UserID: "user1", BookshelfIDs: []string{shelf.ID, target.ID}}
+			create(t, repos.Books, both)
+
+			_, err := repos.Bookshelves.DeleteWithBooks(ctx, shelf.ID, &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: target.ID, BookLimit: 3})
+			assert.ErrorIs(t, err, repository.ErrBookshelfLimitReached)
+			assert.Equal(t, 3, count(t, repos, shelf.ID), "nothing is moved")
+			assert.Equal(t, 2, count(t, repos, target.ID))
+			_, err = repos.Bookshelves.GetByID(ctx, shelf.ID)
+			require.NoError(t, err, "the bookshelf is kept")
+
+			result, err := repos.Bookshelves.DeleteWithBooks(ctx, shelf.ID, &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: target.ID, BookLimit: 4})
+			require.NoError(t, err, "books already on the target do not count twice")
+			assert.Equal(t, 3, result.BooksMoved)
+			assert.Equal(t, 4, count(t, repos, target.ID))
+		})
+	})
+}
+
+func RunCatalogRepo(t *testing.T, newRepos Factory) {
+	ctx := context.Background()
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repos := newRepos(t)
+		entry := &models.CatalogEntry{
+			ISBN10:       "5446120582",
+			ISBN13:       "9785446120581",
+			Title:        "Title",
+			Contributors: []models.Contributor{{Name: "Author", Role: models.RoleAuthor}},
+			Editions:     []models.Edition{{Publisher: "Publisher", ShopName: "Shop"}},
+		}
+		require.NoError(t, repos.Catalog.Create(ctx, entry))
+		require.NotEmpty(t, entry.ID)
+
+		got, err := repos.Catalog.GetByID(ctx, entry.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Title", got.Title)
+		assert.Equal(t, entry.Contributors, got.Contributors)
+		assert.Equal(t, entry.Editions, got.Editions)
+
+		for _, isbn := range []string{"9785446120581", "978-5-4461-2058-1", "5446120582", "5-4461-2058-2"} {
+			got, err = repos.Catalog.GetByISBN(ctx, isbn)
+			require.NoError(t, err, isbn)
+			assert.Equal(t, entry.ID, got.ID, isbn)
+		}
+
+		_, err = repos.Catalog.GetByID(ctx, "000000000000000000000000")
+		assert.ErrorIs(t, err, repository.ErrCatalogEntryNotFound)
+		_, err = repos.Catalog.GetByISBN(ctx, "9785171183660")
+		assert.ErrorIs(t, err, repository.ErrCatalogEntryNotFound)
+	})
+
+	t.Run("AddEdition", func(t *testing.T) {
+		repos := newRepos(t)
+		entry := &models.CatalogEntry{
+			ISBN13:       "9785446120581",
+			Contributors: []models.Contributor{},
+			Editions:     []models.Edition{{Publisher: "Publisher", ShopName: "Shop A"}},
+		}
+		require.NoError(t, repos.Catalog.Create(ctx, entry))
+
+		edition := models.Edition{Publisher: "Publisher", ShopName: "Shop B"}
+		require.NoError(t, repos.Catalog.AddEdition(ctx, entry.ID, edition))
+		require.NoError(t, repos.Catalog.AddEdition(ctx, entry.ID, edition))
+
+		got, err := repos.Catalog.GetByID(ctx, entry.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []models.Edition{entry.Editions[0], edition}, got.Editions, "an edition is listed once")
+
+		err = repos.Catalog.AddEdition(ctx, "000000000000000000000000", edition)
+		assert.ErrorIs(t, err, repository.ErrCatalogEntryNotFound)
+	})
+}
+
+func create(t *testing.T, repo repository.BookRepo, books ...*models.Book) {
+	t.Helper()
+	for _, book := range books {
+		require.NoError(t, repo.Create(context.Background(), book))
+	}
+}
+
+// listAll returns options that list all books in the order they were created.
+func listAll() *models.BookListOptions {
+	return &models.BookListOptions{Page: 1, Limit: 100, Sort: models.SortByCreatedAt, Order: models.SortAsc}
+}
+
+func titles(books []*models.Book) []string {
+	var result []string
+	for _, book := range books {
+		result = append(result, book.Title)
+	}
+	return result
+}
+
+func isbns(books []*models.Book) []string {
+	var isbns []string
+	for _, book := range books {
+		isbns = append(isbns, book.ISBN)
+	}
+	return isbns
+}
+
+func ids(books []*models.Book) []string {
+	var result []string
+	for _, book := range books {
+		result = append(result, book.ID)
+	}
+	return result
+}
+
+func positionIDs(positions []models.Position) []string {
+	var result []string
+	for _, position := range positions {
+		result = append(result, position.ID)
+	}
+	return result
+}
+
+func names(bookshelves []*models.Bookshelf) []string {
+	var result []string
+	for _, bookshelf := range bookshelves {
+		result = append(result, bookshelf.Name)
+	}
+	return result
+}
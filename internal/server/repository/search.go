@@ -5,6 +5,14 @@ import (
 	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
 )
 
+// SearchResult is the searcher's response along with the metadata sent with it.
+type SearchResult struct {
+	*searcherv1.SearchByISBNResponse
+	FailureReason string // set when the status is FAILED
+}
+
 type SearchRepo interface {
-	SearchByISBN(ctx context.Context, isbn string) (*searcherv1.SearchByISBNResponse, error)
+	// SearchByISBN starts or polls an advanced search. With force set, a failed
+	// search is retried at once.
+	SearchByISBN(ctx context.Context, isbn string, force bool) (*SearchResult, error)
 }
@@ -2,7 +2,6 @@ package routes
 
 import (
 	"github.com/getz-devs/librakeeper-server/internal/server/handlers"
-	"github.com/getz-devs/librakeeper-server/internal/server/middlewares"
 	"github.com/gin-gonic/gin"
 )
 
@@ -11,40 +10,50 @@ type Handlers struct {
 	Bookshelves *handlers.BookshelfHandlers
 	Books       *handlers.BookHandlers
 	Search      *handlers.SearchHandlers
+	Auth        gin.HandlerFunc // authenticates the user of a request
+	Health      gin.HandlerFunc
 }
 
 // SetupRoutes sets up the API routes for the server.
 func SetupRoutes(router *gin.Engine, h *Handlers) {
 	api := router.Group("/api")
 
-	api.GET("/health", handlers.HealthCheck)
+	api.GET("/health", h.Health)
 
 	// Book routes
 	booksGroup := api.Group("/books")
 	{
-		booksGroup.POST("/add", middlewares.AuthMiddleware(), h.Books.Create)
-		booksGroup.POST("/add/advanced", middlewares.AuthMiddleware(), h.Books.AddAdvanced)
-		booksGroup.GET("/", middlewares.AuthMiddleware(), h.Books.GetByUser)
-		booksGroup.GET("/:id", middlewares.AuthMiddleware(), h.Books.GetByID)
-		booksGroup.GET("/isbn/:isbn", middlewares.AuthMiddleware(), h.Books.GetByISBN)
-		booksGroup.GET("/bookshelf/:id", middlewares.AuthMiddleware(), h.Books.GetByBookshelfID)
-		booksGroup.PUT("/:id", middlewares.AuthMiddleware(), h.Books.Update)
-		booksGroup.DELETE("/:id", middlewares.AuthMiddleware(), h.Books.Delete)
+		booksGroup.POST("/add", h.Auth, h.Books.Create)
+		booksGroup.POST("/add/advanced", h.Auth, h.Books.AddAdvanced)
+		booksGroup.GET("/", h.Auth, h.Books.GetByUser)
+		booksGroup.GET("/:id", h.Auth, h.Books.GetByID)
+		booksGroup.GET("/isbn/:isbn", h.Auth, h.Books.GetByISBN)
+		booksGroup.GET("/bookshelf/:id", h.Auth, h.Books.GetByBookshelfID)
+		booksGroup.PUT("/bookshelf/:id/order", h.Auth, h.Books.Reorder)
+		booksGroup.PUT("/:id", h.Auth, h.Books.Update)
+		booksGroup.POST("/:id/move", h.Auth, h.Books.Move)
+		booksGroup.POST("/move", h.Auth, h.Books.MoveMany)
+		booksGroup.PUT("/:id/bookshelves/:bookshelf_id", h.Auth, h.Books.AddToBookshelf)
+		booksGroup.DELETE("/:id/bookshelves/:bookshelf_id", h.Auth, h.Books.RemoveFromBookshelf)
+		booksGroup.DELETE("/:id", h.Auth, h.Books.Delete)
 	}
 
 	// Bookshelf routes
 	bookshelvesGroup := api.Group("/bookshelves")
 	{
-		bookshelvesGroup.POST("/add", middlewares.AuthMiddleware(), h.Bookshelves.Create)
-		bookshelvesGroup.GET("/", middlewares.AuthMiddleware(), h.Bookshelves.GetByUser)
-		bookshelvesGroup.GET("/:id", middlewares.AuthMiddleware(), h.Bookshelves.GetByID)
-		bookshelvesGroup.PUT("/:id", middlewares.AuthMiddleware(), h.Bookshelves.Update)
-		bookshelvesGroup.DELETE("/:id", middlewares.AuthMiddleware(), h.Bookshelves.Delete)
+		bookshelvesGroup.POST("/add", h.Auth, h.Bookshelves.Create)
+		bookshelvesGroup.GET("/", h.Auth, h.Bookshelves.GetByUser)
+		bookshelvesGroup.GET("/:id", h.Auth, h.Bookshelves.GetByID)
+		bookshelvesGroup.PUT("/order", h.Auth, h.Bookshelves.Reorder)
+		bookshelvesGroup.PUT("/:id", h.Auth, h.Bookshelves.Update)
+		bookshelvesGroup.PUT("/:id/order", h.Auth, h.Bookshelves.Reorder)
+		bookshelvesGroup.POST("/:id/move", h.Auth, h.Bookshelves.Move)
+		bookshelvesGroup.DELETE("/:id", h.Auth, h.Bookshelves.Delete)
 	}
 
 	searchGroup := api.Group("/search")
 	{
-		searchGroup.GET("/simple", middlewares.AuthMiddleware(), h.Search.Simple)
-		searchGroup.GET("/advanced", middlewares.AuthMiddleware(), h.Search.Advanced)
+		searchGroup.GET("/simple", h.Auth, h.Search.Simple)
+		searchGroup.GET("/advanced", h.Auth, h.Search.Advanced)
 	}
 }
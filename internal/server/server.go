@@ -7,16 +7,22 @@ import (
 	"github.com/getz-devs/librakeeper-server/internal/server/auth"
 	"github.com/getz-devs/librakeeper-server/internal/server/config"
 	"github.com/getz-devs/librakeeper-server/internal/server/handlers"
+	"github.com/getz-devs/librakeeper-server/internal/server/middlewares"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
 	"github.com/getz-devs/librakeeper-server/internal/server/routes"
 	"github.com/getz-devs/librakeeper-server/internal/server/services/book"
 	"github.com/getz-devs/librakeeper-server/internal/server/services/bookshelf"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/pagination"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/policy"
 	"github.com/getz-devs/librakeeper-server/internal/server/services/search"
 	"github.com/getz-devs/librakeeper-server/internal/server/services/storage"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/bolt"
 	"github.com/getz-devs/librakeeper-server/internal/server/storage/mongo"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
@@ -31,6 +37,9 @@ type Server struct {
 	log        *slog.Logger
 	router     *gin.Engine
 	httpServer *http.Server
+	db         io.Closer // the embedded database, closed on shutdown
+
+	searcherConn *grpc.ClientConn // dialed from GRPC.Addr when nil
 }
 
 // NewServer creates a new Server instance.
@@ -41,6 +50,16 @@ func NewServer(config *config.Config, log *slog.Logger) *Server {
 	}
 }
 
+// NewServerWithSearcher creates a Server that reaches the searcher over the
+// given connection instead of dialing GRPC.Addr, e.g. an in-process one.
+func NewServerWithSearcher(config *config.Config, log *slog.Logger, conn *grpc.ClientConn) *Server {
+	return &Server{
+		config:       config,
+		log:          log,
+		searcherConn: conn,
+	}
+}
+
 // Run initializes and starts the HTTP server and handles graceful shutdown.
 func (s *Server) Run() error {
 	if err := s.initialize(); err != nil {
@@ -59,7 +78,13 @@ func (s *Server) Run() error {
 		cancel()
 	}()
 
-	return s.runHTTPServer(ctx)
+	err := s.runHTTPServer(ctx)
+	if s.db != nil {
+		if closeErr := s.db.Close(); closeErr != nil {
+			s.log.Error("failed to close database", slog.Any("error", closeErr))
+		}
+	}
+	return err
 }
 
 func (s *Server) runHTTPServer(ctx context.Context) error {
@@ -81,58 +106,131 @@ func (s *Server) runHTTPServer(ctx context.Context) error {
 	return s.httpServer.Shutdown(shutdownCtx) // Graceful shutdown
 }
 
+// Dependencies are the backends the API is built on.
+type Dependencies struct {
+	Books       repository.BookRepo
+	Bookshelves repository.BookshelfRepo
+	Catalog     repository.CatalogRepo
+	Searcher    repository.SearchRepo
+	Verifier    auth.TokenVerifier
+	Ping        func(ctx context.Context) error // checks the database for /health, optional
+}
+
 // initialize initializes the server components.
 func (s *Server) initialize() error {
 	// Initialize Firebase
-	err := auth.InitializeFirebase(s.config.Auth.ConfigPath)
+	verifier, err := auth.NewFirebase(s.config.Auth.ConfigPath)
 	if err != nil {
 		return fmt.Errorf("failed to initialize Firebase: %w", err)
 	}
 
-	db, err := storage.Initialize(s.config, s.log)
+	deps, err := s.openDatabase()
 	if err != nil {
 		return fmt.Errorf("failed to initialize Database: %w", err)
 	}
 
-	conn, err := grpc.NewClient(
-		s.config.GRPC.Addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	conn := s.searcherConn
+	if conn == nil {
+		conn, err = grpc.NewClient(
+			s.config.GRPC.Addr,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to connect to gRPC server: %w", err)
+		}
+	}
+
+	deps.Searcher = search.NewSearcherClient(conn, s.log)
+	deps.Verifier = verifier
+	s.router, err = NewRouter(s.config, deps, s.log)
 	if err != nil {
-		return fmt.Errorf("failed to connect to gRPC server: %w", err)
+		return err
+	}
+
+	s.httpServer = &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.config.Server.Port),
+		Handler: s.router,
+	}
+
+	return nil
+}
+
+// openDatabase connects to the database selected by database.driver and
+// returns the repositories on top of it.
+func (s *Server) openDatabase() (Dependencies, error) {
+	switch s.config.Database.Driver {
+	case config.DriverBolt:
+		db, err := bolt.Open(s.config.Database.Path, s.log)
+		if err != nil {
+			return Dependencies{}, err
+		}
+		s.db = db
+
+		return Dependencies{
+			Books:       bolt.NewBookRepo(db, s.log, bolt.BooksCollection),
+			Bookshelves: bolt.NewBookshelfRepo(db, s.log),
+			Catalog:     bolt.NewCatalogRepo(db, s.log),
+			Ping:        db.Ping,
+		}, nil
+	default:
+		db, err := storage.Initialize(s.config, s.log)
+		if err != nil {
+			return Dependencies{}, err
+		}
+		if s.config.Database.MigrateOnStartup {
+			if err := mongo.Migrate(context.Background(), db, s.log); err != nil {
+				return Dependencies{}, err
+			}
+		}
+
+		return Dependencies{
+			Books:       mongo.NewBookRepo(db, s.log, mongo.BooksCollection),
+			Bookshelves: mongo.NewBookshelfRepo(db, s.log),
+			Catalog:     mongo.NewCatalogRepo(db, s.log),
+			Ping:        storage.Ping,
+		}, nil
 	}
+}
 
-	bookRepo := mongo.NewBookRepo(db, s.log, "user_books")
-	allBooksRepo := mongo.NewBookRepo(db, s.log, "all_books")
-	bookshelfRepo := mongo.NewBookshelfRepo(db, s.log)
-	searcherClient := search.NewSearcherClient(conn, s.log)
+// NewRouter builds the services and the routes of the API on top of the given backends.
+func NewRouter(cfg *config.Config, deps Dependencies, log *slog.Logger) (*gin.Engine, error) {
+	accessPolicy := policy.New(log)
+
+	var cursors *pagination.Cursors
+	var err error
+	if cfg.Pagination.CursorSecret == "" && cfg.Pagination.AllowRandomSecret {
+		log.Warn("pagination.cursor_secret is not set, cursors will not survive a restart or work across replicas")
+		cursors, err = pagination.NewRandomCursors()
+	} else {
+		cursors, err = pagination.NewCursors(cfg.Pagination.CursorSecret)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cursors: %w", err)
+	}
 
-	searchService := search.NewSearchService(searcherClient, allBooksRepo, s.log)
-	bookService := book.NewBookService(bookRepo, allBooksRepo, bookshelfRepo, searchService, s.log)
-	bookshelfService := bookshelf.NewBookshelfService(bookshelfRepo, s.log)
+	searchService := search.NewSearchService(deps.Searcher, deps.Catalog, log)
+	bookService := book.NewBookService(deps.Books, deps.Catalog, deps.Bookshelves, searchService, accessPolicy, cursors, log)
+	bookshelfService := bookshelf.NewBookshelfService(deps.Bookshelves, accessPolicy, cursors, log)
 
 	h := &routes.Handlers{
-		Books:       handlers.NewBookHandlers(bookService, s.log),
-		Bookshelves: handlers.NewBookshelfHandlers(bookshelfService, s.log),
-		Search:      handlers.NewSearchHandlers(searchService, s.log),
+		Books:       handlers.NewBookHandlers(bookService, log),
+		Bookshelves: handlers.NewBookshelfHandlers(bookshelfService, log),
+		Search:      handlers.NewSearchHandlers(searchService, log),
+		Auth:        middlewares.AuthMiddleware(deps.Verifier),
+		Health:      handlers.NewHealthCheck(deps.Ping),
 	}
 
 	// Configure CORS
 	corsConfig := cors.Config{
-		AllowOrigins:     s.config.Server.AllowedOrigins,
+		AllowOrigins:     cfg.Server.AllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
 		AllowCredentials: true,
 	}
 
-	s.router = gin.New()
-	s.router.Use(gin.Logger(), gin.Recovery(), cors.New(corsConfig))
-	routes.SetupRoutes(s.router, h)
+	router := gin.New()
+	router.Use(gin.Logger(), gin.Recovery(), cors.New(corsConfig))
+	routes.SetupRoutes(router, h)
 
-	s.httpServer = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.config.Server.Port),
-		Handler: s.router,
-	}
-
-	return nil
+	return router, nil
 }
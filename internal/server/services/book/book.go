@@ -4,11 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/searchrpc"
 	"github.com/getz-devs/librakeeper-server/internal/server/models"
 	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/ordering"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/pagination"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/policy"
 	"github.com/getz-devs/librakeeper-server/internal/server/services/search"
-	"github.com/getz-devs/librakeeper-server/internal/server/storage/mongo"
+	"github.com/getz-devs/librakeeper-server/lib/isbn"
 	"log/slog"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -16,32 +23,52 @@ import (
 var (
 	ErrBookNotFound           = errors.New("book not found")
 	ErrBookshelfNotFound      = errors.New("bookshelf not found")
-	ErrUserNotFoundInContext  = errors.New("userID not found in context")
-	ErrNotAuthorized          = errors.New("user is not authorized to perform this action")
+	ErrUserNotFoundInContext  = policy.ErrUserNotFoundInContext
+	ErrNotAuthorized          = policy.ErrNotAuthorized
 	ErrTitleAndAuthorRequired = errors.New("book title and author are required")
 	ErrBookshelfLimitReached  = errors.New("bookshelf has reached the book limit")
 	ErrBookAlreadyExists      = errors.New("book with this ISBN already exists in this bookshelf")
 	ErrCantAddToAllBooks      = errors.New("error adding book to all books")
-	ErrBookAlreadyExistsInALL = errors.New("book already exist in all books")
+	ErrInvalidIndex           = errors.New("invalid search result index")
+	ErrSearchNotFinished      = errors.New("advanced search is not finished yet")
+	ErrSearchFailed           = errors.New("advanced search failed")
+	ErrInvalidDateRange       = errors.New("created_from must not be after created_to")
+	ErrInvalidISBN            = search.ErrInvalidISBN
+	ErrNoBooksToMove          = errors.New("no books to move")
+	ErrTooManyBooksToMove     = fmt.Errorf("at most %d books can be moved at once", maxMoveBooks)
+	ErrTargetNotFound         = errors.New("target bookshelf not found")
+	ErrNotOnBookshelf         = errors.New("book is not on this bookshelf")
+	ErrAmbiguousMove          = errors.New("book is on several bookshelves, the bookshelf to move it from is required")
+	ErrInvalidReorder         = ordering.ErrInvalidReorder
+	ErrIncompleteList         = ordering.ErrIncompleteList
+	ErrUnknownItem            = ordering.ErrUnknownItem
+	ErrSmartBookshelf         = errors.New("the books of a smart bookshelf come from its filter")
 )
 
+// maxMoveBooks is the number of books a single move may take.
+const maxMoveBooks = 100
+
 // BookService defines the interface for book service operations.
 type BookService struct {
 	repo          repository.BookRepo
-	allBooksRepo  repository.BookRepo
+	catalog       repository.CatalogRepo
 	bookshelfRepo repository.BookshelfRepo
 	searcher      *search.SearchService
+	policy        *policy.Policy
+	cursors       *pagination.Cursors
 	log           *slog.Logger
 	bookLimit     int
 }
 
 // NewBookService creates a new BookService instance.
-func NewBookService(repo repository.BookRepo, allBooksRepo repository.BookRepo, bookshelfRepo repository.BookshelfRepo, searcher *search.SearchService, log *slog.Logger) *BookService {
+func NewBookService(repo repository.BookRepo, catalog repository.CatalogRepo, bookshelfRepo repository.BookshelfRepo, searcher *search.SearchService, policy *policy.Policy, cursors *pagination.Cursors, log *slog.Logger) *BookService {
 	return &BookService{
 		repo:          repo,
-		allBooksRepo:  allBooksRepo,
+		catalog:       catalog,
 		bookshelfRepo: bookshelfRepo,
 		searcher:      searcher,
+		policy:        policy,
+		cursors:       cursors,
 		log:           log,
 		bookLimit:     1000, // TODO: Read from config
 	}
@@ -49,171 +76,646 @@ func NewBookService(repo repository.BookRepo, allBooksRepo repository.BookRepo,
 
 // Create creates a new book.
 func (s *BookService) Create(ctx context.Context, book *models.Book) error {
-	// Rule 2: Book Title & Author Presence
-	if book.Title == "" || book.Author == "" {
-		return ErrTitleAndAuthorRequired
+	if err := s.checkCreate(ctx, book); err != nil {
+		return err
 	}
 
-	// Rule 3: Bookshelf Ownership
-	userID, ok := ctx.Value("userID").(string)
-	if !ok {
-		return ErrUserNotFoundInContext
+	entry, err := s.findCatalogEntry(ctx, book.ISBN)
+	if err != nil {
+		return err
 	}
 
-	if book.BookshelfID != "" {
-		// if bookshelf specified, check bookshelf
+	return s.store(ctx, book, entry)
+}
 
-		bookshelf, err := s.bookshelfRepo.GetByID(ctx, book.BookshelfID)
+// checkCreate applies the rules for adding a book to a user's library and
+// sets the owner of the book.
+func (s *BookService) checkCreate(ctx context.Context, book *models.Book) error {
+	// Rule 1: Valid ISBN, stored in its canonical form
+	if book.ISBN != "" {
+		normalized, err := normalizeISBN(book.ISBN)
 		if err != nil {
-			if errors.Is(err, mongo.ErrBookshelfNotFound) {
-				return ErrBookshelfNotFound
-			}
-			return fmt.Errorf("failed to get bookshelf: %w", err)
+			return err
 		}
+		book.ISBN = normalized
+	}
 
-		if bookshelf.UserID != userID {
-			return ErrNotAuthorized
-		}
+	// Rule 2: Book Title & Author Presence
+	if book.Title == "" || book.Author == "" {
+		return ErrTitleAndAuthorRequired
+	}
 
-		// Rule 4: Book Limit per Bookshelf
-		bookCount, err := s.repo.CountInBookshelf(ctx, book.BookshelfID)
-		if err != nil {
-			return fmt.Errorf("failed to get book count for bookshelf: %w", err)
-		}
-		if bookCount >= s.bookLimit {
-			return ErrBookshelfLimitReached
-		}
+	// Rule 3: Bookshelf Ownership
+	userID, err := policy.UserID(ctx)
+	if err != nil {
+		return err
+	}
 
-		// Rule 5: Unique Book within Bookshelf
-		exists, err := s.repo.ExistsInBookshelf(ctx, book.ISBN, book.BookshelfID)
-		if err != nil {
-			return fmt.Errorf("failed to check book existence: %w", err)
-		}
-		if exists {
-			return ErrBookAlreadyExists
+	book.Tags = tagSet(book.Tags)
+
+	// Rules 4 and 5 for each bookshelf the book is put on.
+	book.BookshelfIDs = bookshelfSet(book.BookshelfIDs)
+	for _, bookshelfID := range book.BookshelfIDs {
+		if err := s.checkBookshelf(ctx, bookshelfID, []*models.Book{book}); err != nil {
+			return err
 		}
 	}
 
-	if err := s.repo.Create(ctx, book); err != nil {
-		return fmt.Errorf("failed to create book: %w", err)
-	}
+	// The owner always comes from the authenticated user, never from the request body.
+	book.UserID = userID
 
 	return nil
 }
 
 // GetByID retrieves a book by its ID.
 func (s *BookService) GetByID(ctx context.Context, bookID string) (*models.Book, error) {
-	book, err := s.repo.GetByID(ctx, bookID)
+	book, err := s.getBook(ctx, bookID)
 	if err != nil {
-		if errors.Is(err, mongo.ErrBookNotFound) {
-			return nil, ErrBookNotFound
-		}
-		return nil, fmt.Errorf("failed to get book: %w", err)
+		return nil, err
+	}
+
+	if err := s.policy.Book(ctx, policy.ActionRead, book); err != nil {
+		return nil, err
 	}
+
 	return book, nil
 }
 
-// GetByISBN retrieves a book by its ISBN.
+// GetByISBN retrieves a book by its ISBN from the library of the current user.
 func (s *BookService) GetByISBN(ctx context.Context, isbn string) (*models.Book, error) {
-	book, err := s.repo.GetByISBN(ctx, isbn)
+	userID, err := policy.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	isbn, err = normalizeISBN(isbn)
 	if err != nil {
-		if errors.Is(err, mongo.ErrBookNotFound) {
+		return nil, err
+	}
+
+	book, err := s.repo.GetByISBNAndUser(ctx, isbn, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrBookNotFound) {
 			return nil, ErrBookNotFound
 		}
 		return nil, fmt.Errorf("failed to get book by ISBN: %w", err)
 	}
+
+	if err := s.policy.Book(ctx, policy.ActionRead, book); err != nil {
+		return nil, err
+	}
+
 	return book, nil
 }
 
-// GetByUserID retrieves a list of book for a specific user.
-func (s *BookService) GetByUserID(ctx context.Context, userID string, page int64, limit int64) ([]*models.Book, error) {
-	books, err := s.repo.GetByUserID(ctx, userID, page, limit)
+// GetByUserID retrieves a page of books for a specific user.
+func (s *BookService) GetByUserID(ctx context.Context, userID string, opts *models.BookListOptions) (*models.PaginatedBookResponse, error) {
+	if err := s.policy.Library(ctx, policy.ActionList, userID); err != nil {
+		return nil, err
+	}
+
+	scope := pagination.Scope("books:user:"+userID, opts.Filter)
+	if err := s.normalizeListOptions(opts, scope); err != nil {
+		return nil, err
+	}
+
+	page, err := s.repo.GetByUserID(ctx, userID, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get book by user ID: %w", err)
 	}
-	return books, nil
+
+	return s.paginate(page, opts, scope, "")
 }
 
-// GetByBookshelfID retrieves book by bookshelf ID.
-func (s *BookService) GetByBookshelfID(ctx context.Context, bookshelfID string, page int64, limit int64) ([]*models.Book, error) {
-	books, err := s.repo.GetByBookshelfID(ctx, bookshelfID, page, limit)
+// GetByBookshelfID retrieves a page of books by bookshelf ID, with the books
+// on the bookshelves nested in it when the list is recursive. Only the books
+// on the bookshelf itself can be listed in their manual order. A smart
+// bookshelf lists the books of its owner that match its filter.
+func (s *BookService) GetByBookshelfID(ctx context.Context, bookshelfID string, opts *models.BookListOptions) (*models.PaginatedBookResponse, error) {
+	bookshelf, err := s.getBookshelf(ctx, bookshelfID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.policy.Bookshelf(ctx, policy.ActionList, bookshelf); err != nil {
+		return nil, err
+	}
+
+	if bookshelf.IsSmart() {
+		return s.smartBooks(ctx, bookshelf, opts)
+	}
+
+	scope, sorts := pagination.Scope("books:bookshelf:"+bookshelfID, opts.Filter), []string{models.SortByPosition}
+	if opts.Recursive {
+		scope, sorts = pagination.Scope("books:subtree:"+bookshelfID, opts.Filter), nil
+	}
+	if err := s.normalizeListOptions(opts, scope, sorts...); err != nil {
+		return nil, err
+	}
+
+	var page *models.BookPage
+	if opts.Recursive {
+		var subtree []*models.Bookshelf
+		if subtree, err = s.bookshelfRepo.GetSubtree(ctx, bookshelfID); err != nil {
+			return nil, fmt.Errorf("failed to get nested bookshelves: %w", err)
+		}
+		ids := make([]string, 0, len(subtree))
+		for _, b := range subtree {
+			ids = append(ids, b.ID)
+		}
+		page, err = s.repo.GetByBookshelves(ctx, ids, opts)
+	} else {
+		page, err = s.repo.GetByBookshelfID(ctx, bookshelfID, opts)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get book by bookshelf ID: %w", err)
 	}
-	return books, nil
+
+	return s.paginate(page, opts, scope, bookshelfID)
 }
 
-// Update updates an existing book.
-func (s *BookService) Update(ctx context.Context, bookID string, update *models.BookUpdate) error {
-	// 1. Get the book
-	book, err := s.repo.GetByID(ctx, bookID)
+// smartBooks retrieves a page of the books that match the filter of a smart
+// bookshelf. A smart bookshelf has no nested bookshelves and no manual order.
+func (s *BookService) smartBooks(ctx context.Context, bookshelf *models.Bookshelf, opts *models.BookListOptions) (*models.PaginatedBookResponse, error) {
+	// Editing the filter of the bookshelf invalidates its cursors too.
+	scope := pagination.Scope("books:smart:"+bookshelf.ID, []interface{}{bookshelf.Filter, opts.Filter})
+	if err := s.normalizeListOptions(opts, scope); err != nil {
+		return nil, err
+	}
+
+	filter := bookshelf.Filter.BookFilter(time.Now())
+	opts.ShelfFilter = &filter
+
+	page, err := s.repo.GetByUserID(ctx, bookshelf.UserID, opts)
 	if err != nil {
-		if errors.Is(err, mongo.ErrBookNotFound) {
-			return ErrBookNotFound
+		return nil, fmt.Errorf("failed to get books of smart bookshelf: %w", err)
+	}
+
+	return s.paginate(page, opts, scope, "")
+}
+
+// normalizeListOptions validates the page, clamps the limit and checks the
+// sort field against the common ones and the extra sorts of the list. A
+// cursor replaces the page and carries its own sort field and order.
+func (s *BookService) normalizeListOptions(opts *models.BookListOptions, scope string, sorts ...string) error {
+	if opts.Cursor != "" {
+		cursor, position, err := s.cursors.Resolve(opts.Cursor, scope)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to get book: %w", err)
+		opts.Page, opts.Sort, opts.Order, opts.Position = 1, cursor.Sort, cursor.Order, position
+	}
+
+	page, limit, err := pagination.Normalize(opts.Page, opts.Limit)
+	if err != nil {
+		return err
 	}
 
-	// 2. Get the bookshelf
-	bookshelf, err := s.bookshelfRepo.GetByID(ctx, book.BookshelfID)
+	sort, order, err := pagination.NormalizeSort(opts.Sort, opts.Order,
+		append([]string{models.SortByTitle, models.SortByAuthor, models.SortByCreatedAt, models.SortByUpdatedAt}, sorts...)...)
 	if err != nil {
-		if errors.Is(err, mongo.ErrBookshelfNotFound) {
-			return ErrBookshelfNotFound
+		return err
+	}
+
+	filter := opts.Filter
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && filter.CreatedFrom.After(*filter.CreatedTo) {
+		return ErrInvalidDateRange
+	}
+
+	opts.Page, opts.Limit, opts.Sort, opts.Order = page, limit, sort, order
+	return nil
+}
+
+// paginate wraps a repository page into the response envelope with
+// continuation cursors. A list sorted by position is of the books on the
+// bookshelf.
+func (s *BookService) paginate(page *models.BookPage, opts *models.BookListOptions, scope, bookshelfID string) (*models.PaginatedBookResponse, error) {
+	resp := &models.PaginatedBookResponse{
+		Books: page.Books,
+		Total: page.Total,
+		Page:  opts.Page,
+		Limit: opts.Limit,
+	}
+	if opts.Position != nil {
+		resp.Page = 0 // pages are not numbered when a cursor is used
+	}
+
+	p := pagination.Page{
+		Scope:    scope,
+		Sort:     opts.Sort,
+		Order:    opts.Order,
+		Number:   opts.Page,
+		Position: opts.Position,
+		HasMore:  page.HasMore,
+	}
+	if n := len(page.Books); n > 0 {
+		first, last := page.Books[0], page.Books[n-1]
+		p.First = &pagination.Boundary{Value: bookSortValue(first, opts.Sort, bookshelfID), ID: first.ID}
+		p.Last = &pagination.Boundary{Value: bookSortValue(last, opts.Sort, bookshelfID), ID: last.ID}
+	}
+
+	var err error
+	if resp.NextCursor, resp.PrevCursor, err = s.cursors.Links(p); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// bookSortValue returns the value of the sort field of a book; the position
+// is the one on the bookshelf.
+func bookSortValue(book *models.Book, field, bookshelfID string) interface{} {
+	switch field {
+	case models.SortByTitle:
+		return book.Title
+	case models.SortByAuthor:
+		return book.Author
+	case models.SortByPosition:
+		return book.Positions[bookshelfID]
+	case models.SortByUpdatedAt:
+		return book.UpdatedAt
+	default:
+		return book.CreatedAt
+	}
+}
+
+// Update updates an existing book.
+func (s *BookService) Update(ctx context.Context, bookID string, update *models.BookUpdate) error {
+	book, err := s.getBook(ctx, bookID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.policy.Book(ctx, policy.ActionUpdate, book); err != nil {
+		return err
+	}
+
+	if update.ISBN != nil && *update.ISBN != "" {
+		normalized, err := normalizeISBN(*update.ISBN)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to get bookshelf: %w", err)
+		update.ISBN = &normalized
 	}
 
-	// 3. Get userID from context
-	userID, ok := ctx.Value("userID").(string)
-	if !ok {
-		return ErrUserNotFoundInContext
+	if update.Tags != nil {
+		tags := tagSet(*update.Tags)
+		update.Tags = &tags
 	}
 
-	// 4. Check bookshelf ownership
-	if bookshelf.UserID != userID {
-		return ErrNotAuthorized
+	if update.BookshelfIDs != nil {
+		bookshelfIDs := bookshelfSet(*update.BookshelfIDs)
+		update.BookshelfIDs = &bookshelfIDs
 	}
 
-	// 5. If authorized, proceed with the update:
+	if err := s.resolveMetadata(ctx, book, update); err != nil {
+		return err
+	}
+
+	// New bookshelves are checked like a move and applied as shelf changes.
+	isbn := book.ISBN
+	if update.ISBN != nil {
+		isbn = *update.ISBN
+	}
+	var changes []models.ShelfChange
+	if update.BookshelfIDs != nil {
+		updated := *book
+		updated.ISBN = isbn
+		if changes, err = s.shelfChanges(ctx, &updated, *update.BookshelfIDs); err != nil {
+			return err
+		}
+	}
+
+	// Rule 5: Unique Book within Bookshelf, for a book that gets another ISBN
+	// on the bookshelves it stays on.
+	if isbn != book.ISBN && isbn != "" {
+		for _, bookshelfID := range book.BookshelfIDs {
+			if update.BookshelfIDs != nil && !slices.Contains(*update.BookshelfIDs, bookshelfID) {
+				continue
+			}
+			exists, err := s.repo.ExistsInBookshelf(ctx, isbn, bookshelfID)
+			if err != nil {
+				return fmt.Errorf("failed to check book existence: %w", err)
+			}
+			if exists {
+				return ErrBookAlreadyExists
+			}
+		}
+	}
+
+	// The shelf changes are written with the other fields, so a change that
+	// fails leaves the book as it was.
+	update.Shelves = changes
 	if err := s.repo.Update(ctx, bookID, update); err != nil {
+		if errors.Is(err, repository.ErrBookNotFound) {
+			return ErrBookNotFound
+		}
+		if errors.Is(err, repository.ErrBookAlreadyExists) {
+			return ErrBookAlreadyExists
+		}
 		return fmt.Errorf("failed to update book: %w", err)
 	}
 
 	return nil
 }
 
-// Delete deletes a book.
-func (s *BookService) Delete(ctx context.Context, bookID string) error {
-	// 1. Get the book
-	book, err := s.repo.GetByID(ctx, bookID)
+// shelfChanges checks the bookshelves a book is put on and returns the
+// changes that put it on exactly the given bookshelves. Leaving one bookshelf
+// for another is a move.
+func (s *BookService) shelfChanges(ctx context.Context, book *models.Book, bookshelfIDs []string) ([]models.ShelfChange, error) {
+	var leaves, joins []string
+	for _, bookshelfID := range book.BookshelfIDs {
+		if !slices.Contains(bookshelfIDs, bookshelfID) {
+			leaves = append(leaves, bookshelfID)
+		}
+	}
+	for _, bookshelfID := range bookshelfIDs {
+		if slices.Contains(book.BookshelfIDs, bookshelfID) {
+			continue
+		}
+		if err := s.checkTarget(ctx, bookshelfID, []*models.Book{book}); err != nil {
+			return nil, err
+		}
+		joins = append(joins, bookshelfID)
+	}
+
+	if len(leaves) == 1 && len(joins) == 1 {
+		return []models.ShelfChange{{BookID: book.ID, From: leaves[0], To: joins[0]}}, nil
+	}
+	changes := make([]models.ShelfChange, 0, len(leaves)+len(joins))
+	for _, bookshelfID := range leaves {
+		changes = append(changes, models.ShelfChange{BookID: book.ID, From: bookshelfID})
+	}
+	for _, bookshelfID := range joins {
+		changes = append(changes, models.ShelfChange{BookID: book.ID, To: bookshelfID})
+	}
+	return changes, nil
+}
+
+// Move moves a book from one bookshelf to another and returns the moved book.
+// Without fromBookshelfID, the book leaves the only bookshelf it is on; without
+// bookshelfID, it is taken off the bookshelf.
+func (s *BookService) Move(ctx context.Context, bookID, fromBookshelfID, bookshelfID string) (*models.Book, error) {
+	move := &models.BookMove{BookIDs: []string{bookID}, FromBookshelfID: fromBookshelfID, BookshelfID: bookshelfID}
+	if _, err := s.MoveMany(ctx, move); err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, bookID)
+}
+
+// MoveMany moves books of the user from one bookshelf to another. The
+// destination must belong to the user, have room for the books and not hold
+// their ISBNs yet. Either all books move or none.
+func (s *BookService) MoveMany(ctx context.Context, move *models.BookMove) (*models.BookMoveResult, error) {
+	if len(move.BookIDs) == 0 {
+		return nil, ErrNoBooksToMove
+	}
+	if len(move.BookIDs) > maxMoveBooks {
+		return nil, ErrTooManyBooksToMove
+	}
+
+	result := &models.BookMoveResult{BookshelfID: move.BookshelfID, Moved: []string{}, Unchanged: []string{}}
+	var changes []models.ShelfChange
+	var joining []*models.Book
+	seen := make(map[string]bool, len(move.BookIDs))
+	for _, bookID := range move.BookIDs {
+		if seen[bookID] {
+			continue
+		}
+		seen[bookID] = true
+
+		book, err := s.getBook(ctx, bookID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.policy.Book(ctx, policy.ActionUpdate, book); err != nil {
+			return nil, err
+		}
+
+		from := move.FromBookshelfID
+		switch {
+		case from != "" && !slices.Contains(book.BookshelfIDs, from):
+			return nil, ErrNotOnBookshelf
+		case from == "" && len(book.BookshelfIDs) > 1:
+			return nil, ErrAmbiguousMove
+		case from == "" && len(book.BookshelfIDs) == 1:
+			from = book.BookshelfIDs[0]
+		}
+
+		if from == move.BookshelfID {
+			result.Unchanged = append(result.Unchanged, bookID)
+			continue
+		}
+		if move.BookshelfID != "" && !slices.Contains(book.BookshelfIDs, move.BookshelfID) {
+			joining = append(joining, book)
+		}
+		changes = append(changes, models.ShelfChange{BookID: bookID, From: from, To: move.BookshelfID})
+		result.Moved = append(result.Moved, bookID)
+	}
+
+	if err := s.checkTarget(ctx, move.BookshelfID, joining); err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return result, nil
+	}
+
+	if err := s.reshelve(ctx, changes); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// AddToBookshelf puts a book on one more bookshelf and returns the book. A
+// book already on the bookshelf is left as it is.
+func (s *BookService) AddToBookshelf(ctx context.Context, bookID, bookshelfID string) (*models.Book, error) {
+	book, err := s.getBook(ctx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Book(ctx, policy.ActionUpdate, book); err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(book.BookshelfIDs, bookshelfID) {
+		if err := s.checkTarget(ctx, bookshelfID, []*models.Book{book}); err != nil {
+			return nil, err
+		}
+		if err := s.reshelve(ctx, []models.ShelfChange{{BookID: bookID, To: bookshelfID}}); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetByID(ctx, bookID)
+}
+
+// RemoveFromBookshelf takes a book off a bookshelf and returns the book. The
+// book stays in the library.
+func (s *BookService) RemoveFromBookshelf(ctx context.Context, bookID, bookshelfID string) (*models.Book, error) {
+	book, err := s.getBook(ctx, bookID)
 	if err != nil {
-		if errors.Is(err, mongo.ErrBookNotFound) {
+		return nil, err
+	}
+	if err := s.policy.Book(ctx, policy.ActionUpdate, book); err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(book.BookshelfIDs, bookshelfID) {
+		return nil, ErrNotOnBookshelf
+	}
+	if err := s.reshelve(ctx, []models.ShelfChange{{BookID: bookID, From: bookshelfID}}); err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, bookID)
+}
+
+// checkTarget applies the rules for putting books on a bookshelf they are not
+// on yet. A bookshelf of another user is reported as not found.
+func (s *BookService) checkTarget(ctx context.Context, bookshelfID string, books []*models.Book) error {
+	if bookshelfID == "" {
+		return nil
+	}
+
+	err := s.checkBookshelf(ctx, bookshelfID, books)
+	if errors.Is(err, ErrBookshelfNotFound) || errors.Is(err, ErrNotAuthorized) {
+		return ErrTargetNotFound
+	}
+	return err
+}
+
+// checkBookshelf applies rules 3 to 5 for putting books on a bookshelf.
+func (s *BookService) checkBookshelf(ctx context.Context, bookshelfID string, books []*models.Book) error {
+	// Rule 3: Bookshelf Ownership
+	bookshelf, err := s.getBookshelf(ctx, bookshelfID)
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Bookshelf(ctx, policy.ActionUpdate, bookshelf); err != nil {
+		return err
+	}
+	if bookshelf.IsSmart() {
+		return ErrSmartBookshelf
+	}
+
+	if len(books) == 0 {
+		return nil
+	}
+
+	// Rule 4: Book Limit per Bookshelf
+	bookCount, err := s.repo.CountInBookshelf(ctx, bookshelfID)
+	if err != nil {
+		return fmt.Errorf("failed to get book count for bookshelf: %w", err)
+	}
+	if bookCount+len(books) > s.bookLimit {
+		return ErrBookshelfLimitReached
+	}
+
+	// Rule 5: Unique Book within Bookshelf. Books without an ISBN may share it.
+	isbns := make(map[string]bool, len(books))
+	for _, book := range books {
+		if book.ISBN == "" {
+			continue
+		}
+		if isbns[book.ISBN] {
+			return ErrBookAlreadyExists
+		}
+		isbns[book.ISBN] = true
+
+		exists, err := s.repo.ExistsInBookshelf(ctx, book.ISBN, bookshelfID)
+		if err != nil {
+			return fmt.Errorf("failed to check book existence: %w", err)
+		}
+		if exists {
+			return ErrBookAlreadyExists
+		}
+	}
+
+	return nil
+}
+
+// reshelve applies checked shelf changes and maps storage errors to service
+// errors.
+func (s *BookService) reshelve(ctx context.Context, changes []models.ShelfChange) error {
+	if err := s.repo.Reshelve(ctx, changes); err != nil {
+		if errors.Is(err, repository.ErrBookNotFound) {
 			return ErrBookNotFound
 		}
-		return fmt.Errorf("failed to get book: %w", err)
+		if errors.Is(err, repository.ErrBookAlreadyExists) {
+			return ErrBookAlreadyExists
+		}
+		return fmt.Errorf("failed to reshelve books: %w", err)
 	}
+	return nil
+}
 
-	// 2. Get the bookshelf
-	bookshelf, err := s.bookshelfRepo.GetByID(ctx, book.BookshelfID)
+// Reorder changes the manual order of the books on a bookshelf. Only the books
+// that move get a new position.
+func (s *BookService) Reorder(ctx context.Context, bookshelfID string, order *models.Reorder) error {
+	bookshelf, err := s.getBookshelf(ctx, bookshelfID)
 	if err != nil {
-		if errors.Is(err, mongo.ErrBookshelfNotFound) {
-			return ErrBookshelfNotFound
+		return err
+	}
+	if err := s.policy.Bookshelf(ctx, policy.ActionUpdate, bookshelf); err != nil {
+		return err
+	}
+	if bookshelf.IsSmart() {
+		return ErrSmartBookshelf
+	}
+
+	positions, err := s.repo.Positions(ctx, bookshelfID)
+	if err != nil {
+		return fmt.Errorf("failed to get book positions: %w", err)
+	}
+	changed, err := ordering.Apply(positions, order)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if err := s.repo.SetPositions(ctx, bookshelfID, changed); err != nil {
+		return fmt.Errorf("failed to set book positions: %w", err)
+	}
+	return nil
+}
+
+// bookshelfSet drops empty and repeated bookshelf IDs.
+func bookshelfSet(bookshelfIDs []string) []string {
+	var set []string
+	for _, bookshelfID := range bookshelfIDs {
+		if bookshelfID != "" && !slices.Contains(set, bookshelfID) {
+			set = append(set, bookshelfID)
+		}
+	}
+	return set
+}
+
+// tagSet trims the tags and drops empty and repeated ones.
+func tagSet(tags []string) []string {
+	var set []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(set, tag) {
+			set = append(set, tag)
 		}
-		return fmt.Errorf("failed to get bookshelf: %w", err)
 	}
+	return set
+}
 
-	// 3. Get userID from context
-	userID, ok := ctx.Value("userID").(string)
-	if !ok {
-		return ErrUserNotFoundInContext
+// Delete deletes a book.
+func (s *BookService) Delete(ctx context.Context, bookID string) error {
+	book, err := s.getBook(ctx, bookID)
+	if err != nil {
+		return err
 	}
 
-	// 4. Check bookshelf ownership
-	if bookshelf.UserID != userID {
-		return ErrNotAuthorized
+	if err := s.policy.Book(ctx, policy.ActionDelete, book); err != nil {
+		return err
 	}
 
-	// 5. If authorized, proceed to delete:
 	if err := s.repo.Delete(ctx, bookID); err != nil {
 		return fmt.Errorf("failed to delete book: %w", err)
 	}
@@ -221,51 +723,209 @@ func (s *BookService) Delete(ctx context.Context, bookID string) error {
 	return nil
 }
 
-func (s *BookService) AddAdvanced(ctx context.Context, isbn string, index int) error {
+// getBook loads a book and maps storage errors to service errors.
+func (s *BookService) getBook(ctx context.Context, bookID string) (*models.Book, error) {
+	book, err := s.repo.GetByID(ctx, bookID)
+	if err != nil {
+		if errors.Is(err, repository.ErrBookNotFound) {
+			return nil, ErrBookNotFound
+		}
+		return nil, fmt.Errorf("failed to get book: %w", err)
+	}
+	return book, nil
+}
+
+// getBookshelf loads a bookshelf and maps storage errors to service errors.
+func (s *BookService) getBookshelf(ctx context.Context, bookshelfID string) (*models.Bookshelf, error) {
+	bookshelf, err := s.bookshelfRepo.GetByID(ctx, bookshelfID)
+	if err != nil {
+		if errors.Is(err, repository.ErrBookshelfNotFound) {
+			return nil, ErrBookshelfNotFound
+		}
+		return nil, fmt.Errorf("failed to get bookshelf: %w", err)
+	}
+	return bookshelf, nil
+}
+
+// AddAdvanced adds an offer from the advanced search results to the user's library.
+// The offer is also stored in the shared catalog if the ISBN is not there yet.
+func (s *BookService) AddAdvanced(ctx context.Context, isbn string, index int, bookshelfID string) (*models.Book, error) {
+	if _, err := policy.UserID(ctx); err != nil {
+		return nil, err
+	}
+
 	resp, err := s.searcher.Advanced(ctx, isbn)
 	if err != nil {
-		if errors.Is(err, search.ErrISBNNotFound) {
-			return fmt.Errorf("nothing found by isbn: %w", err)
+		if errors.Is(err, search.ErrISBNNotFound) || errors.Is(err, search.ErrISBNRequired) {
+			return nil, err
 		}
 		s.log.Error("failed to search", slog.Any("error", err))
-		return fmt.Errorf("failed to search: %w", err)
+		return nil, fmt.Errorf("failed to search: %w", err)
 	}
 
-	if index >= len(resp.Books) {
-		return errors.New("invalid index")
+	if resp.Status == searchrpc.StatusFailed {
+		return nil, fmt.Errorf("%w: %s", ErrSearchFailed, resp.Reason)
+	}
+	if resp.Status != searcherv1.SearchByISBNResponse_SUCCESS {
+		return nil, ErrSearchNotFinished
+	}
+
+	if index < 0 || index >= len(resp.Books) {
+		return nil, ErrInvalidIndex
+	}
+	offer := resp.Books[index]
+
+	book := &models.Book{
+		BookshelfIDs: []string{bookshelfID},
+		ISBN:         offer.ISBN, // normalized by the search
+		Title:        offer.Title,
+		Author:       offer.Author,
+		Publishing:   offer.Publishing,
+		Description:  offer.Description,
+		CoverImage:   offer.CoverImage,
+		ShopName:     offer.ShopName,
 	}
 
-	// Добавляем книгу в allBooksRepo
-	// Проверяем, существует ли книга по ISBN
-	_, err = s.allBooksRepo.GetByISBN(ctx, isbn)
-	if errors.Is(err, mongo.ErrBookNotFound) {
-		// Книги нет в allBooksRepo, можно добавить
-		book := resp.Books[index]
-		allBook := &models.Book{
-			Title:       book.Title,
-			Author:      book.Author,
-			ISBN:        book.ISBN,
-			Publishing:  book.Publishing,
-			Description: book.Description,
-			CoverImage:  book.CoverImage,
-			ShopName:    book.ShopName,
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
-			// UserID и BookshelfID не устанавливаем
+	// Check the same rules as Create before touching the catalog.
+	if err := s.checkCreate(ctx, book); err != nil {
+		return nil, err
+	}
+
+	entry, err := s.addToCatalog(ctx, book)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store(ctx, book, entry); err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// addToCatalog returns the catalog entry for the ISBN of the book and creates
+// it from the book when the ISBN is new. Existing catalog records are never
+// overwritten; an offer from another shop is recorded as an extra edition.
+func (s *BookService) addToCatalog(ctx context.Context, book *models.Book) (*models.CatalogEntry, error) {
+	entry, err := s.findCatalogEntry(ctx, book.ISBN)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry != nil {
+		edition := models.EditionOf(book)
+		if edition == (models.Edition{}) || slices.Contains(entry.Editions, edition) {
+			return entry, nil
+		}
+		if err := s.catalog.AddEdition(ctx, entry.ID, edition); err != nil {
+			s.log.Error("failed to add edition to catalog", slog.Any("error", err))
+			return nil, ErrCantAddToAllBooks
 		}
+		entry.Editions = append(entry.Editions, edition)
+
+		// The first edition is the default one, which the linked books show
+		// and are filtered by.
+		if len(entry.Editions) == 1 {
+			if err := s.repo.SyncCatalog(ctx, entry); err != nil {
+				s.log.Error("failed to sync books with catalog", slog.Any("error", err))
+				return nil, ErrCantAddToAllBooks
+			}
+		}
+		return entry, nil
+	}
 
-		if err := s.allBooksRepo.Create(ctx, allBook); err != nil {
-			s.log.Error("failed to create book in allBooksRepo", slog.Any("error", err))
-			return ErrCantAddToAllBooks
+	entry = models.NewCatalogEntry(book)
+	if err := s.catalog.Create(ctx, entry); err != nil {
+		if errors.Is(err, repository.ErrCatalogEntryAlreadyExists) {
+			// Another request created the entry in the meantime.
+			return s.findCatalogEntry(ctx, book.ISBN)
 		}
+		s.log.Error("failed to create catalog entry", slog.Any("error", err))
+		return nil, ErrCantAddToAllBooks
+	}
 
-		return nil
+	return entry, nil
+}
+
+// findCatalogEntry returns the catalog entry for an ISBN, or nil if the
+// ISBN is not in the catalog.
+func (s *BookService) findCatalogEntry(ctx context.Context, isbn string) (*models.CatalogEntry, error) {
+	if isbn == "" {
+		return nil, nil
 	}
+
+	entry, err := s.catalog.GetByISBN(ctx, isbn)
 	if err != nil {
-		s.log.Error("failed to check for existing book in allBooksRepo", slog.Any("error", err))
-		return fmt.Errorf("failed to check for existing book in allBooksRepo: %w", err)
+		if errors.Is(err, repository.ErrCatalogEntryNotFound) {
+			return nil, nil
+		}
+		s.log.Error("failed to get catalog entry", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get catalog entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+// store saves a new user book. A book whose ISBN is in the catalog is linked
+// to the entry: the fields it leaves empty or has equal to the catalog values
+// follow the entry.
+func (s *BookService) store(ctx context.Context, book *models.Book, entry *models.CatalogEntry) error {
+	book.Overrides = nil
+	if entry != nil {
+		book.LinkCatalog(entry)
+	}
+
+	if err := s.repo.Create(ctx, book); err != nil {
+		// A concurrent request put the same ISBN on the shelf.
+		if errors.Is(err, repository.ErrBookAlreadyExists) {
+			return ErrBookAlreadyExists
+		}
+		return fmt.Errorf("failed to create book: %w", err)
 	}
 
-	return ErrBookAlreadyExistsInALL
-	// Если книга уже существует, ничего не делаем
+	return nil
+}
+
+// resolveMetadata turns the metadata of an update into the values stored with
+// the book. A new ISBN links the book to another catalog entry, or to none.
+// The update then sets every metadata field and the overrides of the book.
+func (s *BookService) resolveMetadata(ctx context.Context, book *models.Book, update *models.BookUpdate) error {
+	var entry *models.CatalogEntry
+	var err error
+	switch {
+	case update.ISBN != nil && *update.ISBN != book.ISBN:
+		if entry, err = s.findCatalogEntry(ctx, *update.ISBN); err != nil {
+			return err
+		}
+	case book.CatalogID != "":
+		entry, err = s.catalog.GetByID(ctx, book.CatalogID)
+		if errors.Is(err, repository.ErrCatalogEntryNotFound) {
+			entry = nil
+		} else if err != nil {
+			s.log.Error("failed to get catalog entry", slog.Any("error", err))
+			return fmt.Errorf("failed to get catalog entry: %w", err)
+		}
+	}
+
+	doc := *book
+	if entry == nil && (update.ISBN == nil || *update.ISBN == book.ISBN) {
+		// The entry is gone: the book keeps the values it has.
+		doc.CatalogID, doc.Overrides = "", nil
+	}
+	doc.ApplyMetadata(update, entry)
+
+	update.CatalogID = &doc.CatalogID
+	update.Title, update.Author, update.Publishing = &doc.Title, &doc.Author, &doc.Publishing
+	update.Description, update.CoverImage, update.ShopName = &doc.Description, &doc.CoverImage, &doc.ShopName
+	update.Overrides = &doc.Overrides
+	return nil
+}
+
+// normalizeISBN validates an ISBN and returns its canonical ISBN-13 form.
+func normalizeISBN(s string) (string, error) {
+	normalized, err := isbn.Normalize(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidISBN, err)
+	}
+	return normalized, nil
 }
@@ -2,13 +2,21 @@ package book
 
 import (
 	"context"
+	"encoding/json"
+	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/searchrpc"
 	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/pagination"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/policy"
 	"github.com/getz-devs/librakeeper-server/internal/server/services/search"
 	"github.com/getz-devs/librakeeper-server/internal/server/storage/mongo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"log/slog"
 	"os"
+	"slices"
 	"testing"
 	"time"
 )
@@ -42,16 +50,40 @@ func (m *MockRepository) GetByISBN(ctx context.Context, isbn string) (*models.Bo
 	return args.Get(0).(*models.Book), args.Error(1)
 }
 
+// GetByISBNAndUser mocks the GetByISBNAndUser method of the BookRepo interface.
+func (m *MockRepository) GetByISBNAndUser(ctx context.Context, isbn, userID string) (*models.Book, error) {
+	args := m.Called(ctx, isbn, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
 // GetByUserID mocks the GetByUserID method of the BookRepo interface.
-func (m *MockRepository) GetByUserID(ctx context.Context, userID string, page int64, limit int64) ([]*models.Book, error) {
-	args := m.Called(ctx, userID, page, limit)
-	return args.Get(0).([]*models.Book), args.Error(1)
+func (m *MockRepository) GetByUserID(ctx context.Context, userID string, opts *models.BookListOptions) (*models.BookPage, error) {
+	args := m.Called(ctx, userID, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BookPage), args.Error(1)
 }
 
 // GetByBookshelfID mocks the GetByBookshelfID method of the BookRepo interface.
-func (m *MockRepository) GetByBookshelfID(ctx context.Context, bookshelfID string, page int64, limit int64) ([]*models.Book, error) {
-	args := m.Called(ctx, bookshelfID, page, limit)
-	return args.Get(0).([]*models.Book), args.Error(1)
+func (m *MockRepository) GetByBookshelfID(ctx context.Context, bookshelfID string, opts *models.BookListOptions) (*models.BookPage, error) {
+	args := m.Called(ctx, bookshelfID, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BookPage), args.Error(1)
+}
+
+// GetByBookshelves mocks the GetByBookshelves method of the BookRepo interface.
+func (m *MockRepository) GetByBookshelves(ctx context.Context, bookshelfIDs []string, opts *models.BookListOptions) (*models.BookPage, error) {
+	args := m.Called(ctx, bookshelfIDs, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BookPage), args.Error(1)
 }
 
 // CountInBookshelf mocks the CountInBookshelf method of the BookRepo interface.
@@ -72,6 +104,32 @@ func (m *MockRepository) Update(ctx context.Context, id string, update *models.B
 	return args.Error(0)
 }
 
+// Reshelve mocks the Reshelve method of the BookRepo interface.
+func (m *MockRepository) Reshelve(ctx context.Context, changes []models.ShelfChange) error {
+	args := m.Called(ctx, changes)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SyncCatalog(ctx context.Context, entry *models.CatalogEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+// Positions mocks the Positions method of the BookRepo interface.
+func (m *MockRepository) Positions(ctx context.Context, bookshelfID string) ([]models.Position, error) {
+	args := m.Called(ctx, bookshelfID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Position), args.Error(1)
+}
+
+// SetPositions mocks the SetPositions method of the BookRepo interface.
+func (m *MockRepository) SetPositions(ctx context.Context, bookshelfID string, positions map[string]string) error {
+	args := m.Called(ctx, bookshelfID, positions)
+	return args.Error(0)
+}
+
 // Delete mocks the Delete method of the BookRepo interface.
 func (m *MockRepository) Delete(ctx context.Context, id string) error {
 	args := m.Called(ctx, id)
@@ -99,9 +157,12 @@ func (m *MockBookshelfRepository) GetByID(ctx context.Context, id string) (*mode
 }
 
 // GetByUser mocks the GetByUser method of the BookshelfRepo interface.
-func (m *MockBookshelfRepository) GetByUser(ctx context.Context, userID string, page int64, limit int64) ([]*models.Bookshelf, error) {
-	args := m.Called(ctx, userID, page, limit)
-	return args.Get(0).([]*models.Bookshelf), args.Error(1)
+func (m *MockBookshelfRepository) GetByUser(ctx context.Context, userID string, opts *models.BookshelfListOptions) (*models.BookshelfPage, error) {
+	args := m.Called(ctx, userID, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BookshelfPage), args.Error(1)
 }
 
 // CountByUser mocks the CountByUser method of the BookshelfRepo interface.
@@ -110,34 +171,136 @@ func (m *MockBookshelfRepository) CountByUser(ctx context.Context, userID string
 	return args.Int(0), args.Error(1)
 }
 
-// ExistsByNameAndUser mocks the ExistsByNameAndUser method of the BookshelfRepo interface.
-func (m *MockBookshelfRepository) ExistsByNameAndUser(ctx context.Context, name, userID string) (bool, error) {
-	args := m.Called(ctx, name, userID)
+// ExistsByNameAndParent mocks the ExistsByNameAndParent method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) ExistsByNameAndParent(ctx context.Context, name, userID, parentID string) (bool, error) {
+	args := m.Called(ctx, name, userID, parentID)
 	return args.Bool(0), args.Error(1)
 }
 
+// GetSubtree mocks the GetSubtree method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) GetSubtree(ctx context.Context, id string) ([]*models.Bookshelf, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Bookshelf), args.Error(1)
+}
+
+// CountBooks mocks the CountBooks method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) CountBooks(ctx context.Context, ids []string) (int, error) {
+	args := m.Called(ctx, ids)
+	return args.Int(0), args.Error(1)
+}
+
+// CountBooksByGroup mocks the CountBooksByGroup method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) CountBooksByGroup(ctx context.Context, groups map[string][]string) (map[string]int, error) {
+	args := m.Called(ctx, groups)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
 // Update mocks the Update method of the BookshelfRepo interface.
 func (m *MockBookshelfRepository) Update(ctx context.Context, id string, update *models.BookshelfUpdate) error {
 	args := m.Called(ctx, id, update)
 	return args.Error(0)
 }
 
+// Positions mocks the Positions method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) Positions(ctx context.Context, userID, parentID string) ([]models.Position, error) {
+	args := m.Called(ctx, userID, parentID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Position), args.Error(1)
+}
+
+// SetPositions mocks the SetPositions method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) SetPositions(ctx context.Context, positions map[string]string) error {
+	args := m.Called(ctx, positions)
+	return args.Error(0)
+}
+
 // Delete mocks the Delete method of the BookshelfRepo interface.
 func (m *MockBookshelfRepository) Delete(ctx context.Context, id string) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+// DeleteWithBooks mocks the DeleteWithBooks method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) DeleteWithBooks(ctx context.Context, id string, opts *models.BookshelfDeleteOptions) (*models.BookshelfDeleteResult, error) {
+	args := m.Called(ctx, id, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BookshelfDeleteResult), args.Error(1)
+}
+
 // Helper function to create a pointer to a string
+// MockSearchRepo is a mock implementation of the repository.SearchRepo interface.
+type MockSearchRepo struct {
+	mock.Mock
+}
+
+func (m *MockSearchRepo) SearchByISBN(ctx context.Context, isbn string, force bool) (*repository.SearchResult, error) {
+	args := m.Called(ctx, isbn, force)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.SearchResult), args.Error(1)
+}
+
+// MockCatalogRepo is a mock implementation of the repository.CatalogRepo interface.
+type MockCatalogRepo struct {
+	mock.Mock
+}
+
+func (m *MockCatalogRepo) Create(ctx context.Context, entry *models.CatalogEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *MockCatalogRepo) GetByID(ctx context.Context, id string) (*models.CatalogEntry, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CatalogEntry), args.Error(1)
+}
+
+func (m *MockCatalogRepo) GetByISBN(ctx context.Context, isbn string) (*models.CatalogEntry, error) {
+	args := m.Called(ctx, isbn)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CatalogEntry), args.Error(1)
+}
+
+func (m *MockCatalogRepo) AddEdition(ctx context.Context, id string, edition models.Edition) error {
+	args := m.Called(ctx, id, edition)
+	return args.Error(0)
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
 
+// Helper function to create a cursor codec with a fixed secret
+func newCursors(t *testing.T) *pagination.Cursors {
+	cursors, err := pagination.NewCursors("test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cursors
+}
+
 // -- Tests -- //
 
 func TestBookService_Create_Success(t *testing.T) {
 	repo := new(MockRepository)
 	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
 	searcher := new(search.SearchService)
 	log := slog.New(slog.NewTextHandler(
 		//io.Discard,
@@ -147,9 +310,11 @@ func TestBookService_Create_Success(t *testing.T) {
 	))
 	service := &BookService{
 		repo:          repo,
-		allBooksRepo:  repo, // In this test, both repos are the same mock
+		catalog:       catalogRepo,
 		bookshelfRepo: bookshelfRepo,
 		searcher:      searcher,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
 		log:           log,
 		bookLimit:     1000,
 	}
@@ -159,26 +324,29 @@ func TestBookService_Create_Success(t *testing.T) {
 	ctx = context.WithValue(ctx, "userID", userID)
 
 	book := &models.Book{
-		UserID:      userID,
-		BookshelfID: "testbookshelf",
-		ISBN:        "1234567890",
-		Title:       "Test Book",
-		Author:      "Test Author",
+		UserID:       userID,
+		BookshelfIDs: []string{"testbookshelf"},
+		ISBN:         "9785446120581",
+		Title:        "Test Book",
+		Author:       "Test Author",
 	}
 
 	// Mock the bookshelfRepo.GetByID to return a valid bookshelf
-	bookshelfRepo.On("GetByID", ctx, book.BookshelfID).Return(
+	bookshelfRepo.On("GetByID", ctx, book.BookshelfIDs[0]).Return(
 		&models.Bookshelf{
-			ID:     book.BookshelfID,
+			ID:     book.BookshelfIDs[0],
 			UserID: userID,
 		}, nil,
 	)
 
 	// Mock the repo.CountInBookshelf to return a count less than the limit
-	repo.On("CountInBookshelf", ctx, book.BookshelfID).Return(500, nil)
+	repo.On("CountInBookshelf", ctx, book.BookshelfIDs[0]).Return(500, nil)
 
 	// Mock the repo.ExistsInBookshelf to return false (book doesn't exist)
-	repo.On("ExistsInBookshelf", ctx, book.ISBN, book.BookshelfID).Return(false, nil)
+	repo.On("ExistsInBookshelf", ctx, book.ISBN, book.BookshelfIDs[0]).Return(false, nil)
+
+	// Mock the catalogRepo.GetByISBN to return no catalog entry
+	catalogRepo.On("GetByISBN", ctx, book.ISBN).Return(nil, mongo.ErrCatalogEntryNotFound)
 
 	// Mock the repo.Create to return no error
 	repo.On("Create", ctx, book).Return(nil)
@@ -193,13 +361,16 @@ func TestBookService_Create_Success(t *testing.T) {
 func TestBookService_Create_ErrorTitleAndAuthorRequired(t *testing.T) {
 	repo := new(MockRepository)
 	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
 	searcher := new(search.SearchService)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookService{
 		repo:          repo,
-		allBooksRepo:  repo,
+		catalog:       catalogRepo,
 		bookshelfRepo: bookshelfRepo,
 		searcher:      searcher,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
 		log:           log,
 		bookLimit:     1000,
 	}
@@ -213,29 +384,29 @@ func TestBookService_Create_ErrorTitleAndAuthorRequired(t *testing.T) {
 		{
 			name: "Missing Title",
 			book: &models.Book{
-				UserID:      "testuser",
-				BookshelfID: "testbookshelf",
-				ISBN:        "1234567890",
-				Author:      "Test Author",
+				UserID:       "testuser",
+				BookshelfIDs: []string{"testbookshelf"},
+				ISBN:         "9785446120581",
+				Author:       "Test Author",
 			},
 			error: ErrTitleAndAuthorRequired,
 		},
 		{
 			name: "Missing Author",
 			book: &models.Book{
-				UserID:      "testuser",
-				BookshelfID: "testbookshelf",
-				ISBN:        "1234567890",
-				Title:       "Test Book",
+				UserID:       "testuser",
+				BookshelfIDs: []string{"testbookshelf"},
+				ISBN:         "9785446120581",
+				Title:        "Test Book",
 			},
 			error: ErrTitleAndAuthorRequired,
 		},
 		{
 			name: "Missing Title and Author",
 			book: &models.Book{
-				UserID:      "testuser",
-				BookshelfID: "testbookshelf",
-				ISBN:        "1234567890",
+				UserID:       "testuser",
+				BookshelfIDs: []string{"testbookshelf"},
+				ISBN:         "9785446120581",
 			},
 			error: ErrTitleAndAuthorRequired,
 		},
@@ -259,13 +430,16 @@ func TestBookService_Create_ErrorTitleAndAuthorRequired(t *testing.T) {
 func TestBookService_Create_ErrorUserNotFoundInContext(t *testing.T) {
 	repo := new(MockRepository)
 	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
 	searcher := new(search.SearchService)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookService{
 		repo:          repo,
-		allBooksRepo:  repo,
+		catalog:       catalogRepo,
 		bookshelfRepo: bookshelfRepo,
 		searcher:      searcher,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
 		log:           log,
 		bookLimit:     1000,
 	}
@@ -273,11 +447,11 @@ func TestBookService_Create_ErrorUserNotFoundInContext(t *testing.T) {
 	ctx := context.Background()
 
 	book := &models.Book{
-		UserID:      "testuser",
-		BookshelfID: "testbookshelf",
-		ISBN:        "1234567890",
-		Title:       "Test Book",
-		Author:      "Test Author",
+		UserID:       "testuser",
+		BookshelfIDs: []string{"testbookshelf"},
+		ISBN:         "9785446120581",
+		Title:        "Test Book",
+		Author:       "Test Author",
 	}
 
 	err := service.Create(ctx, book)
@@ -290,29 +464,32 @@ func TestBookService_Create_ErrorUserNotFoundInContext(t *testing.T) {
 func TestBookService_GetByID_Success(t *testing.T) {
 	repo := new(MockRepository)
 	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
 	searcher := new(search.SearchService)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookService{
 		repo:          repo,
-		allBooksRepo:  repo, // В этом тесте, allBooksRepo - тот же мок
+		catalog:       catalogRepo,
 		bookshelfRepo: bookshelfRepo,
 		searcher:      searcher,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
 		log:           log,
 		bookLimit:     1000,
 	}
 
-	ctx := context.Background()
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
 	bookID := "testbookid"
 
 	expectedBook := &models.Book{
-		ID:          bookID,
-		UserID:      "testuser",
-		BookshelfID: "testbookshelf",
-		ISBN:        "1234567890",
-		Title:       "Test Book",
-		Author:      "Test Author",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ID:           bookID,
+		UserID:       "testuser",
+		BookshelfIDs: []string{"testbookshelf"},
+		ISBN:         "9785446120581",
+		Title:        "Test Book",
+		Author:       "Test Author",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
 	}
 
 	repo.On("GetByID", ctx, bookID).Return(expectedBook, nil)
@@ -327,18 +504,21 @@ func TestBookService_GetByID_Success(t *testing.T) {
 func TestBookService_GetByID_ErrorBookNotFound(t *testing.T) {
 	repo := new(MockRepository)
 	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
 	searcher := new(search.SearchService)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookService{
 		repo:          repo,
-		allBooksRepo:  repo,
+		catalog:       catalogRepo,
 		bookshelfRepo: bookshelfRepo,
 		searcher:      searcher,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
 		log:           log,
 		bookLimit:     1000,
 	}
 
-	ctx := context.Background()
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
 	bookID := "nonexistentbookid"
 
 	repo.On("GetByID", ctx, bookID).Return(nil, mongo.ErrBookNotFound)
@@ -353,13 +533,16 @@ func TestBookService_GetByID_ErrorBookNotFound(t *testing.T) {
 func TestBookService_Update_Success(t *testing.T) {
 	repo := new(MockRepository)
 	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
 	searcher := new(search.SearchService)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookService{
 		repo:          repo,
-		allBooksRepo:  repo,
+		catalog:       catalogRepo,
 		bookshelfRepo: bookshelfRepo,
 		searcher:      searcher,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
 		log:           log,
 		bookLimit:     1000,
 	}
@@ -378,23 +561,16 @@ func TestBookService_Update_Success(t *testing.T) {
 	}
 
 	existingBook := &models.Book{
-		ID:          bookID,
-		UserID:      userID,
-		BookshelfID: "testbookshelf",
-		ISBN:        "1234567890",
-		Title:       "Test Book",
-		Author:      "Test Author",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ID:           bookID,
+		UserID:       userID,
+		BookshelfIDs: []string{"testbookshelf"},
+		ISBN:         "9785446120581",
+		Title:        "Test Book",
+		Author:       "Test Author",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
 	}
 
-	bookshelfRepo.On("GetByID", ctx, existingBook.BookshelfID).Return(
-		&models.Bookshelf{
-			ID:     existingBook.BookshelfID,
-			UserID: userID,
-		}, nil,
-	)
-
 	repo.On("GetByID", ctx, bookID).Return(existingBook, nil)
 	repo.On("Update", ctx, bookID, update).Return(nil)
 
@@ -405,16 +581,361 @@ func TestBookService_Update_Success(t *testing.T) {
 	bookshelfRepo.AssertExpectations(t)
 }
 
+func TestBookService_Update_RelinksCatalogOnISBNChange(t *testing.T) {
+	repo := new(MockRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:      repo,
+		catalog:   catalogRepo,
+		searcher:  new(search.SearchService),
+		policy:    policy.New(log),
+		cursors:   newCursors(t),
+		log:       log,
+		bookLimit: 1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	bookID := "testbookid"
+	update := &models.BookUpdate{ISBN: stringPtr("9785171183660")}
+
+	repo.On("GetByID", ctx, bookID).Return(&models.Book{ID: bookID, UserID: "testuser", ISBN: "9785446120581", CatalogID: "old"}, nil)
+	catalogRepo.On("GetByISBN", ctx, "9785171183660").Return(&models.CatalogEntry{ID: "new"}, nil)
+	repo.On("Update", ctx, bookID, mock.MatchedBy(func(u *models.BookUpdate) bool {
+		return u.CatalogID != nil && *u.CatalogID == "new"
+	})).Return(nil)
+
+	err := service.Update(ctx, bookID, update)
+
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+	catalogRepo.AssertExpectations(t)
+}
+
+func TestBookService_Update_OverridesCatalogFields(t *testing.T) {
+	repo := new(MockRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:      repo,
+		catalog:   catalogRepo,
+		searcher:  new(search.SearchService),
+		policy:    policy.New(log),
+		cursors:   newCursors(t),
+		log:       log,
+		bookLimit: 1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	bookID := "testbookid"
+	entry := &models.CatalogEntry{
+		ID:           "entry1",
+		ISBN13:       "9785446120581",
+		Title:        "Catalog Title",
+		Description:  "Catalog Description",
+		Contributors: []models.Contributor{{Name: "Catalog Author", Role: models.RoleAuthor}},
+	}
+	book := &models.Book{ID: bookID, UserID: "testuser", ISBN: "9785446120581", CatalogID: "entry1",
+		Title: "Own Title", Author: "Catalog Author", Description: "Catalog Description", Overrides: []string{models.FieldTitle}}
+
+	// An empty description clears it; a null title follows the catalog again.
+	var update models.BookUpdate
+	require.NoError(t, json.Unmarshal([]byte(`{"title": null, "description": ""}`), &update))
+
+	repo.On("GetByID", ctx, bookID).Return(book, nil)
+	catalogRepo.On("GetByID", ctx, "entry1").Return(entry, nil)
+	repo.On("Update", ctx, bookID, mock.MatchedBy(func(u *models.BookUpdate) bool {
+		return *u.CatalogID == "entry1" && *u.Title == "Catalog Title" && *u.Author == "Catalog Author" &&
+			*u.Description == "" && slices.Equal(*u.Overrides, []string{models.FieldDescription})
+	})).Return(nil)
+
+	err := service.Update(ctx, bookID, &update)
+
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+	catalogRepo.AssertExpectations(t)
+}
+
+func TestBookService_Update_KeepsValuesOfRemovedCatalogEntry(t *testing.T) {
+	repo := new(MockRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:      repo,
+		catalog:   catalogRepo,
+		searcher:  new(search.SearchService),
+		policy:    policy.New(log),
+		cursors:   newCursors(t),
+		log:       log,
+		bookLimit: 1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	bookID := "testbookid"
+	update := &models.BookUpdate{Tags: &[]string{"classic"}}
+
+	repo.On("GetByID", ctx, bookID).Return(&models.Book{ID: bookID, UserID: "testuser", ISBN: "9785446120581", CatalogID: "gone", Title: "Catalog Title"}, nil)
+	catalogRepo.On("GetByID", ctx, "gone").Return(nil, repository.ErrCatalogEntryNotFound)
+	repo.On("Update", ctx, bookID, mock.MatchedBy(func(u *models.BookUpdate) bool {
+		return *u.CatalogID == "" && *u.Title == "Catalog Title" && *u.Overrides == nil
+	})).Return(nil)
+
+	err := service.Update(ctx, bookID, update)
+
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+	catalogRepo.AssertExpectations(t)
+}
+
+func TestBookService_Update_ErrorBookAlreadyExistsInTargetShelf(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		catalog:       new(MockCatalogRepo),
+		bookshelfRepo: bookshelfRepo,
+		searcher:      new(search.SearchService),
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	bookID := "testbookid"
+	update := &models.BookUpdate{BookshelfIDs: &[]string{"shelf2"}}
+
+	repo.On("GetByID", ctx, bookID).Return(&models.Book{ID: bookID, UserID: "testuser", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581"}, nil)
+	bookshelfRepo.On("GetByID", ctx, "shelf2").Return(&models.Bookshelf{ID: "shelf2", UserID: "testuser"}, nil)
+	repo.On("CountInBookshelf", ctx, "shelf2").Return(0, nil)
+	repo.On("ExistsInBookshelf", ctx, "9785446120581", "shelf2").Return(true, nil)
+
+	err := service.Update(ctx, bookID, update)
+
+	assert.ErrorIs(t, err, ErrBookAlreadyExists)
+	repo.AssertNotCalled(t, "Update", ctx, bookID, update)
+}
+
+func TestBookService_Update_ReshelvesBook(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		catalog:       new(MockCatalogRepo),
+		bookshelfRepo: bookshelfRepo,
+		searcher:      new(search.SearchService),
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	bookID := "testbookid"
+	update := &models.BookUpdate{BookshelfIDs: &[]string{"shelf3", "shelf2", ""}, Title: stringPtr("Updated Title")}
+
+	repo.On("GetByID", ctx, bookID).Return(&models.Book{ID: bookID, UserID: "testuser", BookshelfIDs: []string{"shelf1", "shelf3"}, ISBN: "9785446120581"}, nil)
+	bookshelfRepo.On("GetByID", ctx, "shelf2").Return(&models.Bookshelf{ID: "shelf2", UserID: "testuser"}, nil)
+	repo.On("CountInBookshelf", ctx, "shelf2").Return(3, nil)
+	repo.On("ExistsInBookshelf", ctx, "9785446120581", "shelf2").Return(false, nil)
+	// Leaving one bookshelf for another is a move; shelf3 is kept. The move
+	// is written with the title.
+	repo.On("Update", ctx, bookID, mock.MatchedBy(func(u *models.BookUpdate) bool {
+		return *u.Title == "Updated Title" && slices.Equal(u.Shelves, []models.ShelfChange{{BookID: bookID, From: "shelf1", To: "shelf2"}})
+	})).Return(nil)
+
+	err := service.Update(ctx, bookID, update)
+
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+	bookshelfRepo.AssertExpectations(t)
+}
+
+func TestBookService_Update_DeduplicatesBookshelves(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		catalog:       new(MockCatalogRepo),
+		bookshelfRepo: bookshelfRepo,
+		searcher:      new(search.SearchService),
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	bookID := "testbookid"
+	update := &models.BookUpdate{BookshelfIDs: &[]string{"shelf2", "shelf1", "shelf2"}, ISBN: stringPtr("9785171183660")}
+
+	repo.On("GetByID", ctx, bookID).Return(&models.Book{ID: bookID, UserID: "testuser", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581"}, nil)
+	service.catalog.(*MockCatalogRepo).On("GetByISBN", ctx, "9785171183660").Return(nil, repository.ErrCatalogEntryNotFound)
+	bookshelfRepo.On("GetByID", ctx, "shelf2").Return(&models.Bookshelf{ID: "shelf2", UserID: "testuser"}, nil).Once()
+	repo.On("CountInBookshelf", ctx, "shelf2").Return(0, nil).Once()
+	repo.On("ExistsInBookshelf", ctx, "9785171183660", "shelf2").Return(false, nil).Once()
+	repo.On("ExistsInBookshelf", ctx, "9785171183660", "shelf1").Return(false, nil).Once()
+	repo.On("Update", ctx, bookID, mock.MatchedBy(func(u *models.BookUpdate) bool {
+		return len(*u.BookshelfIDs) == 2 && slices.Equal(u.Shelves, []models.ShelfChange{{BookID: bookID, To: "shelf2"}})
+	})).Return(nil)
+
+	err := service.Update(ctx, bookID, update)
+
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+	bookshelfRepo.AssertExpectations(t)
+}
+
+func TestBookService_MoveMany(t *testing.T) {
+	books := map[string]*models.Book{
+		"b1":      {ID: "b1", UserID: "testuser", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581"},
+		"b2":      {ID: "b2", UserID: "testuser", BookshelfIDs: []string{"shelf1"}, ISBN: "9785171183660"},
+		"b3":      {ID: "b3", UserID: "testuser", BookshelfIDs: []string{"shelf2"}, ISBN: "9785446120581"},
+		"noisbn":  {ID: "noisbn", UserID: "testuser"},
+		"multi":   {ID: "multi", UserID: "testuser", BookshelfIDs: []string{"shelf1", "shelf2"}, ISBN: "9780306406157"},
+		"foreign": {ID: "foreign", UserID: "otheruser", BookshelfIDs: []string{"other"}},
+	}
+	bookshelves := map[string]*models.Bookshelf{
+		"shelf1": {ID: "shelf1", UserID: "testuser"},
+		"shelf2": {ID: "shelf2", UserID: "testuser"},
+		"full":   {ID: "full", UserID: "testuser"},
+		"empty":  {ID: "empty", UserID: "testuser"},
+		"other":  {ID: "other", UserID: "otheruser"},
+	}
+
+	tests := []struct {
+		name        string
+		move        models.BookMove
+		wantErr     error
+		wantChanges []models.ShelfChange
+		wantSame    []string
+	}{
+		{
+			name: "moves and skips books already there",
+			move: models.BookMove{BookIDs: []string{"b2", "noisbn", "b2", "b3"}, BookshelfID: "shelf2"},
+			wantChanges: []models.ShelfChange{
+				{BookID: "b2", From: "shelf1", To: "shelf2"},
+				{BookID: "noisbn", To: "shelf2"},
+			},
+			wantSame: []string{"b3"},
+		},
+		{name: "unshelves", move: models.BookMove{BookIDs: []string{"b1"}}, wantChanges: []models.ShelfChange{{BookID: "b1", From: "shelf1"}}, wantSame: []string{}},
+		{name: "from one of several bookshelves", move: models.BookMove{BookIDs: []string{"multi"}, FromBookshelfID: "shelf1", BookshelfID: "empty"}, wantChanges: []models.ShelfChange{{BookID: "multi", From: "shelf1", To: "empty"}}, wantSame: []string{}},
+		{name: "to a bookshelf the book is on", move: models.BookMove{BookIDs: []string{"multi"}, FromBookshelfID: "shelf1", BookshelfID: "shelf2"}, wantChanges: []models.ShelfChange{{BookID: "multi", From: "shelf1", To: "shelf2"}}, wantSame: []string{}},
+		{name: "several bookshelves without from", move: models.BookMove{BookIDs: []string{"multi"}, BookshelfID: "empty"}, wantErr: ErrAmbiguousMove},
+		{name: "not on from", move: models.BookMove{BookIDs: []string{"b3"}, FromBookshelfID: "shelf1", BookshelfID: "empty"}, wantErr: ErrNotOnBookshelf},
+		{name: "no books", move: models.BookMove{BookshelfID: "shelf2"}, wantErr: ErrNoBooksToMove},
+		{name: "too many books", move: models.BookMove{BookIDs: make([]string, maxMoveBooks+1), BookshelfID: "shelf2"}, wantErr: ErrTooManyBooksToMove},
+		{name: "missing book", move: models.BookMove{BookIDs: []string{"missing"}, BookshelfID: "shelf2"}, wantErr: ErrBookNotFound},
+		{name: "foreign book", move: models.BookMove{BookIDs: []string{"foreign"}, BookshelfID: "shelf2"}, wantErr: ErrNotAuthorized},
+		{name: "missing target", move: models.BookMove{BookIDs: []string{"b1"}, BookshelfID: "missing"}, wantErr: ErrTargetNotFound},
+		{name: "foreign target", move: models.BookMove{BookIDs: []string{"b1"}, BookshelfID: "other"}, wantErr: ErrTargetNotFound},
+		{name: "target full", move: models.BookMove{BookIDs: []string{"b1", "b2"}, BookshelfID: "full"}, wantErr: ErrBookshelfLimitReached},
+		{name: "target has the ISBN", move: models.BookMove{BookIDs: []string{"b1"}, BookshelfID: "shelf2"}, wantErr: ErrBookAlreadyExists},
+		{name: "same ISBN twice", move: models.BookMove{BookIDs: []string{"b1", "b3"}, BookshelfID: "empty"}, wantErr: ErrBookAlreadyExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			bookshelfRepo := new(MockBookshelfRepository)
+			log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			service := &BookService{
+				repo:          repo,
+				bookshelfRepo: bookshelfRepo,
+				policy:        policy.New(log),
+				log:           log,
+				bookLimit:     10,
+			}
+			ctx := context.WithValue(context.Background(), "userID", "testuser")
+
+			for id, book := range books {
+				repo.On("GetByID", ctx, id).Return(book, nil).Maybe()
+			}
+			repo.On("GetByID", ctx, mock.Anything).Return(nil, repository.ErrBookNotFound).Maybe()
+			for id, bookshelf := range bookshelves {
+				bookshelfRepo.On("GetByID", ctx, id).Return(bookshelf, nil).Maybe()
+			}
+			bookshelfRepo.On("GetByID", ctx, mock.Anything).Return(nil, repository.ErrBookshelfNotFound).Maybe()
+			repo.On("CountInBookshelf", ctx, "full").Return(9, nil).Maybe()
+			repo.On("CountInBookshelf", ctx, mock.Anything).Return(1, nil).Maybe()
+			repo.On("ExistsInBookshelf", ctx, "9785446120581", "shelf2").Return(true, nil).Maybe()
+			repo.On("ExistsInBookshelf", ctx, mock.Anything, mock.Anything).Return(false, nil).Maybe()
+			repo.On("Reshelve", ctx, tt.wantChanges).Return(nil).Maybe()
+
+			result, err := service.MoveMany(ctx, &tt.move)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				repo.AssertNotCalled(t, "Reshelve", mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			var moved []string
+			for _, change := range tt.wantChanges {
+				moved = append(moved, change.BookID)
+			}
+			assert.Equal(t, moved, result.Moved)
+			assert.Equal(t, tt.wantSame, result.Unchanged)
+			repo.AssertCalled(t, "Reshelve", ctx, tt.wantChanges)
+		})
+	}
+}
+
+func TestBookService_AddAndRemoveBookshelf(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		bookshelfRepo: bookshelfRepo,
+		policy:        policy.New(log),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	book := &models.Book{ID: "b1", UserID: "testuser", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581"}
+
+	repo.On("GetByID", ctx, "b1").Return(book, nil)
+	bookshelfRepo.On("GetByID", ctx, "shelf2").Return(&models.Bookshelf{ID: "shelf2", UserID: "testuser"}, nil)
+	bookshelfRepo.On("GetByID", ctx, "other").Return(&models.Bookshelf{ID: "other", UserID: "otheruser"}, nil)
+	repo.On("CountInBookshelf", ctx, "shelf2").Return(0, nil)
+	repo.On("ExistsInBookshelf", ctx, "9785446120581", "shelf2").Return(false, nil)
+	repo.On("Reshelve", ctx, []models.ShelfChange{{BookID: "b1", To: "shelf2"}}).Return(nil).Once()
+	repo.On("Reshelve", ctx, []models.ShelfChange{{BookID: "b1", From: "shelf1"}}).Return(nil).Once()
+
+	_, err := service.AddToBookshelf(ctx, "b1", "shelf2")
+	assert.NoError(t, err)
+	_, err = service.AddToBookshelf(ctx, "b1", "shelf1")
+	assert.NoError(t, err, "a book already on the bookshelf is left as it is")
+	_, err = service.AddToBookshelf(ctx, "b1", "other")
+	assert.ErrorIs(t, err, ErrTargetNotFound)
+
+	_, err = service.RemoveFromBookshelf(ctx, "b1", "shelf1")
+	assert.NoError(t, err)
+	_, err = service.RemoveFromBookshelf(ctx, "b1", "shelf2")
+	assert.ErrorIs(t, err, ErrNotOnBookshelf, "the mocked book is still only on shelf1")
+
+	repo.AssertExpectations(t)
+}
+
 func TestBookService_Update_ErrorBookNotFound(t *testing.T) {
 	repo := new(MockRepository)
 	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
 	searcher := new(search.SearchService)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookService{
 		repo:          repo,
-		allBooksRepo:  repo,
+		catalog:       catalogRepo,
 		bookshelfRepo: bookshelfRepo,
 		searcher:      searcher,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
 		log:           log,
 		bookLimit:     1000,
 	}
@@ -438,13 +959,16 @@ func TestBookService_Update_ErrorBookNotFound(t *testing.T) {
 func TestBookService_Delete_Success(t *testing.T) {
 	repo := new(MockRepository)
 	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
 	searcher := new(search.SearchService)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookService{
 		repo:          repo,
-		allBooksRepo:  repo,
+		catalog:       catalogRepo,
 		bookshelfRepo: bookshelfRepo,
 		searcher:      searcher,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
 		log:           log,
 		bookLimit:     1000,
 	}
@@ -455,23 +979,16 @@ func TestBookService_Delete_Success(t *testing.T) {
 	bookID := "testbookid"
 
 	existingBook := &models.Book{
-		ID:          bookID,
-		UserID:      userID,
-		BookshelfID: "testbookshelf",
-		ISBN:        "1234567890",
-		Title:       "Test Book",
-		Author:      "Test Author",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ID:           bookID,
+		UserID:       userID,
+		BookshelfIDs: []string{"testbookshelf"},
+		ISBN:         "9785446120581",
+		Title:        "Test Book",
+		Author:       "Test Author",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
 	}
 
-	bookshelfRepo.On("GetByID", ctx, existingBook.BookshelfID).Return(
-		&models.Bookshelf{
-			ID:     existingBook.BookshelfID,
-			UserID: userID,
-		}, nil,
-	)
-
 	repo.On("GetByID", ctx, bookID).Return(existingBook, nil)
 	repo.On("Delete", ctx, bookID).Return(nil)
 
@@ -485,13 +1002,16 @@ func TestBookService_Delete_Success(t *testing.T) {
 func TestBookService_Delete_ErrorBookNotFound(t *testing.T) {
 	repo := new(MockRepository)
 	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
 	searcher := new(search.SearchService)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookService{
 		repo:          repo,
-		allBooksRepo:  repo,
+		catalog:       catalogRepo,
 		bookshelfRepo: bookshelfRepo,
 		searcher:      searcher,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
 		log:           log,
 		bookLimit:     1000,
 	}
@@ -508,3 +1028,726 @@ func TestBookService_Delete_ErrorBookNotFound(t *testing.T) {
 	assert.ErrorIs(t, err, ErrBookNotFound)
 	repo.AssertExpectations(t)
 }
+
+func TestBookService_CrossUserAccessDenied(t *testing.T) {
+	owner := "owner"
+	intruder := "intruder"
+
+	ownedBook := &models.Book{
+		ID:           "ownedbook",
+		UserID:       owner,
+		BookshelfIDs: []string{"ownedbookshelf"},
+		ISBN:         "9785446120581",
+		Title:        "Test Book",
+		Author:       "Test Author",
+	}
+	ownedBookshelf := &models.Bookshelf{
+		ID:     ownedBook.BookshelfIDs[0],
+		UserID: owner,
+		Name:   "Owner Bookshelf",
+	}
+
+	testCases := []struct {
+		name string
+		call func(ctx context.Context, service *BookService) error
+	}{
+		{
+			name: "GetByID",
+			call: func(ctx context.Context, service *BookService) error {
+				_, err := service.GetByID(ctx, ownedBook.ID)
+				return err
+			},
+		},
+		{
+			name: "GetByUserID",
+			call: func(ctx context.Context, service *BookService) error {
+				_, err := service.GetByUserID(ctx, owner, &models.BookListOptions{Page: 1, Limit: 10})
+				return err
+			},
+		},
+		{
+			name: "GetByBookshelfID",
+			call: func(ctx context.Context, service *BookService) error {
+				_, err := service.GetByBookshelfID(ctx, ownedBookshelf.ID, &models.BookListOptions{Page: 1, Limit: 10})
+				return err
+			},
+		},
+		{
+			name: "Create",
+			call: func(ctx context.Context, service *BookService) error {
+				return service.Create(ctx, &models.Book{
+					BookshelfIDs: []string{ownedBookshelf.ID},
+					ISBN:         "9780306406157",
+					Title:        "Intruder Book",
+					Author:       "Intruder Author",
+				})
+			},
+		},
+		{
+			name: "Update",
+			call: func(ctx context.Context, service *BookService) error {
+				return service.Update(ctx, ownedBook.ID, &models.BookUpdate{Title: stringPtr("Hacked")})
+			},
+		},
+		{
+			name: "Delete",
+			call: func(ctx context.Context, service *BookService) error {
+				return service.Delete(ctx, ownedBook.ID)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			bookshelfRepo := new(MockBookshelfRepository)
+			catalogRepo := new(MockCatalogRepo)
+			log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			service := &BookService{
+				repo:          repo,
+				catalog:       catalogRepo,
+				bookshelfRepo: bookshelfRepo,
+				searcher:      new(search.SearchService),
+				policy:        policy.New(log),
+				cursors:       newCursors(t),
+				log:           log,
+				bookLimit:     1000,
+			}
+
+			ctx := context.WithValue(context.Background(), "userID", intruder)
+
+			repo.On("GetByID", ctx, ownedBook.ID).Return(ownedBook, nil).Maybe()
+			bookshelfRepo.On("GetByID", ctx, ownedBookshelf.ID).Return(ownedBookshelf, nil).Maybe()
+
+			err := tc.call(ctx, service)
+			assert.ErrorIs(t, err, ErrNotAuthorized)
+
+			// Nothing may be read, listed or written on behalf of the intruder.
+			repo.AssertNotCalled(t, "GetByUserID", mock.Anything, mock.Anything, mock.Anything)
+			repo.AssertNotCalled(t, "GetByBookshelfID", mock.Anything, mock.Anything, mock.Anything)
+			repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+			repo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+			repo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestBookService_GetByISBN_ScopedToUser(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		catalog:       catalogRepo,
+		bookshelfRepo: bookshelfRepo,
+		searcher:      new(search.SearchService),
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "intruder")
+	isbn := "9785446120581"
+
+	repo.On("GetByISBNAndUser", ctx, isbn, "intruder").Return(nil, mongo.ErrBookNotFound)
+
+	book, err := service.GetByISBN(ctx, isbn)
+
+	assert.ErrorIs(t, err, ErrBookNotFound)
+	assert.Nil(t, book)
+	repo.AssertExpectations(t)
+}
+
+func TestBookService_Create_SetsOwnerFromContext(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		catalog:       catalogRepo,
+		bookshelfRepo: bookshelfRepo,
+		searcher:      new(search.SearchService),
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+
+	book := &models.Book{
+		UserID: "someoneelse",
+		ISBN:   "9785446120581",
+		Title:  "Test Book",
+		Author: "Test Author",
+	}
+
+	catalogRepo.On("GetByISBN", ctx, book.ISBN).Return(nil, mongo.ErrCatalogEntryNotFound)
+	repo.On("Create", ctx, book).Return(nil)
+
+	err := service.Create(ctx, book)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "testuser", book.UserID)
+	repo.AssertExpectations(t)
+}
+
+func TestBookService_GetByUserID_Envelope(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		catalog:       catalogRepo,
+		bookshelfRepo: bookshelfRepo,
+		searcher:      new(search.SearchService),
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	userID := "testuser"
+	ctx := context.WithValue(context.Background(), "userID", userID)
+	opts := &models.BookListOptions{Page: 2, Limit: 500, Sort: models.SortByTitle, Order: models.SortDesc}
+	books := []*models.Book{{ID: "book1", UserID: userID}}
+
+	repo.On("GetByUserID", ctx, userID, opts).Return(&models.BookPage{Books: books, Total: 101, HasMore: true}, nil)
+
+	resp, err := service.GetByUserID(ctx, userID, opts)
+
+	assert.NoError(t, err)
+	assert.Equal(t, books, resp.Books)
+	assert.Equal(t, int64(101), resp.Total)
+	assert.Equal(t, int64(2), resp.Page)
+	assert.Equal(t, pagination.MaxLimit, resp.Limit)
+	assert.NotEmpty(t, resp.NextCursor)
+	assert.NotEmpty(t, resp.PrevCursor)
+	repo.AssertExpectations(t)
+}
+
+func TestBookService_GetByBookshelfID_Recursive(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		bookshelfRepo: bookshelfRepo,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	room := &models.Bookshelf{ID: "room", UserID: "testuser"}
+	opts := &models.BookListOptions{Page: 1, Recursive: true}
+	books := []*models.Book{{ID: "book1", UserID: "testuser"}}
+
+	bookshelfRepo.On("GetByID", ctx, "room").Return(room, nil)
+	bookshelfRepo.On("GetSubtree", ctx, "room").Return([]*models.Bookshelf{room, {ID: "bookcase", ParentID: "room"}}, nil)
+	repo.On("GetByBookshelves", ctx, []string{"room", "bookcase"}, opts).Return(&models.BookPage{Books: books, Total: 1}, nil)
+
+	resp, err := service.GetByBookshelfID(ctx, "room", opts)
+
+	assert.NoError(t, err)
+	assert.Equal(t, books, resp.Books)
+	repo.AssertNotCalled(t, "GetByBookshelfID", mock.Anything, mock.Anything, mock.Anything)
+	repo.AssertExpectations(t)
+}
+
+func TestBookService_GetByBookshelfID_PositionSort(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cursors := newCursors(t)
+	service := &BookService{
+		repo:          repo,
+		bookshelfRepo: bookshelfRepo,
+		policy:        policy.New(log),
+		cursors:       cursors,
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	bookshelfRepo.On("GetByID", ctx, "shelf").Return(&models.Bookshelf{ID: "shelf", UserID: "testuser"}, nil)
+
+	opts := &models.BookListOptions{Page: 1, Limit: 2, Sort: models.SortByPosition}
+	books := []*models.Book{
+		{ID: "book2", Positions: map[string]string{"shelf": "F", "other": "z"}},
+		{ID: "book1", Positions: map[string]string{"shelf": "V"}},
+	}
+	repo.On("GetByBookshelfID", ctx, "shelf", opts).Return(&models.BookPage{Books: books, Total: 3, HasMore: true}, nil)
+
+	resp, err := service.GetByBookshelfID(ctx, "shelf", opts)
+	assert.NoError(t, err)
+
+	// The cursor continues after the position on this bookshelf.
+	next, err := cursors.Decode(resp.NextCursor, pagination.Scope("books:bookshelf:shelf", models.BookFilter{}))
+	assert.NoError(t, err)
+	assert.Equal(t, models.SortByPosition, next.Sort)
+	assert.Equal(t, "V", next.Value)
+	assert.Equal(t, "book1", next.ID)
+
+	// Books in a subtree have no single position to sort by.
+	_, err = service.GetByBookshelfID(ctx, "shelf", &models.BookListOptions{Page: 1, Sort: models.SortByPosition, Recursive: true})
+	assert.ErrorIs(t, err, pagination.ErrInvalidSort)
+	repo.AssertNotCalled(t, "GetByBookshelves", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBookService_Reorder(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		bookshelfRepo: bookshelfRepo,
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	bookshelfRepo.On("GetByID", ctx, "shelf").Return(&models.Bookshelf{ID: "shelf", UserID: "testuser"}, nil)
+	bookshelfRepo.On("GetByID", ctx, "foreign").Return(&models.Bookshelf{ID: "foreign", UserID: "otheruser"}, nil)
+	bookshelfRepo.On("GetByID", ctx, "missing").Return(nil, repository.ErrBookshelfNotFound)
+	repo.On("Positions", ctx, "shelf").Return([]models.Position{{ID: "book1", Key: "F"}, {ID: "book2", Key: "V"}, {ID: "book3", Key: "k"}}, nil)
+
+	// Only the moved book gets a new position, between its new neighbours.
+	repo.On("SetPositions", ctx, "shelf", mock.MatchedBy(func(changed map[string]string) bool {
+		return len(changed) == 1 && changed["book3"] > "F" && changed["book3"] < "V"
+	})).Return(nil).Once()
+	assert.NoError(t, service.Reorder(ctx, "shelf", &models.Reorder{ID: "book3", After: "book1"}))
+
+	// An order that is already in place writes nothing.
+	assert.NoError(t, service.Reorder(ctx, "shelf", &models.Reorder{IDs: []string{"book1", "book2", "book3"}}))
+
+	err := service.Reorder(ctx, "shelf", &models.Reorder{IDs: []string{"book1", "book2"}})
+	assert.ErrorIs(t, err, ErrIncompleteList)
+	err = service.Reorder(ctx, "shelf", &models.Reorder{ID: "book9", Before: "book1"})
+	assert.ErrorIs(t, err, ErrUnknownItem)
+	err = service.Reorder(ctx, "foreign", &models.Reorder{ID: "book1", Before: "book2"})
+	assert.ErrorIs(t, err, ErrNotAuthorized)
+	err = service.Reorder(ctx, "missing", &models.Reorder{ID: "book1", Before: "book2"})
+	assert.ErrorIs(t, err, ErrBookshelfNotFound)
+
+	repo.AssertExpectations(t)
+	repo.AssertNumberOfCalls(t, "SetPositions", 1)
+}
+
+func TestBookService_SmartBookshelf(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cursors := newCursors(t)
+	service := &BookService{
+		repo:          repo,
+		bookshelfRepo: bookshelfRepo,
+		policy:        policy.New(log),
+		cursors:       cursors,
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	smart := &models.Bookshelf{ID: "smart", UserID: "testuser", Filter: &models.SmartFilter{Tag: "gift", AddedWithinDays: 30}}
+	bookshelfRepo.On("GetByID", ctx, "smart").Return(smart, nil)
+	bookshelfRepo.On("GetByID", ctx, "foreign").Return(&models.Bookshelf{ID: "foreign", UserID: "otheruser", Filter: &models.SmartFilter{Tag: "gift"}}, nil)
+
+	// The books of the owner that match the filter, with the list filter on top.
+	books := []*models.Book{{ID: "book1", Title: "A"}}
+	repo.On("GetByUserID", ctx, "testuser", mock.MatchedBy(func(o *models.BookListOptions) bool {
+		return o.ShelfFilter != nil && o.ShelfFilter.Tag == "gift" && o.ShelfFilter.CreatedFrom != nil &&
+			time.Since(*o.ShelfFilter.CreatedFrom) > 29*24*time.Hour && o.Filter.Author == "Tolstoy"
+	})).Return(&models.BookPage{Books: books, Total: 3, HasMore: true}, nil).Once()
+
+	resp, err := service.GetByBookshelfID(ctx, "smart", &models.BookListOptions{Page: 1, Limit: 1, Sort: models.SortByTitle, Filter: models.BookFilter{Author: "Tolstoy"}})
+	assert.NoError(t, err)
+	assert.Equal(t, books, resp.Books)
+	assert.Equal(t, int64(3), resp.Total)
+	_, err = cursors.Decode(resp.NextCursor, pagination.Scope("books:smart:smart", []interface{}{smart.Filter, models.BookFilter{Author: "Tolstoy"}}))
+	assert.NoError(t, err)
+
+	// A smart bookshelf has no manual order and holds no books of its own.
+	_, err = service.GetByBookshelfID(ctx, "smart", &models.BookListOptions{Page: 1, Sort: models.SortByPosition})
+	assert.ErrorIs(t, err, pagination.ErrInvalidSort)
+	err = service.Create(ctx, &models.Book{BookshelfIDs: []string{"smart"}, Title: "Title", Author: "Author"})
+	assert.ErrorIs(t, err, ErrSmartBookshelf)
+	err = service.Reorder(ctx, "smart", &models.Reorder{IDs: []string{"book1"}})
+	assert.ErrorIs(t, err, ErrSmartBookshelf)
+
+	_, err = service.GetByBookshelfID(ctx, "foreign", &models.BookListOptions{Page: 1})
+	assert.ErrorIs(t, err, ErrNotAuthorized)
+
+	repo.AssertExpectations(t)
+	repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestBookService_Create_NormalizesTags(t *testing.T) {
+	repo := new(MockRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:      repo,
+		catalog:   catalogRepo,
+		policy:    policy.New(log),
+		cursors:   newCursors(t),
+		log:       log,
+		bookLimit: 1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	book := &models.Book{Title: "Title", Author: "Author", Tags: []string{" gift", "", "gift ", "to read"}}
+	repo.On("Create", ctx, book).Return(nil)
+
+	assert.NoError(t, service.Create(ctx, book))
+	assert.Equal(t, []string{"gift", "to read"}, book.Tags)
+}
+
+func TestBookService_GetByUserID_InvalidOptions(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		catalog:       catalogRepo,
+		bookshelfRepo: bookshelfRepo,
+		searcher:      new(search.SearchService),
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	userID := "testuser"
+	ctx := context.WithValue(context.Background(), "userID", userID)
+	from := time.Now()
+	to := from.Add(-time.Hour)
+
+	testCases := []struct {
+		name string
+		opts *models.BookListOptions
+		err  error
+	}{
+		{name: "Invalid Page", opts: &models.BookListOptions{Page: 0, Limit: 10}, err: pagination.ErrInvalidPage},
+		{name: "Invalid Sort", opts: &models.BookListOptions{Page: 1, Limit: 10, Sort: "isbn"}, err: pagination.ErrInvalidSort},
+		{
+			name: "Invalid Date Range",
+			opts: &models.BookListOptions{Page: 1, Limit: 10, Filter: models.BookFilter{CreatedFrom: &from, CreatedTo: &to}},
+			err:  ErrInvalidDateRange,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.GetByUserID(ctx, userID, tc.opts)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	repo.AssertNotCalled(t, "GetByUserID", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBookService_GetByUserID_Cursor(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cursors := newCursors(t)
+	service := &BookService{
+		repo:          repo,
+		catalog:       catalogRepo,
+		bookshelfRepo: bookshelfRepo,
+		searcher:      new(search.SearchService),
+		policy:        policy.New(log),
+		cursors:       cursors,
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	userID := "testuser"
+	ctx := context.WithValue(context.Background(), "userID", userID)
+
+	scope := pagination.Scope("books:user:"+userID, models.BookFilter{})
+	token, err := cursors.Encode(pagination.Cursor{
+		Scope: scope,
+		Sort:  models.SortByTitle,
+		Order: models.SortDesc,
+		Value: "M",
+		ID:    "book5",
+	})
+	assert.NoError(t, err)
+
+	// The cursor overrides the sort requested by the client.
+	opts := &models.BookListOptions{Page: 7, Limit: 2, Sort: models.SortByAuthor, Cursor: token}
+	books := []*models.Book{{ID: "book4", Title: "L"}, {ID: "book3", Title: "K"}}
+
+	repo.On("GetByUserID", ctx, userID, mock.MatchedBy(func(o *models.BookListOptions) bool {
+		return o.Sort == models.SortByTitle && o.Order == models.SortDesc &&
+			o.Position != nil && o.Position.Value == "M" && o.Position.ID == "book5"
+	})).Return(&models.BookPage{Books: books, Total: 10, HasMore: true}, nil)
+
+	resp, err := service.GetByUserID(ctx, userID, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), resp.Page)
+
+	next, err := cursors.Decode(resp.NextCursor, scope)
+	assert.NoError(t, err)
+	assert.Equal(t, "K", next.Value)
+	assert.Equal(t, "book3", next.ID)
+
+	prev, err := cursors.Decode(resp.PrevCursor, scope)
+	assert.NoError(t, err)
+	assert.Equal(t, "L", prev.Value)
+	assert.True(t, prev.Backward)
+
+	// A tampered cursor is rejected.
+	_, err = service.GetByUserID(ctx, userID, &models.BookListOptions{Limit: 2, Cursor: resp.NextCursor + "x"})
+	assert.ErrorIs(t, err, pagination.ErrInvalidCursor)
+
+	// So is a cursor replayed with other filters.
+	_, err = service.GetByUserID(ctx, userID, &models.BookListOptions{Limit: 2, Cursor: resp.NextCursor, Filter: models.BookFilter{Tag: "gift"}})
+	assert.ErrorIs(t, err, pagination.ErrInvalidCursor)
+	repo.AssertExpectations(t)
+}
+
+func TestBookService_Create_ErrorInvalidISBN(t *testing.T) {
+	repo := new(MockRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:      repo,
+		catalog:   catalogRepo,
+		searcher:  new(search.SearchService),
+		policy:    policy.New(log),
+		cursors:   newCursors(t),
+		log:       log,
+		bookLimit: 1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+
+	err := service.Create(ctx, &models.Book{ISBN: "978-5-4461-2058-2", Title: "Test Book", Author: "Test Author"})
+
+	assert.ErrorIs(t, err, ErrInvalidISBN)
+	repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestBookService_Create_LinksCatalogEntry(t *testing.T) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		catalog:       catalogRepo,
+		bookshelfRepo: bookshelfRepo,
+		searcher:      new(search.SearchService),
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+
+	book := &models.Book{
+		ISBN:       "5-17-118366-X",
+		Title:      "Test Book",
+		Author:     "Test Author",
+		Publishing: "My Publisher",
+	}
+	entry := &models.CatalogEntry{
+		ID:           "entry1",
+		ISBN13:       "9785171183660",
+		Title:        "Test Book",
+		Description:  "From the catalog",
+		Contributors: []models.Contributor{{Name: "Test Author", Role: models.RoleAuthor}},
+		Editions:     []models.Edition{{Publisher: "Publisher"}},
+	}
+
+	catalogRepo.On("GetByISBN", ctx, "9785171183660").Return(entry, nil)
+	repo.On("Create", ctx, mock.MatchedBy(func(b *models.Book) bool {
+		return b.ISBN == "9785171183660" && b.CatalogID == "entry1" && b.Title == "Test Book" && b.Author == "Test Author" &&
+			b.Publishing == "My Publisher" && b.Description == "From the catalog" && slices.Equal(b.Overrides, []string{models.FieldPublishing})
+	})).Return(nil)
+
+	err := service.Create(ctx, book)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "9785171183660", book.ISBN)
+	assert.Equal(t, "entry1", book.CatalogID)
+	assert.Equal(t, "Test Book", book.Title)
+	assert.Equal(t, "Test Author", book.Author)
+	assert.Equal(t, "My Publisher", book.Publishing)
+	assert.Equal(t, "From the catalog", book.Description)
+	repo.AssertExpectations(t)
+}
+
+func newAddAdvancedService(t *testing.T) (*BookService, *MockRepository, *MockCatalogRepo, *MockBookshelfRepository, *MockSearchRepo) {
+	repo := new(MockRepository)
+	bookshelfRepo := new(MockBookshelfRepository)
+	catalogRepo := new(MockCatalogRepo)
+	searchRepo := new(MockSearchRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookService{
+		repo:          repo,
+		catalog:       catalogRepo,
+		bookshelfRepo: bookshelfRepo,
+		searcher:      search.NewSearchService(searchRepo, catalogRepo, log),
+		policy:        policy.New(log),
+		cursors:       newCursors(t),
+		log:           log,
+		bookLimit:     1000,
+	}
+	return service, repo, catalogRepo, bookshelfRepo, searchRepo
+}
+
+func TestBookService_AddAdvanced_Success(t *testing.T) {
+	service, repo, catalogRepo, bookshelfRepo, searchRepo := newAddAdvancedService(t)
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	isbn := "9785171183660"
+
+	searchRepo.On("SearchByISBN", ctx, isbn, false).Return(&repository.SearchResult{SearchByISBNResponse: &searcherv1.SearchByISBNResponse{
+		Status: searcherv1.SearchByISBNResponse_SUCCESS,
+		Books: []*searcherv1.Book{
+			{Title: "Other", Author: "Other Author", ShopName: "shop1"},
+			{Title: "Test Book", Author: "Test Author", Publishing: "Publisher", ImgUrl: "cover.jpg", ShopName: "shop2"},
+		},
+	}}, nil)
+	bookshelfRepo.On("GetByID", ctx, "shelf1").Return(&models.Bookshelf{ID: "shelf1", UserID: "testuser"}, nil)
+	repo.On("CountInBookshelf", ctx, "shelf1").Return(0, nil)
+	repo.On("ExistsInBookshelf", ctx, isbn, "shelf1").Return(false, nil)
+	catalogRepo.On("GetByISBN", ctx, isbn).Return(nil, mongo.ErrCatalogEntryNotFound)
+	catalogRepo.On("Create", ctx, mock.MatchedBy(func(e *models.CatalogEntry) bool {
+		return e.ISBN13 == isbn && e.Title == "Test Book" && e.Authors() == "Test Author"
+	})).Run(func(args mock.Arguments) {
+		args.Get(1).(*models.CatalogEntry).ID = "entry1"
+	}).Return(nil)
+	// The user's copy follows the catalog entry.
+	repo.On("Create", ctx, mock.MatchedBy(func(b *models.Book) bool {
+		return b.CatalogID == "entry1" && b.Title == "Test Book" && b.Author == "Test Author" && b.ShopName == "shop2" && b.Overrides == nil
+	})).Return(nil)
+
+	book, err := service.AddAdvanced(ctx, isbn, 1, "shelf1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "testuser", book.UserID)
+	assert.Equal(t, "shelf1", book.BookshelfIDs[0])
+	assert.Equal(t, "entry1", book.CatalogID)
+	assert.Equal(t, "Test Book", book.Title)
+	assert.Equal(t, "cover.jpg", book.CoverImage)
+	assert.Equal(t, "shop2", book.ShopName)
+	repo.AssertExpectations(t)
+	catalogRepo.AssertExpectations(t)
+	bookshelfRepo.AssertExpectations(t)
+}
+
+func TestBookService_AddAdvanced_CatalogRecordExists(t *testing.T) {
+	service, repo, catalogRepo, _, searchRepo := newAddAdvancedService(t)
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	isbn := "9785171183660"
+
+	searchRepo.On("SearchByISBN", ctx, isbn, false).Return(&repository.SearchResult{SearchByISBNResponse: &searcherv1.SearchByISBNResponse{
+		Status: searcherv1.SearchByISBNResponse_SUCCESS,
+		Books:  []*searcherv1.Book{{Title: "Test Book, 2nd ed.", Author: "Test Author", ShopName: "shop2"}},
+	}}, nil)
+	entry := &models.CatalogEntry{
+		ID:           "entry1",
+		ISBN13:       isbn,
+		Title:        "Test Book",
+		Contributors: []models.Contributor{{Name: "Test Author", Role: models.RoleAuthor}},
+		Editions:     []models.Edition{{ShopName: "shop1"}},
+	}
+	catalogRepo.On("GetByISBN", ctx, isbn).Return(entry, nil)
+	catalogRepo.On("AddEdition", ctx, "entry1", models.Edition{ShopName: "shop2"}).Return(nil)
+	// Values that differ from the catalog are kept as overrides.
+	repo.On("Create", ctx, mock.MatchedBy(func(b *models.Book) bool {
+		return b.CatalogID == "entry1" && b.Title == "Test Book, 2nd ed." && b.Author == "Test Author" && b.ShopName == "shop2" &&
+			slices.Equal(b.Overrides, []string{models.FieldTitle, models.FieldShopName})
+	})).Return(nil)
+
+	book, err := service.AddAdvanced(ctx, isbn, 0, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "testuser", book.UserID)
+	assert.Equal(t, "Test Author", book.Author)
+	catalogRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	catalogRepo.AssertExpectations(t)
+	repo.AssertExpectations(t)
+}
+
+func TestBookService_AddAdvanced_SearchNotFinished(t *testing.T) {
+	service, repo, _, _, searchRepo := newAddAdvancedService(t)
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+
+	searchRepo.On("SearchByISBN", ctx, "9785446120581", false).Return(&repository.SearchResult{SearchByISBNResponse: &searcherv1.SearchByISBNResponse{
+		Status: searcherv1.SearchByISBNResponse_PROCESSING,
+	}}, nil)
+
+	_, err := service.AddAdvanced(ctx, "9785446120581", 0, "")
+
+	assert.ErrorIs(t, err, ErrSearchNotFinished)
+	repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestBookService_AddAdvanced_SearchFailed(t *testing.T) {
+	service, repo, _, _, searchRepo := newAddAdvancedService(t)
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+
+	searchRepo.On("SearchByISBN", ctx, "9785446120581", false).Return(&repository.SearchResult{
+		SearchByISBNResponse: &searcherv1.SearchByISBNResponse{Status: searchrpc.StatusFailed},
+		FailureReason:        "shop is unavailable",
+	}, nil)
+
+	_, err := service.AddAdvanced(ctx, "9785446120581", 0, "")
+
+	assert.ErrorIs(t, err, ErrSearchFailed)
+	assert.ErrorContains(t, err, "shop is unavailable")
+	repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestBookService_AddAdvanced_ErrorInvalidIndex(t *testing.T) {
+	service, repo, _, _, searchRepo := newAddAdvancedService(t)
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+
+	searchRepo.On("SearchByISBN", ctx, "9785446120581", false).Return(&repository.SearchResult{SearchByISBNResponse: &searcherv1.SearchByISBNResponse{
+		Status: searcherv1.SearchByISBNResponse_SUCCESS,
+		Books:  []*searcherv1.Book{{Title: "Test Book", Author: "Test Author"}},
+	}}, nil)
+
+	for _, index := range []int{-1, 1} {
+		_, err := service.AddAdvanced(ctx, "9785446120581", index, "")
+		assert.ErrorIs(t, err, ErrInvalidIndex)
+	}
+	repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestBookService_AddAdvanced_ErrorForeignBookshelf(t *testing.T) {
+	service, repo, catalogRepo, bookshelfRepo, searchRepo := newAddAdvancedService(t)
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+
+	searchRepo.On("SearchByISBN", ctx, "9785446120581", false).Return(&repository.SearchResult{SearchByISBNResponse: &searcherv1.SearchByISBNResponse{
+		Status: searcherv1.SearchByISBNResponse_SUCCESS,
+		Books:  []*searcherv1.Book{{Title: "Test Book", Author: "Test Author"}},
+	}}, nil)
+	bookshelfRepo.On("GetByID", ctx, "shelf1").Return(&models.Bookshelf{ID: "shelf1", UserID: "otheruser"}, nil)
+
+	_, err := service.AddAdvanced(ctx, "9785446120581", 0, "shelf1")
+
+	assert.ErrorIs(t, err, ErrNotAuthorized)
+	catalogRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
@@ -1,35 +1,75 @@
 package bookshelf
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/getz-devs/librakeeper-server/internal/server/models"
 	"github.com/getz-devs/librakeeper-server/internal/server/repository"
-	"github.com/getz-devs/librakeeper-server/internal/server/storage/mongo"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/ordering"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/pagination"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/policy"
 	"log/slog"
+	"slices"
+	"strings"
+	"unicode/utf8"
 )
 
 // Custom Error Types:
 var (
 	ErrBookshelfNotFound      = errors.New("bookshelf not found")
 	ErrNameRequired           = errors.New("bookshelf name is required")
-	ErrUserNotFoundInContext  = errors.New("userID not found in context")
-	ErrNotAuthorized          = errors.New("user is not authorized to perform this action")
+	ErrUserNotFoundInContext  = policy.ErrUserNotFoundInContext
+	ErrNotAuthorized          = policy.ErrNotAuthorized
 	ErrBookshelfAlreadyExists = errors.New("bookshelf with this name already exists for this user")
+	ErrBookshelfNotEmpty      = errors.New("bookshelf is not empty; delete or move its books")
+	ErrInvalidDeleteMode      = errors.New("delete mode must be refuse, cascade or move")
+	ErrInvalidDeleteTarget    = errors.New("books can only be moved to another bookshelf")
+	ErrTargetNotFound         = errors.New("target bookshelf not found")
+	ErrTargetHasBook          = errors.New("target bookshelf already holds a book with the same ISBN")
+	ErrTargetLimitReached     = errors.New("target bookshelf has reached the book limit")
+	ErrSmartTarget            = errors.New("the books of a smart bookshelf come from its filter")
+	ErrParentNotFound         = errors.New("parent bookshelf not found")
+	ErrBookshelfCycle         = errors.New("a bookshelf cannot be nested in itself or in a bookshelf nested in it")
+	ErrTooDeep                = fmt.Errorf("bookshelves cannot be nested more than %d levels deep", maxDepth)
+	ErrBookshelfHasChildren   = errors.New("bookshelf has nested bookshelves; move or delete them first")
+	ErrInvalidReorder         = ordering.ErrInvalidReorder
+	ErrIncompleteList         = ordering.ErrIncompleteList
+	ErrUnknownItem            = ordering.ErrUnknownItem
+	ErrInvalidFilter          = errors.New("invalid smart bookshelf filter")
+	ErrNotSmart               = errors.New("only a smart bookshelf has a filter")
+	ErrSmartParent            = errors.New("bookshelves cannot be nested in a smart bookshelf")
+)
+
+// maxDepth is the number of levels bookshelves can be nested in, counting
+// the top level: a room, a bookcase, a shelf and so on.
+const maxDepth = 8
+
+// Limits of the conditions of a smart bookshelf filter.
+const (
+	maxFilterLength = 200   // characters of a text condition
+	maxAddedDays    = 36500 // about a hundred years
 )
 
 // BookshelfService handles business logic for bookshelf.
 type BookshelfService struct {
-	repo repository.BookshelfRepo
-	log  *slog.Logger
+	repo    repository.BookshelfRepo
+	policy  *policy.Policy
+	cursors *pagination.Cursors
+	log     *slog.Logger
+	// bookLimit is the most books a bookshelf holds, as in the book service.
+	bookLimit int
 }
 
 // NewBookshelfService creates a new BookshelfService instance.
-func NewBookshelfService(repo repository.BookshelfRepo, log *slog.Logger) *BookshelfService {
+func NewBookshelfService(repo repository.BookshelfRepo, policy *policy.Policy, cursors *pagination.Cursors, log *slog.Logger) *BookshelfService {
 	return &BookshelfService{
-		repo: repo,
-		log:  log,
+		repo:      repo,
+		policy:    policy,
+		cursors:   cursors,
+		log:       log,
+		bookLimit: 1000, // TODO: Read from config
 	}
 }
 
@@ -41,24 +81,38 @@ func (s *BookshelfService) Create(ctx context.Context, bookshelf *models.Bookshe
 	}
 
 	// Get userID from context
-	userID, ok := ctx.Value("userID").(string)
-	if !ok {
-		return ErrUserNotFoundInContext
+	userID, err := policy.UserID(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Rule 2: Unique Bookshelf Name per User
-	exists, err := s.repo.ExistsByNameAndUser(ctx, bookshelf.Name, userID)
-	if err != nil {
-		return fmt.Errorf("failed to check bookshelf existence: %w", err)
+	// Rule 4: The filter of a smart bookshelf can be translated to a query
+	if bookshelf.Filter != nil {
+		if err := normalizeFilter(bookshelf.Filter); err != nil {
+			return err
+		}
 	}
-	if exists {
-		return ErrBookshelfAlreadyExists
+
+	// Rule 3: The parent is a bookshelf of the user with room for one more level
+	if bookshelf.ParentID != "" {
+		if _, err := s.checkParent(ctx, bookshelf.ParentID, 1); err != nil {
+			return err
+		}
+	}
+
+	// Rule 2: Unique Bookshelf Name per Parent
+	if err := s.checkName(ctx, bookshelf.Name, userID, bookshelf.ParentID); err != nil {
+		return err
 	}
 
 	// Set the UserID for the bookshelf
 	bookshelf.UserID = userID
 
 	if err := s.repo.Create(ctx, bookshelf); err != nil {
+		// A concurrent request created a bookshelf with the same name.
+		if errors.Is(err, repository.ErrBookshelfAlreadyExists) {
+			return ErrBookshelfAlreadyExists
+		}
 		return fmt.Errorf("failed to create bookshelf: %w", err)
 	}
 
@@ -67,79 +121,484 @@ func (s *BookshelfService) Create(ctx context.Context, bookshelf *models.Bookshe
 
 // GetByID retrieves a bookshelf by its ID.
 func (s *BookshelfService) GetByID(ctx context.Context, bookshelfID string) (*models.Bookshelf, error) {
-	bookshelf, err := s.repo.GetByID(ctx, bookshelfID)
+	bookshelf, err := s.get(ctx, bookshelfID)
 	if err != nil {
-		if errors.Is(err, mongo.ErrBookshelfNotFound) {
-			return nil, ErrBookshelfNotFound
-		}
-		return nil, fmt.Errorf("failed to get bookshelf: %w", err)
+		return nil, err
+	}
+
+	if err := s.policy.Bookshelf(ctx, policy.ActionRead, bookshelf); err != nil {
+		return nil, err
 	}
+
 	return bookshelf, nil
 }
 
-// GetByUser retrieves a list of bookshelf for a specific user.
-func (s *BookshelfService) GetByUser(ctx context.Context, userID string, page int64, limit int64) ([]*models.Bookshelf, error) {
-	bookshelves, err := s.repo.GetByUser(ctx, userID, page, limit)
+// Details retrieves a bookshelf with the bookshelves it is nested in, those
+// nested directly in it, and the number of books on it and on its subtree.
+func (s *BookshelfService) Details(ctx context.Context, bookshelfID string) (*models.BookshelfDetails, error) {
+	bookshelf, err := s.GetByID(ctx, bookshelfID)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors, err := s.ancestors(ctx, bookshelf)
+	if err != nil {
+		return nil, err
+	}
+	subtree, err := s.subtree(ctx, bookshelfID)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &models.BookshelfDetails{
+		Bookshelf:   *bookshelf,
+		Breadcrumbs: make([]models.BookshelfRef, 0, len(ancestors)),
+		Children:    []models.BookshelfChild{},
+	}
+	for _, ancestor := range ancestors {
+		details.Breadcrumbs = append(details.Breadcrumbs, models.BookshelfRef{ID: ancestor.ID, Name: ancestor.Name})
+	}
+
+	// The subtree lists parents before their children, so every bookshelf
+	// below the children can be assigned to the child it is nested in.
+	branch := map[string]string{}
+	var children []*models.Bookshelf
+	for _, b := range subtree[1:] {
+		if b.ParentID == bookshelfID {
+			branch[b.ID] = b.ID
+			children = append(children, b)
+		} else {
+			branch[b.ID] = branch[b.ParentID]
+		}
+	}
+	slices.SortFunc(children, func(a, b *models.Bookshelf) int {
+		return cmp.Or(strings.Compare(a.Position, b.Position), strings.Compare(a.ID, b.ID))
+	})
+	if len(children) > 0 {
+		nested := map[string][]string{}
+		for _, b := range subtree[1:] {
+			nested[branch[b.ID]] = append(nested[branch[b.ID]], b.ID)
+		}
+		counts, err := s.repo.CountBooksByGroup(ctx, nested)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count books: %w", err)
+		}
+		for _, child := range children {
+			details.Children = append(details.Children, models.BookshelfChild{
+				BookshelfRef: models.BookshelfRef{ID: child.ID, Name: child.Name},
+				SubtreeBooks: counts[child.ID],
+			})
+		}
+	}
+
+	if details.Books, err = s.countBooks(ctx, []string{bookshelfID}); err != nil {
+		return nil, err
+	}
+	if details.SubtreeBooks, err = s.countBooks(ctx, ids(subtree)); err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
+
+// GetByUser retrieves a page of bookshelves for a specific user, or of those
+// nested directly in a parent. A cursor replaces the page and carries its own
+// sort field and order.
+func (s *BookshelfService) GetByUser(ctx context.Context, userID string, opts *models.BookshelfListOptions) (*models.PaginatedBookshelfResponse, error) {
+	if err := s.policy.Library(ctx, policy.ActionList, userID); err != nil {
+		return nil, err
+	}
+
+	scope := "bookshelves:user:" + userID
+	if opts.ParentID != nil {
+		scope += ":parent:" + *opts.ParentID
+	}
+	if opts.Cursor != "" {
+		cursor, position, err := s.cursors.Resolve(opts.Cursor, scope)
+		if err != nil {
+			return nil, err
+		}
+		opts.Page, opts.Sort, opts.Order, opts.Position = 1, cursor.Sort, cursor.Order, position
+	}
+
+	page, limit, err := pagination.Normalize(opts.Page, opts.Limit)
+	if err != nil {
+		return nil, err
+	}
+	sort, order, err := pagination.NormalizeSort(opts.Sort, opts.Order,
+		models.SortByName, models.SortByPosition, models.SortByCreatedAt, models.SortByUpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	opts.Page, opts.Limit, opts.Sort, opts.Order = page, limit, sort, order
+
+	result, err := s.repo.GetByUser(ctx, userID, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get bookshelf by user ID: %w", err)
 	}
-	return bookshelves, nil
+
+	resp := &models.PaginatedBookshelfResponse{
+		Bookshelves: result.Bookshelves,
+		Total:       result.Total,
+		Page:        opts.Page,
+		Limit:       opts.Limit,
+	}
+	if opts.Position != nil {
+		resp.Page = 0 // pages are not numbered when a cursor is used
+	}
+
+	p := pagination.Page{
+		Scope:    scope,
+		Sort:     opts.Sort,
+		Order:    opts.Order,
+		Number:   opts.Page,
+		Position: opts.Position,
+		HasMore:  result.HasMore,
+	}
+	if n := len(result.Bookshelves); n > 0 {
+		first, last := result.Bookshelves[0], result.Bookshelves[n-1]
+		p.First = &pagination.Boundary{Value: bookshelfSortValue(first, opts.Sort), ID: first.ID}
+		p.Last = &pagination.Boundary{Value: bookshelfSortValue(last, opts.Sort), ID: last.ID}
+	}
+
+	if resp.NextCursor, resp.PrevCursor, err = s.cursors.Links(p); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
 }
 
-// Update updates an existing bookshelf.
+// bookshelfSortValue returns the value of the sort field of a bookshelf.
+func bookshelfSortValue(bookshelf *models.Bookshelf, field string) interface{} {
+	switch field {
+	case models.SortByName:
+		return bookshelf.Name
+	case models.SortByPosition:
+		return bookshelf.Position
+	case models.SortByUpdatedAt:
+		return bookshelf.UpdatedAt
+	default:
+		return bookshelf.CreatedAt
+	}
+}
+
+// Update updates an existing bookshelf. A new parent moves the bookshelf
+// together with the bookshelves nested in it, to the end of the parent.
 func (s *BookshelfService) Update(ctx context.Context, bookshelfID string, update *models.BookshelfUpdate) error {
-	// Get the bookshelf
-	bookshelf, err := s.repo.GetByID(ctx, bookshelfID)
+	bookshelf, err := s.get(ctx, bookshelfID)
 	if err != nil {
-		if errors.Is(err, mongo.ErrBookshelfNotFound) {
-			return ErrBookshelfNotFound
+		return err
+	}
+
+	if err := s.policy.Bookshelf(ctx, policy.ActionUpdate, bookshelf); err != nil {
+		return err
+	}
+
+	name, parentID := bookshelf.Name, bookshelf.ParentID
+	if update.Name != nil {
+		name = *update.Name
+	}
+
+	// Rule 3: The parent is a bookshelf of the user, outside the subtree of
+	// the bookshelf, with room for all its levels
+	if update.ParentID != nil && *update.ParentID == bookshelf.ParentID {
+		update.ParentID = nil // the bookshelf keeps its position
+	}
+	if update.ParentID != nil {
+		parentID = *update.ParentID
+		if err := s.checkMove(ctx, bookshelfID, parentID); err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to get bookshelf: %w", err)
 	}
 
-	// Get userID from context
-	userID, ok := ctx.Value("userID").(string)
-	if !ok {
-		return ErrUserNotFoundInContext
+	// Rule 4: Only a smart bookshelf has a filter, and it can be translated
+	// to a query
+	if update.Filter != nil {
+		if !bookshelf.IsSmart() {
+			return ErrNotSmart
+		}
+		if err := normalizeFilter(update.Filter); err != nil {
+			return err
+		}
 	}
 
-	// Check bookshelf ownership
-	if bookshelf.UserID != userID {
-		return ErrNotAuthorized
+	// Rule 2: Unique Bookshelf Name per Parent
+	if name != bookshelf.Name || parentID != bookshelf.ParentID {
+		if err := s.checkName(ctx, name, bookshelf.UserID, parentID); err != nil {
+			return err
+		}
 	}
 
 	if err := s.repo.Update(ctx, bookshelfID, update); err != nil {
+		if errors.Is(err, repository.ErrBookshelfAlreadyExists) {
+			return ErrBookshelfAlreadyExists
+		}
 		return fmt.Errorf("failed to update bookshelf: %w", err)
 	}
 
 	return nil
 }
 
-// Delete deletes a bookshelf.
-func (s *BookshelfService) Delete(ctx context.Context, bookshelfID string) error {
-	// Get the bookshelf
+// Move nests a bookshelf, with the bookshelves nested in it, in another one,
+// or moves it to the top level when parentID is empty.
+func (s *BookshelfService) Move(ctx context.Context, bookshelfID, parentID string) (*models.Bookshelf, error) {
+	if err := s.Update(ctx, bookshelfID, &models.BookshelfUpdate{ParentID: &parentID}); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, bookshelfID)
+}
+
+// Reorder changes the manual order of the bookshelves nested directly in a
+// parent, or of the user's top-level bookshelves when parentID is empty.
+// Only the bookshelves that move get a new position.
+func (s *BookshelfService) Reorder(ctx context.Context, parentID string, order *models.Reorder) error {
+	userID, err := policy.UserID(ctx)
+	if err != nil {
+		return err
+	}
+	if parentID != "" {
+		parent, err := s.get(ctx, parentID)
+		if err != nil {
+			return err
+		}
+		if err := s.policy.Bookshelf(ctx, policy.ActionUpdate, parent); err != nil {
+			return err
+		}
+		userID = parent.UserID
+	}
+
+	positions, err := s.repo.Positions(ctx, userID, parentID)
+	if err != nil {
+		return fmt.Errorf("failed to get bookshelf positions: %w", err)
+	}
+	changed, err := ordering.Apply(positions, order)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if err := s.repo.SetPositions(ctx, changed); err != nil {
+		return fmt.Errorf("failed to set bookshelf positions: %w", err)
+	}
+	return nil
+}
+
+// Delete deletes a bookshelf. By default only an empty bookshelf is deleted;
+// the cascade mode deletes its books too, and the move mode moves them to
+// another bookshelf of the user or, without a target, off any bookshelf.
+func (s *BookshelfService) Delete(ctx context.Context, bookshelfID string, opts *models.BookshelfDeleteOptions) (*models.BookshelfDeleteResult, error) {
+	switch opts.Mode {
+	case "":
+		opts.Mode = models.DeleteModeRefuse
+	case models.DeleteModeRefuse, models.DeleteModeCascade, models.DeleteModeMove:
+	default:
+		return nil, ErrInvalidDeleteMode
+	}
+	if opts.TargetID != "" && (opts.Mode != models.DeleteModeMove || opts.TargetID == bookshelfID) {
+		return nil, ErrInvalidDeleteTarget
+	}
+
+	bookshelf, err := s.get(ctx, bookshelfID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.policy.Bookshelf(ctx, policy.ActionDelete, bookshelf); err != nil {
+		return nil, err
+	}
+
+	if opts.TargetID != "" {
+		// Someone else's bookshelf is reported as missing.
+		target, err := s.get(ctx, opts.TargetID)
+		if errors.Is(err, ErrBookshelfNotFound) {
+			return nil, ErrTargetNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.policy.Bookshelf(ctx, policy.ActionUpdate, target); err != nil {
+			if errors.Is(err, ErrNotAuthorized) {
+				return nil, ErrTargetNotFound
+			}
+			return nil, err
+		}
+		// A smart bookshelf holds no books of its own.
+		if target.IsSmart() {
+			return nil, ErrSmartTarget
+		}
+		opts.BookLimit = s.bookLimit
+	}
+
+	result, err := s.repo.DeleteWithBooks(ctx, bookshelfID, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrBookshelfNotFound):
+			return nil, ErrBookshelfNotFound
+		case errors.Is(err, repository.ErrBookshelfNotEmpty):
+			return nil, ErrBookshelfNotEmpty
+		case errors.Is(err, repository.ErrBookshelfHasChildren):
+			return nil, ErrBookshelfHasChildren
+		case errors.Is(err, repository.ErrBookAlreadyExists):
+			return nil, ErrTargetHasBook
+		case errors.Is(err, repository.ErrBookshelfLimitReached):
+			return nil, ErrTargetLimitReached
+		}
+		return nil, fmt.Errorf("failed to delete bookshelf: %w", err)
+	}
+
+	return result, nil
+}
+
+// get loads a bookshelf and maps storage errors to service errors.
+func (s *BookshelfService) get(ctx context.Context, bookshelfID string) (*models.Bookshelf, error) {
 	bookshelf, err := s.repo.GetByID(ctx, bookshelfID)
 	if err != nil {
-		if errors.Is(err, mongo.ErrBookshelfNotFound) {
-			return ErrBookshelfNotFound
+		if errors.Is(err, repository.ErrBookshelfNotFound) {
+			return nil, ErrBookshelfNotFound
 		}
-		return fmt.Errorf("failed to get bookshelf: %w", err)
+		return nil, fmt.Errorf("failed to get bookshelf: %w", err)
 	}
+	return bookshelf, nil
+}
 
-	// Get userID from context
-	userID, ok := ctx.Value("userID").(string)
-	if !ok {
-		return ErrUserNotFoundInContext
+// checkName checks that the user has no other bookshelf with the name in the parent.
+func (s *BookshelfService) checkName(ctx context.Context, name, userID, parentID string) error {
+	exists, err := s.repo.ExistsByNameAndParent(ctx, name, userID, parentID)
+	if err != nil {
+		return fmt.Errorf("failed to check bookshelf existence: %w", err)
+	}
+	if exists {
+		return ErrBookshelfAlreadyExists
+	}
+	return nil
+}
+
+// checkParent checks that the user may nest bookshelves in the parent and
+// that levels more fit below it. It returns the parent and the bookshelves it
+// is nested in, outermost first. Someone else's bookshelf is reported as
+// missing.
+func (s *BookshelfService) checkParent(ctx context.Context, parentID string, levels int) ([]*models.Bookshelf, error) {
+	parent, err := s.get(ctx, parentID)
+	if errors.Is(err, ErrBookshelfNotFound) {
+		return nil, ErrParentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.Bookshelf(ctx, policy.ActionUpdate, parent); err != nil {
+		if errors.Is(err, ErrNotAuthorized) {
+			return nil, ErrParentNotFound
+		}
+		return nil, err
+	}
+	if parent.IsSmart() {
+		return nil, ErrSmartParent
+	}
+
+	path, err := s.ancestors(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+	path = append(path, parent)
+	if len(path)+levels > maxDepth {
+		return nil, ErrTooDeep
 	}
+	return path, nil
+}
 
-	// Check bookshelf ownership
-	if bookshelf.UserID != userID {
-		return ErrNotAuthorized
+// checkMove checks that a bookshelf and its subtree can be nested in the
+// parent: not in the subtree itself, and not deeper than maxDepth.
+func (s *BookshelfService) checkMove(ctx context.Context, bookshelfID, parentID string) error {
+	subtree, err := s.subtree(ctx, bookshelfID)
+	if err != nil {
+		return err
 	}
 
-	if err := s.repo.Delete(ctx, bookshelfID); err != nil {
-		return fmt.Errorf("failed to delete bookshelf: %w", err)
+	depth := map[string]int{bookshelfID: 1}
+	levels := 1
+	for _, b := range subtree[1:] {
+		depth[b.ID] = depth[b.ParentID] + 1
+		levels = max(levels, depth[b.ID])
 	}
 
+	if parentID == "" {
+		return nil
+	}
+	if _, ok := depth[parentID]; ok {
+		return ErrBookshelfCycle
+	}
+	_, err = s.checkParent(ctx, parentID, levels)
+	return err
+}
+
+// ancestors returns the bookshelves a bookshelf is nested in, outermost
+// first. The walk stops at maxDepth, so it ends even if the parents loop.
+func (s *BookshelfService) ancestors(ctx context.Context, bookshelf *models.Bookshelf) ([]*models.Bookshelf, error) {
+	var path []*models.Bookshelf
+	for parentID := bookshelf.ParentID; parentID != "" && len(path) < maxDepth; {
+		parent, err := s.get(ctx, parentID)
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, parent)
+		parentID = parent.ParentID
+	}
+	slices.Reverse(path)
+	return path, nil
+}
+
+// subtree loads a bookshelf and the bookshelves nested in it.
+func (s *BookshelfService) subtree(ctx context.Context, bookshelfID string) ([]*models.Bookshelf, error) {
+	subtree, err := s.repo.GetSubtree(ctx, bookshelfID)
+	if err != nil {
+		if errors.Is(err, repository.ErrBookshelfNotFound) {
+			return nil, ErrBookshelfNotFound
+		}
+		return nil, fmt.Errorf("failed to get nested bookshelves: %w", err)
+	}
+	return subtree, nil
+}
+
+// countBooks returns the number of books on any of the bookshelves.
+func (s *BookshelfService) countBooks(ctx context.Context, ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	count, err := s.repo.CountBooks(ctx, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count books: %w", err)
+	}
+	return count, nil
+}
+
+// ids returns the IDs of the bookshelves.
+func ids(bookshelves []*models.Bookshelf) []string {
+	ids := make([]string, 0, len(bookshelves))
+	for _, b := range bookshelves {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+// normalizeFilter trims the text conditions of a smart bookshelf filter and
+// checks that at least one condition is set and every condition is in range.
+func normalizeFilter(f *models.SmartFilter) error {
+	f.Author = strings.TrimSpace(f.Author)
+	f.ShopName = strings.TrimSpace(f.ShopName)
+	f.Tag = strings.TrimSpace(f.Tag)
+
+	for _, condition := range []struct{ name, value string }{{"author", f.Author}, {"shop", f.ShopName}, {"tag", f.Tag}} {
+		if utf8.RuneCountInString(condition.value) > maxFilterLength {
+			return fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidFilter, condition.name, maxFilterLength)
+		}
+	}
+	if f.AddedWithinDays < 0 || f.AddedWithinDays > maxAddedDays {
+		return fmt.Errorf("%w: added_within_days must be between 1 and %d", ErrInvalidFilter, maxAddedDays)
+	}
+	if *f == (models.SmartFilter{}) {
+		return fmt.Errorf("%w: at least one condition is required", ErrInvalidFilter)
+	}
 	return nil
 }
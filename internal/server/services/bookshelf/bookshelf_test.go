@@ -2,12 +2,19 @@ package bookshelf
 
 import (
 	"context"
+	"fmt"
 	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/pagination"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/policy"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/document"
 	"github.com/getz-devs/librakeeper-server/internal/server/storage/mongo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"log/slog"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -33,9 +40,12 @@ func (m *MockBookshelfRepository) GetByID(ctx context.Context, id string) (*mode
 }
 
 // GetByUser mocks the GetByUser method of the BookshelfRepo interface.
-func (m *MockBookshelfRepository) GetByUser(ctx context.Context, userID string, page int64, limit int64) ([]*models.Bookshelf, error) {
-	args := m.Called(ctx, userID, page, limit)
-	return args.Get(0).([]*models.Bookshelf), args.Error(1)
+func (m *MockBookshelfRepository) GetByUser(ctx context.Context, userID string, opts *models.BookshelfListOptions) (*models.BookshelfPage, error) {
+	args := m.Called(ctx, userID, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BookshelfPage), args.Error(1)
 }
 
 // CountByUser mocks the CountByUser method of the BookshelfRepo interface.
@@ -44,30 +54,80 @@ func (m *MockBookshelfRepository) CountByUser(ctx context.Context, userID string
 	return args.Int(0), args.Error(1)
 }
 
-// ExistsByNameAndUser mocks the ExistsByNameAndUser method of the BookshelfRepo interface.
-func (m *MockBookshelfRepository) ExistsByNameAndUser(ctx context.Context, name, userID string) (bool, error) {
-	args := m.Called(ctx, name, userID)
+// ExistsByNameAndParent mocks the ExistsByNameAndParent method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) ExistsByNameAndParent(ctx context.Context, name, userID, parentID string) (bool, error) {
+	args := m.Called(ctx, name, userID, parentID)
 	return args.Bool(0), args.Error(1)
 }
 
+// GetSubtree mocks the GetSubtree method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) GetSubtree(ctx context.Context, id string) ([]*models.Bookshelf, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Bookshelf), args.Error(1)
+}
+
+// CountBooks mocks the CountBooks method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) CountBooks(ctx context.Context, ids []string) (int, error) {
+	args := m.Called(ctx, ids)
+	return args.Int(0), args.Error(1)
+}
+
+// CountBooksByGroup mocks the CountBooksByGroup method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) CountBooksByGroup(ctx context.Context, groups map[string][]string) (map[string]int, error) {
+	args := m.Called(ctx, groups)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
 // Update mocks the Update method of the BookshelfRepo interface.
 func (m *MockBookshelfRepository) Update(ctx context.Context, id string, update *models.BookshelfUpdate) error {
 	args := m.Called(ctx, id, update)
 	return args.Error(0)
 }
 
+// Positions mocks the Positions method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) Positions(ctx context.Context, userID, parentID string) ([]models.Position, error) {
+	args := m.Called(ctx, userID, parentID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Position), args.Error(1)
+}
+
+// SetPositions mocks the SetPositions method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) SetPositions(ctx context.Context, positions map[string]string) error {
+	args := m.Called(ctx, positions)
+	return args.Error(0)
+}
+
 // Delete mocks the Delete method of the BookshelfRepo interface.
 func (m *MockBookshelfRepository) Delete(ctx context.Context, id string) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+// DeleteWithBooks mocks the DeleteWithBooks method of the BookshelfRepo interface.
+func (m *MockBookshelfRepository) DeleteWithBooks(ctx context.Context, id string, opts *models.BookshelfDeleteOptions) (*models.BookshelfDeleteResult, error) {
+	args := m.Called(ctx, id, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BookshelfDeleteResult), args.Error(1)
+}
+
 func TestBookshelfService_Create_Success(t *testing.T) {
 	repo := new(MockBookshelfRepository)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookshelfService{
-		repo: repo,
-		log:  log,
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
 	}
 
 	ctx := context.Background()
@@ -78,7 +138,7 @@ func TestBookshelfService_Create_Success(t *testing.T) {
 		Name: "Test Bookshelf",
 	}
 
-	repo.On("ExistsByNameAndUser", ctx, bookshelf.Name, userID).Return(false, nil)
+	repo.On("ExistsByNameAndParent", ctx, bookshelf.Name, userID, "").Return(false, nil)
 	repo.On("Create", ctx, bookshelf).Return(nil)
 
 	err := service.Create(ctx, bookshelf)
@@ -92,8 +152,10 @@ func TestBookshelfService_Create_ErrorNameRequired(t *testing.T) {
 	repo := new(MockBookshelfRepository)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookshelfService{
-		repo: repo,
-		log:  log,
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
 	}
 
 	ctx := context.Background()
@@ -112,8 +174,10 @@ func TestBookshelfService_Create_ErrorUserNotFoundInContext(t *testing.T) {
 	repo := new(MockBookshelfRepository)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookshelfService{
-		repo: repo,
-		log:  log,
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
 	}
 
 	ctx := context.Background()
@@ -132,11 +196,13 @@ func TestBookshelfService_GetByID_Success(t *testing.T) {
 	repo := new(MockBookshelfRepository)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookshelfService{
-		repo: repo,
-		log:  log,
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
 	}
 
-	ctx := context.Background()
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
 	bookshelfID := "testbookshelfid"
 
 	expectedBookshelf := &models.Bookshelf{
@@ -160,11 +226,13 @@ func TestBookshelfService_GetByID_ErrorBookshelfNotFound(t *testing.T) {
 	repo := new(MockBookshelfRepository)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookshelfService{
-		repo: repo,
-		log:  log,
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
 	}
 
-	ctx := context.Background()
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
 	bookshelfID := "nonexistentbookshelf"
 
 	repo.On("GetByID", ctx, bookshelfID).Return(nil, mongo.ErrBookshelfNotFound)
@@ -180,8 +248,10 @@ func TestBookshelfService_Update_Success(t *testing.T) {
 	repo := new(MockBookshelfRepository)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookshelfService{
-		repo: repo,
-		log:  log,
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
 	}
 
 	ctx := context.Background()
@@ -201,6 +271,7 @@ func TestBookshelfService_Update_Success(t *testing.T) {
 	}
 
 	repo.On("GetByID", ctx, bookshelfID).Return(existingBookshelf, nil)
+	repo.On("ExistsByNameAndParent", ctx, *update.Name, userID, "").Return(false, nil)
 	repo.On("Update", ctx, bookshelfID, update).Return(nil)
 
 	err := service.Update(ctx, bookshelfID, update)
@@ -209,12 +280,37 @@ func TestBookshelfService_Update_Success(t *testing.T) {
 	repo.AssertExpectations(t)
 }
 
+func TestBookshelfService_Update_ErrorBookshelfAlreadyExists(t *testing.T) {
+	repo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookshelfService{
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	bookshelfID := "testbookshelfid"
+	update := &models.BookshelfUpdate{Name: stringPtr("Fiction")}
+
+	repo.On("GetByID", ctx, bookshelfID).Return(&models.Bookshelf{ID: bookshelfID, UserID: "testuser", Name: "Poetry"}, nil)
+	repo.On("ExistsByNameAndParent", ctx, "Fiction", "testuser", "").Return(true, nil)
+
+	err := service.Update(ctx, bookshelfID, update)
+
+	assert.ErrorIs(t, err, ErrBookshelfAlreadyExists)
+	repo.AssertNotCalled(t, "Update", ctx, bookshelfID, update)
+}
+
 func TestBookshelfService_Update_ErrorBookshelfNotFound(t *testing.T) {
 	repo := new(MockBookshelfRepository)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookshelfService{
-		repo: repo,
-		log:  log,
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
 	}
 
 	ctx := context.Background()
@@ -237,8 +333,10 @@ func TestBookshelfService_Delete_Success(t *testing.T) {
 	repo := new(MockBookshelfRepository)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookshelfService{
-		repo: repo,
-		log:  log,
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
 	}
 
 	ctx := context.Background()
@@ -255,20 +353,113 @@ func TestBookshelfService_Delete_Success(t *testing.T) {
 	}
 
 	repo.On("GetByID", ctx, bookshelfID).Return(existingBookshelf, nil)
-	repo.On("Delete", ctx, bookshelfID).Return(nil)
+	repo.On("DeleteWithBooks", ctx, bookshelfID, &models.BookshelfDeleteOptions{Mode: models.DeleteModeRefuse}).
+		Return(&models.BookshelfDeleteResult{BookshelfID: bookshelfID, Mode: models.DeleteModeRefuse}, nil)
 
-	err := service.Delete(ctx, bookshelfID)
+	result, err := service.Delete(ctx, bookshelfID, &models.BookshelfDeleteOptions{})
 
 	assert.NoError(t, err)
+	assert.Equal(t, models.DeleteModeRefuse, result.Mode, "refuse is the default mode")
 	repo.AssertExpectations(t)
 }
 
+func TestBookshelfService_Delete_ErrorBookshelfNotEmpty(t *testing.T) {
+	repo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookshelfService{
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
+	}
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	bookshelfID := "testbookshelfid"
+	opts := &models.BookshelfDeleteOptions{Mode: models.DeleteModeRefuse}
+
+	repo.On("GetByID", ctx, bookshelfID).Return(&models.Bookshelf{ID: bookshelfID, UserID: "testuser"}, nil)
+	repo.On("DeleteWithBooks", ctx, bookshelfID, opts).Return(nil, repository.ErrBookshelfNotEmpty)
+
+	_, err := service.Delete(ctx, bookshelfID, opts)
+
+	assert.ErrorIs(t, err, ErrBookshelfNotEmpty)
+	repo.AssertExpectations(t)
+}
+
+func TestBookshelfService_Delete_MoveToTarget(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+	shelf := &models.Bookshelf{ID: "shelf1", UserID: "testuser"}
+
+	testCases := []struct {
+		name    string
+		opts    *models.BookshelfDeleteOptions
+		target  *models.Bookshelf
+		repoErr error
+		wantErr error
+	}{
+		{name: "Moved", opts: &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: "shelf2"}, target: &models.Bookshelf{ID: "shelf2", UserID: "testuser"}},
+		{name: "Unshelved", opts: &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove}},
+		{name: "TargetHasBook", opts: &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: "shelf2"}, target: &models.Bookshelf{ID: "shelf2", UserID: "testuser"}, repoErr: repository.ErrBookAlreadyExists, wantErr: ErrTargetHasBook},
+		{name: "TargetFull", opts: &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: "shelf2"}, target: &models.Bookshelf{ID: "shelf2", UserID: "testuser"}, repoErr: repository.ErrBookshelfLimitReached, wantErr: ErrTargetLimitReached},
+		{name: "ForeignTarget", opts: &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: "shelf2"}, target: &models.Bookshelf{ID: "shelf2", UserID: "someone"}, wantErr: ErrTargetNotFound},
+		{name: "MissingTarget", opts: &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: "shelf2"}, wantErr: ErrTargetNotFound},
+		{name: "SameTarget", opts: &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: "shelf1"}, wantErr: ErrInvalidDeleteTarget},
+		{name: "TargetWithoutMove", opts: &models.BookshelfDeleteOptions{Mode: models.DeleteModeCascade, TargetID: "shelf2"}, wantErr: ErrInvalidDeleteTarget},
+		{name: "UnknownMode", opts: &models.BookshelfDeleteOptions{Mode: "burn"}, wantErr: ErrInvalidDeleteMode},
+		{name: "SmartTarget", opts: &models.BookshelfDeleteOptions{Mode: models.DeleteModeMove, TargetID: "shelf2"}, target: &models.Bookshelf{ID: "shelf2", UserID: "testuser", Filter: &models.SmartFilter{Tag: "gift"}}, wantErr: ErrSmartTarget},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := new(MockBookshelfRepository)
+			log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			service := &BookshelfService{
+				repo:      repo,
+				policy:    policy.New(log),
+				cursors:   newCursors(t),
+				log:       log,
+				bookLimit: 10,
+			}
+
+			repo.On("GetByID", ctx, "shelf1").Return(shelf, nil).Maybe()
+			if tc.target != nil {
+				repo.On("GetByID", ctx, "shelf2").Return(tc.target, nil).Maybe()
+			} else {
+				repo.On("GetByID", ctx, "shelf2").Return(nil, repository.ErrBookshelfNotFound).Maybe()
+			}
+			result := &models.BookshelfDeleteResult{BookshelfID: "shelf1", Mode: models.DeleteModeMove, BooksMoved: 2, TargetBookshelfID: tc.opts.TargetID}
+			if tc.repoErr != nil {
+				result = nil
+			}
+			repo.On("DeleteWithBooks", ctx, "shelf1", tc.opts).Return(result, tc.repoErr).Maybe()
+
+			got, err := service.Delete(ctx, "shelf1", tc.opts)
+
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				if tc.repoErr == nil {
+					repo.AssertNotCalled(t, "DeleteWithBooks", mock.Anything, mock.Anything, mock.Anything)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 2, got.BooksMoved)
+			assert.Equal(t, tc.opts.TargetID, got.TargetBookshelfID)
+			if tc.opts.TargetID != "" {
+				assert.Equal(t, 10, tc.opts.BookLimit, "the target's book limit is passed on")
+			}
+		})
+	}
+}
+
 func TestBookshelfService_Delete_ErrorBookshelfNotFound(t *testing.T) {
 	repo := new(MockBookshelfRepository)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &BookshelfService{
-		repo: repo,
-		log:  log,
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
 	}
 
 	ctx := context.Background()
@@ -278,7 +469,7 @@ func TestBookshelfService_Delete_ErrorBookshelfNotFound(t *testing.T) {
 
 	repo.On("GetByID", ctx, bookshelfID).Return(nil, mongo.ErrBookshelfNotFound)
 
-	err := service.Delete(ctx, bookshelfID)
+	_, err := service.Delete(ctx, bookshelfID, &models.BookshelfDeleteOptions{})
 
 	assert.ErrorIs(t, err, ErrBookshelfNotFound)
 	repo.AssertExpectations(t)
@@ -288,3 +479,358 @@ func TestBookshelfService_Delete_ErrorBookshelfNotFound(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+// Helper function to create a cursor codec with a fixed secret
+func newCursors(t *testing.T) *pagination.Cursors {
+	cursors, err := pagination.NewCursors("test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cursors
+}
+
+func TestBookshelfService_CrossUserAccessDenied(t *testing.T) {
+	owner := "owner"
+	intruder := "intruder"
+
+	ownedBookshelf := &models.Bookshelf{
+		ID:     "ownedbookshelf",
+		UserID: owner,
+		Name:   "Owner Bookshelf",
+	}
+
+	testCases := []struct {
+		name string
+		call func(ctx context.Context, service *BookshelfService) error
+	}{
+		{
+			name: "GetByID",
+			call: func(ctx context.Context, service *BookshelfService) error {
+				_, err := service.GetByID(ctx, ownedBookshelf.ID)
+				return err
+			},
+		},
+		{
+			name: "GetByUser",
+			call: func(ctx context.Context, service *BookshelfService) error {
+				_, err := service.GetByUser(ctx, owner, &models.BookshelfListOptions{Page: 1, Limit: 10})
+				return err
+			},
+		},
+		{
+			name: "Update",
+			call: func(ctx context.Context, service *BookshelfService) error {
+				return service.Update(ctx, ownedBookshelf.ID, &models.BookshelfUpdate{Name: stringPtr("Hacked")})
+			},
+		},
+		{
+			name: "Delete",
+			call: func(ctx context.Context, service *BookshelfService) error {
+				_, err := service.Delete(ctx, ownedBookshelf.ID, &models.BookshelfDeleteOptions{Mode: models.DeleteModeCascade})
+				return err
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := new(MockBookshelfRepository)
+			log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			service := &BookshelfService{
+				repo:    repo,
+				policy:  policy.New(log),
+				cursors: newCursors(t),
+				log:     log,
+			}
+
+			ctx := context.WithValue(context.Background(), "userID", intruder)
+
+			repo.On("GetByID", ctx, ownedBookshelf.ID).Return(ownedBookshelf, nil).Maybe()
+
+			err := tc.call(ctx, service)
+			assert.ErrorIs(t, err, ErrNotAuthorized)
+
+			repo.AssertNotCalled(t, "GetByUser", mock.Anything, mock.Anything, mock.Anything)
+			repo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+			repo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+			repo.AssertNotCalled(t, "DeleteWithBooks", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestBookshelfService_GetByUser_Envelope(t *testing.T) {
+	repo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookshelfService{
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
+	}
+
+	userID := "testuser"
+	ctx := context.WithValue(context.Background(), "userID", userID)
+	opts := &models.BookshelfListOptions{Page: 1}
+	bookshelves := []*models.Bookshelf{{ID: "bookshelf1", UserID: userID, Name: "Test Bookshelf"}}
+
+	repo.On("GetByUser", ctx, userID, opts).Return(&models.BookshelfPage{Bookshelves: bookshelves, Total: 1}, nil)
+
+	resp, err := service.GetByUser(ctx, userID, opts)
+
+	assert.NoError(t, err)
+	assert.Equal(t, bookshelves, resp.Bookshelves)
+	assert.Equal(t, int64(1), resp.Total)
+	assert.Equal(t, int64(1), resp.Page)
+	assert.Equal(t, pagination.DefaultLimit, resp.Limit)
+	assert.Equal(t, models.SortByCreatedAt, opts.Sort)
+	assert.Empty(t, resp.NextCursor)
+	assert.Empty(t, resp.PrevCursor)
+	repo.AssertExpectations(t)
+}
+
+// newTreeService returns a service over a tree of the test user's bookshelves
+// (room > bookcase > top, bottom; hall; a chain c1 > c2 > ... > c8 as deep as
+// bookshelves can be nested) and another user's bookshelf.
+func newTreeService(t *testing.T) (*BookshelfService, *MockBookshelfRepository, context.Context) {
+	repo := new(MockBookshelfRepository)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &BookshelfService{
+		repo:    repo,
+		policy:  policy.New(log),
+		cursors: newCursors(t),
+		log:     log,
+	}
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+
+	shelves := []*models.Bookshelf{
+		{ID: "room", Name: "Room"},
+		{ID: "bookcase", ParentID: "room", Name: "Bookcase"},
+		{ID: "top", ParentID: "bookcase", Name: "Top"},
+		{ID: "bottom", ParentID: "bookcase", Name: "Bottom"},
+		{ID: "hall", Name: "Hall"},
+		{ID: "smart", Name: "Gifts", Filter: &models.SmartFilter{Tag: "gift"}},
+	}
+	for i := 1; i <= maxDepth; i++ {
+		chain := &models.Bookshelf{ID: fmt.Sprintf("c%d", i), Name: "Chain"}
+		if i > 1 {
+			chain.ParentID = fmt.Sprintf("c%d", i-1)
+		}
+		shelves = append(shelves, chain)
+	}
+	for _, shelf := range shelves {
+		shelf.UserID = "testuser"
+		repo.On("GetByID", ctx, shelf.ID).Return(shelf, nil).Maybe()
+		repo.On("GetSubtree", ctx, shelf.ID).Return(document.Subtree(shelves, shelf.ID), nil).Maybe()
+	}
+	repo.On("GetByID", ctx, "foreign").Return(&models.Bookshelf{ID: "foreign", UserID: "otheruser"}, nil).Maybe()
+	repo.On("GetByID", ctx, mock.Anything).Return(nil, repository.ErrBookshelfNotFound).Maybe()
+
+	return service, repo, ctx
+}
+
+func TestBookshelfService_Create_Nested(t *testing.T) {
+	tests := []struct {
+		name     string
+		parentID string
+		wantErr  error
+	}{
+		{name: "nested", parentID: "bookcase"},
+		{name: "deepest level", parentID: fmt.Sprintf("c%d", maxDepth-1)},
+		{name: "too deep", parentID: fmt.Sprintf("c%d", maxDepth), wantErr: ErrTooDeep},
+		{name: "missing parent", parentID: "missing", wantErr: ErrParentNotFound},
+		{name: "foreign parent", parentID: "foreign", wantErr: ErrParentNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo, ctx := newTreeService(t)
+			bookshelf := &models.Bookshelf{Name: "Shelf", ParentID: tt.parentID}
+			repo.On("ExistsByNameAndParent", ctx, "Shelf", "testuser", tt.parentID).Return(false, nil).Maybe()
+			repo.On("Create", ctx, bookshelf).Return(nil).Maybe()
+
+			err := service.Create(ctx, bookshelf)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				repo.AssertNotCalled(t, "Create", ctx, bookshelf)
+				return
+			}
+			assert.NoError(t, err)
+			repo.AssertCalled(t, "Create", ctx, bookshelf)
+		})
+	}
+}
+
+func TestBookshelfService_Move(t *testing.T) {
+	tests := []struct {
+		name        string
+		bookshelfID string
+		parentID    string
+		nameTaken   bool
+		wantErr     error
+	}{
+		{name: "to the top level", bookshelfID: "bottom", parentID: ""},
+		{name: "subtree into another bookshelf", bookshelfID: "bookcase", parentID: "hall"},
+		{name: "into itself", bookshelfID: "bookcase", parentID: "bookcase", wantErr: ErrBookshelfCycle},
+		{name: "into its own subtree", bookshelfID: "room", parentID: "top", wantErr: ErrBookshelfCycle},
+		{name: "subtree too deep", bookshelfID: "bookcase", parentID: fmt.Sprintf("c%d", maxDepth-1), wantErr: ErrTooDeep},
+		{name: "name taken in the parent", bookshelfID: "bookcase", parentID: "hall", nameTaken: true, wantErr: ErrBookshelfAlreadyExists},
+		{name: "foreign parent", bookshelfID: "bookcase", parentID: "foreign", wantErr: ErrParentNotFound},
+		{name: "missing bookshelf", bookshelfID: "missing", parentID: "hall", wantErr: ErrBookshelfNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo, ctx := newTreeService(t)
+			repo.On("ExistsByNameAndParent", ctx, mock.Anything, "testuser", tt.parentID).Return(tt.nameTaken, nil).Maybe()
+			update := &models.BookshelfUpdate{ParentID: &tt.parentID}
+			repo.On("Update", ctx, tt.bookshelfID, update).Return(nil).Maybe()
+
+			_, err := service.Move(ctx, tt.bookshelfID, tt.parentID)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				repo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			repo.AssertCalled(t, "Update", ctx, tt.bookshelfID, update)
+		})
+	}
+}
+
+func TestBookshelfService_Details(t *testing.T) {
+	service, repo, ctx := newTreeService(t)
+	repo.On("CountBooks", ctx, []string{"room"}).Return(1, nil)
+	repo.On("CountBooks", ctx, []string{"room", "bookcase", "bottom", "top"}).Return(4, nil)
+	repo.On("CountBooksByGroup", ctx, map[string][]string{"bookcase": {"bookcase", "bottom", "top"}}).Return(map[string]int{"bookcase": 3}, nil).Once()
+	repo.On("CountBooks", ctx, []string{"top"}).Return(2, nil)
+
+	details, err := service.Details(ctx, "room")
+	require.NoError(t, err)
+	assert.Equal(t, "Room", details.Name)
+	assert.Empty(t, details.Breadcrumbs)
+	assert.Equal(t, []models.BookshelfChild{{BookshelfRef: models.BookshelfRef{ID: "bookcase", Name: "Bookcase"}, SubtreeBooks: 3}}, details.Children)
+	assert.Equal(t, 1, details.Books)
+	assert.Equal(t, 4, details.SubtreeBooks)
+
+	details, err = service.Details(ctx, "top")
+	require.NoError(t, err)
+	assert.Equal(t, []models.BookshelfRef{{ID: "room", Name: "Room"}, {ID: "bookcase", Name: "Bookcase"}}, details.Breadcrumbs)
+	assert.NotNil(t, details.Children)
+	assert.Empty(t, details.Children)
+	assert.Equal(t, 2, details.SubtreeBooks)
+
+	_, err = service.Details(ctx, "foreign")
+	assert.ErrorIs(t, err, ErrNotAuthorized)
+}
+
+func TestBookshelfService_Reorder(t *testing.T) {
+	positions := []models.Position{{ID: "top", Key: "F"}, {ID: "bottom", Key: "V"}}
+
+	tests := []struct {
+		name     string
+		parentID string
+		order    models.Reorder
+		changed  []string
+		wantErr  error
+	}{
+		{name: "nested", parentID: "bookcase", order: models.Reorder{ID: "bottom", Before: "top"}, changed: []string{"bottom"}},
+		{name: "unchanged", parentID: "bookcase", order: models.Reorder{IDs: []string{"top", "bottom"}}},
+		{name: "top level", parentID: "", order: models.Reorder{IDs: []string{"bottom", "top"}}, changed: []string{"bottom"}},
+		{name: "incomplete list", parentID: "bookcase", order: models.Reorder{IDs: []string{"top"}}, wantErr: ErrIncompleteList},
+		{name: "unknown item", parentID: "bookcase", order: models.Reorder{ID: "room", After: "top"}, wantErr: ErrUnknownItem},
+		{name: "invalid reorder", parentID: "bookcase", order: models.Reorder{ID: "top"}, wantErr: ErrInvalidReorder},
+		{name: "foreign parent", parentID: "foreign", order: models.Reorder{ID: "bottom", Before: "top"}, wantErr: ErrNotAuthorized},
+		{name: "missing parent", parentID: "missing", order: models.Reorder{ID: "bottom", Before: "top"}, wantErr: ErrBookshelfNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo, ctx := newTreeService(t)
+			repo.On("Positions", ctx, "testuser", tt.parentID).Return(positions, nil).Maybe()
+			repo.On("SetPositions", ctx, mock.Anything).Return(nil).Maybe()
+
+			err := service.Reorder(ctx, tt.parentID, &tt.order)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				repo.AssertNotCalled(t, "SetPositions", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			if tt.changed == nil {
+				repo.AssertNotCalled(t, "SetPositions", mock.Anything, mock.Anything)
+				return
+			}
+			repo.AssertCalled(t, "SetPositions", ctx, mock.MatchedBy(func(changed map[string]string) bool {
+				return len(changed) == len(tt.changed) && changed[tt.changed[0]] != ""
+			}))
+		})
+	}
+}
+
+func TestBookshelfService_SmartFilter(t *testing.T) {
+	noCover := false
+	long := strings.Repeat("й", maxFilterLength+1)
+
+	tests := []struct {
+		name    string
+		filter  models.SmartFilter
+		want    models.SmartFilter
+		wantErr error
+	}{
+		{name: "trimmed", filter: models.SmartFilter{Author: "  Tolstoy ", Tag: " gift"}, want: models.SmartFilter{Author: "Tolstoy", Tag: "gift"}},
+		{name: "no cover", filter: models.SmartFilter{HasCover: &noCover}, want: models.SmartFilter{HasCover: &noCover}},
+		{name: "recent", filter: models.SmartFilter{AddedWithinDays: 30, ShopName: "Shop"}, want: models.SmartFilter{AddedWithinDays: 30, ShopName: "Shop"}},
+		{name: "empty", filter: models.SmartFilter{}, wantErr: ErrInvalidFilter},
+		{name: "blank", filter: models.SmartFilter{Author: "  "}, wantErr: ErrInvalidFilter},
+		{name: "too long", filter: models.SmartFilter{Tag: long}, wantErr: ErrInvalidFilter},
+		{name: "negative days", filter: models.SmartFilter{AddedWithinDays: -1}, wantErr: ErrInvalidFilter},
+		{name: "too many days", filter: models.SmartFilter{AddedWithinDays: maxAddedDays + 1}, wantErr: ErrInvalidFilter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo, ctx := newTreeService(t)
+			filter := tt.filter
+			bookshelf := &models.Bookshelf{Name: "Smart", Filter: &filter}
+			repo.On("ExistsByNameAndParent", ctx, "Smart", "testuser", "").Return(false, nil).Maybe()
+			repo.On("Create", ctx, bookshelf).Return(nil).Maybe()
+
+			err := service.Create(ctx, bookshelf)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *bookshelf.Filter)
+		})
+	}
+}
+
+func TestBookshelfService_SmartBookshelf(t *testing.T) {
+	service, repo, ctx := newTreeService(t)
+	repo.On("ExistsByNameAndParent", ctx, mock.Anything, "testuser", mock.Anything).Return(false, nil).Maybe()
+	repo.On("Update", ctx, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	// Nothing is nested in a smart bookshelf.
+	err := service.Create(ctx, &models.Bookshelf{Name: "Shelf", ParentID: "smart"})
+	assert.ErrorIs(t, err, ErrSmartParent)
+	_, err = service.Move(ctx, "bookcase", "smart")
+	assert.ErrorIs(t, err, ErrSmartParent)
+
+	// Only a smart bookshelf gets a new filter.
+	err = service.Update(ctx, "room", &models.BookshelfUpdate{Filter: &models.SmartFilter{Tag: "gift"}})
+	assert.ErrorIs(t, err, ErrNotSmart)
+	err = service.Update(ctx, "smart", &models.BookshelfUpdate{Filter: &models.SmartFilter{}})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	repo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+
+	update := &models.BookshelfUpdate{Filter: &models.SmartFilter{Tag: " present "}}
+	require.NoError(t, service.Update(ctx, "smart", update))
+	repo.AssertCalled(t, "Update", ctx, "smart", update)
+	assert.Equal(t, "present", update.Filter.Tag)
+}
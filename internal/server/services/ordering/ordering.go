@@ -0,0 +1,89 @@
+// Package ordering applies reorder requests to manually ordered lists, such as
+// the books on a bookshelf or the bookshelves with the same parent. Items are
+// ordered by fractional index keys, so a reorder only rewrites the keys of the
+// items that actually move.
+package ordering
+
+import (
+	"errors"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/lib/fracindex"
+	"slices"
+)
+
+// Custom Error Types:
+var (
+	ErrInvalidReorder = errors.New("reorder takes either ids, or an id with before or after")
+	ErrIncompleteList = errors.New("ids must list every item exactly once")
+	ErrUnknownItem    = errors.New("item is not in the list")
+)
+
+// Apply returns the new keys of the items, listed in their current order,
+// that the reorder moves: item ID -> key. Either the full list of IDs is
+// given in the new order, or one item is moved before or after another.
+func Apply(items []models.Position, order *models.Reorder) (map[string]string, error) {
+	ids, err := reordered(items, order)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]string, len(items))
+	for _, item := range items {
+		keys[item.ID] = item.Key
+	}
+	current := make([]string, len(ids))
+	for i, id := range ids {
+		current[i] = keys[id]
+	}
+
+	changed := map[string]string{}
+	for i, key := range fracindex.Rekey(current) {
+		if key != current[i] {
+			changed[ids[i]] = key
+		}
+	}
+	return changed, nil
+}
+
+// reordered returns the IDs of the items in the order the reorder asks for.
+func reordered(items []models.Position, order *models.Reorder) ([]string, error) {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	if len(order.IDs) > 0 {
+		if order.ID != "" || order.Before != "" || order.After != "" {
+			return nil, ErrInvalidReorder
+		}
+		if len(order.IDs) != len(ids) {
+			return nil, ErrIncompleteList
+		}
+		seen := make(map[string]bool, len(order.IDs))
+		for _, id := range order.IDs {
+			if seen[id] || !slices.Contains(ids, id) {
+				return nil, ErrIncompleteList
+			}
+			seen[id] = true
+		}
+		return order.IDs, nil
+	}
+
+	anchor := order.Before
+	if order.ID == "" || (order.Before == "") == (order.After == "") || anchor == order.ID || order.After == order.ID {
+		return nil, ErrInvalidReorder
+	}
+	if anchor == "" {
+		anchor = order.After
+	}
+	if !slices.Contains(ids, order.ID) || !slices.Contains(ids, anchor) {
+		return nil, ErrUnknownItem
+	}
+
+	ids = slices.DeleteFunc(ids, func(id string) bool { return id == order.ID })
+	at := slices.Index(ids, anchor)
+	if order.After != "" {
+		at++
+	}
+	return slices.Insert(ids, at, order.ID), nil
+}
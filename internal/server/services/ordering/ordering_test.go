@@ -0,0 +1,72 @@
+package ordering
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	items := []models.Position{{ID: "a", Key: "F"}, {ID: "b", Key: "V"}, {ID: "c", Key: "k"}}
+
+	tests := []struct {
+		name    string
+		order   models.Reorder
+		want    []string // IDs in the new order
+		changed []string // IDs whose key changes
+		err     error
+	}{
+		{"unchanged", models.Reorder{IDs: []string{"a", "b", "c"}}, []string{"a", "b", "c"}, nil, nil},
+		{"full list", models.Reorder{IDs: []string{"c", "a", "b"}}, []string{"c", "a", "b"}, []string{"c"}, nil},
+		{"reversed", models.Reorder{IDs: []string{"c", "b", "a"}}, []string{"c", "b", "a"}, []string{"b", "c"}, nil},
+		{"before", models.Reorder{ID: "c", Before: "b"}, []string{"a", "c", "b"}, []string{"c"}, nil},
+		{"after", models.Reorder{ID: "a", After: "c"}, []string{"b", "c", "a"}, []string{"a"}, nil},
+		{"before first", models.Reorder{ID: "b", Before: "a"}, []string{"b", "a", "c"}, []string{"b"}, nil},
+		{"in place", models.Reorder{ID: "a", Before: "b"}, []string{"a", "b", "c"}, nil, nil},
+		{"missing item", models.Reorder{IDs: []string{"a", "b"}}, nil, nil, ErrIncompleteList},
+		{"repeated item", models.Reorder{IDs: []string{"a", "b", "b"}}, nil, nil, ErrIncompleteList},
+		{"foreign item", models.Reorder{IDs: []string{"a", "b", "x"}}, nil, nil, ErrIncompleteList},
+		{"unknown id", models.Reorder{ID: "x", Before: "a"}, nil, nil, ErrUnknownItem},
+		{"unknown anchor", models.Reorder{ID: "a", After: "x"}, nil, nil, ErrUnknownItem},
+		{"empty", models.Reorder{}, nil, nil, ErrInvalidReorder},
+		{"no anchor", models.Reorder{ID: "a"}, nil, nil, ErrInvalidReorder},
+		{"both anchors", models.Reorder{ID: "a", Before: "b", After: "c"}, nil, nil, ErrInvalidReorder},
+		{"itself", models.Reorder{ID: "a", Before: "a"}, nil, nil, ErrInvalidReorder},
+		{"both forms", models.Reorder{IDs: []string{"a", "b", "c"}, ID: "a", After: "b"}, nil, nil, ErrInvalidReorder},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, err := Apply(items, &tt.order)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			var ids []string
+			for id := range changed {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			assert.Equal(t, tt.changed, ids)
+
+			// Sorting by the new keys gives the requested order.
+			result := make([]models.Position, len(items))
+			for i, item := range items {
+				if key, ok := changed[item.ID]; ok {
+					item.Key = key
+				}
+				result[i] = item
+			}
+			sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+			var order []string
+			for _, item := range result {
+				order = append(order, item.ID)
+			}
+			assert.Equal(t, tt.want, order)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor occurs when a cursor is malformed, tampered with or used for another list.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrNoCursorSecret occurs when cursors are created without a secret.
+var ErrNoCursorSecret = errors.New("cursor secret is empty")
+
+// Cursor is the decoded content of a continuation token.
+type Cursor struct {
+	Scope    string           `json:"sc"` // list the cursor was issued for
+	Sort     string           `json:"s"`
+	Order    models.SortOrder `json:"o"`
+	Value    string           `json:"v"` // sort field value of the boundary item
+	ID       string           `json:"id"`
+	Backward bool             `json:"b,omitempty"`
+}
+
+// Cursors signs and verifies opaque continuation tokens.
+type Cursors struct {
+	secret []byte
+}
+
+// NewCursors creates a new Cursors instance signing with the secret, which
+// must not be empty.
+func NewCursors(secret string) (*Cursors, error) {
+	if secret == "" {
+		return nil, ErrNoCursorSecret
+	}
+	return &Cursors{secret: []byte(secret)}, nil
+}
+
+// NewRandomCursors creates a new Cursors instance signing with a random
+// secret. Its cursors are invalid after a restart and on other replicas.
+func NewRandomCursors() (*Cursors, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate cursor secret: %w", err)
+	}
+	return &Cursors{secret: key}, nil
+}
+
+// Scope returns the scope of a list with the given filter, so that a cursor
+// is only valid with the filter it was issued for. The sort field and order
+// are signed in the cursor itself.
+func Scope(list string, filter interface{}) string {
+	payload, err := json.Marshal(filter)
+	if err != nil {
+		// Filters are plain values; one that cannot be encoded matches no cursor.
+		return list + ":invalid"
+	}
+	sum := sha256.Sum256(payload)
+	return list + ":" + hex.EncodeToString(sum[:8])
+}
+
+// Encode serializes and signs a cursor.
+func (c *Cursors) Encode(cursor Cursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(encoded)), nil
+}
+
+// Decode verifies a token and checks that it was issued for the given scope.
+func (c *Cursors) Decode(token, scope string) (*Cursor, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, c.sign(encoded)) {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(payload, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Scope != scope || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+func (c *Cursors) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// Position converts a decoded cursor into a repository keyset position.
+// Timestamp sort fields are parsed back into time values.
+func (c *Cursor) Position() (*models.CursorPosition, error) {
+	var value interface{} = c.Value
+	if c.Sort == models.SortByCreatedAt || c.Sort == models.SortByUpdatedAt {
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		value = t
+	}
+
+	return &models.CursorPosition{
+		Value:    value,
+		ID:       c.ID,
+		Backward: c.Backward,
+	}, nil
+}
+
+// FormatValue formats a sort field value for a cursor.
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Resolve decodes a client token into the cursor and its keyset position.
+func (c *Cursors) Resolve(token, scope string) (*Cursor, *models.CursorPosition, error) {
+	cursor, err := c.Decode(token, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	position, err := cursor.Position()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cursor, position, nil
+}
+
+// Boundary is the sort field value and ID of the first or last item of a page.
+type Boundary struct {
+	Value interface{}
+	ID    string
+}
+
+// Page describes a fetched page for building its continuation cursors.
+type Page struct {
+	Scope    string
+	Sort     string
+	Order    models.SortOrder
+	Number   int64                  // page number in offset mode
+	Position *models.CursorPosition // position the page was read from in cursor mode
+	HasMore  bool                   // more items follow in the listing direction
+	First    *Boundary
+	Last     *Boundary
+}
+
+// Links returns the next and previous cursors of a page. Offset pages get
+// cursors too, so clients can switch to infinite scroll from any page.
+func (c *Cursors) Links(p Page) (next string, prev string, err error) {
+	if p.First == nil || p.Last == nil {
+		return "", "", nil
+	}
+
+	backward := p.Position != nil && p.Position.Backward
+	hasNext := p.HasMore
+	hasPrev := p.Position != nil || p.Number > 1
+	if backward {
+		hasNext, hasPrev = true, p.HasMore
+	}
+
+	if hasNext {
+		next, err = c.Encode(Cursor{
+			Scope: p.Scope,
+			Sort:  p.Sort,
+			Order: p.Order,
+			Value: FormatValue(p.Last.Value),
+			ID:    p.Last.ID,
+		})
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if hasPrev {
+		prev, err = c.Encode(Cursor{
+			Scope:    p.Scope,
+			Sort:     p.Sort,
+			Order:    p.Order,
+			Value:    FormatValue(p.First.Value),
+			ID:       p.First.ID,
+			Backward: true,
+		})
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return next, prev, nil
+}
@@ -0,0 +1,143 @@
+package pagination
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCursors_RoundTrip(t *testing.T) {
+	cursors, err := NewCursors("secret")
+	require.NoError(t, err)
+
+	createdAt := time.Date(2024, 5, 1, 10, 30, 0, 123000000, time.UTC)
+	token, err := cursors.Encode(Cursor{
+		Scope: "books:user:testuser",
+		Sort:  models.SortByCreatedAt,
+		Order: models.SortDesc,
+		Value: FormatValue(createdAt),
+		ID:    "book1",
+	})
+	require.NoError(t, err)
+
+	cursor, position, err := cursors.Resolve(token, "books:user:testuser")
+	require.NoError(t, err)
+	assert.Equal(t, models.SortByCreatedAt, cursor.Sort)
+	assert.Equal(t, models.SortDesc, cursor.Order)
+	assert.Equal(t, createdAt, position.Value)
+	assert.Equal(t, "book1", position.ID)
+	assert.False(t, position.Backward)
+}
+
+func TestCursors_Rejected(t *testing.T) {
+	cursors, err := NewCursors("secret")
+	require.NoError(t, err)
+	other, err := NewCursors("other-secret")
+	require.NoError(t, err)
+
+	token, err := cursors.Encode(Cursor{Scope: "books:user:owner", Sort: models.SortByTitle, Order: models.SortAsc, Value: "A", ID: "book1"})
+	require.NoError(t, err)
+	forged, err := other.Encode(Cursor{Scope: "books:user:owner", Sort: models.SortByTitle, Order: models.SortAsc, Value: "A", ID: "book1"})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name  string
+		token string
+		scope string
+	}{
+		{name: "Other Scope", token: token, scope: "books:user:intruder"},
+		{name: "Other Secret", token: forged, scope: "books:user:owner"},
+		{name: "Tampered Payload", token: "x" + token, scope: "books:user:owner"},
+		{name: "No Signature", token: "abc", scope: "books:user:owner"},
+		{name: "Garbage", token: "!!!.???", scope: "books:user:owner"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := cursors.Decode(tc.token, tc.scope)
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
+
+func TestNewCursors_RequiresSecret(t *testing.T) {
+	_, err := NewCursors("")
+	assert.ErrorIs(t, err, ErrNoCursorSecret)
+
+	random, err := NewRandomCursors()
+	require.NoError(t, err)
+	other, err := NewRandomCursors()
+	require.NoError(t, err)
+	token, err := random.Encode(Cursor{Scope: "books:user:owner", Sort: models.SortByTitle, Order: models.SortAsc, Value: "A", ID: "book1"})
+	require.NoError(t, err)
+	_, err = other.Decode(token, "books:user:owner")
+	assert.ErrorIs(t, err, ErrInvalidCursor, "random secrets differ")
+}
+
+func TestScope(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	filter := models.BookFilter{Author: "Tolkien", CreatedFrom: &from}
+
+	assert.Equal(t, Scope("books:user:u1", filter), Scope("books:user:u1", filter))
+	assert.NotEqual(t, Scope("books:user:u1", filter), Scope("books:user:u2", filter))
+	assert.NotEqual(t, Scope("books:user:u1", filter), Scope("books:user:u1", models.BookFilter{Author: "Tolkien"}))
+	assert.NotEqual(t, Scope("books:user:u1", filter), Scope("books:user:u1", models.BookFilter{}))
+}
+
+func TestCursors_Links(t *testing.T) {
+	cursors, err := NewCursors("secret")
+	require.NoError(t, err)
+
+	first := &Boundary{Value: "A", ID: "book1"}
+	last := &Boundary{Value: "C", ID: "book3"}
+	page := func(number int64, position *models.CursorPosition, hasMore bool) Page {
+		return Page{
+			Scope:    "books:user:testuser",
+			Sort:     models.SortByTitle,
+			Order:    models.SortAsc,
+			Number:   number,
+			Position: position,
+			HasMore:  hasMore,
+			First:    first,
+			Last:     last,
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		page     Page
+		wantNext bool
+		wantPrev bool
+	}{
+		{name: "First Page", page: page(1, nil, true), wantNext: true},
+		{name: "Last Page", page: page(3, nil, false), wantPrev: true},
+		{name: "Forward Cursor", page: page(1, &models.CursorPosition{ID: "book0"}, true), wantNext: true, wantPrev: true},
+		{name: "Forward Cursor At End", page: page(1, &models.CursorPosition{ID: "book0"}, false), wantPrev: true},
+		{name: "Backward Cursor At Start", page: page(1, &models.CursorPosition{ID: "book4", Backward: true}, false), wantNext: true},
+		{name: "Empty Page", page: Page{Scope: "books:user:testuser", HasMore: true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			next, prev, err := cursors.Links(tc.page)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantNext, next != "")
+			assert.Equal(t, tc.wantPrev, prev != "")
+
+			if next != "" {
+				cursor, err := cursors.Decode(next, tc.page.Scope)
+				require.NoError(t, err)
+				assert.Equal(t, last.ID, cursor.ID)
+				assert.False(t, cursor.Backward)
+			}
+			if prev != "" {
+				cursor, err := cursors.Decode(prev, tc.page.Scope)
+				require.NoError(t, err)
+				assert.Equal(t, first.ID, cursor.ID)
+				assert.True(t, cursor.Backward)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package pagination
+
+import (
+	"errors"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+)
+
+const (
+	DefaultLimit int64 = 10
+	MaxLimit     int64 = 100
+)
+
+// Custom Error Types:
+var (
+	ErrInvalidPage  = errors.New("page must be a positive number")
+	ErrInvalidSort  = errors.New("unsupported sort field")
+	ErrInvalidOrder = errors.New("sort order must be asc or desc")
+)
+
+// Normalize validates the page and clamps the limit to [1, MaxLimit].
+// A zero limit falls back to DefaultLimit.
+func Normalize(page, limit int64) (int64, int64, error) {
+	if page < 1 {
+		return 0, 0, ErrInvalidPage
+	}
+
+	switch {
+	case limit <= 0:
+		limit = DefaultLimit
+	case limit > MaxLimit:
+		limit = MaxLimit
+	}
+
+	return page, limit, nil
+}
+
+// NormalizeSort validates the sort field against the allowed ones.
+// An empty field falls back to created_at, an empty order to ascending.
+func NormalizeSort(sort string, order models.SortOrder, allowed ...string) (string, models.SortOrder, error) {
+	if sort == "" {
+		sort = models.SortByCreatedAt
+	}
+
+	valid := false
+	for _, field := range allowed {
+		if field == sort {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", 0, ErrInvalidSort
+	}
+
+	switch order {
+	case 0:
+		order = models.SortAsc
+	case models.SortAsc, models.SortDesc:
+	default:
+		return "", 0, ErrInvalidOrder
+	}
+
+	return sort, order, nil
+}
@@ -0,0 +1,57 @@
+package pagination
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		name          string
+		page, limit   int64
+		expectedPage  int64
+		expectedLimit int64
+		err           error
+	}{
+		{name: "Valid", page: 2, limit: 20, expectedPage: 2, expectedLimit: 20},
+		{name: "Default Limit", page: 1, limit: 0, expectedPage: 1, expectedLimit: DefaultLimit},
+		{name: "Negative Limit", page: 1, limit: -5, expectedPage: 1, expectedLimit: DefaultLimit},
+		{name: "Clamped Limit", page: 1, limit: 1000, expectedPage: 1, expectedLimit: MaxLimit},
+		{name: "Zero Page", page: 0, limit: 10, err: ErrInvalidPage},
+		{name: "Negative Page", page: -1, limit: 10, err: ErrInvalidPage},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, limit, err := Normalize(tc.page, tc.limit)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPage, page)
+			assert.Equal(t, tc.expectedLimit, limit)
+		})
+	}
+}
+
+func TestNormalizeSort(t *testing.T) {
+	allowed := []string{models.SortByTitle, models.SortByCreatedAt}
+
+	sort, order, err := NormalizeSort("", 0, allowed...)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SortByCreatedAt, sort)
+	assert.Equal(t, models.SortAsc, order)
+
+	sort, order, err = NormalizeSort(models.SortByTitle, models.SortDesc, allowed...)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SortByTitle, sort)
+	assert.Equal(t, models.SortDesc, order)
+
+	_, _, err = NormalizeSort("isbn", models.SortAsc, allowed...)
+	assert.ErrorIs(t, err, ErrInvalidSort)
+
+	_, _, err = NormalizeSort(models.SortByTitle, 5, allowed...)
+	assert.ErrorIs(t, err, ErrInvalidOrder)
+}
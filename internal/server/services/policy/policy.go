@@ -0,0 +1,132 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"log/slog"
+)
+
+// Custom Error Types:
+var (
+	ErrUserNotFoundInContext = errors.New("userID not found in context")
+	ErrNotAuthorized         = errors.New("user is not authorized to perform this action")
+)
+
+// Action is an operation a user performs on a resource.
+type Action string
+
+const (
+	ActionRead   Action = "read"
+	ActionList   Action = "list"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Kind is the type of resource being accessed.
+type Kind string
+
+const (
+	KindBook      Kind = "book"
+	KindBookshelf Kind = "bookshelf"
+	KindLibrary   Kind = "library" // all books or bookshelves of a user
+)
+
+// Resource describes the object an action is performed on.
+type Resource struct {
+	Kind    Kind
+	ID      string
+	OwnerID string
+}
+
+// Rule decides whether a user may perform an action on a resource.
+// Rules only grant access; a request is denied when no rule allows it.
+type Rule interface {
+	Allows(ctx context.Context, userID string, action Action, resource Resource) (bool, error)
+}
+
+// RuleFunc is an adapter to allow the use of ordinary functions as a Rule.
+type RuleFunc func(ctx context.Context, userID string, action Action, resource Resource) (bool, error)
+
+// Allows calls f(ctx, userID, action, resource).
+func (f RuleFunc) Allows(ctx context.Context, userID string, action Action, resource Resource) (bool, error) {
+	return f(ctx, userID, action, resource)
+}
+
+// OwnerRule grants every action to the owner of the resource.
+var OwnerRule = RuleFunc(func(_ context.Context, userID string, _ Action, resource Resource) (bool, error) {
+	return resource.OwnerID != "" && resource.OwnerID == userID, nil
+})
+
+// Policy is the single place where access to books and bookshelves is decided.
+// Shared access can be added later by passing additional rules to New.
+type Policy struct {
+	rules []Rule
+	log   *slog.Logger
+}
+
+// New creates a new Policy. Without rules only owners are allowed.
+func New(log *slog.Logger, rules ...Rule) *Policy {
+	if len(rules) == 0 {
+		rules = []Rule{OwnerRule}
+	}
+	return &Policy{
+		rules: rules,
+		log:   log,
+	}
+}
+
+// UserID returns the authenticated user from the context.
+func UserID(ctx context.Context) (string, error) {
+	userID, ok := ctx.Value("userID").(string)
+	if !ok || userID == "" {
+		return "", ErrUserNotFoundInContext
+	}
+	return userID, nil
+}
+
+// Authorize checks that the user from the context may perform the action on the resource.
+func (p *Policy) Authorize(ctx context.Context, action Action, resource Resource) error {
+	const op = "policy.Policy.Authorize"
+
+	userID, err := UserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range p.rules {
+		allowed, err := rule.Allows(ctx, userID, action, resource)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if allowed {
+			return nil
+		}
+	}
+
+	p.log.Warn("access denied",
+		slog.String("op", op),
+		slog.String("userID", userID),
+		slog.String("action", string(action)),
+		slog.String("kind", string(resource.Kind)),
+		slog.String("id", resource.ID),
+	)
+	return ErrNotAuthorized
+}
+
+// Book checks access to a book.
+func (p *Policy) Book(ctx context.Context, action Action, book *models.Book) error {
+	return p.Authorize(ctx, action, Resource{Kind: KindBook, ID: book.ID, OwnerID: book.UserID})
+}
+
+// Bookshelf checks access to a bookshelf.
+func (p *Policy) Bookshelf(ctx context.Context, action Action, bookshelf *models.Bookshelf) error {
+	return p.Authorize(ctx, action, Resource{Kind: KindBookshelf, ID: bookshelf.ID, OwnerID: bookshelf.UserID})
+}
+
+// Library checks access to the whole library (books or bookshelves) of a user.
+func (p *Policy) Library(ctx context.Context, action Action, ownerID string) error {
+	return p.Authorize(ctx, action, Resource{Kind: KindLibrary, ID: ownerID, OwnerID: ownerID})
+}
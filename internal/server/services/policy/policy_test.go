@@ -0,0 +1,76 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestPolicy_AccessMatrix(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	p := New(log)
+
+	book := &models.Book{ID: "book", UserID: "owner"}
+	bookshelf := &models.Bookshelf{ID: "bookshelf", UserID: "owner"}
+	actions := []Action{ActionRead, ActionList, ActionCreate, ActionUpdate, ActionDelete}
+
+	users := []struct {
+		name   string
+		ctx    context.Context
+		expect error
+	}{
+		{name: "owner", ctx: context.WithValue(context.Background(), "userID", "owner"), expect: nil},
+		{name: "other user", ctx: context.WithValue(context.Background(), "userID", "intruder"), expect: ErrNotAuthorized},
+		{name: "anonymous", ctx: context.Background(), expect: ErrUserNotFoundInContext},
+		{name: "empty user", ctx: context.WithValue(context.Background(), "userID", ""), expect: ErrUserNotFoundInContext},
+	}
+
+	for _, u := range users {
+		for _, action := range actions {
+			t.Run(u.name+"/"+string(action), func(t *testing.T) {
+				assert.ErrorIs(t, p.Book(u.ctx, action, book), u.expect)
+				assert.ErrorIs(t, p.Bookshelf(u.ctx, action, bookshelf), u.expect)
+				assert.ErrorIs(t, p.Library(u.ctx, action, "owner"), u.expect)
+			})
+		}
+	}
+}
+
+func TestPolicy_OwnerlessResourceDenied(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	p := New(log)
+
+	ctx := context.WithValue(context.Background(), "userID", "testuser")
+
+	assert.ErrorIs(t, p.Book(ctx, ActionRead, &models.Book{ID: "book"}), ErrNotAuthorized)
+}
+
+func TestPolicy_AdditionalRuleGrantsAccess(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	shared := RuleFunc(func(_ context.Context, userID string, action Action, resource Resource) (bool, error) {
+		return userID == "friend" && action == ActionRead && resource.Kind == KindBookshelf, nil
+	})
+	p := New(log, OwnerRule, shared)
+
+	bookshelf := &models.Bookshelf{ID: "bookshelf", UserID: "owner"}
+	ctx := context.WithValue(context.Background(), "userID", "friend")
+
+	assert.NoError(t, p.Bookshelf(ctx, ActionRead, bookshelf))
+	assert.ErrorIs(t, p.Bookshelf(ctx, ActionDelete, bookshelf), ErrNotAuthorized)
+}
+
+func TestPolicy_RuleErrorIsReturned(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ruleErr := errors.New("rule failed")
+	p := New(log, RuleFunc(func(context.Context, string, Action, Resource) (bool, error) {
+		return false, ruleErr
+	}))
+
+	ctx := context.WithValue(context.Background(), "userID", "owner")
+
+	assert.ErrorIs(t, p.Library(ctx, ActionList, "owner"), ruleErr)
+}
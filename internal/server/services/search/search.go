@@ -3,17 +3,19 @@ package search
 import (
 	"context"
 	"errors"
+	"fmt"
 	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/searchrpc"
 	"github.com/getz-devs/librakeeper-server/internal/server/models"
 	"github.com/getz-devs/librakeeper-server/internal/server/repository"
-	"github.com/getz-devs/librakeeper-server/internal/server/storage/mongo"
+	"github.com/getz-devs/librakeeper-server/lib/isbn"
 	"log/slog"
 )
 
 type SearchService struct {
-	searcher     repository.SearchRepo
-	allBooksRepo repository.BookRepo
-	log          *slog.Logger
+	searcher repository.SearchRepo
+	catalog  repository.CatalogRepo
+	log      *slog.Logger
 }
 
 // Simple выполняет простой поиск по ISBN в локальной базе данных.
@@ -21,40 +23,54 @@ func (s *SearchService) Simple(ctx context.Context, isbn string) (*models.Search
 	const op = "search.SearchService.Simple"
 	log := s.log.With(slog.String("op", op), slog.String("isbn", isbn))
 
-	if isbn == "" {
-		return nil, ErrISBNRequired
+	isbn, err := normalize(isbn)
+	if err != nil {
+		return nil, err
 	}
 
-	// Используем GetByISBN для поиска по ISBN
-	book, err := s.allBooksRepo.GetByISBN(ctx, isbn)
+	entry, err := s.catalog.GetByISBN(ctx, isbn)
 	if err != nil {
-		if errors.Is(err, mongo.ErrBookNotFound) {
+		if errors.Is(err, repository.ErrCatalogEntryNotFound) {
 			return nil, ErrISBNNotFound
 		}
-		log.Error("failed to get book from allBooksRepo", slog.Any("error", err))
+		log.Error("failed to get catalog entry", slog.Any("error", err))
 		return nil, err
 	}
 
 	return &models.SearchResponse{
 		Status: searcherv1.SearchByISBNResponse_SUCCESS,
-		Books:  []*models.Book{book}, // Используем найденный объект book напрямую
+		Books:  []*models.Book{entry.Book()},
 	}, nil
 }
 
 // Advanced выполняет расширенный поиск по ISBN с использованием gRPC.
 func (s *SearchService) Advanced(ctx context.Context, isbn string) (*models.SearchResponse, error) { // Измените тип возвращаемого значения
+	return s.advanced(ctx, isbn, false)
+}
+
+// Retry re-runs a failed advanced search without waiting for its backoff.
+func (s *SearchService) Retry(ctx context.Context, isbn string) (*models.SearchResponse, error) {
+	return s.advanced(ctx, isbn, true)
+}
+
+func (s *SearchService) advanced(ctx context.Context, isbn string, force bool) (*models.SearchResponse, error) {
 	const op = "search.SearchService.Advanced"
 	log := s.log.With(slog.String("op", op), slog.String("isbn", isbn))
 
-	if isbn == "" {
-		return nil, ErrISBNRequired
+	isbn, err := normalize(isbn)
+	if err != nil {
+		return nil, err
 	}
 
-	grpcResponse, err := s.searcher.SearchByISBN(ctx, isbn) // Получаем ответ от gRPC сервиса
+	grpcResponse, err := s.searcher.SearchByISBN(ctx, isbn, force) // Получаем ответ от gRPC сервиса
 	if err != nil {
 		log.Error("failed to search by ISBN", slog.Any("error", err))
 		return nil, err
 	}
+	if !searchrpc.KnownStatus(grpcResponse.Status) {
+		log.Error("unknown search status", slog.Int("status", int(grpcResponse.Status)))
+		return nil, fmt.Errorf("%w: %d", ErrUnknownStatus, grpcResponse.Status)
+	}
 
 	// Преобразуем gRPC ответ в models.SearchResponse
 	var books []*models.Book
@@ -73,14 +89,28 @@ func (s *SearchService) Advanced(ctx context.Context, isbn string) (*models.Sear
 
 	return &models.SearchResponse{
 		Status: grpcResponse.Status,
+		Reason: grpcResponse.FailureReason,
 		Books:  books,
 	}, nil
 }
 
-func NewSearchService(client repository.SearchRepo, repo repository.BookRepo, log *slog.Logger) *SearchService {
+func NewSearchService(client repository.SearchRepo, catalog repository.CatalogRepo, log *slog.Logger) *SearchService {
 	return &SearchService{
-		searcher:     client,
-		allBooksRepo: repo,
-		log:          log,
+		searcher: client,
+		catalog:  catalog,
+		log:      log,
+	}
+}
+
+// normalize validates an ISBN and returns its canonical ISBN-13 form.
+func normalize(s string) (string, error) {
+	if s == "" {
+		return "", ErrISBNRequired
+	}
+
+	normalized, err := isbn.Normalize(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidISBN, err)
 	}
+	return normalized, nil
 }
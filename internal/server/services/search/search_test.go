@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/searchrpc"
 	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"log/slog"
@@ -17,130 +19,110 @@ type MockSearchRepo struct {
 	mock.Mock
 }
 
-func (m *MockSearchRepo) SearchByISBN(ctx context.Context, isbn string) (*searcherv1.SearchByISBNResponse, error) {
-	args := m.Called(ctx, isbn)
+func (m *MockSearchRepo) SearchByISBN(ctx context.Context, isbn string, force bool) (*repository.SearchResult, error) {
+	args := m.Called(ctx, isbn, force)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*searcherv1.SearchByISBNResponse), args.Error(1)
+	return args.Get(0).(*repository.SearchResult), args.Error(1)
 }
 
-type MockBookRepo struct {
+type MockCatalogRepo struct {
 	mock.Mock
 }
 
-func (m *MockBookRepo) Create(ctx context.Context, book *models.Book) error {
-	args := m.Called(ctx, book)
+func (m *MockCatalogRepo) Create(ctx context.Context, entry *models.CatalogEntry) error {
+	args := m.Called(ctx, entry)
 	return args.Error(0)
 }
 
-func (m *MockBookRepo) GetByID(ctx context.Context, id string) (*models.Book, error) {
+func (m *MockCatalogRepo) GetByID(ctx context.Context, id string) (*models.CatalogEntry, error) {
 	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*models.Book), args.Error(1)
+	return args.Get(0).(*models.CatalogEntry), args.Error(1)
 }
 
-func (m *MockBookRepo) GetByISBN(ctx context.Context, isbn string) (*models.Book, error) {
+func (m *MockCatalogRepo) GetByISBN(ctx context.Context, isbn string) (*models.CatalogEntry, error) {
 	args := m.Called(ctx, isbn)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*models.Book), args.Error(1)
-}
-
-func (m *MockBookRepo) GetByUserID(ctx context.Context, userID string, page int64, limit int64) ([]*models.Book, error) {
-	args := m.Called(ctx, userID, page, limit)
-	return args.Get(0).([]*models.Book), args.Error(1)
-}
-
-func (m *MockBookRepo) GetByBookshelfID(ctx context.Context, bookshelfID string, page int64, limit int64) ([]*models.Book, error) {
-	args := m.Called(ctx, bookshelfID, page, limit)
-	return args.Get(0).([]*models.Book), args.Error(1)
-}
-
-func (m *MockBookRepo) CountInBookshelf(ctx context.Context, bookshelfID string) (int, error) {
-	args := m.Called(ctx, bookshelfID)
-	return args.Int(0), args.Error(1)
-}
-
-func (m *MockBookRepo) ExistsInBookshelf(ctx context.Context, isbn, bookshelfID string) (bool, error) {
-	args := m.Called(ctx, isbn, bookshelfID)
-	return args.Bool(0), args.Error(1)
-}
-
-func (m *MockBookRepo) Update(ctx context.Context, id string, update *models.BookUpdate) error {
-	args := m.Called(ctx, id, update)
-	return args.Error(0)
+	return args.Get(0).(*models.CatalogEntry), args.Error(1)
 }
 
-func (m *MockBookRepo) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockCatalogRepo) AddEdition(ctx context.Context, id string, edition models.Edition) error {
+	args := m.Called(ctx, id, edition)
 	return args.Error(0)
 }
 
 func TestSearchService_Simple_Success(t *testing.T) {
 	searchRepo := new(MockSearchRepo)
-	bookRepo := new(MockBookRepo)
+	catalogRepo := new(MockCatalogRepo)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &SearchService{
-		searcher:     searchRepo,
-		allBooksRepo: bookRepo,
-		log:          log,
+		searcher: searchRepo,
+		catalog:  catalogRepo,
+		log:      log,
 	}
 
 	ctx := context.Background()
-	isbn := "1234567890"
-	expectedBook := &models.Book{
-		ID:          "testbookid",
-		UserID:      "testuser",
-		BookshelfID: "testbookshelf",
-		ISBN:        isbn,
-		Title:       "Test Book",
-		Author:      "Test Author",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	isbn := "5-17-118366-X"
+	entry := &models.CatalogEntry{
+		ID:           "testentryid",
+		ISBN10:       "517118366X",
+		ISBN13:       "9785171183660",
+		Title:        "Test Book",
+		Contributors: []models.Contributor{{Name: "Test Author", Role: models.RoleAuthor}},
+		Editions:     []models.Edition{{Publisher: "Test Publishing", ShopName: "Test Shop"}},
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
 	}
 
-	bookRepo.On("GetByISBN", ctx, isbn).Return(expectedBook, nil)
+	catalogRepo.On("GetByISBN", ctx, "9785171183660").Return(entry, nil)
 
 	resp, err := service.Simple(ctx, isbn)
 
 	assert.NoError(t, err)
 	assert.Equal(t, searcherv1.SearchByISBNResponse_SUCCESS, resp.Status)
-	assert.Equal(t, expectedBook, resp.Books[0])
-	bookRepo.AssertExpectations(t)
+	assert.Equal(t, "testentryid", resp.Books[0].CatalogID)
+	assert.Equal(t, "9785171183660", resp.Books[0].ISBN)
+	assert.Equal(t, "Test Book", resp.Books[0].Title)
+	assert.Equal(t, "Test Author", resp.Books[0].Author)
+	assert.Equal(t, "Test Publishing", resp.Books[0].Publishing)
+	assert.Equal(t, "Test Shop", resp.Books[0].ShopName)
+	catalogRepo.AssertExpectations(t)
 }
 
 func TestSearchService_Simple_ErrorISBNNotFound(t *testing.T) {
 	searchRepo := new(MockSearchRepo)
-	bookRepo := new(MockBookRepo)
+	catalogRepo := new(MockCatalogRepo)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &SearchService{
-		searcher:     searchRepo,
-		allBooksRepo: bookRepo,
-		log:          log,
+		searcher: searchRepo,
+		catalog:  catalogRepo,
+		log:      log,
 	}
 
 	ctx := context.Background()
-	isbn := "nonexistentisbn"
+	isbn := "9785446120581"
 
-	bookRepo.On("GetByISBN", ctx, isbn).Return(nil, errors.New("isbn not found"))
+	catalogRepo.On("GetByISBN", ctx, isbn).Return(nil, errors.New("isbn not found"))
 
 	_, err := service.Simple(ctx, isbn)
 	assert.ErrorContains(t, err, "isbn not found")
-	bookRepo.AssertExpectations(t)
+	catalogRepo.AssertExpectations(t)
 }
 
 func TestSearchService_Simple_ErrorISBNRequired(t *testing.T) {
 	searchRepo := new(MockSearchRepo)
-	bookRepo := new(MockBookRepo)
+	catalogRepo := new(MockCatalogRepo)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &SearchService{
-		searcher:     searchRepo,
-		allBooksRepo: bookRepo,
-		log:          log,
+		searcher: searchRepo,
+		catalog:  catalogRepo,
+		log:      log,
 	}
 
 	ctx := context.Background()
@@ -152,16 +134,16 @@ func TestSearchService_Simple_ErrorISBNRequired(t *testing.T) {
 
 func TestSearchService_Advanced_Success(t *testing.T) {
 	searchRepo := new(MockSearchRepo)
-	bookRepo := new(MockBookRepo)
+	catalogRepo := new(MockCatalogRepo)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &SearchService{
-		searcher:     searchRepo,
-		allBooksRepo: bookRepo,
-		log:          log,
+		searcher: searchRepo,
+		catalog:  catalogRepo,
+		log:      log,
 	}
 
 	ctx := context.Background()
-	isbn := "1234567890"
+	isbn := "978-5-4461-2058-1"
 
 	grpcResponse := &searcherv1.SearchByISBNResponse{
 		Status: searcherv1.SearchByISBNResponse_SUCCESS,
@@ -183,30 +165,31 @@ func TestSearchService_Advanced_Success(t *testing.T) {
 		},
 	}
 
-	searchRepo.On("SearchByISBN", ctx, isbn).Return(grpcResponse, nil)
+	searchRepo.On("SearchByISBN", ctx, "9785446120581", false).Return(&repository.SearchResult{SearchByISBNResponse: grpcResponse}, nil)
 
 	resp, err := service.Advanced(ctx, isbn)
 
 	assert.NoError(t, err)
 	assert.Equal(t, grpcResponse.Status, resp.Status)
 	assert.Len(t, resp.Books, len(grpcResponse.Books))
+	assert.Equal(t, "9785446120581", resp.Books[0].ISBN)
 	searchRepo.AssertExpectations(t)
 }
 
 func TestSearchService_Advanced_ErrorISBNNotFound(t *testing.T) {
 	searchRepo := new(MockSearchRepo)
-	bookRepo := new(MockBookRepo)
+	catalogRepo := new(MockCatalogRepo)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &SearchService{
-		searcher:     searchRepo,
-		allBooksRepo: bookRepo,
-		log:          log,
+		searcher: searchRepo,
+		catalog:  catalogRepo,
+		log:      log,
 	}
 
 	ctx := context.Background()
-	isbn := "nonexistentisbn"
+	isbn := "9785446120581"
 
-	searchRepo.On("SearchByISBN", ctx, isbn).Return(nil, errors.New("isbn not found"))
+	searchRepo.On("SearchByISBN", ctx, isbn, false).Return(nil, errors.New("isbn not found"))
 
 	_, err := service.Advanced(ctx, isbn)
 	assert.ErrorContains(t, err, "isbn not found")
@@ -215,12 +198,12 @@ func TestSearchService_Advanced_ErrorISBNNotFound(t *testing.T) {
 
 func TestSearchService_Advanced_ErrorISBNRequired(t *testing.T) {
 	searchRepo := new(MockSearchRepo)
-	bookRepo := new(MockBookRepo)
+	catalogRepo := new(MockCatalogRepo)
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	service := &SearchService{
-		searcher:     searchRepo,
-		allBooksRepo: bookRepo,
-		log:          log,
+		searcher: searchRepo,
+		catalog:  catalogRepo,
+		log:      log,
 	}
 
 	ctx := context.Background()
@@ -229,3 +212,100 @@ func TestSearchService_Advanced_ErrorISBNRequired(t *testing.T) {
 	_, err := service.Advanced(ctx, isbn)
 	assert.ErrorIs(t, err, ErrISBNRequired)
 }
+
+func TestSearchService_ErrorInvalidISBN(t *testing.T) {
+	searchRepo := new(MockSearchRepo)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &SearchService{
+		searcher: searchRepo,
+		catalog:  catalogRepo,
+		log:      log,
+	}
+
+	ctx := context.Background()
+	isbn := "9785446120582"
+
+	_, err := service.Simple(ctx, isbn)
+	assert.ErrorIs(t, err, ErrInvalidISBN)
+
+	_, err = service.Advanced(ctx, isbn)
+	assert.ErrorIs(t, err, ErrInvalidISBN)
+
+	catalogRepo.AssertNotCalled(t, "GetByISBN", mock.Anything, mock.Anything)
+	searchRepo.AssertNotCalled(t, "SearchByISBN", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSearchService_Advanced_Failed(t *testing.T) {
+	searchRepo := new(MockSearchRepo)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &SearchService{
+		searcher: searchRepo,
+		catalog:  catalogRepo,
+		log:      log,
+	}
+
+	ctx := context.Background()
+	isbn := "9785446120581"
+
+	searchRepo.On("SearchByISBN", ctx, isbn, false).Return(&repository.SearchResult{
+		SearchByISBNResponse: &searcherv1.SearchByISBNResponse{Status: searchrpc.StatusFailed},
+		FailureReason:        "shop is unavailable",
+	}, nil)
+
+	resp, err := service.Advanced(ctx, isbn)
+
+	assert.NoError(t, err)
+	assert.Equal(t, searchrpc.StatusFailed, resp.Status)
+	assert.Equal(t, "shop is unavailable", resp.Reason)
+	assert.Empty(t, resp.Books)
+	searchRepo.AssertExpectations(t)
+}
+
+func TestSearchService_Advanced_ErrorUnknownStatus(t *testing.T) {
+	searchRepo := new(MockSearchRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &SearchService{
+		searcher: searchRepo,
+		catalog:  new(MockCatalogRepo),
+		log:      log,
+	}
+
+	ctx := context.Background()
+
+	searchRepo.On("SearchByISBN", ctx, "9785446120581", false).Return(&repository.SearchResult{
+		SearchByISBNResponse: &searcherv1.SearchByISBNResponse{
+			Status: 7,
+			Books:  []*searcherv1.Book{{Title: "Book"}},
+		},
+	}, nil)
+
+	resp, err := service.Advanced(ctx, "9785446120581")
+
+	assert.ErrorIs(t, err, ErrUnknownStatus)
+	assert.Nil(t, resp)
+}
+
+func TestSearchService_Retry(t *testing.T) {
+	searchRepo := new(MockSearchRepo)
+	catalogRepo := new(MockCatalogRepo)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := &SearchService{
+		searcher: searchRepo,
+		catalog:  catalogRepo,
+		log:      log,
+	}
+
+	ctx := context.Background()
+
+	searchRepo.On("SearchByISBN", ctx, "9785446120581", true).Return(&repository.SearchResult{
+		SearchByISBNResponse: &searcherv1.SearchByISBNResponse{Status: searcherv1.SearchByISBNResponse_PROCESSING},
+	}, nil)
+
+	resp, err := service.Retry(ctx, "978-5-4461-2058-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, searcherv1.SearchByISBNResponse_PROCESSING, resp.Status)
+	searchRepo.AssertExpectations(t)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/searchrpc"
 	"github.com/getz-devs/librakeeper-server/internal/server/repository"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"log/slog"
 	"time"
 )
@@ -13,6 +15,10 @@ import (
 var (
 	ErrISBNNotFound = errors.New("ISBN not found")
 	ErrISBNRequired = errors.New("ISBN is required")
+	ErrInvalidISBN  = errors.New("ISBN is not valid")
+	// ErrUnknownStatus occurs when the searcher answers with a status this
+	// build does not know, e.g. after the contract was extended.
+	ErrUnknownStatus = errors.New("searcher returned an unknown status")
 )
 
 type SearcherClient struct {
@@ -20,7 +26,7 @@ type SearcherClient struct {
 	log    *slog.Logger
 }
 
-func (s *SearcherClient) SearchByISBN(ctx context.Context, isbn string) (*searcherv1.SearchByISBNResponse, error) {
+func (s *SearcherClient) SearchByISBN(ctx context.Context, isbn string, force bool) (*repository.SearchResult, error) {
 	const op = "search.SearcherClient.SearchByISBN"
 	log := s.log.With(slog.String("op", op), slog.String("isbn", isbn))
 
@@ -32,13 +38,21 @@ func (s *SearcherClient) SearchByISBN(ctx context.Context, isbn string) (*search
 	defer cancel()
 
 	// Используем client напрямую, без создания нового
-	resp, err := s.client.SearchByISBN(ctx, &searcherv1.SearchByISBNRequest{Isbn: isbn})
+	if force {
+		ctx = metadata.NewOutgoingContext(ctx, searchrpc.WithForceRetry())
+	}
+
+	var header metadata.MD
+	resp, err := s.client.SearchByISBN(ctx, &searcherv1.SearchByISBNRequest{Isbn: isbn}, grpc.Header(&header))
 	if err != nil {
 		log.Error("failed to search by isbn", slog.Any("error", err))
 		return nil, err
 	}
 
-	return resp, nil
+	return &repository.SearchResult{
+		SearchByISBNResponse: resp,
+		FailureReason:        searchrpc.FailureReason(header),
+	}, nil
 }
 
 func NewSearcherClient(conn *grpc.ClientConn, log *slog.Logger) repository.SearchRepo { // Передаем конфигурацию
@@ -0,0 +1,181 @@
+package bolt
+
+import (
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository/repotest"
+	"github.com/getz-devs/librakeeper-server/lib/boltdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db, err := Open(filepath.Join(t.TempDir(), "librakeeper.db"), log)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+
+		return repotest.Repos{
+			Books:       NewBookRepo(db, log, BooksCollection),
+			Bookshelves: NewBookshelfRepo(db, log),
+			Catalog:     NewCatalogRepo(db, log),
+			CorrectCatalog: func(t *testing.T, entry *models.CatalogEntry) {
+				err := db.bolt.Update(func(tx *bbolt.Tx) error {
+					old, err := catalog.get(tx, entry.ID)
+					if err != nil {
+						return err
+					}
+					return catalog.put(tx, entry.ID, old, entry)
+				})
+				require.NoError(t, err)
+			},
+		}
+	})
+}
+
+func TestReopen(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "librakeeper.db")
+
+	db, err := Open(path, log)
+	require.NoError(t, err)
+	book := &models.Book{UserID: "user1", BookshelfIDs: []string{"shelf1"}, ISBN: "9785446120581", Title: "Title"}
+	require.NoError(t, NewBookRepo(db, log, BooksCollection).Create(context.Background(), book))
+	require.NoError(t, db.Close())
+
+	db, err = Open(path, log)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	got, err := NewBookRepo(db, log, BooksCollection).GetByISBNAndUser(context.Background(), "9785446120581", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, book.ID, got.ID)
+	assert.Equal(t, "Title", got.Title)
+}
+
+func TestMigrateShelves(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "librakeeper.db")
+
+	// A database of the schema before books could be on several bookshelves.
+	db, err := boltdb.Open(path, migrations[:1], log)
+	require.NoError(t, err)
+	err = db.Update(func(tx *bbolt.Tx) error {
+		index, err := tx.CreateBucketIfNotExists([]byte(BooksCollection + ".bookshelf_id"))
+		if err != nil {
+			return err
+		}
+		for _, doc := range []*singleShelfBook{
+			{Book: models.Book{ID: "shelved", UserID: "user1", ISBN: "9785446120581"}, BookshelfID: "shelf1"},
+			{Book: models.Book{ID: "unshelved", UserID: "user1", ISBN: "9785446120581"}},
+		} {
+			if err := boltdb.Put(tx.Bucket([]byte(BooksCollection)), doc.ID, doc); err != nil {
+				return err
+			}
+			if err := index.Put(boltdb.IndexKey(doc.BookshelfID, doc.ID), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	migrated, err := Open(path, log)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = migrated.Close() })
+
+	books := NewBookRepo(migrated, log, BooksCollection)
+	page, err := books.GetByBookshelfID(context.Background(), "shelf1", &models.BookListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Books, 1)
+	assert.Equal(t, "shelved", page.Books[0].ID)
+	assert.Equal(t, []string{"shelf1"}, page.Books[0].BookshelfIDs)
+
+	got, err := books.GetByID(context.Background(), "unshelved")
+	require.NoError(t, err)
+	assert.Empty(t, got.BookshelfIDs)
+
+	err = migrated.bolt.View(func(tx *bbolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte(BooksCollection+".bookshelf_id")), "the old index is dropped")
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestMigrateNesting(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "librakeeper.db")
+
+	// A database of the schema before bookshelves were indexed by parent.
+	db, err := boltdb.Open(path, migrations[:2], log)
+	require.NoError(t, err)
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return boltdb.Put(tx.Bucket([]byte(bookshelves.name)), "legacy", &models.Bookshelf{ID: "legacy", UserID: "user1", Name: "Fiction"})
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	migrated, err := Open(path, log)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = migrated.Close() })
+
+	exists, err := NewBookshelfRepo(migrated, log).ExistsByNameAndParent(context.Background(), "Fiction", "user1", "")
+	require.NoError(t, err)
+	assert.True(t, exists, "legacy bookshelves are at the top level")
+}
+
+func TestMigratePositions(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "librakeeper.db")
+
+	// A database of the schema before books and bookshelves had positions.
+	db, err := boltdb.Open(path, migrations[:3], log)
+	require.NoError(t, err)
+	added := time.Now().Add(-time.Hour)
+	err = db.Update(func(tx *bbolt.Tx) error {
+		userBooks := books(BooksCollection)
+		for _, doc := range []*models.Book{
+			{ID: "second", UserID: "user1", BookshelfIDs: []string{"shelf1"}, CreatedAt: added.Add(time.Minute)},
+			{ID: "first", UserID: "user1", BookshelfIDs: []string{"shelf1"}, CreatedAt: added},
+		} {
+			if err := userBooks.put(tx, doc.ID, nil, doc); err != nil {
+				return err
+			}
+		}
+		for _, doc := range []*models.Bookshelf{
+			{ID: "poetry", UserID: "user1", Name: "Poetry", CreatedAt: added.Add(time.Minute)},
+			{ID: "fiction", UserID: "user1", Name: "Fiction", CreatedAt: added},
+		} {
+			if err := bookshelves.put(tx, doc.ID, nil, doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	migrated, err := Open(path, log)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = migrated.Close() })
+
+	onShelf, err := NewBookRepo(migrated, log, BooksCollection).Positions(context.Background(), "shelf1")
+	require.NoError(t, err)
+	require.Len(t, onShelf, 2)
+	assert.Equal(t, []string{"first", "second"}, []string{onShelf[0].ID, onShelf[1].ID}, "books keep the order they were added in")
+
+	shelves, err := NewBookshelfRepo(migrated, log).Positions(context.Background(), "user1", "")
+	require.NoError(t, err)
+	require.Len(t, shelves, 2)
+	assert.Equal(t, []string{"fiction", "poetry"}, []string{shelves[0].ID, shelves[1].ID})
+	assert.NotEmpty(t, shelves[0].Key)
+}
@@ -0,0 +1,415 @@
+package bolt
+
+import (
+	"context"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/document"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// BookRepo implements the repository.BookRepo interface for bbolt.
+type BookRepo struct {
+	db         *DB
+	collection collection[models.Book]
+	log        *slog.Logger
+}
+
+// NewBookRepo creates a new BookRepo instance.
+func NewBookRepo(db *DB, log *slog.Logger, collectionName string) repository.BookRepo {
+	return &BookRepo{
+		db:         db,
+		collection: books(collectionName),
+		log:        log,
+	}
+}
+
+// Create inserts a new book into the database.
+func (r *BookRepo) Create(ctx context.Context, book *models.Book) error {
+	book.ID = primitive.NewObjectID().Hex()
+	book.CreatedAt = time.Now()
+	book.UpdatedAt = time.Now()
+
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		existing, err := r.collection.get(tx, book.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return repository.ErrBookAlreadyExists
+		}
+		if err := document.Place(book, lastPosition(tx, r.collection)); err != nil {
+			return err
+		}
+		return r.collection.put(tx, book.ID, nil, book)
+	})
+	if err == repository.ErrBookAlreadyExists {
+		return err
+	}
+	if err != nil {
+		r.log.Error("failed to create book", slog.Any("error", err))
+		return fmt.Errorf("failed to create book: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a book from the database by its ID.
+func (r *BookRepo) GetByID(ctx context.Context, id string) (*models.Book, error) {
+	var book *models.Book
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		doc, err := r.collection.get(tx, id)
+		if err != nil || doc == nil {
+			return err
+		}
+		book, err = merged(tx, doc)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book: %w", err)
+	}
+	if book == nil {
+		return nil, repository.ErrBookNotFound
+	}
+	return book, nil
+}
+
+// GetByISBN retrieves a book from the database by its ISBN.
+func (r *BookRepo) GetByISBN(ctx context.Context, isbn string) (*models.Book, error) {
+	book, err := r.findOne("isbn", isbn, func(*models.Book) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book by ISBN: %w", err)
+	}
+	if book == nil {
+		return nil, repository.ErrBookNotFound
+	}
+	return book, nil
+}
+
+// GetByISBNAndUser retrieves a book with the given ISBN from a user's library.
+func (r *BookRepo) GetByISBNAndUser(ctx context.Context, isbn, userID string) (*models.Book, error) {
+	book, err := r.findOne("isbn", isbn, func(b *models.Book) bool { return b.UserID == userID })
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book by ISBN and user: %w", err)
+	}
+	if book == nil {
+		return nil, repository.ErrBookNotFound
+	}
+	return book, nil
+}
+
+// GetByUserID retrieves a page of books associated with a specific user ID.
+func (r *BookRepo) GetByUserID(ctx context.Context, userID string, opts *models.BookListOptions) (*models.BookPage, error) {
+	page, err := r.find("user_id", []string{userID}, opts)
+	if err != nil {
+		r.log.Error("failed to get book by user id", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get book by user ID: %w", err)
+	}
+
+	return page, nil
+}
+
+// GetByBookshelfID retrieves a page of books belonging to a specific bookshelf ID.
+func (r *BookRepo) GetByBookshelfID(ctx context.Context, bookshelfID string, opts *models.BookListOptions) (*models.BookPage, error) {
+	page, err := r.find("bookshelf_ids", []string{bookshelfID}, opts.OnBookshelf(bookshelfID))
+	if err != nil {
+		r.log.Error("failed to get book by bookshelf id", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get book by bookshelf id: %w", err)
+	}
+
+	return page, nil
+}
+
+// GetByBookshelves retrieves a page of the books on any of the bookshelves.
+func (r *BookRepo) GetByBookshelves(ctx context.Context, bookshelfIDs []string, opts *models.BookListOptions) (*models.BookPage, error) {
+	page, err := r.find("bookshelf_ids", bookshelfIDs, opts)
+	if err != nil {
+		r.log.Error("failed to get books by bookshelves", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get books by bookshelves: %w", err)
+	}
+
+	return page, nil
+}
+
+// findOne returns the first book, in _id order, of those indexed under the
+// value that match, merged with its catalog entry. It returns nil if no book matches.
+func (r *BookRepo) findOne(field, value string, match func(*models.Book) bool) (*models.Book, error) {
+	var book *models.Book
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		docs, err := r.collection.find(tx, field, value)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if match(doc) {
+				book, err = merged(tx, doc)
+				return err
+			}
+		}
+		return nil
+	})
+	return book, err
+}
+
+// find returns a page of the books indexed under any of the values, merged
+// with the catalog and filtered the way the MongoDB repository does it.
+func (r *BookRepo) find(field string, values []string, opts *models.BookListOptions) (*models.BookPage, error) {
+	books := []*models.Book{}
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		seen := map[string]bool{}
+		for _, value := range values {
+			docs, err := r.collection.find(tx, field, value)
+			if err != nil {
+				return err
+			}
+			for _, doc := range docs {
+				if seen[doc.ID] {
+					continue
+				}
+				seen[doc.ID] = true
+				book, err := merged(tx, doc)
+				if err != nil {
+					return err
+				}
+				books = append(books, book)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return document.Books(books, opts), nil
+}
+
+// merged sets the fields the user has not overridden to the values of the
+// catalog entry of a book, so reads show catalog corrections at once.
+func merged(tx *bbolt.Tx, book *models.Book) (*models.Book, error) {
+	if book.CatalogID == "" {
+		return book, nil
+	}
+	entry, err := catalog.get(tx, book.CatalogID)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		book.Merge(entry)
+	}
+	return book, nil
+}
+
+// CountInBookshelf returns the number of book in a bookshelf.
+func (r *BookRepo) CountInBookshelf(ctx context.Context, bookshelfID string) (int, error) {
+	var count int
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		count = len(r.collection.ids(tx, "bookshelf_ids", bookshelfID))
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count books in bookshelf: %w", err)
+	}
+	return count, nil
+}
+
+// ExistsInBookshelf checks if a book with the given ISBN already exists in the bookshelf.
+func (r *BookRepo) ExistsInBookshelf(ctx context.Context, isbn, bookshelfID string) (bool, error) {
+	book, err := r.findOne("isbn", isbn, func(b *models.Book) bool { return slices.Contains(b.BookshelfIDs, bookshelfID) })
+	if err != nil {
+		return false, fmt.Errorf("failed to check book existence: %w", err)
+	}
+	return book != nil, nil
+}
+
+// Update updates a book in the database. Like the $set of the MongoDB
+// repository, it clears the publisher and the shop when they are not given.
+func (r *BookRepo) Update(ctx context.Context, id string, update *models.BookUpdate) error {
+	update.UpdatedAt = time.Now()
+
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		old, err := r.collection.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return repository.ErrBookNotFound
+		}
+
+		doc := *old
+		document.SetBook(&doc, update)
+		if err := r.collection.put(tx, id, old, &doc); err != nil {
+			return err
+		}
+		if len(update.Shelves) == 0 {
+			return nil
+		}
+		return reshelve(tx, r.collection, update.Shelves, update.UpdatedAt)
+	})
+	if err == repository.ErrBookNotFound || err == repository.ErrBookAlreadyExists {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update book: %w", err)
+	}
+	return nil
+}
+
+// SyncCatalog copies the metadata of a catalog entry to the books linked to
+// it, except for the fields their users have overridden.
+func (r *BookRepo) SyncCatalog(ctx context.Context, entry *models.CatalogEntry) error {
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		docs, err := r.collection.find(tx, "catalog_id", entry.ID)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			old := *doc
+			doc.Merge(entry)
+			if err := r.collection.put(tx, doc.ID, &old, doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.log.Error("failed to sync books with catalog", slog.Any("error", err))
+		return fmt.Errorf("failed to sync books with catalog: %w", err)
+	}
+	return nil
+}
+
+// Reshelve applies the shelf changes and records them in the history of the
+// books, in one transaction.
+func (r *BookRepo) Reshelve(ctx context.Context, changes []models.ShelfChange) error {
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		return reshelve(tx, r.collection, changes, time.Now())
+	})
+	if err == repository.ErrBookNotFound || err == repository.ErrBookAlreadyExists {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reshelve books: %w", err)
+	}
+	return nil
+}
+
+// reshelve applies shelf changes to the books of a collection within a
+// transaction. It fails, so that the transaction is rolled back, when a book
+// is missing or a bookshelf would hold an ISBN twice.
+func reshelve(tx *bbolt.Tx, coll collection[models.Book], changes []models.ShelfChange, at time.Time) error {
+	positions, err := document.Placements(changes, lastPosition(tx, coll))
+	if err != nil {
+		return err
+	}
+
+	for i, change := range changes {
+		old, err := coll.get(tx, change.BookID)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return repository.ErrBookNotFound
+		}
+		doc := *old
+		if document.Reshelve(&doc, change, positions[i], at) {
+			if err := coll.put(tx, doc.ID, old, &doc); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, change := range changes {
+		if change.To == "" {
+			continue
+		}
+		onShelf, err := coll.find(tx, "bookshelf_ids", change.To)
+		if err != nil {
+			return err
+		}
+		if document.Duplicates(onShelf) {
+			return repository.ErrBookAlreadyExists
+		}
+	}
+	return nil
+}
+
+// lastPosition returns a function that finds the largest position on a
+// bookshelf among the books of a collection.
+func lastPosition(tx *bbolt.Tx, coll collection[models.Book]) func(string) (string, error) {
+	return func(bookshelfID string) (string, error) {
+		onShelf, err := coll.find(tx, "bookshelf_ids", bookshelfID)
+		if err != nil {
+			return "", err
+		}
+		return document.LastPosition(onShelf, bookshelfID), nil
+	}
+}
+
+// Positions returns the positions of the books on a bookshelf, in order.
+func (r *BookRepo) Positions(ctx context.Context, bookshelfID string) ([]models.Position, error) {
+	positions := []models.Position{}
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		onShelf, err := r.collection.find(tx, "bookshelf_ids", bookshelfID)
+		for _, doc := range onShelf {
+			positions = append(positions, models.Position{ID: doc.ID, Key: doc.Positions[bookshelfID]})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book positions: %w", err)
+	}
+	document.SortPositions(positions)
+	return positions, nil
+}
+
+// SetPositions sets the positions of books on a bookshelf, in one
+// transaction. Books that are no longer on it are skipped.
+func (r *BookRepo) SetPositions(ctx context.Context, bookshelfID string, positions map[string]string) error {
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		for id, position := range positions {
+			old, err := r.collection.get(tx, id)
+			if err != nil {
+				return err
+			}
+			if old == nil || !slices.Contains(old.BookshelfIDs, bookshelfID) {
+				continue
+			}
+			doc := *old
+			document.SetPosition(&doc, bookshelfID, position)
+			if err := r.collection.put(tx, id, old, &doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set book positions: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a book from the database.
+func (r *BookRepo) Delete(ctx context.Context, id string) error {
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		doc, err := r.collection.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			return repository.ErrBookNotFound
+		}
+		return r.collection.delete(tx, id, doc)
+	})
+	if err == repository.ErrBookNotFound {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete book: %w", err)
+	}
+	return nil
+}
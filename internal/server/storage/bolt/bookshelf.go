@@ -0,0 +1,401 @@
+package bolt
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/document"
+	"github.com/getz-devs/librakeeper-server/lib/fracindex"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BookshelfRepo implements the repository.BookshelfRepo interface for bbolt.
+type BookshelfRepo struct {
+	db  *DB
+	log *slog.Logger
+}
+
+// NewBookshelfRepo creates a new BookshelfRepo instance.
+func NewBookshelfRepo(db *DB, log *slog.Logger) repository.BookshelfRepo {
+	return &BookshelfRepo{
+		db:  db,
+		log: log,
+	}
+}
+
+// Create inserts a new bookshelf into the database.
+func (r *BookshelfRepo) Create(ctx context.Context, bookshelf *models.Bookshelf) error {
+	bookshelf.ID = primitive.NewObjectID().Hex()
+	bookshelf.CreatedAt = time.Now()
+	bookshelf.UpdatedAt = time.Now()
+
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		existing, err := bookshelves.get(tx, bookshelf.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return repository.ErrBookshelfAlreadyExists
+		}
+		if bookshelf.Position, err = nextPosition(tx, bookshelf.UserID, bookshelf.ParentID); err != nil {
+			return err
+		}
+		return bookshelves.put(tx, bookshelf.ID, nil, bookshelf)
+	})
+	if err == repository.ErrBookshelfAlreadyExists {
+		return err
+	}
+	if err != nil {
+		r.log.Error("failed to create bookshelf", slog.Any("error", err))
+		return fmt.Errorf("failed to create bookshelf: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a bookshelf from the database by its ID.
+func (r *BookshelfRepo) GetByID(ctx context.Context, id string) (*models.Bookshelf, error) {
+	var bookshelf *models.Bookshelf
+	err := r.db.bolt.View(func(tx *bbolt.Tx) (err error) {
+		bookshelf, err = bookshelves.get(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookshelf: %w", err)
+	}
+	if bookshelf == nil {
+		return nil, repository.ErrBookshelfNotFound
+	}
+	return bookshelf, nil
+}
+
+// GetByUser retrieves a page of bookshelves associated with a specific user ID.
+func (r *BookshelfRepo) GetByUser(ctx context.Context, userID string, opts *models.BookshelfListOptions) (*models.BookshelfPage, error) {
+	var docs []*models.Bookshelf
+	err := r.db.bolt.View(func(tx *bbolt.Tx) (err error) {
+		if opts.ParentID != nil {
+			docs, err = siblings(tx, userID, *opts.ParentID)
+			return err
+		}
+		docs, err = bookshelves.find(tx, "user_id", userID)
+		return err
+	})
+	if err != nil {
+		r.log.Error("failed to get bookshelves by user", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get bookshelves by user: %w", err)
+	}
+
+	if docs == nil {
+		docs = []*models.Bookshelf{}
+	}
+	return document.Bookshelves(docs, opts), nil
+}
+
+// CountByUser returns the number of bookshelf owned by a user.
+func (r *BookshelfRepo) CountByUser(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		count = len(bookshelves.ids(tx, "user_id", userID))
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count bookshelves: %w", err)
+	}
+	return count, nil
+}
+
+// ExistsByNameAndParent checks if a bookshelf with the given name is nested in the parent.
+func (r *BookshelfRepo) ExistsByNameAndParent(ctx context.Context, name, userID, parentID string) (bool, error) {
+	var exists bool
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		docs, err := bookshelves.find(tx, "parent_id", parentID)
+		for _, doc := range docs {
+			if doc.Name == name && doc.UserID == userID {
+				exists = true
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check bookshelf existence: %w", err)
+	}
+	return exists, nil
+}
+
+// GetSubtree returns the bookshelf and the bookshelves nested in it.
+func (r *BookshelfRepo) GetSubtree(ctx context.Context, id string) ([]*models.Bookshelf, error) {
+	var subtree []*models.Bookshelf
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		root, err := bookshelves.get(tx, id)
+		if err != nil || root == nil {
+			return err
+		}
+		docs, err := bookshelves.find(tx, "user_id", root.UserID)
+		subtree = document.Subtree(docs, id)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nested bookshelves: %w", err)
+	}
+	if subtree == nil {
+		return nil, repository.ErrBookshelfNotFound
+	}
+	return subtree, nil
+}
+
+// CountBooks returns the number of books of BooksCollection on any of the bookshelves.
+func (r *BookshelfRepo) CountBooks(ctx context.Context, ids []string) (int, error) {
+	userBooks := books(BooksCollection)
+	found := map[string]bool{}
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		for _, id := range ids {
+			for _, bookID := range userBooks.ids(tx, "bookshelf_ids", id) {
+				found[bookID] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count books in bookshelves: %w", err)
+	}
+	return len(found), nil
+}
+
+// CountBooksByGroup returns, for every group of bookshelves, the number of
+// books of BooksCollection on any of its bookshelves.
+func (r *BookshelfRepo) CountBooksByGroup(ctx context.Context, groups map[string][]string) (map[string]int, error) {
+	userBooks := books(BooksCollection)
+	counts := make(map[string]int, len(groups))
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		for key, ids := range groups {
+			found := map[string]bool{}
+			for _, id := range ids {
+				for _, bookID := range userBooks.ids(tx, "bookshelf_ids", id) {
+					found[bookID] = true
+				}
+			}
+			counts[key] = len(found)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count books by group: %w", err)
+	}
+	return counts, nil
+}
+
+// Update updates a bookshelf in the database.
+func (r *BookshelfRepo) Update(ctx context.Context, id string, update *models.BookshelfUpdate) error {
+	update.UpdatedAt = time.Now()
+
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		old, err := bookshelves.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return repository.ErrBookshelfNotFound
+		}
+
+		if update.ParentID != nil {
+			position, err := nextPosition(tx, old.UserID, *update.ParentID)
+			if err != nil {
+				return err
+			}
+			update.Position = &position
+		}
+
+		doc := *old
+		document.SetBookshelf(&doc, update)
+		return bookshelves.put(tx, id, old, &doc)
+	})
+	if err == repository.ErrBookshelfNotFound {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update bookshelf: %w", err)
+	}
+	return nil
+}
+
+// Positions returns the positions of the bookshelves of a user nested
+// directly in the parent, in order.
+func (r *BookshelfRepo) Positions(ctx context.Context, userID, parentID string) ([]models.Position, error) {
+	positions := []models.Position{}
+	err := r.db.bolt.View(func(tx *bbolt.Tx) error {
+		docs, err := siblings(tx, userID, parentID)
+		for _, doc := range docs {
+			positions = append(positions, models.Position{ID: doc.ID, Key: doc.Position})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookshelf positions: %w", err)
+	}
+	document.SortPositions(positions)
+	return positions, nil
+}
+
+// SetPositions sets the positions of bookshelves, in one transaction.
+// Missing bookshelves are skipped.
+func (r *BookshelfRepo) SetPositions(ctx context.Context, positions map[string]string) error {
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		for id, position := range positions {
+			old, err := bookshelves.get(tx, id)
+			if err != nil {
+				return err
+			}
+			if old == nil {
+				continue
+			}
+			doc := *old
+			doc.Position = position
+			if err := bookshelves.put(tx, id, old, &doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set bookshelf positions: %w", err)
+	}
+	return nil
+}
+
+// siblings returns the bookshelves of a user nested directly in the parent.
+func siblings(tx *bbolt.Tx, userID, parentID string) ([]*models.Bookshelf, error) {
+	docs, err := bookshelves.find(tx, "parent_id", parentID)
+	if err != nil {
+		return nil, err
+	}
+	owned := []*models.Bookshelf{}
+	for _, doc := range docs {
+		if doc.UserID == userID {
+			owned = append(owned, doc)
+		}
+	}
+	return owned, nil
+}
+
+// nextPosition returns the position at the end of the bookshelves of a user
+// nested directly in the parent.
+func nextPosition(tx *bbolt.Tx, userID, parentID string) (string, error) {
+	docs, err := siblings(tx, userID, parentID)
+	if err != nil {
+		return "", err
+	}
+	return fracindex.Between(document.LastBookshelfPosition(docs), "")
+}
+
+// Delete removes a bookshelf from the database.
+func (r *BookshelfRepo) Delete(ctx context.Context, id string) error {
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		doc, err := bookshelves.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			return repository.ErrBookshelfNotFound
+		}
+		return bookshelves.delete(tx, id, doc)
+	})
+	if err == repository.ErrBookshelfNotFound {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete bookshelf: %w", err)
+	}
+	return nil
+}
+
+// DeleteWithBooks deletes a bookshelf and refuses, deletes or moves the books
+// of BooksCollection on it, in one transaction.
+func (r *BookshelfRepo) DeleteWithBooks(ctx context.Context, id string, opts *models.BookshelfDeleteOptions) (*models.BookshelfDeleteResult, error) {
+	userBooks := books(BooksCollection)
+	result := &models.BookshelfDeleteResult{BookshelfID: id, Mode: opts.Mode}
+
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		shelf, err := bookshelves.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if shelf == nil {
+			return repository.ErrBookshelfNotFound
+		}
+		if len(bookshelves.ids(tx, "parent_id", id)) > 0 {
+			return repository.ErrBookshelfHasChildren
+		}
+
+		onShelf, err := userBooks.find(tx, "bookshelf_ids", id)
+		if err != nil {
+			return err
+		}
+
+		switch opts.Mode {
+		case models.DeleteModeCascade:
+			// Books on other bookshelves too only leave this one.
+			var kept []models.ShelfChange
+			for _, doc := range onShelf {
+				if len(doc.BookshelfIDs) > 1 {
+					kept = append(kept, models.ShelfChange{BookID: doc.ID, From: id})
+					continue
+				}
+				if err := userBooks.delete(tx, doc.ID, doc); err != nil {
+					return err
+				}
+			}
+			if err := reshelve(tx, userBooks, kept, time.Now()); err != nil {
+				return err
+			}
+			result.BooksKept = len(kept)
+			result.BooksDeleted = len(onShelf) - len(kept)
+		case models.DeleteModeMove:
+			if opts.TargetID != "" && opts.BookLimit > 0 {
+				total := len(userBooks.ids(tx, "bookshelf_ids", opts.TargetID))
+				for _, doc := range onShelf {
+					if !slices.Contains(doc.BookshelfIDs, opts.TargetID) {
+						total++
+					}
+				}
+				if total > opts.BookLimit {
+					return repository.ErrBookshelfLimitReached
+				}
+			}
+			// The books keep their order behind those on the target.
+			slices.SortFunc(onShelf, func(a, b *models.Book) int {
+				return cmp.Or(strings.Compare(a.Positions[id], b.Positions[id]), strings.Compare(a.ID, b.ID))
+			})
+			changes := make([]models.ShelfChange, 0, len(onShelf))
+			for _, doc := range onShelf {
+				changes = append(changes, models.ShelfChange{BookID: doc.ID, From: id, To: opts.TargetID})
+			}
+			if err := reshelve(tx, userBooks, changes, time.Now()); err != nil {
+				return err
+			}
+			result.BooksMoved = len(onShelf)
+			result.TargetBookshelfID = opts.TargetID
+		default:
+			if len(onShelf) > 0 {
+				return repository.ErrBookshelfNotEmpty
+			}
+		}
+
+		return bookshelves.delete(tx, id, shelf)
+	})
+	switch err {
+	case nil:
+		return result, nil
+	case repository.ErrBookshelfNotFound, repository.ErrBookshelfNotEmpty, repository.ErrBookshelfHasChildren,
+		repository.ErrBookAlreadyExists, repository.ErrBookshelfLimitReached:
+		return nil, err
+	default:
+		return nil, fmt.Errorf("failed to delete bookshelf: %w", err)
+	}
+}
@@ -0,0 +1,117 @@
+package bolt
+
+import (
+	"context"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	isbnlib "github.com/getz-devs/librakeeper-server/lib/isbn"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// CatalogRepo implements the repository.CatalogRepo interface for bbolt.
+type CatalogRepo struct {
+	db  *DB
+	log *slog.Logger
+}
+
+// NewCatalogRepo creates a new CatalogRepo instance.
+func NewCatalogRepo(db *DB, log *slog.Logger) repository.CatalogRepo {
+	return &CatalogRepo{
+		db:  db,
+		log: log,
+	}
+}
+
+// Create inserts a new catalog entry into the database. Like the unique index
+// of the MongoDB collection, the isbn13 index allows one entry per ISBN-13.
+func (r *CatalogRepo) Create(ctx context.Context, entry *models.CatalogEntry) error {
+	entry.ID = primitive.NewObjectID().Hex()
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = time.Now()
+
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		if len(catalog.ids(tx, "isbn13", entry.ISBN13)) > 0 {
+			return repository.ErrCatalogEntryAlreadyExists
+		}
+		return catalog.put(tx, entry.ID, nil, entry)
+	})
+	if err == repository.ErrCatalogEntryAlreadyExists {
+		return err
+	}
+	if err != nil {
+		r.log.Error("failed to create catalog entry", slog.Any("error", err))
+		return fmt.Errorf("failed to create catalog entry: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a catalog entry by its ID.
+func (r *CatalogRepo) GetByID(ctx context.Context, id string) (*models.CatalogEntry, error) {
+	var entry *models.CatalogEntry
+	err := r.db.bolt.View(func(tx *bbolt.Tx) (err error) {
+		entry, err = catalog.get(tx, id)
+		return err
+	})
+	return found(entry, err)
+}
+
+// GetByISBN retrieves a catalog entry by an ISBN-10 or ISBN-13, with or without hyphens.
+func (r *CatalogRepo) GetByISBN(ctx context.Context, isbn string) (*models.CatalogEntry, error) {
+	isbn13, err := isbnlib.To13(isbn)
+	if err != nil {
+		isbn13 = isbnlib.Clean(isbn)
+	}
+
+	var entry *models.CatalogEntry
+	err = r.db.bolt.View(func(tx *bbolt.Tx) error {
+		entries, err := catalog.find(tx, "isbn13", isbn13)
+		if len(entries) > 0 {
+			entry = entries[0]
+		}
+		return err
+	})
+	return found(entry, err)
+}
+
+func found(entry *models.CatalogEntry, err error) (*models.CatalogEntry, error) {
+	if err != nil {
+		return nil, fmt.Errorf("failed to get catalog entry: %w", err)
+	}
+	if entry == nil {
+		return nil, repository.ErrCatalogEntryNotFound
+	}
+	return entry, nil
+}
+
+// AddEdition adds an edition to a catalog entry unless it is already listed.
+func (r *CatalogRepo) AddEdition(ctx context.Context, id string, edition models.Edition) error {
+	err := r.db.bolt.Update(func(tx *bbolt.Tx) error {
+		old, err := catalog.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return repository.ErrCatalogEntryNotFound
+		}
+
+		doc := *old
+		if !slices.Contains(doc.Editions, edition) {
+			doc.Editions = append(doc.Editions, edition)
+		}
+		doc.UpdatedAt = time.Now()
+		return catalog.put(tx, id, old, &doc)
+	})
+	if err == repository.ErrCatalogEntryNotFound {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add edition: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package bolt
+
+import (
+	"github.com/getz-devs/librakeeper-server/lib/boltdb"
+	"go.etcd.io/bbolt"
+)
+
+// collection is a bucket of documents keyed by _id. Each indexed field has a
+// bucket of its own, named <collection>.<field>, that is kept up to date on
+// every write. An array field is indexed under each of its values, like a
+// MongoDB multikey index.
+type collection[T any] struct {
+	name    string
+	indexes map[string]func(*T) []string // field -> values of the field in a document
+}
+
+// buckets returns the names of the buckets of the collection and its indexes.
+func (c collection[T]) buckets() []string {
+	names := []string{c.name}
+	for field := range c.indexes {
+		names = append(names, c.index(field))
+	}
+	return names
+}
+
+func (c collection[T]) index(field string) string {
+	return c.name + "." + field
+}
+
+// get returns the document with the _id, or nil if there is none.
+func (c collection[T]) get(tx *bbolt.Tx, id string) (*T, error) {
+	b := tx.Bucket([]byte(c.name))
+	if b == nil {
+		return nil, nil
+	}
+
+	var doc T
+	found, err := boltdb.Get(b, id, &doc)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ids returns the _id of the documents whose field has the value, in _id order.
+func (c collection[T]) ids(tx *bbolt.Tx, field, value string) []string {
+	b := tx.Bucket([]byte(c.index(field)))
+	if b == nil {
+		return nil
+	}
+
+	var ids []string
+	boltdb.ScanIndex(b, value, func(id string) bool {
+		ids = append(ids, id)
+		return true
+	})
+	return ids
+}
+
+// find returns the documents whose field has the value, in _id order.
+func (c collection[T]) find(tx *bbolt.Tx, field, value string) ([]*T, error) {
+	var docs []*T
+	for _, id := range c.ids(tx, field, value) {
+		doc, err := c.get(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// put stores a document and moves its index entries from the old version of
+// the document, if there is one.
+func (c collection[T]) put(tx *bbolt.Tx, id string, old, doc *T) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(c.name))
+	if err != nil {
+		return err
+	}
+
+	for field, values := range c.indexes {
+		index, err := tx.CreateBucketIfNotExists([]byte(c.index(field)))
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			for _, value := range values(old) {
+				if err := index.Delete(boltdb.IndexKey(value, id)); err != nil {
+					return err
+				}
+			}
+		}
+		for _, value := range values(doc) {
+			if err := index.Put(boltdb.IndexKey(value, id), nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	return boltdb.Put(b, id, doc)
+}
+
+// delete removes a stored document and its index entries.
+func (c collection[T]) delete(tx *bbolt.Tx, id string, doc *T) error {
+	for field, values := range c.indexes {
+		if index := tx.Bucket([]byte(c.index(field))); index != nil {
+			for _, value := range values(doc) {
+				if err := index.Delete(boltdb.IndexKey(value, id)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	b := tx.Bucket([]byte(c.name))
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(id))
+}
+
+// reindex puts every document again, filling the buckets of indexes added
+// after the documents were stored.
+func (c collection[T]) reindex(tx *bbolt.Tx) error {
+	b := tx.Bucket([]byte(c.name))
+	if b == nil {
+		return nil
+	}
+
+	// Documents are collected first: a bucket is not written while it is
+	// iterated.
+	docs := map[string]*T{}
+	err := b.ForEach(func(k, _ []byte) error {
+		var doc T
+		if _, err := boltdb.Get(b, string(k), &doc); err != nil {
+			return err
+		}
+		docs[string(k)] = &doc
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for id, doc := range docs {
+		if err := c.put(tx, id, nil, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value indexes a field with a single value.
+func value[T any](field func(*T) string) func(*T) []string {
+	return func(doc *T) []string { return []string{field(doc)} }
+}
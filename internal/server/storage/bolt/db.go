@@ -0,0 +1,112 @@
+// Package bolt implements the repositories on an embedded bbolt database in a
+// single file, for self-hosting without MongoDB. Documents are stored as BSON
+// in one bucket per MongoDB collection; queries that MongoDB answers from an
+// index read an index bucket per field.
+package bolt
+
+import (
+	"context"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/lib/boltdb"
+	"go.etcd.io/bbolt"
+	"log/slog"
+)
+
+// BooksCollection is the collection of the books of the users.
+const BooksCollection = "user_books"
+
+// migrations are the schema versions of the database, oldest first. Only
+// append to the list.
+var migrations = []boltdb.Migration{
+	{
+		Name: "create collections and indexes",
+		Up: boltdb.CreateBuckets(concat(
+			books(BooksCollection).buckets(),
+			bookshelves.buckets(),
+			catalog.buckets(),
+		)...),
+	},
+	{
+		Name: "shelve books on several bookshelves",
+		Up:   shelveBooks(BooksCollection),
+	},
+	{
+		Name: "index bookshelves by parent",
+		Up:   bookshelves.reindex,
+	},
+	{
+		Name: "position books and bookshelves",
+		Up: func(tx *bbolt.Tx) error {
+			if err := positionBooks(BooksCollection)(tx); err != nil {
+				return err
+			}
+			return positionBookshelves(tx)
+		},
+	},
+}
+
+// DB is an open database file shared by the repositories.
+type DB struct {
+	bolt *bbolt.DB
+}
+
+// Open opens the database file, creating it if needed, and migrates its schema.
+func Open(path string, log *slog.Logger) (*DB, error) {
+	db, err := boltdb.Open(path, migrations, log)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("opened embedded database", slog.String("path", path))
+	return &DB{bolt: db}, nil
+}
+
+// Close closes the database file.
+func (db *DB) Close() error {
+	return db.bolt.Close()
+}
+
+// Ping checks that the database is open.
+func (db *DB) Ping(ctx context.Context) error {
+	if err := db.bolt.View(func(tx *bbolt.Tx) error { return nil }); err != nil {
+		return fmt.Errorf("bolt ping failed: %w", err)
+	}
+	return nil
+}
+
+// books returns a collection of books, indexed like the MongoDB one.
+func books(name string) collection[models.Book] {
+	return collection[models.Book]{
+		name: name,
+		indexes: map[string]func(*models.Book) []string{
+			"user_id":       value(func(b *models.Book) string { return b.UserID }),
+			"bookshelf_ids": func(b *models.Book) []string { return b.BookshelfIDs },
+			"isbn":          value(func(b *models.Book) string { return b.ISBN }),
+			"catalog_id":    value(func(b *models.Book) string { return b.CatalogID }),
+		},
+	}
+}
+
+var bookshelves = collection[models.Bookshelf]{
+	name: "bookshelf",
+	indexes: map[string]func(*models.Bookshelf) []string{
+		"user_id":   value(func(b *models.Bookshelf) string { return b.UserID }),
+		"parent_id": value(func(b *models.Bookshelf) string { return b.ParentID }),
+	},
+}
+
+var catalog = collection[models.CatalogEntry]{
+	name: "all_books",
+	indexes: map[string]func(*models.CatalogEntry) []string{
+		"isbn13": value(func(e *models.CatalogEntry) string { return e.ISBN13 }),
+	},
+}
+
+func concat(lists ...[]string) []string {
+	var all []string
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
@@ -0,0 +1,92 @@
+package bolt
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/document"
+	"github.com/getz-devs/librakeeper-server/lib/boltdb"
+	"go.etcd.io/bbolt"
+)
+
+// positionBooks returns a migration step that gives every book a position on
+// each of its bookshelves, in the order the books were added.
+func positionBooks(name string) func(tx *bbolt.Tx) error {
+	return func(tx *bbolt.Tx) error {
+		coll := books(name)
+		docs, err := all(tx, coll)
+		if err != nil {
+			return err
+		}
+
+		onShelf := map[string][]*models.Book{}
+		for _, doc := range docs {
+			for _, bookshelfID := range doc.BookshelfIDs {
+				onShelf[bookshelfID] = append(onShelf[bookshelfID], doc)
+			}
+		}
+		changed := map[string]*models.Book{}
+		for bookshelfID, shelved := range onShelf {
+			placed, err := document.BackfillBooks(shelved, bookshelfID)
+			if err != nil {
+				return err
+			}
+			for _, doc := range placed {
+				changed[doc.ID] = doc
+			}
+		}
+
+		// Positions are not indexed, so the index entries stay as they are.
+		for id, doc := range changed {
+			if err := coll.put(tx, id, doc, doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// positionBookshelves gives every bookshelf a position among those with the
+// same parent, in the order they were created.
+func positionBookshelves(tx *bbolt.Tx) error {
+	docs, err := all(tx, bookshelves)
+	if err != nil {
+		return err
+	}
+
+	type group struct{ userID, parentID string }
+	siblings := map[group][]*models.Bookshelf{}
+	for _, doc := range docs {
+		g := group{doc.UserID, doc.ParentID}
+		siblings[g] = append(siblings[g], doc)
+	}
+	for _, docs := range siblings {
+		placed, err := document.BackfillBookshelves(docs)
+		if err != nil {
+			return err
+		}
+		for _, doc := range placed {
+			if err := bookshelves.put(tx, doc.ID, doc, doc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// all returns every document of a collection.
+func all[T any](tx *bbolt.Tx, coll collection[T]) ([]*T, error) {
+	b := tx.Bucket([]byte(coll.name))
+	if b == nil {
+		return nil, nil
+	}
+
+	var docs []*T
+	err := b.ForEach(func(k, _ []byte) error {
+		var doc T
+		if _, err := boltdb.Get(b, string(k), &doc); err != nil {
+			return err
+		}
+		docs = append(docs, &doc)
+		return nil
+	})
+	return docs, err
+}
@@ -0,0 +1,56 @@
+package bolt
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/lib/boltdb"
+	"go.etcd.io/bbolt"
+)
+
+// singleShelfBook is a book stored before books could be on several
+// bookshelves.
+type singleShelfBook struct {
+	models.Book `bson:",inline"`
+	BookshelfID string `bson:"bookshelf_id,omitempty"`
+}
+
+// shelveBooks returns a migration step that moves the bookshelf of every book
+// into its bookshelf_ids and replaces the bookshelf_id index.
+func shelveBooks(name string) func(tx *bbolt.Tx) error {
+	return func(tx *bbolt.Tx) error {
+		coll := books(name)
+		b := tx.Bucket([]byte(coll.name))
+		if b == nil {
+			return nil
+		}
+
+		// Documents are collected first: a bucket is not written while it is
+		// iterated.
+		var docs []*models.Book
+		err := b.ForEach(func(k, _ []byte) error {
+			var old singleShelfBook
+			if _, err := boltdb.Get(b, string(k), &old); err != nil {
+				return err
+			}
+			doc := old.Book
+			if old.BookshelfID != "" && len(doc.BookshelfIDs) == 0 {
+				doc.BookshelfIDs = []string{old.BookshelfID}
+			}
+			docs = append(docs, &doc)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.DeleteBucket([]byte(coll.index("bookshelf_id"))); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+		// The other indexes already hold the entries put again here.
+		for _, doc := range docs {
+			if err := coll.put(tx, doc.ID, nil, doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
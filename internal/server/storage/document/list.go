@@ -0,0 +1,190 @@
+// Package document emulates the MongoDB queries and updates of the
+// repositories for the backends that cannot push them down to a database:
+// filtering, sorting and pagination of lists, and the $set of updates.
+package document
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Key is the position of an item in a sorted list: the sort field value and
+// the _id as a tie-breaker.
+type Key struct {
+	Value interface{}
+	ID    string
+}
+
+// compareValues orders sort field values like MongoDB does: missing values
+// first, then strings, then dates.
+func compareValues(a, b interface{}) int {
+	rank := func(v interface{}) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case string:
+			return 1
+		case time.Time:
+			return 2
+		}
+		return 3
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	return 0
+}
+
+func compareKeys(a, b Key) int {
+	if c := compareValues(a.Value, b.Value); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// Paginate sorts the items and returns one page of them, the way pageQuery
+// does for MongoDB: by offset, or after a keyset position. A backward page is
+// returned in the listing order. It reports whether more items follow in the
+// listing direction.
+func Paginate[T any](items []T, key func(T) Key, order models.SortOrder, page, limit int64, position *models.CursorPosition) ([]T, bool) {
+	if position != nil && position.Backward {
+		order = -order
+	}
+	slices.SortFunc(items, func(a, b T) int {
+		return compareKeys(key(a), key(b)) * int(order)
+	})
+
+	if position == nil {
+		total := int64(len(items))
+		skip := min(max((page-1)*limit, 0), total)
+		items = items[skip:]
+		if limit > 0 && int64(len(items)) > limit {
+			items = items[:limit]
+		}
+		return items, skip+int64(len(items)) < total
+	}
+
+	boundary := Key{Value: position.Value, ID: position.ID}
+	result := []T{}
+	for _, item := range items {
+		if compareKeys(key(item), boundary)*int(order) > 0 {
+			result = append(result, item)
+		}
+	}
+
+	hasMore := false
+	if limit > 0 && int64(len(result)) > limit {
+		hasMore = true
+		result = result[:limit]
+	}
+	if position.Backward {
+		slices.Reverse(result)
+	}
+	return result, hasMore
+}
+
+// MatchBook reports whether a book, merged with its catalog entry, passes the filter.
+func MatchBook(b *models.Book, f models.BookFilter) bool {
+	if f.Author != "" && !containsFold(b.Author, f.Author) {
+		return false
+	}
+	if f.Publisher != "" && !containsFold(b.Publishing, f.Publisher) {
+		return false
+	}
+	if f.ShopName != "" && b.ShopName != f.ShopName {
+		return false
+	}
+	if f.HasCover != nil && (b.CoverImage != "") != *f.HasCover {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(b.Tags, f.Tag) {
+		return false
+	}
+	if f.CreatedFrom != nil && b.CreatedAt.Before(*f.CreatedFrom) {
+		return false
+	}
+	if f.CreatedTo != nil && b.CreatedAt.After(*f.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+// containsFold reports whether substr is within s, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// BookKey returns the position of a book in a list sorted by a field. The
+// positions on a bookshelf are sorted by models.PositionField.
+func BookKey(field string) func(*models.Book) Key {
+	return func(b *models.Book) Key {
+		var value interface{}
+		switch field {
+		case models.SortByTitle:
+			value = b.Title
+		case models.SortByAuthor:
+			value = b.Author
+		case models.SortByCreatedAt:
+			value = b.CreatedAt
+		case models.SortByUpdatedAt:
+			value = b.UpdatedAt
+		default:
+			if bookshelfID, ok := strings.CutPrefix(field, models.PositionField("")); ok {
+				if position, ok := b.Positions[bookshelfID]; ok {
+					value = position
+				}
+			}
+		}
+		return Key{Value: value, ID: b.ID}
+	}
+}
+
+// BookshelfKey returns the position of a bookshelf in a list sorted by a field.
+func BookshelfKey(field string) func(*models.Bookshelf) Key {
+	return func(b *models.Bookshelf) Key {
+		var value interface{}
+		switch field {
+		case models.SortByName:
+			value = b.Name
+		case models.SortByPosition:
+			value = b.Position
+		case models.SortByCreatedAt:
+			value = b.CreatedAt
+		case models.SortByUpdatedAt:
+			value = b.UpdatedAt
+		}
+		return Key{Value: value, ID: b.ID}
+	}
+}
+
+// Books filters a user's or a bookshelf's books and returns the requested page.
+func Books(books []*models.Book, opts *models.BookListOptions) *models.BookPage {
+	matched := []*models.Book{}
+	for _, book := range books {
+		if opts.ShelfFilter != nil && !MatchBook(book, *opts.ShelfFilter) {
+			continue
+		}
+		if MatchBook(book, opts.Filter) {
+			matched = append(matched, book)
+		}
+	}
+
+	total := int64(len(matched))
+	page, hasMore := Paginate(matched, BookKey(opts.Sort), opts.Order, opts.Page, opts.Limit, opts.Position)
+	return &models.BookPage{Books: page, Total: total, HasMore: hasMore}
+}
+
+// Bookshelves returns the requested page of a user's bookshelves.
+func Bookshelves(bookshelves []*models.Bookshelf, opts *models.BookshelfListOptions) *models.BookshelfPage {
+	total := int64(len(bookshelves))
+	page, hasMore := Paginate(bookshelves, BookshelfKey(opts.Sort), opts.Order, opts.Page, opts.Limit, opts.Position)
+	return &models.BookshelfPage{Bookshelves: page, Total: total, HasMore: hasMore}
+}
@@ -0,0 +1,151 @@
+package document
+
+import (
+	"cmp"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/lib/fracindex"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Placements returns the positions of the books that the changes put on a
+// bookshelf: after the last book there, in the order of the changes. last
+// returns the largest position on a bookshelf, or "" for an empty one.
+// Changes that put no book on a bookshelf get no position.
+func Placements(changes []models.ShelfChange, last func(bookshelfID string) (string, error)) ([]string, error) {
+	joining := map[string]int{}
+	for _, change := range changes {
+		if change.To != "" {
+			joining[change.To]++
+		}
+	}
+
+	keys := make(map[string][]string, len(joining))
+	for bookshelfID, n := range joining {
+		after, err := last(bookshelfID)
+		if err != nil {
+			return nil, err
+		}
+		if keys[bookshelfID], err = fracindex.Sequence(after, "", n); err != nil {
+			return nil, err
+		}
+	}
+
+	positions := make([]string, len(changes))
+	for i, change := range changes {
+		if change.To != "" {
+			positions[i], keys[change.To] = keys[change.To][0], keys[change.To][1:]
+		}
+	}
+	return positions, nil
+}
+
+// LastPosition returns the largest position of the books on a bookshelf.
+func LastPosition(books []*models.Book, bookshelfID string) string {
+	last := ""
+	for _, book := range books {
+		last = max(last, book.Positions[bookshelfID])
+	}
+	return last
+}
+
+// LastBookshelfPosition returns the largest position of the bookshelves.
+func LastBookshelfPosition(bookshelves []*models.Bookshelf) string {
+	last := ""
+	for _, bookshelf := range bookshelves {
+		last = max(last, bookshelf.Position)
+	}
+	return last
+}
+
+// Place gives a new book positions at the end of each of its bookshelves;
+// last returns the largest position on a bookshelf, or "" for an empty one.
+func Place(doc *models.Book, last func(bookshelfID string) (string, error)) error {
+	doc.Positions = make(map[string]string, len(doc.BookshelfIDs))
+	for _, bookshelfID := range doc.BookshelfIDs {
+		after, err := last(bookshelfID)
+		if err != nil {
+			return err
+		}
+		if doc.Positions[bookshelfID], err = fracindex.Between(after, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPosition sets the position of a stored book on a bookshelf. The map is
+// copied, so that a copy of the document keeps the old positions.
+func SetPosition(doc *models.Book, bookshelfID, position string) {
+	positions := maps.Clone(doc.Positions)
+	if positions == nil {
+		positions = map[string]string{}
+	}
+	positions[bookshelfID] = position
+	doc.Positions = positions
+}
+
+// SortPositions orders positions like a list sorted by position: by key,
+// then by ID.
+func SortPositions(positions []models.Position) {
+	slices.SortFunc(positions, func(a, b models.Position) int {
+		return cmp.Or(strings.Compare(a.Key, b.Key), strings.Compare(a.ID, b.ID))
+	})
+}
+
+// BackfillBooks gives the books on a bookshelf that have no position there
+// one after the positioned books, oldest first. It returns the books it
+// changed.
+func BackfillBooks(books []*models.Book, bookshelfID string) ([]*models.Book, error) {
+	books = slices.Clone(books)
+	slices.SortFunc(books, func(a, b *models.Book) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+
+	keys := make([]string, len(books))
+	for i, book := range books {
+		keys[i] = book.Positions[bookshelfID]
+	}
+	filled, err := fracindex.Fill(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []*models.Book
+	for i, book := range books {
+		if filled[i] != keys[i] {
+			SetPosition(book, bookshelfID, filled[i])
+			changed = append(changed, book)
+		}
+	}
+	return changed, nil
+}
+
+// BackfillBookshelves gives the bookshelves with the same parent that have no
+// position one after the positioned ones, oldest first. It returns the
+// bookshelves it changed.
+func BackfillBookshelves(bookshelves []*models.Bookshelf) ([]*models.Bookshelf, error) {
+	bookshelves = slices.Clone(bookshelves)
+	slices.SortFunc(bookshelves, func(a, b *models.Bookshelf) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+
+	keys := make([]string, len(bookshelves))
+	for i, bookshelf := range bookshelves {
+		keys[i] = bookshelf.Position
+	}
+	filled, err := fracindex.Fill(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []*models.Bookshelf
+	for i, bookshelf := range bookshelves {
+		if filled[i] != keys[i] {
+			bookshelf.Position = filled[i]
+			changed = append(changed, bookshelf)
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,44 @@
+package document
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"slices"
+	"strings"
+)
+
+// Subtree returns the bookshelf with the id and the bookshelves nested in it,
+// taken from all bookshelves of its user, in the order of the $graphLookup of
+// the MongoDB repository: by depth, then by _id. It returns nil if the
+// bookshelf is not among them.
+func Subtree(bookshelves []*models.Bookshelf, id string) []*models.Bookshelf {
+	children := map[string][]*models.Bookshelf{}
+	var root *models.Bookshelf
+	for _, b := range bookshelves {
+		if b.ID == id {
+			root = b
+		}
+		children[b.ParentID] = append(children[b.ParentID], b)
+	}
+	if root == nil {
+		return nil
+	}
+
+	subtree := []*models.Bookshelf{root}
+	seen := map[string]bool{root.ID: true}
+	for level := subtree; len(level) > 0; {
+		var next []*models.Bookshelf
+		for _, b := range level {
+			for _, child := range children[b.ID] {
+				// A cycle, which the service does not let form, ends the walk.
+				if !seen[child.ID] {
+					seen[child.ID] = true
+					next = append(next, child)
+				}
+			}
+		}
+		slices.SortFunc(next, func(a, b *models.Bookshelf) int { return strings.Compare(a.ID, b.ID) })
+		subtree = append(subtree, next...)
+		level = next
+	}
+	return subtree
+}
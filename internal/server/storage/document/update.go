@@ -0,0 +1,116 @@
+package document
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"maps"
+	"slices"
+	"time"
+)
+
+// SetBook applies an update to a stored book like the $set of the MongoDB
+// repository: fields that are not given are kept, except for the publisher and
+// the shop, which are cleared.
+func SetBook(doc *models.Book, update *models.BookUpdate) {
+	set := func(field *string, value *string) {
+		if value != nil {
+			*field = *value
+		}
+	}
+	set(&doc.ISBN, update.ISBN)
+	set(&doc.CatalogID, update.CatalogID)
+	set(&doc.Title, update.Title)
+	set(&doc.Author, update.Author)
+	set(&doc.Description, update.Description)
+	set(&doc.CoverImage, update.CoverImage)
+	doc.Publishing = ""
+	set(&doc.Publishing, update.Publishing)
+	doc.ShopName = ""
+	set(&doc.ShopName, update.ShopName)
+	if update.Tags != nil {
+		doc.Tags = slices.Clone(*update.Tags)
+	}
+	if update.Overrides != nil {
+		doc.Overrides = slices.Clone(*update.Overrides)
+	}
+	doc.UpdatedAt = update.UpdatedAt
+}
+
+// SetBookshelf applies an update to a stored bookshelf like the $set of the
+// MongoDB repository.
+func SetBookshelf(doc *models.Bookshelf, update *models.BookshelfUpdate) {
+	if update.Name != nil {
+		doc.Name = *update.Name
+	}
+	if update.ParentID != nil {
+		doc.ParentID = *update.ParentID
+	}
+	if update.Position != nil {
+		doc.Position = *update.Position
+	}
+	if update.Filter != nil {
+		filter := *update.Filter
+		doc.Filter = &filter
+	}
+	doc.UpdatedAt = update.UpdatedAt
+}
+
+// Reshelve applies a shelf change to a stored book and records it in the
+// history. A book joining a bookshelf gets the position there. It reports
+// whether the bookshelves of the book changed; a change that changes nothing
+// is not recorded.
+func Reshelve(doc *models.Book, change models.ShelfChange, position string, at time.Time) bool {
+	leaves := change.From != "" && slices.Contains(doc.BookshelfIDs, change.From)
+	joins := change.To != "" && !slices.Contains(doc.BookshelfIDs, change.To)
+	if !leaves && !joins {
+		return false
+	}
+
+	shelves := make([]string, 0, len(doc.BookshelfIDs)+1)
+	for _, id := range doc.BookshelfIDs {
+		if !leaves || id != change.From {
+			shelves = append(shelves, id)
+		}
+	}
+	if joins {
+		shelves = append(shelves, change.To)
+	}
+
+	event := models.BookEvent{FromBookshelfID: change.From, ToBookshelfID: change.To, At: at}
+	switch {
+	case change.From != "" && change.To != "":
+		event.Type = models.BookEventMoved
+	case change.From != "":
+		event.Type = models.BookEventRemoved
+	default:
+		event.Type = models.BookEventAdded
+	}
+
+	if leaves {
+		doc.Positions = maps.Clone(doc.Positions)
+		delete(doc.Positions, change.From)
+	}
+	if joins {
+		SetPosition(doc, change.To, position)
+	}
+
+	doc.BookshelfIDs = shelves
+	doc.History = append(slices.Clip(doc.History), event)
+	doc.UpdatedAt = at
+	return true
+}
+
+// Duplicates reports whether two of the books share an ISBN. Books without an
+// ISBN are not compared.
+func Duplicates(books []*models.Book) bool {
+	seen := make(map[string]bool, len(books))
+	for _, book := range books {
+		if book.ISBN == "" {
+			continue
+		}
+		if seen[book.ISBN] {
+			return true
+		}
+		seen[book.ISBN] = true
+	}
+	return false
+}
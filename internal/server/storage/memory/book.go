@@ -0,0 +1,309 @@
+package memory
+
+import (
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/document"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// BookRepo implements the repository.BookRepo interface in memory.
+type BookRepo struct {
+	db         *DB
+	collection string
+	log        *slog.Logger
+}
+
+// NewBookRepo creates a new BookRepo instance.
+func NewBookRepo(db *DB, log *slog.Logger, collectionName string) repository.BookRepo {
+	return &BookRepo{
+		db:         db,
+		collection: collectionName,
+		log:        log,
+	}
+}
+
+// Create inserts a new book into the database.
+func (r *BookRepo) Create(ctx context.Context, book *models.Book) error {
+	book.ID = primitive.NewObjectID().Hex()
+	book.CreatedAt = time.Now()
+	book.UpdatedAt = time.Now()
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	books := r.db.collection(r.collection)
+	if _, ok := books[book.ID]; ok {
+		return repository.ErrBookAlreadyExists
+	}
+	if err := document.Place(book, lastPosition(books)); err != nil {
+		return err
+	}
+
+	doc := *book
+	doc.CreatedAt = stored(doc.CreatedAt)
+	doc.UpdatedAt = stored(doc.UpdatedAt)
+	books[doc.ID] = doc
+	return nil
+}
+
+// GetByID retrieves a book from the database by its ID.
+func (r *BookRepo) GetByID(ctx context.Context, id string) (*models.Book, error) {
+	return r.findOne(func(b *models.Book) bool { return b.ID == id })
+}
+
+// GetByISBN retrieves a book from the database by its ISBN.
+func (r *BookRepo) GetByISBN(ctx context.Context, isbn string) (*models.Book, error) {
+	return r.findOne(func(b *models.Book) bool { return b.ISBN == isbn })
+}
+
+// GetByISBNAndUser retrieves a book with the given ISBN from a user's library.
+func (r *BookRepo) GetByISBNAndUser(ctx context.Context, isbn, userID string) (*models.Book, error) {
+	return r.findOne(func(b *models.Book) bool { return b.ISBN == isbn && b.UserID == userID })
+}
+
+// GetByUserID retrieves a page of books associated with a specific user ID.
+func (r *BookRepo) GetByUserID(ctx context.Context, userID string, opts *models.BookListOptions) (*models.BookPage, error) {
+	return r.find(func(b *models.Book) bool { return b.UserID == userID }, opts), nil
+}
+
+// GetByBookshelfID retrieves a page of books belonging to a specific bookshelf ID.
+func (r *BookRepo) GetByBookshelfID(ctx context.Context, bookshelfID string, opts *models.BookListOptions) (*models.BookPage, error) {
+	return r.find(func(b *models.Book) bool { return slices.Contains(b.BookshelfIDs, bookshelfID) }, opts.OnBookshelf(bookshelfID)), nil
+}
+
+// GetByBookshelves retrieves a page of the books on any of the bookshelves.
+func (r *BookRepo) GetByBookshelves(ctx context.Context, bookshelfIDs []string, opts *models.BookListOptions) (*models.BookPage, error) {
+	return r.find(func(b *models.Book) bool {
+		return slices.ContainsFunc(b.BookshelfIDs, func(id string) bool { return slices.Contains(bookshelfIDs, id) })
+	}, opts), nil
+}
+
+// findOne returns the book matching the filter with the smallest _id, merged
+// with its catalog entry.
+func (r *BookRepo) findOne(match func(*models.Book) bool) (*models.Book, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var found *models.Book
+	for _, doc := range r.db.books[r.collection] {
+		if match(&doc) && (found == nil || doc.ID < found.ID) {
+			found = &doc
+		}
+	}
+	if found == nil {
+		return nil, repository.ErrBookNotFound
+	}
+	return r.merged(*found), nil
+}
+
+// find returns a page of the books selected by the base filter, merged with
+// the catalog and filtered the way the MongoDB repository does it.
+func (r *BookRepo) find(base func(*models.Book) bool, opts *models.BookListOptions) *models.BookPage {
+	r.db.mu.RLock()
+	books := []*models.Book{}
+	for _, doc := range r.db.books[r.collection] {
+		if base(&doc) {
+			books = append(books, r.merged(doc))
+		}
+	}
+	r.db.mu.RUnlock()
+
+	return document.Books(books, opts)
+}
+
+// merged sets the fields the user has not overridden to the values of the
+// catalog entry of a book. The caller must hold the read lock.
+func (r *BookRepo) merged(doc models.Book) *models.Book {
+	book := doc
+	if entry, ok := r.db.catalog[book.CatalogID]; ok && book.CatalogID != "" {
+		book.Merge(&entry)
+	}
+	return &book
+}
+
+// CountInBookshelf returns the number of book in a bookshelf.
+func (r *BookRepo) CountInBookshelf(ctx context.Context, bookshelfID string) (int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	count := 0
+	for _, doc := range r.db.books[r.collection] {
+		if slices.Contains(doc.BookshelfIDs, bookshelfID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ExistsInBookshelf checks if a book with the given ISBN already exists in the bookshelf.
+func (r *BookRepo) ExistsInBookshelf(ctx context.Context, isbn, bookshelfID string) (bool, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, doc := range r.db.books[r.collection] {
+		if doc.ISBN == isbn && slices.Contains(doc.BookshelfIDs, bookshelfID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Update updates a book in the database. Like the $set of the MongoDB
+// repository, it clears the publisher and the shop when they are not given.
+func (r *BookRepo) Update(ctx context.Context, id string, update *models.BookUpdate) error {
+	update.UpdatedAt = time.Now()
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	books := r.db.collection(r.collection)
+	doc, ok := books[id]
+	if !ok {
+		return repository.ErrBookNotFound
+	}
+
+	old := doc
+	document.SetBook(&doc, update)
+	doc.UpdatedAt = stored(doc.UpdatedAt)
+
+	books[id] = doc
+	if len(update.Shelves) > 0 {
+		if err := reshelve(books, update.Shelves, doc.UpdatedAt); err != nil {
+			books[id] = old
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncCatalog copies the metadata of a catalog entry to the books linked to
+// it, except for the fields their users have overridden.
+func (r *BookRepo) SyncCatalog(ctx context.Context, entry *models.CatalogEntry) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	books := r.db.collection(r.collection)
+	for id, doc := range books {
+		if doc.CatalogID == entry.ID {
+			doc.Merge(entry)
+			books[id] = doc
+		}
+	}
+	return nil
+}
+
+// Reshelve applies the shelf changes and records them in the history of the
+// books. The database stays locked throughout.
+func (r *BookRepo) Reshelve(ctx context.Context, changes []models.ShelfChange) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	return reshelve(r.db.collection(r.collection), changes, stored(time.Now()))
+}
+
+// reshelve applies shelf changes to the books of a collection, or none of
+// them when a book is missing or a bookshelf would hold an ISBN twice.
+func reshelve(books map[string]models.Book, changes []models.ShelfChange, at time.Time) error {
+	positions, err := document.Placements(changes, lastPosition(books))
+	if err != nil {
+		return err
+	}
+
+	staged := make(map[string]models.Book, len(changes))
+	for i, change := range changes {
+		doc, ok := staged[change.BookID]
+		if !ok {
+			if doc, ok = books[change.BookID]; !ok {
+				return repository.ErrBookNotFound
+			}
+		}
+		document.Reshelve(&doc, change, positions[i], at)
+		staged[change.BookID] = doc
+	}
+
+	for _, change := range changes {
+		if change.To == "" {
+			continue
+		}
+		var onShelf []*models.Book
+		for id, doc := range books {
+			if next, ok := staged[id]; ok {
+				doc = next
+			}
+			if slices.Contains(doc.BookshelfIDs, change.To) {
+				onShelf = append(onShelf, &doc)
+			}
+		}
+		if document.Duplicates(onShelf) {
+			return repository.ErrBookAlreadyExists
+		}
+	}
+
+	for id, doc := range staged {
+		books[id] = doc
+	}
+	return nil
+}
+
+// lastPosition returns a function that finds the largest position on a
+// bookshelf among the books of a collection.
+func lastPosition(books map[string]models.Book) func(string) (string, error) {
+	return func(bookshelfID string) (string, error) {
+		last := ""
+		for _, doc := range books {
+			last = max(last, doc.Positions[bookshelfID])
+		}
+		return last, nil
+	}
+}
+
+// Positions returns the positions of the books on a bookshelf, in order.
+func (r *BookRepo) Positions(ctx context.Context, bookshelfID string) ([]models.Position, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	positions := []models.Position{}
+	for _, doc := range r.db.books[r.collection] {
+		if slices.Contains(doc.BookshelfIDs, bookshelfID) {
+			positions = append(positions, models.Position{ID: doc.ID, Key: doc.Positions[bookshelfID]})
+		}
+	}
+	document.SortPositions(positions)
+	return positions, nil
+}
+
+// SetPositions sets the positions of books on a bookshelf. Books that are
+// no longer on it are skipped.
+func (r *BookRepo) SetPositions(ctx context.Context, bookshelfID string, positions map[string]string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	books := r.db.collection(r.collection)
+	for id, position := range positions {
+		doc, ok := books[id]
+		if !ok || !slices.Contains(doc.BookshelfIDs, bookshelfID) {
+			continue
+		}
+		document.SetPosition(&doc, bookshelfID, position)
+		books[id] = doc
+	}
+	return nil
+}
+
+// Delete removes a book from the database.
+func (r *BookRepo) Delete(ctx context.Context, id string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	books := r.db.collection(r.collection)
+	if _, ok := books[id]; !ok {
+		return repository.ErrBookNotFound
+	}
+	delete(books, id)
+	return nil
+}
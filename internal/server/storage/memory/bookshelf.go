@@ -0,0 +1,320 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/document"
+	"github.com/getz-devs/librakeeper-server/lib/fracindex"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BookshelfRepo implements the repository.BookshelfRepo interface in memory.
+type BookshelfRepo struct {
+	db  *DB
+	log *slog.Logger
+}
+
+// NewBookshelfRepo creates a new BookshelfRepo instance.
+func NewBookshelfRepo(db *DB, log *slog.Logger) repository.BookshelfRepo {
+	return &BookshelfRepo{
+		db:  db,
+		log: log,
+	}
+}
+
+// Create inserts a new bookshelf into the database.
+func (r *BookshelfRepo) Create(ctx context.Context, bookshelf *models.Bookshelf) error {
+	bookshelf.ID = primitive.NewObjectID().Hex()
+	bookshelf.CreatedAt = time.Now()
+	bookshelf.UpdatedAt = time.Now()
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.bookshelves[bookshelf.ID]; ok {
+		return repository.ErrBookshelfAlreadyExists
+	}
+	position, err := fracindex.Between(r.lastPosition(bookshelf.UserID, bookshelf.ParentID), "")
+	if err != nil {
+		return err
+	}
+	bookshelf.Position = position
+
+	doc := *bookshelf
+	doc.CreatedAt = stored(doc.CreatedAt)
+	doc.UpdatedAt = stored(doc.UpdatedAt)
+	r.db.bookshelves[doc.ID] = doc
+	return nil
+}
+
+// GetByID retrieves a bookshelf from the database by its ID.
+func (r *BookshelfRepo) GetByID(ctx context.Context, id string) (*models.Bookshelf, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	doc, ok := r.db.bookshelves[id]
+	if !ok {
+		return nil, repository.ErrBookshelfNotFound
+	}
+	return &doc, nil
+}
+
+// GetByUser retrieves a page of bookshelves associated with a specific user ID.
+func (r *BookshelfRepo) GetByUser(ctx context.Context, userID string, opts *models.BookshelfListOptions) (*models.BookshelfPage, error) {
+	r.db.mu.RLock()
+	bookshelves := []*models.Bookshelf{}
+	for _, doc := range r.db.bookshelves {
+		if doc.UserID == userID && (opts.ParentID == nil || doc.ParentID == *opts.ParentID) {
+			bookshelves = append(bookshelves, &doc)
+		}
+	}
+	r.db.mu.RUnlock()
+
+	return document.Bookshelves(bookshelves, opts), nil
+}
+
+// CountByUser returns the number of bookshelf owned by a user.
+func (r *BookshelfRepo) CountByUser(ctx context.Context, userID string) (int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	count := 0
+	for _, doc := range r.db.bookshelves {
+		if doc.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ExistsByNameAndParent checks if a bookshelf with the given name is nested in the parent.
+func (r *BookshelfRepo) ExistsByNameAndParent(ctx context.Context, name, userID, parentID string) (bool, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, doc := range r.db.bookshelves {
+		if doc.Name == name && doc.UserID == userID && doc.ParentID == parentID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetSubtree returns the bookshelf and the bookshelves nested in it.
+func (r *BookshelfRepo) GetSubtree(ctx context.Context, id string) ([]*models.Bookshelf, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	root, ok := r.db.bookshelves[id]
+	if !ok {
+		return nil, repository.ErrBookshelfNotFound
+	}
+	var bookshelves []*models.Bookshelf
+	for _, doc := range r.db.bookshelves {
+		if doc.UserID == root.UserID {
+			bookshelves = append(bookshelves, &doc)
+		}
+	}
+	return document.Subtree(bookshelves, id), nil
+}
+
+// CountBooks returns the number of books of BooksCollection on any of the bookshelves.
+func (r *BookshelfRepo) CountBooks(ctx context.Context, ids []string) (int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	count := 0
+	for _, doc := range r.db.collection(BooksCollection) {
+		if slices.ContainsFunc(doc.BookshelfIDs, func(id string) bool { return slices.Contains(ids, id) }) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CountBooksByGroup returns, for every group of bookshelves, the number of
+// books of BooksCollection on any of its bookshelves.
+func (r *BookshelfRepo) CountBooksByGroup(ctx context.Context, groups map[string][]string) (map[string]int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	counts := make(map[string]int, len(groups))
+	for key, ids := range groups {
+		counts[key] = 0
+		for _, doc := range r.db.collection(BooksCollection) {
+			if slices.ContainsFunc(doc.BookshelfIDs, func(id string) bool { return slices.Contains(ids, id) }) {
+				counts[key]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+// Update updates a bookshelf in the database.
+func (r *BookshelfRepo) Update(ctx context.Context, id string, update *models.BookshelfUpdate) error {
+	update.UpdatedAt = time.Now()
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	doc, ok := r.db.bookshelves[id]
+	if !ok {
+		return repository.ErrBookshelfNotFound
+	}
+	if update.ParentID != nil {
+		position, err := fracindex.Between(r.lastPosition(doc.UserID, *update.ParentID), "")
+		if err != nil {
+			return err
+		}
+		update.Position = &position
+	}
+	document.SetBookshelf(&doc, update)
+	doc.UpdatedAt = stored(doc.UpdatedAt)
+
+	r.db.bookshelves[id] = doc
+	return nil
+}
+
+// Positions returns the positions of the bookshelves of a user nested
+// directly in the parent, in order.
+func (r *BookshelfRepo) Positions(ctx context.Context, userID, parentID string) ([]models.Position, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	positions := []models.Position{}
+	for _, doc := range r.db.bookshelves {
+		if doc.UserID == userID && doc.ParentID == parentID {
+			positions = append(positions, models.Position{ID: doc.ID, Key: doc.Position})
+		}
+	}
+	document.SortPositions(positions)
+	return positions, nil
+}
+
+// SetPositions sets the positions of bookshelves. Missing bookshelves are
+// skipped.
+func (r *BookshelfRepo) SetPositions(ctx context.Context, positions map[string]string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for id, position := range positions {
+		if doc, ok := r.db.bookshelves[id]; ok {
+			doc.Position = position
+			r.db.bookshelves[id] = doc
+		}
+	}
+	return nil
+}
+
+// lastPosition returns the largest position among the bookshelves of a user
+// nested directly in the parent. The caller must hold the lock.
+func (r *BookshelfRepo) lastPosition(userID, parentID string) string {
+	last := ""
+	for _, doc := range r.db.bookshelves {
+		if doc.UserID == userID && doc.ParentID == parentID {
+			last = max(last, doc.Position)
+		}
+	}
+	return last
+}
+
+// Delete removes a bookshelf from the database.
+func (r *BookshelfRepo) Delete(ctx context.Context, id string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.bookshelves[id]; !ok {
+		return repository.ErrBookshelfNotFound
+	}
+	delete(r.db.bookshelves, id)
+	return nil
+}
+
+// DeleteWithBooks deletes a bookshelf and refuses, deletes or moves the books
+// of BooksCollection on it. The database stays locked throughout.
+func (r *BookshelfRepo) DeleteWithBooks(ctx context.Context, id string, opts *models.BookshelfDeleteOptions) (*models.BookshelfDeleteResult, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.bookshelves[id]; !ok {
+		return nil, repository.ErrBookshelfNotFound
+	}
+	for _, doc := range r.db.bookshelves {
+		if doc.ParentID == id {
+			return nil, repository.ErrBookshelfHasChildren
+		}
+	}
+
+	books := r.db.collection(BooksCollection)
+	var onShelf []models.Book
+	for _, doc := range books {
+		if slices.Contains(doc.BookshelfIDs, id) {
+			onShelf = append(onShelf, doc)
+		}
+	}
+
+	result := &models.BookshelfDeleteResult{BookshelfID: id, Mode: opts.Mode}
+	switch opts.Mode {
+	case models.DeleteModeCascade:
+		// Books on other bookshelves too only leave this one.
+		var kept []models.ShelfChange
+		for _, doc := range onShelf {
+			if len(doc.BookshelfIDs) > 1 {
+				kept = append(kept, models.ShelfChange{BookID: doc.ID, From: id})
+			}
+		}
+		if err := reshelve(books, kept, stored(time.Now())); err != nil {
+			return nil, err
+		}
+		for _, doc := range onShelf {
+			if len(doc.BookshelfIDs) == 1 {
+				delete(books, doc.ID)
+			}
+		}
+		result.BooksKept = len(kept)
+		result.BooksDeleted = len(onShelf) - len(kept)
+	case models.DeleteModeMove:
+		if opts.TargetID != "" && opts.BookLimit > 0 {
+			total := 0
+			for _, doc := range books {
+				if slices.Contains(doc.BookshelfIDs, opts.TargetID) {
+					total++
+				}
+			}
+			for _, doc := range onShelf {
+				if !slices.Contains(doc.BookshelfIDs, opts.TargetID) {
+					total++
+				}
+			}
+			if total > opts.BookLimit {
+				return nil, repository.ErrBookshelfLimitReached
+			}
+		}
+		// The books keep their order behind those on the target.
+		slices.SortFunc(onShelf, func(a, b models.Book) int {
+			return cmp.Or(strings.Compare(a.Positions[id], b.Positions[id]), strings.Compare(a.ID, b.ID))
+		})
+		changes := make([]models.ShelfChange, 0, len(onShelf))
+		for _, doc := range onShelf {
+			changes = append(changes, models.ShelfChange{BookID: doc.ID, From: id, To: opts.TargetID})
+		}
+		if err := reshelve(books, changes, stored(time.Now())); err != nil {
+			return nil, err
+		}
+		result.BooksMoved = len(onShelf)
+		result.TargetBookshelfID = opts.TargetID
+	default:
+		if len(onShelf) > 0 {
+			return nil, repository.ErrBookshelfNotEmpty
+		}
+	}
+
+	delete(r.db.bookshelves, id)
+	return result, nil
+}
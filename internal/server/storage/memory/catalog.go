@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	isbnlib "github.com/getz-devs/librakeeper-server/lib/isbn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// CatalogRepo implements the repository.CatalogRepo interface in memory.
+type CatalogRepo struct {
+	db  *DB
+	log *slog.Logger
+}
+
+// NewCatalogRepo creates a new CatalogRepo instance.
+func NewCatalogRepo(db *DB, log *slog.Logger) repository.CatalogRepo {
+	return &CatalogRepo{
+		db:  db,
+		log: log,
+	}
+}
+
+// Create inserts a new catalog entry into the database. There is one entry
+// per ISBN-13.
+func (r *CatalogRepo) Create(ctx context.Context, entry *models.CatalogEntry) error {
+	entry.ID = primitive.NewObjectID().Hex()
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = time.Now()
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, doc := range r.db.catalog {
+		if doc.ISBN13 == entry.ISBN13 {
+			return repository.ErrCatalogEntryAlreadyExists
+		}
+	}
+
+	doc := cloneEntry(*entry)
+	doc.CreatedAt = stored(doc.CreatedAt)
+	doc.UpdatedAt = stored(doc.UpdatedAt)
+	r.db.catalog[doc.ID] = doc
+	return nil
+}
+
+// GetByID retrieves a catalog entry by its ID.
+func (r *CatalogRepo) GetByID(ctx context.Context, id string) (*models.CatalogEntry, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	doc, ok := r.db.catalog[id]
+	if !ok {
+		return nil, repository.ErrCatalogEntryNotFound
+	}
+	entry := cloneEntry(doc)
+	return &entry, nil
+}
+
+// GetByISBN retrieves a catalog entry by an ISBN-10 or ISBN-13, with or without hyphens.
+func (r *CatalogRepo) GetByISBN(ctx context.Context, isbn string) (*models.CatalogEntry, error) {
+	isbn13, err := isbnlib.To13(isbn)
+	if err != nil {
+		isbn13 = isbnlib.Clean(isbn)
+	}
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, doc := range r.db.catalog {
+		if doc.ISBN13 == isbn13 {
+			entry := cloneEntry(doc)
+			return &entry, nil
+		}
+	}
+	return nil, repository.ErrCatalogEntryNotFound
+}
+
+// AddEdition adds an edition to a catalog entry unless it is already listed.
+func (r *CatalogRepo) AddEdition(ctx context.Context, id string, edition models.Edition) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	doc, ok := r.db.catalog[id]
+	if !ok {
+		return repository.ErrCatalogEntryNotFound
+	}
+	if !slices.Contains(doc.Editions, edition) {
+		doc.Editions = append(slices.Clone(doc.Editions), edition)
+	}
+	doc.UpdatedAt = stored(time.Now())
+
+	r.db.catalog[id] = doc
+	return nil
+}
+
+// cloneEntry copies an entry so callers never share its slices with the database.
+func cloneEntry(entry models.CatalogEntry) models.CatalogEntry {
+	entry.Contributors = slices.Clone(entry.Contributors)
+	entry.Editions = slices.Clone(entry.Editions)
+	return entry
+}
@@ -0,0 +1,47 @@
+// Package memory implements the repositories in process memory. It behaves
+// like the MongoDB repositories and is meant for tests and local runs; nothing
+// is persisted.
+package memory
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"sync"
+	"time"
+)
+
+// BooksCollection is the collection of the books of the users. Bookshelf
+// deletions change the books in it.
+const BooksCollection = "user_books"
+
+// DB holds the collections shared by the repositories, like a MongoDB database.
+type DB struct {
+	mu          sync.RWMutex
+	books       map[string]map[string]models.Book // collection name -> _id -> book
+	bookshelves map[string]models.Bookshelf
+	catalog     map[string]models.CatalogEntry
+}
+
+// NewDB creates an empty database.
+func NewDB() *DB {
+	return &DB{
+		books:       map[string]map[string]models.Book{},
+		bookshelves: map[string]models.Bookshelf{},
+		catalog:     map[string]models.CatalogEntry{},
+	}
+}
+
+// collection returns the books of a collection, creating it on first use.
+// The caller must hold the write lock.
+func (db *DB) collection(name string) map[string]models.Book {
+	books, ok := db.books[name]
+	if !ok {
+		books = map[string]models.Book{}
+		db.books[name] = books
+	}
+	return books
+}
+
+// stored returns a time as MongoDB hands it back: in UTC with millisecond precision.
+func stored(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
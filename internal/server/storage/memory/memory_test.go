@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository/repotest"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db := NewDB()
+		return repotest.Repos{
+			Books:       NewBookRepo(db, log, BooksCollection),
+			Bookshelves: NewBookshelfRepo(db, log),
+			Catalog:     NewCatalogRepo(db, log),
+			CorrectCatalog: func(t *testing.T, entry *models.CatalogEntry) {
+				db.mu.Lock()
+				defer db.mu.Unlock()
+				db.catalog[entry.ID] = cloneEntry(*entry)
+			},
+		}
+	})
+}
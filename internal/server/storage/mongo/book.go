@@ -6,23 +6,30 @@ import (
 	"fmt"
 	"github.com/getz-devs/librakeeper-server/internal/server/models"
 	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/document"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log/slog"
+	"regexp"
+	"slices"
 	"time"
 )
 
+// BooksCollection is the collection of the books of the users.
+const BooksCollection = "user_books"
+
 // ErrBookNotFound occurs when a book is not found in the database.
-var ErrBookNotFound = errors.New("book not found")
+var ErrBookNotFound = repository.ErrBookNotFound
 
 // ErrBookAlreadyExists occurs when trying to create a book with an ID that already exists.
-var ErrBookAlreadyExists = errors.New("book already exists")
+var ErrBookAlreadyExists = repository.ErrBookAlreadyExists
 
 // BookRepo implements the repository.BookRepo interface for MongoDB.
 type BookRepo struct {
 	collection *mongo.Collection
+	catalog    *mongo.Collection
 	log        *slog.Logger
 }
 
@@ -30,6 +37,7 @@ type BookRepo struct {
 func NewBookRepo(db *mongo.Database, log *slog.Logger, collectionName string) repository.BookRepo {
 	return &BookRepo{
 		collection: db.Collection(collectionName),
+		catalog:    db.Collection(CatalogCollection),
 		log:        log,
 	}
 }
@@ -40,6 +48,10 @@ func (r *BookRepo) Create(ctx context.Context, book *models.Book) error {
 	book.CreatedAt = time.Now()
 	book.UpdatedAt = time.Now()
 
+	if err := document.Place(book, lastPosition(ctx, r.collection)); err != nil {
+		return fmt.Errorf("failed to place book: %w", err)
+	}
+
 	_, err := r.collection.InsertOne(ctx, book)
 	if err != nil {
 		// Check for duplicate key error
@@ -57,74 +69,219 @@ func (r *BookRepo) Create(ctx context.Context, book *models.Book) error {
 
 // GetByID retrieves a book from the database by its ID.
 func (r *BookRepo) GetByID(ctx context.Context, id string) (*models.Book, error) {
-	var book models.Book
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&book)
+	book, err := r.findOne(ctx, bson.M{"_id": id})
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
+		if errors.Is(err, ErrBookNotFound) {
 			return nil, ErrBookNotFound
 		}
 		return nil, fmt.Errorf("failed to get book: %w", err)
 	}
-	return &book, nil
+	return book, nil
 }
 
 // GetByISBN retrieves a book from the database by its ISBN.
 func (r *BookRepo) GetByISBN(ctx context.Context, isbn string) (*models.Book, error) {
-	var book models.Book
-	err := r.collection.FindOne(ctx, bson.M{"isbn": isbn}).Decode(&book)
+	book, err := r.findOne(ctx, bson.M{"isbn": isbn})
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
+		if errors.Is(err, ErrBookNotFound) {
 			return nil, ErrBookNotFound
 		}
 		return nil, fmt.Errorf("failed to get book by ISBN: %w", err)
 	}
-	return &book, nil
+	return book, nil
 }
 
-// GetByUserID retrieves book associated with a specific user ID.
-func (r *BookRepo) GetByUserID(ctx context.Context, userID string, page int64, limit int64) ([]*models.Book, error) {
-	findOptions := options.Find()
-	findOptions.SetSkip((page - 1) * limit)
-	findOptions.SetLimit(limit)
+// GetByISBNAndUser retrieves a book with the given ISBN from a user's library.
+func (r *BookRepo) GetByISBNAndUser(ctx context.Context, isbn, userID string) (*models.Book, error) {
+	book, err := r.findOne(ctx, bson.M{"isbn": isbn, "user_id": userID})
+	if err != nil {
+		if errors.Is(err, ErrBookNotFound) {
+			return nil, ErrBookNotFound
+		}
+		return nil, fmt.Errorf("failed to get book by ISBN and user: %w", err)
+	}
+	return book, nil
+}
 
-	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, findOptions)
+// GetByUserID retrieves a page of books associated with a specific user ID.
+func (r *BookRepo) GetByUserID(ctx context.Context, userID string, opts *models.BookListOptions) (*models.BookPage, error) {
+	page, err := r.find(ctx, bson.M{"user_id": userID}, listFilter(opts), opts)
 	if err != nil {
+		r.log.Error("failed to get book by user id", slog.Any("error", err))
 		return nil, fmt.Errorf("failed to get book by user ID: %w", err)
 	}
-	defer cursor.Close(ctx)
 
-	var books []*models.Book
-	if err = cursor.All(ctx, &books); err != nil {
-		return nil, fmt.Errorf("failed to decode book: %w", err)
+	return page, nil
+}
+
+// GetByBookshelfID retrieves a page of books belonging to a specific bookshelf ID.
+func (r *BookRepo) GetByBookshelfID(ctx context.Context, bookshelfID string, opts *models.BookListOptions) (*models.BookPage, error) {
+	page, err := r.find(ctx, bson.M{"bookshelf_ids": bookshelfID}, listFilter(opts), opts.OnBookshelf(bookshelfID))
+	if err != nil {
+		r.log.Error("failed to get book by bookshelf id", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get book by bookshelf id: %w", err)
 	}
 
-	return books, nil
+	return page, nil
 }
 
-// GetByBookshelfID retrieves book belonging to a specific bookshelf ID.
-func (r *BookRepo) GetByBookshelfID(ctx context.Context, bookshelfID string, page int64, limit int64) ([]*models.Book, error) {
-	matchStage := bson.D{{"$match", bson.D{{"bookshelf_id", bookshelfID}}}}
-	skipStage := bson.D{{"$skip", (page - 1) * limit}}
-	limitStage := bson.D{{"$limit", limit}}
+// GetByBookshelves retrieves a page of the books on any of the bookshelves.
+func (r *BookRepo) GetByBookshelves(ctx context.Context, bookshelfIDs []string, opts *models.BookListOptions) (*models.BookPage, error) {
+	page, err := r.find(ctx, bson.M{"bookshelf_ids": bson.M{"$in": bookshelfIDs}}, listFilter(opts), opts)
+	if err != nil {
+		r.log.Error("failed to get books by bookshelves", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get books by bookshelves: %w", err)
+	}
+
+	return page, nil
+}
 
-	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{matchStage, skipStage, limitStage})
+// findOne returns the first book matching the filter, merged with its catalog
+// entry.
+func (r *BookRepo) findOne(ctx context.Context, filter bson.M) (*models.Book, error) {
+	var book models.Book
+	err := r.collection.FindOne(ctx, filter).Decode(&book)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrBookNotFound
+	}
 	if err != nil {
-		r.log.Error("failed to get book by bookshelf id", slog.Any("error", err))
-		return nil, fmt.Errorf("failed to get book by bookshelf id: %w", err)
+		return nil, err
+	}
+	if err := r.merge(ctx, []*models.Book{&book}); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// find runs a sorted query, paginated either by offset or by keyset position,
+// and counts all books matching the filter. The query runs on the copies of
+// the catalog metadata the books hold, so it can use their indexes; the books
+// of the page are then merged with their catalog entries.
+func (r *BookRepo) find(ctx context.Context, base, filter bson.M, opts *models.BookListOptions) (*models.BookPage, error) {
+	filter = bson.M{"$and": bson.A{base, filter}}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count books: %w", err)
+	}
+
+	query, findOptions := pageQuery(filter, opts.Sort, opts.Order, opts.Page, opts.Limit, opts.Position)
+
+	cursor, err := r.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find books: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var books []*models.Book
+	books := []*models.Book{}
 	if err = cursor.All(ctx, &books); err != nil {
 		return nil, fmt.Errorf("failed to decode book: %w", err)
 	}
 
-	return books, nil
+	page := &models.BookPage{Total: total}
+	if opts.Position == nil {
+		page.HasMore = (opts.Page-1)*opts.Limit+int64(len(books)) < total
+	} else if int64(len(books)) > opts.Limit {
+		page.HasMore = true
+		books = books[:opts.Limit]
+	}
+	if opts.Position != nil && opts.Position.Backward {
+		slices.Reverse(books)
+	}
+	if err := r.merge(ctx, books); err != nil {
+		return nil, err
+	}
+	page.Books = books
+
+	return page, nil
+}
+
+// merge sets the fields the users have not overridden to the values of the
+// catalog entries of the books, so reads show catalog corrections at once.
+// Books whose entry is gone keep their values.
+func (r *BookRepo) merge(ctx context.Context, books []*models.Book) error {
+	ids := bson.A{}
+	for _, book := range books {
+		if book.CatalogID != "" {
+			ids = append(ids, book.CatalogID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	cursor, err := r.catalog.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return fmt.Errorf("failed to find catalog entries: %w", err)
+	}
+	var entries []*models.CatalogEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return fmt.Errorf("failed to decode catalog entry: %w", err)
+	}
+
+	byID := make(map[string]*models.CatalogEntry, len(entries))
+	for _, entry := range entries {
+		byID[entry.ID] = entry
+	}
+	for _, book := range books {
+		if entry, ok := byID[book.CatalogID]; ok {
+			book.Merge(entry)
+		}
+	}
+	return nil
+}
+
+// listFilter translates the filters of a book list into a MongoDB query.
+func listFilter(opts *models.BookListOptions) bson.M {
+	if opts.ShelfFilter == nil {
+		return bookFilter(opts.Filter)
+	}
+	return bson.M{"$and": bson.A{bookFilter(*opts.ShelfFilter), bookFilter(opts.Filter)}}
+}
+
+// bookFilter translates a models.BookFilter into a MongoDB query. Strings are
+// only ever compared as values, and quoted in regular expressions, so they
+// cannot inject operators.
+func bookFilter(f models.BookFilter) bson.M {
+	filter := bson.M{}
+
+	if f.Author != "" {
+		filter["author"] = primitive.Regex{Pattern: regexp.QuoteMeta(f.Author), Options: "i"}
+	}
+	if f.Publisher != "" {
+		filter["publishing"] = primitive.Regex{Pattern: regexp.QuoteMeta(f.Publisher), Options: "i"}
+	}
+	if f.ShopName != "" {
+		filter["shop_name"] = f.ShopName
+	}
+	if f.Tag != "" {
+		filter["tags"] = f.Tag
+	}
+	if f.HasCover != nil {
+		if *f.HasCover {
+			filter["cover_image"] = bson.M{"$nin": bson.A{"", nil}}
+		} else {
+			filter["cover_image"] = bson.M{"$in": bson.A{"", nil}}
+		}
+	}
+
+	createdAt := bson.M{}
+	if f.CreatedFrom != nil {
+		createdAt["$gte"] = *f.CreatedFrom
+	}
+	if f.CreatedTo != nil {
+		createdAt["$lte"] = *f.CreatedTo
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	return filter
 }
 
 // CountInBookshelf returns the number of book in a bookshelf.
 func (r *BookRepo) CountInBookshelf(ctx context.Context, bookshelfID string) (int, error) {
-	count, err := r.collection.CountDocuments(ctx, bson.M{"bookshelf_id": bookshelfID})
+	count, err := r.collection.CountDocuments(ctx, bson.M{"bookshelf_ids": bookshelfID})
 	if err != nil {
 		r.log.Error("failed to count book by bookshelf ID", slog.Any("error", err))
 		return 0, fmt.Errorf("failed to count book by bookshelf ID: %w", err)
@@ -135,7 +292,7 @@ func (r *BookRepo) CountInBookshelf(ctx context.Context, bookshelfID string) (in
 
 // ExistsInBookshelf checks if a book with the given ISBN already exists in the bookshelf.
 func (r *BookRepo) ExistsInBookshelf(ctx context.Context, isbn, bookshelfID string) (bool, error) {
-	count, err := r.collection.CountDocuments(ctx, bson.M{"isbn": isbn, "bookshelf_id": bookshelfID})
+	count, err := r.collection.CountDocuments(ctx, bson.M{"isbn": isbn, "bookshelf_ids": bookshelfID})
 	if err != nil {
 		r.log.Error("failed to check book existence", slog.Any("error", err))
 		return false, fmt.Errorf("failed to check book existence: %w", err)
@@ -147,24 +304,237 @@ func (r *BookRepo) ExistsInBookshelf(ctx context.Context, isbn, bookshelfID stri
 // Update updates a book in the database.
 func (r *BookRepo) Update(ctx context.Context, id string, update *models.BookUpdate) error {
 	update.UpdatedAt = time.Now()
-	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
+	if len(update.Shelves) == 0 {
+		return updateBook(ctx, r.collection, id, update)
+	}
+
+	// Shelf changes need a transaction, and so a replica set.
+	session, err := r.collection.Database().Client().StartSession()
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return ErrBookNotFound
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if err := updateBook(sc, r.collection, id, update); err != nil {
+			return nil, err
 		}
+		return nil, reshelve(sc, r.collection, update.Shelves, update.UpdatedAt)
+	})
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrBookNotFound), errors.Is(err, ErrBookAlreadyExists):
+		return err
+	default:
+		r.log.Error("failed to update book", slog.Any("error", err))
 		return fmt.Errorf("failed to update book: %w", err)
 	}
+}
+
+// updateBook sets the fields of a book.
+func updateBook(ctx context.Context, books *mongo.Collection, id string, update *models.BookUpdate) error {
+	res, err := books.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
+	if err != nil {
+		// The book got an ISBN one of its shelves already holds.
+		var writeErr mongo.WriteException
+		if errors.As(err, &writeErr) && writeErr.WriteErrors[0].Code == 11000 {
+			return ErrBookAlreadyExists
+		}
+		return fmt.Errorf("failed to update book: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrBookNotFound
+	}
 	return nil
 }
 
-// Delete removes a book from the database.
-func (r *BookRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+// SyncCatalog copies the metadata of a catalog entry to the books linked to
+// it, except for the fields their users have overridden.
+func (r *BookRepo) SyncCatalog(ctx context.Context, entry *models.CatalogEntry) error {
+	view := entry.Book()
+	values := map[string]string{
+		models.FieldTitle:       view.Title,
+		models.FieldAuthor:      view.Author,
+		models.FieldPublishing:  view.Publishing,
+		models.FieldDescription: view.Description,
+		models.FieldCoverImage:  view.CoverImage,
+		models.FieldShopName:    view.ShopName,
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(values))
+	for name, value := range values {
+		writes = append(writes, mongo.NewUpdateManyModel().
+			SetFilter(bson.M{"catalog_id": entry.ID, "overrides": bson.M{"$ne": name}}).
+			SetUpdate(bson.M{"$set": bson.M{name: value}}))
+	}
+	if _, err := r.collection.BulkWrite(ctx, writes); err != nil {
+		r.log.Error("failed to sync books with catalog", slog.Any("error", err))
+		return fmt.Errorf("failed to sync books with catalog: %w", err)
+	}
+	return nil
+}
+
+// Reshelve applies the shelf changes and records them in the history of the
+// books, in one transaction. Transactions need a replica set.
+func (r *BookRepo) Reshelve(ctx context.Context, changes []models.ShelfChange) error {
+	session, err := r.collection.Database().Client().StartSession()
 	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, reshelve(sc, r.collection, changes, time.Now())
+	})
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrBookNotFound), errors.Is(err, ErrBookAlreadyExists):
+		return err
+	default:
+		r.log.Error("failed to reshelve books", slog.Any("error", err))
+		return fmt.Errorf("failed to reshelve books: %w", err)
+	}
+}
+
+// reshelve applies shelf changes to the books of a collection within a
+// transaction. It fails, so that the transaction is aborted, when a book is
+// missing or a bookshelf would hold an ISBN twice.
+func reshelve(ctx context.Context, books *mongo.Collection, changes []models.ShelfChange, at time.Time) error {
+	positions, err := document.Placements(changes, lastPosition(ctx, books))
+	if err != nil {
+		return err
+	}
+
+	for i, change := range changes {
+		var doc models.Book
+		err := books.FindOne(ctx, bson.M{"_id": change.BookID}).Decode(&doc)
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return ErrBookNotFound
 		}
+		if err != nil {
+			return err
+		}
+		if !document.Reshelve(&doc, change, positions[i], at) {
+			continue
+		}
+		// A null positions field could not take the position of a later shelf.
+		if doc.Positions == nil {
+			doc.Positions = map[string]string{}
+		}
+
+		_, err = books.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{
+			"bookshelf_ids": doc.BookshelfIDs,
+			"positions":     doc.Positions,
+			"history":       doc.History,
+			"updated_at":    doc.UpdatedAt,
+		}})
+		if err != nil {
+			var writeErr mongo.WriteException
+			if errors.As(err, &writeErr) && writeErr.WriteErrors[0].Code == 11000 {
+				return ErrBookAlreadyExists
+			}
+			return err
+		}
+	}
+
+	// The unique index catches the duplicates too, but only once it is built.
+	for _, change := range changes {
+		if change.To == "" {
+			continue
+		}
+		cursor, err := books.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"bookshelf_ids": change.To, "isbn": bson.M{"$gt": ""}}}},
+			{{Key: "$group", Value: bson.M{"_id": "$isbn", "count": bson.M{"$sum": 1}}}},
+			{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+			{{Key: "$limit", Value: 1}},
+		})
+		if err != nil {
+			return err
+		}
+		duplicate := cursor.Next(ctx)
+		err = cursor.Err()
+		_ = cursor.Close(ctx)
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			return ErrBookAlreadyExists
+		}
+	}
+	return nil
+}
+
+// lastPosition returns a function that finds the largest position on a
+// bookshelf among the books of a collection.
+func lastPosition(ctx context.Context, books *mongo.Collection) func(string) (string, error) {
+	return func(bookshelfID string) (string, error) {
+		field := models.PositionField(bookshelfID)
+		var doc models.Book
+		err := books.FindOne(ctx, bson.M{"bookshelf_ids": bookshelfID},
+			options.FindOne().SetSort(bson.D{{Key: field, Value: -1}}).SetProjection(bson.M{field: 1}),
+		).Decode(&doc)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return doc.Positions[bookshelfID], nil
+	}
+}
+
+// Positions returns the positions of the books on a bookshelf, in order.
+func (r *BookRepo) Positions(ctx context.Context, bookshelfID string) ([]models.Position, error) {
+	field := models.PositionField(bookshelfID)
+	cursor, err := r.collection.Find(ctx, bson.M{"bookshelf_ids": bookshelfID},
+		options.Find().SetSort(sortSpec(field, models.SortAsc)).SetProjection(bson.M{field: 1}))
+	if err != nil {
+		r.log.Error("failed to get book positions", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get book positions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []models.Book
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode book positions: %w", err)
+	}
+	positions := make([]models.Position, 0, len(docs))
+	for _, doc := range docs {
+		positions = append(positions, models.Position{ID: doc.ID, Key: doc.Positions[bookshelfID]})
+	}
+	return positions, nil
+}
+
+// SetPositions sets the positions of books on a bookshelf. Books that are
+// no longer on it are skipped.
+func (r *BookRepo) SetPositions(ctx context.Context, bookshelfID string, positions map[string]string) error {
+	if len(positions) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(positions))
+	for id, position := range positions {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id, "bookshelf_ids": bookshelfID}).
+			SetUpdate(bson.M{"$set": bson.M{models.PositionField(bookshelfID): position}}))
+	}
+	if _, err := r.collection.BulkWrite(ctx, writes); err != nil {
+		r.log.Error("failed to set book positions", slog.Any("error", err))
+		return fmt.Errorf("failed to set book positions: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a book from the database.
+func (r *BookRepo) Delete(ctx context.Context, id string) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
 		return fmt.Errorf("failed to delete book: %w", err)
 	}
+	if res.DeletedCount == 0 {
+		return ErrBookNotFound
+	}
 	return nil
 }
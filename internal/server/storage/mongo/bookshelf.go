@@ -1,28 +1,41 @@
 package mongo
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/getz-devs/librakeeper-server/internal/server/models"
 	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/lib/fracindex"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log/slog"
+	"slices"
 	"time"
 )
 
 // ErrBookshelfNotFound occurs when a bookshelf is not found in the database.
-var ErrBookshelfNotFound = errors.New("bookshelf not found")
+var ErrBookshelfNotFound = repository.ErrBookshelfNotFound
 
 // ErrBookshelfAlreadyExists occurs when trying to create a bookshelf with an ID that already exists.
-var ErrBookshelfAlreadyExists = errors.New("bookshelf already exists")
+var ErrBookshelfAlreadyExists = repository.ErrBookshelfAlreadyExists
+
+// ErrBookshelfNotEmpty occurs when refusing to delete a bookshelf that holds books.
+var ErrBookshelfNotEmpty = repository.ErrBookshelfNotEmpty
+
+// ErrBookshelfHasChildren occurs when refusing to delete a bookshelf that other bookshelves are nested in.
+var ErrBookshelfHasChildren = repository.ErrBookshelfHasChildren
+
+// ErrBookshelfLimitReached occurs when moving books would put more than the book limit on a bookshelf.
+var ErrBookshelfLimitReached = repository.ErrBookshelfLimitReached
 
 // BookshelfRepo implements the repository.BookshelfRepo interface for MongoDB.
 type BookshelfRepo struct {
 	collection *mongo.Collection
+	books      *mongo.Collection
 	log        *slog.Logger
 }
 
@@ -30,6 +43,7 @@ type BookshelfRepo struct {
 func NewBookshelfRepo(db *mongo.Database, log *slog.Logger) repository.BookshelfRepo {
 	return &BookshelfRepo{
 		collection: db.Collection("bookshelf"),
+		books:      db.Collection(BooksCollection),
 		log:        log,
 	}
 }
@@ -40,7 +54,14 @@ func (r *BookshelfRepo) Create(ctx context.Context, bookshelf *models.Bookshelf)
 	bookshelf.CreatedAt = time.Now()
 	bookshelf.UpdatedAt = time.Now()
 
-	_, err := r.collection.InsertOne(ctx, bookshelf)
+	position, err := r.nextPosition(ctx, bookshelf.UserID, bookshelf.ParentID)
+	if err != nil {
+		r.log.Error("failed to place bookshelf", slog.Any("error", err))
+		return fmt.Errorf("failed to place bookshelf: %w", err)
+	}
+	bookshelf.Position = position
+
+	_, err = r.collection.InsertOne(ctx, bookshelf)
 	if err != nil {
 		// Check for duplicate key error
 		var writeErr mongo.WriteException
@@ -59,7 +80,6 @@ func (r *BookshelfRepo) Create(ctx context.Context, bookshelf *models.Bookshelf)
 func (r *BookshelfRepo) GetByID(ctx context.Context, id string) (*models.Bookshelf, error) {
 	var bookshelf models.Bookshelf
 	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&bookshelf)
-	fmt.Printf("%+v\n", bookshelf)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, ErrBookshelfNotFound
@@ -70,25 +90,46 @@ func (r *BookshelfRepo) GetByID(ctx context.Context, id string) (*models.Bookshe
 	return &bookshelf, nil
 }
 
-// GetByUser retrieves bookshelf associated with a specific user ID.
-func (r *BookshelfRepo) GetByUser(ctx context.Context, userID string, page int64, limit int64) ([]*models.Bookshelf, error) {
-	findOptions := options.Find()
-	findOptions.SetSkip((page - 1) * limit)
-	findOptions.SetLimit(limit)
+// GetByUser retrieves a page of bookshelves associated with a specific user ID.
+func (r *BookshelfRepo) GetByUser(ctx context.Context, userID string, opts *models.BookshelfListOptions) (*models.BookshelfPage, error) {
+	filter := bson.M{"user_id": userID}
+	if opts.ParentID != nil {
+		filter["parent_id"] = *opts.ParentID
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		r.log.Error("failed to count bookshelf by user ID", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to count bookshelf by user ID: %w", err)
+	}
 
-	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, findOptions)
+	query, findOptions := pageQuery(filter, opts.Sort, opts.Order, opts.Page, opts.Limit, opts.Position)
+
+	cursor, err := r.collection.Find(ctx, query, findOptions)
 	if err != nil {
 		r.log.Error("failed to get bookshelf by user ID", slog.Any("error", err))
 		return nil, fmt.Errorf("failed to get bookshelf by user ID: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var bookshelves []*models.Bookshelf
+	bookshelves := []*models.Bookshelf{}
 	if err = cursor.All(ctx, &bookshelves); err != nil {
 		return nil, fmt.Errorf("failed to decode bookshelf: %w", err)
 	}
 
-	return bookshelves, nil
+	page := &models.BookshelfPage{Total: total}
+	if opts.Position == nil {
+		page.HasMore = (opts.Page-1)*opts.Limit+int64(len(bookshelves)) < total
+	} else if int64(len(bookshelves)) > opts.Limit {
+		page.HasMore = true
+		bookshelves = bookshelves[:opts.Limit]
+	}
+	if opts.Position != nil && opts.Position.Backward {
+		slices.Reverse(bookshelves)
+	}
+	page.Bookshelves = bookshelves
+
+	return page, nil
 }
 
 // CountByUser returns the number of bookshelf owned by a user.
@@ -102,38 +143,328 @@ func (r *BookshelfRepo) CountByUser(ctx context.Context, userID string) (int, er
 	return int(count), nil
 }
 
-// ExistsByNameAndUser checks if a bookshelf with the given name already exists for a user.
-func (r *BookshelfRepo) ExistsByNameAndUser(ctx context.Context, name, userID string) (bool, error) {
-	count, err := r.collection.CountDocuments(ctx, bson.M{"name": name, "user_id": userID})
+// ExistsByNameAndParent checks if a bookshelf with the given name is nested in the parent.
+func (r *BookshelfRepo) ExistsByNameAndParent(ctx context.Context, name, userID, parentID string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"name": name, "user_id": userID, "parent_id": parentID})
 	if err != nil {
-		r.log.Error("failed to check bookshelf existence by name and user", slog.Any("error", err))
-		return false, fmt.Errorf("failed to check bookshelf existence by name and user: %w", err)
+		r.log.Error("failed to check bookshelf existence by name and parent", slog.Any("error", err))
+		return false, fmt.Errorf("failed to check bookshelf existence by name and parent: %w", err)
 	}
 
 	return count > 0, nil
 }
 
+// GetSubtree returns the bookshelf and the bookshelves nested in it, found
+// by a $graphLookup over parent_id.
+func (r *BookshelfRepo) GetSubtree(ctx context.Context, id string) ([]*models.Bookshelf, error) {
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": id}}},
+		{{Key: "$graphLookup", Value: bson.M{
+			"from":             r.collection.Name(),
+			"startWith":        "$_id",
+			"connectFromField": "_id",
+			"connectToField":   "parent_id",
+			"as":               "nested",
+			"depthField":       "depth",
+		}}},
+	})
+	if err != nil {
+		r.log.Error("failed to get nested bookshelves", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get nested bookshelves: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	type nested struct {
+		models.Bookshelf `bson:",inline"`
+		Depth            int64 `bson:"depth"`
+	}
+	var roots []struct {
+		models.Bookshelf `bson:",inline"`
+		Nested           []nested `bson:"nested"`
+	}
+	if err := cursor.All(ctx, &roots); err != nil {
+		return nil, fmt.Errorf("failed to decode nested bookshelves: %w", err)
+	}
+	if len(roots) == 0 {
+		return nil, ErrBookshelfNotFound
+	}
+
+	// $graphLookup returns the nested bookshelves in no particular order.
+	slices.SortFunc(roots[0].Nested, func(a, b nested) int {
+		if a.Depth != b.Depth {
+			return cmp.Compare(a.Depth, b.Depth)
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	subtree := []*models.Bookshelf{&roots[0].Bookshelf}
+	for i := range roots[0].Nested {
+		subtree = append(subtree, &roots[0].Nested[i].Bookshelf)
+	}
+	return subtree, nil
+}
+
+// CountBooks returns the number of books of BooksCollection on any of the bookshelves.
+func (r *BookshelfRepo) CountBooks(ctx context.Context, ids []string) (int, error) {
+	count, err := r.books.CountDocuments(ctx, bson.M{"bookshelf_ids": bson.M{"$in": ids}})
+	if err != nil {
+		r.log.Error("failed to count books in bookshelves", slog.Any("error", err))
+		return 0, fmt.Errorf("failed to count books in bookshelves: %w", err)
+	}
+
+	return int(count), nil
+}
+
+// CountBooksByGroup returns, for every group of bookshelves, the number of
+// books of BooksCollection on any of its bookshelves. Every book is matched
+// against all groups at once and counted once per group it is in.
+func (r *BookshelfRepo) CountBooksByGroup(ctx context.Context, groups map[string][]string) (map[string]int, error) {
+	counts := make(map[string]int, len(groups))
+	var all []string
+	spec := bson.A{}
+	for key, ids := range groups {
+		counts[key] = 0
+		all = append(all, ids...)
+		spec = append(spec, bson.M{"key": key, "ids": ids})
+	}
+	if len(all) == 0 {
+		return counts, nil
+	}
+
+	cursor, err := r.books.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"bookshelf_ids": bson.M{"$in": all}}}},
+		{{Key: "$project", Value: bson.M{"group": bson.M{"$filter": bson.M{
+			"input": bson.M{"$literal": spec},
+			"cond": bson.M{"$gt": bson.A{
+				bson.M{"$size": bson.M{"$setIntersection": bson.A{"$bookshelf_ids", "$$this.ids"}}},
+				0,
+			}},
+		}}}}},
+		{{Key: "$unwind", Value: "$group"}},
+		{{Key: "$group", Value: bson.M{"_id": "$group.key", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		r.log.Error("failed to count books by group", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to count books by group: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Key   string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode book counts: %w", err)
+	}
+	for _, group := range result {
+		counts[group.Key] = group.Count
+	}
+	return counts, nil
+}
+
 // Update updates a bookshelf in the database.
 func (r *BookshelfRepo) Update(ctx context.Context, id string, update *models.BookshelfUpdate) error {
 	update.UpdatedAt = time.Now()
-	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
-	if err != nil {
+	if update.ParentID != nil {
+		var doc models.Bookshelf
+		err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return ErrBookshelfNotFound
 		}
+		if err != nil {
+			return fmt.Errorf("failed to get bookshelf: %w", err)
+		}
+		position, err := r.nextPosition(ctx, doc.UserID, *update.ParentID)
+		if err != nil {
+			return fmt.Errorf("failed to place bookshelf: %w", err)
+		}
+		update.Position = &position
+	}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
+	if err != nil {
+		// The bookshelf was renamed to the name of another one of the user's.
+		var writeErr mongo.WriteException
+		if errors.As(err, &writeErr) && writeErr.WriteErrors[0].Code == 11000 {
+			return ErrBookshelfAlreadyExists
+		}
 		return fmt.Errorf("failed to update bookshelf: %w", err)
 	}
+	if res.MatchedCount == 0 {
+		return ErrBookshelfNotFound
+	}
 	return nil
 }
 
+// Positions returns the positions of the bookshelves of a user nested
+// directly in the parent, in order.
+func (r *BookshelfRepo) Positions(ctx context.Context, userID, parentID string) ([]models.Position, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID, "parent_id": parentID},
+		options.Find().SetSort(sortSpec("position", models.SortAsc)).SetProjection(bson.M{"position": 1}))
+	if err != nil {
+		r.log.Error("failed to get bookshelf positions", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get bookshelf positions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []models.Bookshelf
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode bookshelf positions: %w", err)
+	}
+	positions := make([]models.Position, 0, len(docs))
+	for _, doc := range docs {
+		positions = append(positions, models.Position{ID: doc.ID, Key: doc.Position})
+	}
+	return positions, nil
+}
+
+// SetPositions sets the positions of bookshelves. Missing bookshelves are
+// skipped.
+func (r *BookshelfRepo) SetPositions(ctx context.Context, positions map[string]string) error {
+	if len(positions) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(positions))
+	for id, position := range positions {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$set": bson.M{"position": position}}))
+	}
+	if _, err := r.collection.BulkWrite(ctx, writes); err != nil {
+		r.log.Error("failed to set bookshelf positions", slog.Any("error", err))
+		return fmt.Errorf("failed to set bookshelf positions: %w", err)
+	}
+	return nil
+}
+
+// nextPosition returns the position at the end of the bookshelves of a user
+// nested directly in the parent.
+func (r *BookshelfRepo) nextPosition(ctx context.Context, userID, parentID string) (string, error) {
+	var last models.Bookshelf
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID, "parent_id": parentID},
+		options.FindOne().SetSort(bson.D{{Key: "position", Value: -1}}).SetProjection(bson.M{"position": 1}),
+	).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", err
+	}
+	return fracindex.Between(last.Position, "")
+}
+
 // Delete removes a bookshelf from the database.
 func (r *BookshelfRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return ErrBookshelfNotFound
-		}
 		return fmt.Errorf("failed to delete bookshelf: %w", err)
 	}
+	if res.DeletedCount == 0 {
+		return ErrBookshelfNotFound
+	}
+	return nil
+}
+
+// DeleteWithBooks deletes a bookshelf and refuses, deletes or moves the books
+// of BooksCollection on it, in one transaction. Transactions need a replica
+// set; a single node can run as a one-member replica set.
+func (r *BookshelfRepo) DeleteWithBooks(ctx context.Context, id string, opts *models.BookshelfDeleteOptions) (*models.BookshelfDeleteResult, error) {
+	session, err := r.collection.Database().Client().StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	var result *models.BookshelfDeleteResult
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		// The callback is retried on transient errors, so it starts afresh.
+		result = &models.BookshelfDeleteResult{BookshelfID: id, Mode: opts.Mode}
+		return nil, r.deleteWithBooks(sc, id, opts, result)
+	})
+	switch {
+	case err == nil:
+		return result, nil
+	case errors.Is(err, ErrBookshelfNotFound), errors.Is(err, ErrBookshelfNotEmpty), errors.Is(err, ErrBookshelfHasChildren),
+		errors.Is(err, ErrBookAlreadyExists), errors.Is(err, ErrBookshelfLimitReached):
+		return nil, err
+	default:
+		r.log.Error("failed to delete bookshelf", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to delete bookshelf: %w", err)
+	}
+}
+
+// deleteWithBooks runs the steps of DeleteWithBooks within a transaction.
+func (r *BookshelfRepo) deleteWithBooks(ctx context.Context, id string, opts *models.BookshelfDeleteOptions, result *models.BookshelfDeleteResult) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrBookshelfNotFound
+	}
+	children, err := r.collection.CountDocuments(ctx, bson.M{"parent_id": id})
+	if err != nil {
+		return err
+	}
+	if children > 0 {
+		return ErrBookshelfHasChildren
+	}
+
+	// Moved books keep their order behind those on the target.
+	cursor, err := r.books.Find(ctx, bson.M{"bookshelf_ids": id},
+		options.Find().SetSort(sortSpec(models.PositionField(id), models.SortAsc)))
+	if err != nil {
+		return err
+	}
+	var onShelf []models.Book
+	if err := cursor.All(ctx, &onShelf); err != nil {
+		return err
+	}
+
+	switch opts.Mode {
+	case models.DeleteModeCascade:
+		// Books on other bookshelves too only leave this one.
+		var kept []models.ShelfChange
+		for _, doc := range onShelf {
+			if len(doc.BookshelfIDs) > 1 {
+				kept = append(kept, models.ShelfChange{BookID: doc.ID, From: id})
+			}
+		}
+		if err := reshelve(ctx, r.books, kept, time.Now()); err != nil {
+			return err
+		}
+		res, err := r.books.DeleteMany(ctx, bson.M{"bookshelf_ids": bson.A{id}})
+		if err != nil {
+			return err
+		}
+		result.BooksKept = len(kept)
+		result.BooksDeleted = int(res.DeletedCount)
+	case models.DeleteModeMove:
+		if opts.TargetID != "" && opts.BookLimit > 0 {
+			total, err := r.books.CountDocuments(ctx, bson.M{"bookshelf_ids": opts.TargetID})
+			if err != nil {
+				return err
+			}
+			for _, doc := range onShelf {
+				if !slices.Contains(doc.BookshelfIDs, opts.TargetID) {
+					total++
+				}
+			}
+			if total > int64(opts.BookLimit) {
+				return ErrBookshelfLimitReached
+			}
+		}
+		changes := make([]models.ShelfChange, 0, len(onShelf))
+		for _, doc := range onShelf {
+			changes = append(changes, models.ShelfChange{BookID: doc.ID, From: id, To: opts.TargetID})
+		}
+		if err := reshelve(ctx, r.books, changes, time.Now()); err != nil {
+			return err
+		}
+		result.BooksMoved = len(onShelf)
+		result.TargetBookshelfID = opts.TargetID
+	default:
+		if len(onShelf) > 0 {
+			return ErrBookshelfNotEmpty
+		}
+	}
+
 	return nil
 }
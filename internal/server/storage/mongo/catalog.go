@@ -0,0 +1,99 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	isbnlib "github.com/getz-devs/librakeeper-server/lib/isbn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log/slog"
+	"time"
+)
+
+// CatalogCollection is the collection of the shared book catalog.
+const CatalogCollection = "all_books"
+
+// ErrCatalogEntryNotFound occurs when a catalog entry is not found in the database.
+var ErrCatalogEntryNotFound = repository.ErrCatalogEntryNotFound
+
+// ErrCatalogEntryAlreadyExists occurs when trying to create a catalog entry for an ISBN that already exists.
+var ErrCatalogEntryAlreadyExists = repository.ErrCatalogEntryAlreadyExists
+
+// CatalogRepo implements the repository.CatalogRepo interface for MongoDB.
+type CatalogRepo struct {
+	collection *mongo.Collection
+	log        *slog.Logger
+}
+
+// NewCatalogRepo creates a new CatalogRepo instance.
+func NewCatalogRepo(db *mongo.Database, log *slog.Logger) repository.CatalogRepo {
+	return &CatalogRepo{
+		collection: db.Collection(CatalogCollection),
+		log:        log,
+	}
+}
+
+// Create inserts a new catalog entry into the database.
+func (r *CatalogRepo) Create(ctx context.Context, entry *models.CatalogEntry) error {
+	entry.ID = primitive.NewObjectID().Hex()
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, entry)
+	if err != nil {
+		var writeErr mongo.WriteException
+		if errors.As(err, &writeErr) && writeErr.WriteErrors[0].Code == 11000 {
+			return ErrCatalogEntryAlreadyExists
+		}
+
+		r.log.Error("failed to create catalog entry", slog.Any("error", err))
+		return fmt.Errorf("failed to create catalog entry: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a catalog entry by its ID.
+func (r *CatalogRepo) GetByID(ctx context.Context, id string) (*models.CatalogEntry, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+// GetByISBN retrieves a catalog entry by an ISBN-10 or ISBN-13, with or without hyphens.
+func (r *CatalogRepo) GetByISBN(ctx context.Context, isbn string) (*models.CatalogEntry, error) {
+	isbn13, err := isbnlib.To13(isbn)
+	if err != nil {
+		isbn13 = isbnlib.Clean(isbn)
+	}
+	return r.findOne(ctx, bson.M{"isbn13": isbn13})
+}
+
+func (r *CatalogRepo) findOne(ctx context.Context, filter bson.M) (*models.CatalogEntry, error) {
+	var entry models.CatalogEntry
+	err := r.collection.FindOne(ctx, filter).Decode(&entry)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCatalogEntryNotFound
+		}
+		return nil, fmt.Errorf("failed to get catalog entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// AddEdition adds an edition to a catalog entry unless it is already listed.
+func (r *CatalogRepo) AddEdition(ctx context.Context, id string, edition models.Edition) error {
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$addToSet": bson.M{"editions": edition},
+		"$set":      bson.M{"updated_at": time.Now()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add edition: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrCatalogEntryNotFound
+	}
+	return nil
+}
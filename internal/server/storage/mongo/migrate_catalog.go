@@ -0,0 +1,142 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log/slog"
+	"time"
+)
+
+// CatalogMigrationResult reports what MigrateCatalog changed.
+type CatalogMigrationResult struct {
+	Converted int // legacy all_books records turned into catalog entries
+	Merged    int // legacy records merged into an entry with the same ISBN
+	Linked    int // user books linked to a catalog entry
+	Created   int // catalog entries created from user books
+}
+
+// MigrateCatalog converts legacy all_books records, which had the shape of a
+// user book, into catalog entries and links user books to the entries by ISBN.
+// User books with an ISBN missing from the catalog get a new entry built from
+// their metadata. Fields that differ from the catalog values become overrides;
+// the others follow later corrections. The migration can be run repeatedly.
+func MigrateCatalog(ctx context.Context, db *mongo.Database, log *slog.Logger) (*CatalogMigrationResult, error) {
+	const op = "mongo.MigrateCatalog"
+	log = log.With(slog.String("op", op))
+
+	catalog := NewCatalogRepo(db, log)
+	result := &CatalogMigrationResult{}
+
+	if err := convertLegacyCatalog(ctx, db.Collection(CatalogCollection), catalog, result); err != nil {
+		return result, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := linkUserBooks(ctx, db.Collection(BooksCollection), catalog, result); err != nil {
+		return result, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("catalog migration finished",
+		slog.Int("converted", result.Converted),
+		slog.Int("merged", result.Merged),
+		slog.Int("linked", result.Linked),
+		slog.Int("created", result.Created),
+	)
+	return result, nil
+}
+
+// convertLegacyCatalog rewrites all_books records without an isbn13 field.
+func convertLegacyCatalog(ctx context.Context, collection *mongo.Collection, catalog repository.CatalogRepo, result *CatalogMigrationResult) error {
+	cursor, err := collection.Find(ctx, bson.M{"isbn13": bson.M{"$exists": false}})
+	if err != nil {
+		return fmt.Errorf("failed to find legacy catalog records: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var legacy models.Book
+		if err := cursor.Decode(&legacy); err != nil {
+			return fmt.Errorf("failed to decode legacy catalog record: %w", err)
+		}
+
+		existing, err := catalog.GetByISBN(ctx, legacy.ISBN)
+		switch {
+		case err == nil:
+			// The same ISBN with other separators is already converted.
+			if err := catalog.AddEdition(ctx, existing.ID, models.EditionOf(&legacy)); err != nil {
+				return err
+			}
+			if _, err := collection.DeleteOne(ctx, bson.M{"_id": legacy.ID}); err != nil {
+				return fmt.Errorf("failed to delete legacy catalog record: %w", err)
+			}
+			result.Merged++
+			continue
+		case !errors.Is(err, ErrCatalogEntryNotFound):
+			return err
+		}
+
+		entry := models.NewCatalogEntry(&legacy)
+		entry.ID = legacy.ID
+		entry.CreatedAt = legacy.CreatedAt
+		entry.UpdatedAt = time.Now()
+
+		if _, err := collection.ReplaceOne(ctx, bson.M{"_id": legacy.ID}, entry); err != nil {
+			return fmt.Errorf("failed to convert catalog record %s: %w", legacy.ID, err)
+		}
+		result.Converted++
+	}
+
+	return cursor.Err()
+}
+
+// linkUserBooks links user books that have an ISBN but no catalog_id.
+func linkUserBooks(ctx context.Context, collection *mongo.Collection, catalog repository.CatalogRepo, result *CatalogMigrationResult) error {
+	cursor, err := collection.Find(ctx, bson.M{
+		"catalog_id": bson.M{"$exists": false},
+		"isbn":       bson.M{"$nin": bson.A{"", nil}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find unlinked user books: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var book models.Book
+		if err := cursor.Decode(&book); err != nil {
+			return fmt.Errorf("failed to decode user book: %w", err)
+		}
+
+		entry, err := catalog.GetByISBN(ctx, book.ISBN)
+		if errors.Is(err, ErrCatalogEntryNotFound) {
+			entry = models.NewCatalogEntry(&book)
+			if err = catalog.Create(ctx, entry); err == nil {
+				result.Created++
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		book.LinkCatalog(entry)
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": book.ID}, bson.M{"$set": bson.M{
+			"catalog_id":  book.CatalogID,
+			"title":       book.Title,
+			"author":      book.Author,
+			"publishing":  book.Publishing,
+			"description": book.Description,
+			"cover_image": book.CoverImage,
+			"shop_name":   book.ShopName,
+			"overrides":   book.Overrides,
+		}})
+		if err != nil {
+			return fmt.Errorf("failed to link user book %s: %w", book.ID, err)
+		}
+		result.Linked++
+	}
+
+	return cursor.Err()
+}
@@ -0,0 +1,176 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	isbnlib "github.com/getz-devs/librakeeper-server/lib/isbn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+)
+
+// normalizeBookISBNs rewrites the ISBNs of the user books in the canonical
+// ISBN-13 form, so the same book entered with and without hyphens, or as an
+// ISBN-10, is recognized as a duplicate. Invalid ISBNs are kept as they are.
+func normalizeBookISBNs(ctx context.Context, books *mongo.Collection, log *slog.Logger) error {
+	cursor, err := books.Find(ctx, bson.M{"isbn": bson.M{"$gt": ""}}, options.Find().SetProjection(bson.M{"isbn": 1}))
+	if err != nil {
+		return fmt.Errorf("failed to find user books: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	normalized := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID   interface{} `bson:"_id"`
+			ISBN string      `bson:"isbn"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode user book: %w", err)
+		}
+
+		isbn, err := isbnlib.Normalize(doc.ISBN)
+		if err != nil || isbn == doc.ISBN {
+			continue
+		}
+		if _, err := books.UpdateByID(ctx, doc.ID, bson.M{"$set": bson.M{"isbn": isbn}}); err != nil {
+			return fmt.Errorf("failed to normalize the ISBN of user book %v: %w", doc.ID, err)
+		}
+		normalized++
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to find user books: %w", err)
+	}
+
+	log.Info("normalized user book ISBNs", slog.Int("books", normalized))
+	return nil
+}
+
+// unshelveDuplicates takes the books that hold an ISBN a bookshelf already
+// holds off that bookshelf, so the unique index over the shelf field and the
+// ISBN can be built. The book added first stays; the others stay in the
+// library of the user. The field is the legacy bookshelf_id or bookshelf_ids.
+func unshelveDuplicates(ctx context.Context, books *mongo.Collection, field string, log *slog.Logger) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{field: bson.M{"$gt": ""}, "isbn": bson.M{"$gt": ""}}}},
+	}
+	if field == "bookshelf_ids" {
+		pipeline = append(pipeline, bson.D{{Key: "$unwind", Value: "$" + field}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"shelf": "$" + field, "isbn": "$isbn"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	)
+
+	cursor, err := books.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return fmt.Errorf("failed to find duplicate books: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	unshelved := 0
+	for cursor.Next(ctx) {
+		var group struct {
+			Key struct {
+				Shelf string `bson:"shelf"`
+				ISBN  string `bson:"isbn"`
+			} `bson:"_id"`
+			IDs []interface{} `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return fmt.Errorf("failed to decode duplicate books: %w", err)
+		}
+
+		update := bson.M{"$set": bson.M{field: ""}}
+		if field == "bookshelf_ids" {
+			update = bson.M{
+				"$pull":  bson.M{field: group.Key.Shelf},
+				"$unset": bson.M{"positions." + group.Key.Shelf: ""},
+			}
+		}
+		res, err := books.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}}, update)
+		if err != nil {
+			return fmt.Errorf("failed to unshelve duplicates of %s: %w", group.Key.ISBN, err)
+		}
+		unshelved += int(res.ModifiedCount)
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to find duplicate books: %w", err)
+	}
+
+	log.Info("unshelved duplicate books", slog.String("field", field), slog.Int("books", unshelved))
+	return nil
+}
+
+// renameDuplicateBookshelves renames the bookshelves whose name is taken by
+// another one with the same values of the scope fields, so the unique index
+// over them and the name can be built. The bookshelf created first keeps its
+// name; the others get a free one with a number, e.g. "Fiction (2)".
+func renameDuplicateBookshelves(ctx context.Context, bookshelves *mongo.Collection, log *slog.Logger, scope ...string) error {
+	key := bson.M{"name": "$name"}
+	for _, field := range scope {
+		key[field] = "$" + field
+	}
+
+	cursor, err := bookshelves.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   key,
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return fmt.Errorf("failed to find duplicate bookshelves: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	renamed := 0
+	for cursor.Next(ctx) {
+		var group struct {
+			Key bson.M        `bson:"_id"`
+			IDs []interface{} `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return fmt.Errorf("failed to decode duplicate bookshelves: %w", err)
+		}
+		name, _ := group.Key["name"].(string)
+
+		n := 2
+		for _, id := range group.IDs[1:] {
+			var candidate string
+			for ; ; n++ {
+				candidate = fmt.Sprintf("%s (%d)", name, n)
+				filter := bson.M{"name": candidate}
+				for _, field := range scope {
+					filter[field] = group.Key[field]
+				}
+				taken, err := bookshelves.CountDocuments(ctx, filter)
+				if err != nil {
+					return fmt.Errorf("failed to check bookshelf name: %w", err)
+				}
+				if taken == 0 {
+					break
+				}
+			}
+			if _, err := bookshelves.UpdateByID(ctx, id, bson.M{"$set": bson.M{"name": candidate}}); err != nil {
+				return fmt.Errorf("failed to rename bookshelf %v: %w", id, err)
+			}
+			renamed++
+			n++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to find duplicate bookshelves: %w", err)
+	}
+
+	log.Info("renamed duplicate bookshelves", slog.Int("bookshelves", renamed))
+	return nil
+}
@@ -0,0 +1,51 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+)
+
+// MigrateNesting puts the bookshelves stored before bookshelves could be
+// nested at the top level, and replaces the unique name per user index with
+// one per parent, renaming duplicates first. The migration can be run
+// repeatedly.
+func MigrateNesting(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+	const op = "mongo.MigrateNesting"
+	log = log.With(slog.String("op", op))
+	bookshelves := db.Collection("bookshelf")
+
+	res, err := bookshelves.UpdateMany(ctx, bson.M{"parent_id": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"parent_id": ""}})
+	if err != nil {
+		return fmt.Errorf("%s: failed to convert bookshelves: %w", op, err)
+	}
+
+	_, err = bookshelves.Indexes().DropOne(ctx, "user_id_1_name_1")
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound")) {
+		return fmt.Errorf("%s: failed to drop the name index: %w", op, err)
+	}
+
+	if err := renameDuplicateBookshelves(ctx, bookshelves, log, "user_id", "parent_id"); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = bookshelves.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Nested bookshelves are looked up by parent_id.
+		{Keys: bson.D{{Key: "parent_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "parent_id", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%s: failed to create the parent_id indexes: %w", op, err)
+	}
+
+	log.Info("nesting migration finished", slog.Int64("converted", res.ModifiedCount))
+	return nil
+}
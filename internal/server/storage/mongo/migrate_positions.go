@@ -0,0 +1,97 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/document"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log/slog"
+)
+
+// MigratePositions gives the books stored before bookshelves could be
+// ordered a position on each of their bookshelves, and the bookshelves a
+// position among those with the same parent, in the order they were added.
+// Positions that are already set are kept, so the migration can be run
+// repeatedly.
+func MigratePositions(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+	const op = "mongo.MigratePositions"
+	log = log.With(slog.String("op", op))
+	books := db.Collection(BooksCollection)
+	bookshelves := db.Collection("bookshelf")
+
+	bookshelfIDs, err := books.Distinct(ctx, "bookshelf_ids", bson.M{})
+	if err != nil {
+		return fmt.Errorf("%s: failed to list bookshelves of books: %w", op, err)
+	}
+	placedBooks := 0
+	for _, value := range bookshelfIDs {
+		bookshelfID, ok := value.(string)
+		if !ok {
+			continue
+		}
+		placed, err := positionBooks(ctx, books, bookshelfID)
+		if err != nil {
+			return fmt.Errorf("%s: failed to position books on %s: %w", op, bookshelfID, err)
+		}
+		placedBooks += placed
+	}
+
+	cursor, err := bookshelves.Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("%s: failed to read bookshelves: %w", op, err)
+	}
+	var docs []*models.Bookshelf
+	if err := cursor.All(ctx, &docs); err != nil {
+		return fmt.Errorf("%s: failed to decode bookshelves: %w", op, err)
+	}
+
+	type group struct{ userID, parentID string }
+	siblings := map[group][]*models.Bookshelf{}
+	for _, doc := range docs {
+		g := group{doc.UserID, doc.ParentID}
+		siblings[g] = append(siblings[g], doc)
+	}
+	placedBookshelves := 0
+	for _, docs := range siblings {
+		placed, err := document.BackfillBookshelves(docs)
+		if err != nil {
+			return fmt.Errorf("%s: failed to position bookshelves: %w", op, err)
+		}
+		for _, doc := range placed {
+			if _, err := bookshelves.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"position": doc.Position}}); err != nil {
+				return fmt.Errorf("%s: failed to position bookshelf %s: %w", op, doc.ID, err)
+			}
+		}
+		placedBookshelves += len(placed)
+	}
+
+	log.Info("positions migration finished", slog.Int("books", placedBooks), slog.Int("bookshelves", placedBookshelves))
+	return nil
+}
+
+// positionBooks gives the books on a bookshelf without a position there one,
+// and returns how many it changed.
+func positionBooks(ctx context.Context, books *mongo.Collection, bookshelfID string) (int, error) {
+	cursor, err := books.Find(ctx, bson.M{"bookshelf_ids": bookshelfID})
+	if err != nil {
+		return 0, err
+	}
+	var docs []*models.Book
+	if err := cursor.All(ctx, &docs); err != nil {
+		return 0, err
+	}
+
+	placed, err := document.BackfillBooks(docs, bookshelfID)
+	if err != nil {
+		return 0, err
+	}
+	field := models.PositionField(bookshelfID)
+	for _, doc := range placed {
+		if _, err := books.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{field: doc.Positions[bookshelfID]}}); err != nil {
+			return 0, err
+		}
+	}
+	return len(placed), nil
+}
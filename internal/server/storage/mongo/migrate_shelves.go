@@ -0,0 +1,63 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+)
+
+// MigrateShelves moves the single bookshelf_id of the user books stored before
+// books could be on several bookshelves into their bookshelf_ids, and replaces
+// the unique bookshelf index with one over bookshelf_ids, taking duplicates off
+// their bookshelves first. The migration can be run repeatedly.
+func MigrateShelves(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+	const op = "mongo.MigrateShelves"
+	log = log.With(slog.String("op", op))
+	books := db.Collection(BooksCollection)
+
+	res, err := books.UpdateMany(ctx, bson.M{"bookshelf_id": bson.M{"$exists": true}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"bookshelf_ids": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{"$bookshelf_id", ""}},
+			bson.A{"$bookshelf_id"},
+			bson.A{},
+		}}}}},
+		{{Key: "$unset", Value: "bookshelf_id"}},
+	})
+	if err != nil {
+		return fmt.Errorf("%s: failed to convert books: %w", op, err)
+	}
+
+	_, err = books.Indexes().DropOne(ctx, "bookshelf_id_1_isbn_1")
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound")) {
+		return fmt.Errorf("%s: failed to drop the bookshelf_id index: %w", op, err)
+	}
+
+	// Books written by a build that did not check the shelf may hold an ISBN twice.
+	if err := unshelveDuplicates(ctx, books, "bookshelf_ids", log); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = books.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "bookshelf_ids", Value: 1}}},
+		// A book is on a shelf at most once. Books without a shelf or an
+		// ISBN are not indexed.
+		{
+			Keys: bson.D{{Key: "bookshelf_ids", Value: 1}, {Key: "isbn", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"bookshelf_ids.0": bson.M{"$exists": true},
+				"isbn":            bson.M{"$gt": ""},
+			}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%s: failed to create the bookshelf_ids indexes: %w", op, err)
+	}
+
+	log.Info("shelf migration finished", slog.Int64("converted", res.ModifiedCount))
+	return nil
+}
@@ -0,0 +1,105 @@
+package mongo
+
+import (
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/lib/mongomigrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+)
+
+// MigrationsCollection records the migrations applied to the database.
+const MigrationsCollection = "schema_migrations"
+
+// migrations are applied in order; new ones go at the end.
+var migrations = []mongomigrate.Migration{
+	{
+		Name: "link user books to the catalog",
+		Up: func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+			_, err := MigrateCatalog(ctx, db, log)
+			return err
+		},
+	},
+	{
+		Name: "create user_books indexes",
+		Up: mongomigrate.Steps(
+			func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+				return normalizeBookISBNs(ctx, db.Collection(BooksCollection), log)
+			},
+			func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+				return unshelveDuplicates(ctx, db.Collection(BooksCollection), "bookshelf_id", log)
+			},
+			mongomigrate.CreateIndexes(BooksCollection,
+				mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}},
+				mongo.IndexModel{Keys: bson.D{{Key: "isbn", Value: 1}, {Key: "user_id", Value: 1}}},
+				// SyncCatalog
+				mongo.IndexModel{Keys: bson.D{{Key: "catalog_id", Value: 1}}},
+				// The library of a user, sorted by each sort field.
+				libraryIndex(models.SortByTitle),
+				libraryIndex(models.SortByAuthor),
+				libraryIndex(models.SortByCreatedAt),
+				libraryIndex(models.SortByUpdatedAt),
+				// A book is on a shelf at most once. Books without a shelf or an
+				// ISBN are not indexed.
+				mongo.IndexModel{
+					Keys: bson.D{{Key: "bookshelf_id", Value: 1}, {Key: "isbn", Value: 1}},
+					Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+						"bookshelf_id": bson.M{"$gt": ""},
+						"isbn":         bson.M{"$gt": ""},
+					}),
+				},
+			),
+		),
+	},
+	{
+		Name: "create bookshelf indexes",
+		Up: mongomigrate.Steps(
+			func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+				return renameDuplicateBookshelves(ctx, db.Collection("bookshelf"), log, "user_id")
+			},
+			mongomigrate.CreateIndexes("bookshelf",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+			),
+		),
+	},
+	{
+		Name: "create all_books indexes",
+		Up: mongomigrate.CreateIndexes(CatalogCollection,
+			mongo.IndexModel{
+				Keys: bson.D{{Key: "isbn13", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+					"isbn13": bson.M{"$exists": true},
+				}),
+			},
+		),
+	},
+	{
+		Name: "shelve books on several bookshelves",
+		Up:   MigrateShelves,
+	},
+	{
+		Name: "nest bookshelves",
+		Up:   MigrateNesting,
+	},
+	{
+		Name: "position books and bookshelves",
+		Up:   MigratePositions,
+	},
+}
+
+// libraryIndex serves the pages of a library sorted by the field.
+func libraryIndex(field string) mongo.IndexModel {
+	return mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: field, Value: 1}, {Key: "_id", Value: 1}}}
+}
+
+// Migrate brings the database schema up to date: it links legacy books to the
+// catalog and creates the indexes the repositories rely on, including the
+// unique ones behind their ErrAlreadyExists errors.
+func Migrate(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+	return mongomigrate.Migrate(ctx, db, MigrationsCollection, migrations, log)
+}
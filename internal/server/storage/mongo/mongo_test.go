@@ -0,0 +1,286 @@
+package mongo
+
+import (
+	"context"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository"
+	"github.com/getz-devs/librakeeper-server/internal/server/repository/repotest"
+	"github.com/getz-devs/librakeeper-server/lib/mongomigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestConformance runs against the MongoDB server at MONGO_TEST_URI, each
+// test in a database of its own that is dropped afterwards. Bookshelf
+// deletion uses transactions, so the server must be a replica set member.
+func TestConformance(t *testing.T) {
+	client := connect(t)
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db := testDatabase(t, client)
+		return repotest.Repos{
+			Books:       NewBookRepo(db, log, BooksCollection),
+			Bookshelves: NewBookshelfRepo(db, log),
+			Catalog:     NewCatalogRepo(db, log),
+			CorrectCatalog: func(t *testing.T, entry *models.CatalogEntry) {
+				_, err := db.Collection(CatalogCollection).ReplaceOne(context.Background(), bson.M{"_id": entry.ID}, entry)
+				require.NoError(t, err)
+			},
+		}
+	})
+}
+
+// TestListFilter checks the translation of list and smart bookshelf filters,
+// which needs no server.
+func TestListFilter(t *testing.T) {
+	noCover := false
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	shelf := (&models.SmartFilter{Author: "O'Brien (ed.)", AddedWithinDays: 30, HasCover: &noCover, ShopName: "$ne", Tag: "{$gt: ''}"}).
+		BookFilter(from.AddDate(0, 0, 30))
+
+	filter := listFilter(&models.BookListOptions{ShelfFilter: &shelf, Filter: models.BookFilter{Tag: "gift"}})
+
+	assert.Equal(t, bson.M{"$and": bson.A{
+		bson.M{
+			"author":      primitive.Regex{Pattern: `O'Brien \(ed\.\)`, Options: "i"},
+			"shop_name":   "$ne",
+			"tags":        "{$gt: ''}",
+			"cover_image": bson.M{"$in": bson.A{"", nil}},
+			"created_at":  bson.M{"$gte": from},
+		},
+		bson.M{"tags": "gift"},
+	}}, filter, "strings are matched as values or quoted patterns")
+	assert.Equal(t, bson.M{"tags": "gift"}, listFilter(&models.BookListOptions{Filter: models.BookFilter{Tag: "gift"}}))
+}
+
+// TestMigrate checks that the unique indexes back the repositories'
+// ErrAlreadyExists errors and that migrating again changes nothing.
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	db := testDatabase(t, connect(t))
+
+	require.NoError(t, Migrate(ctx, db, log), "migrating twice is a no-op")
+	version, err := mongomigrate.Version(ctx, db, MigrationsCollection)
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+
+	shelves := NewBookshelfRepo(db, log)
+	fiction := &models.Bookshelf{UserID: "user1", Name: "Fiction"}
+	require.NoError(t, shelves.Create(ctx, fiction))
+	assert.ErrorIs(t, shelves.Create(ctx, &models.Bookshelf{UserID: "user1", Name: "Fiction"}), repository.ErrBookshelfAlreadyExists)
+	require.NoError(t, shelves.Create(ctx, &models.Bookshelf{UserID: "user2", Name: "Fiction"}))
+	poetry := &models.Bookshelf{UserID: "user1", Name: "Poetry"}
+	require.NoError(t, shelves.Create(ctx, poetry))
+	name := "Fiction"
+	assert.ErrorIs(t, shelves.Update(ctx, poetry.ID, &models.BookshelfUpdate{Name: &name}), repository.ErrBookshelfAlreadyExists)
+	// Names are unique per parent.
+	require.NoError(t, shelves.Create(ctx, &models.Bookshelf{UserID: "user1", ParentID: poetry.ID, Name: "Fiction"}))
+	parent := poetry.ID
+	assert.ErrorIs(t, shelves.Update(ctx, fiction.ID, &models.BookshelfUpdate{ParentID: &parent}), repository.ErrBookshelfAlreadyExists)
+
+	books := NewBookRepo(db, log, BooksCollection)
+	require.NoError(t, books.Create(ctx, &models.Book{UserID: "user1", BookshelfIDs: []string{fiction.ID}, ISBN: "9785446120581"}))
+	assert.ErrorIs(t, books.Create(ctx, &models.Book{UserID: "user1", BookshelfIDs: []string{poetry.ID, fiction.ID}, ISBN: "9785446120581"}), repository.ErrBookAlreadyExists)
+	require.NoError(t, books.Create(ctx, &models.Book{UserID: "user1", BookshelfIDs: []string{poetry.ID}, ISBN: "9785446120581"}))
+
+	// Books without a shelf or an ISBN are not unique.
+	require.NoError(t, books.Create(ctx, &models.Book{UserID: "user1", ISBN: "9785446120581"}))
+	require.NoError(t, books.Create(ctx, &models.Book{UserID: "user1", ISBN: "9785446120581"}))
+	require.NoError(t, books.Create(ctx, &models.Book{UserID: "user1", BookshelfIDs: []string{fiction.ID}}))
+	require.NoError(t, books.Create(ctx, &models.Book{UserID: "user1", BookshelfIDs: []string{fiction.ID}}))
+}
+
+// TestMigrate_Duplicates checks that the migrations clean up the duplicates
+// of a legacy database before they build the unique indexes.
+func TestMigrate_Duplicates(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	db := emptyDatabase(t, connect(t))
+
+	added := time.Now().Add(-time.Hour)
+	_, err := db.Collection(BooksCollection).InsertMany(ctx, []interface{}{
+		bson.M{"_id": "first", "user_id": "user1", "bookshelf_id": "shelf1", "isbn": "978-5-4461-2058-1", "created_at": added},
+		bson.M{"_id": "again", "user_id": "user1", "bookshelf_id": "shelf1", "isbn": "9785446120581", "created_at": added.Add(time.Minute)},
+		bson.M{"_id": "elsewhere", "user_id": "user1", "bookshelf_id": "shelf2", "isbn": "9785446120581", "created_at": added},
+	})
+	require.NoError(t, err)
+	_, err = db.Collection("bookshelf").InsertMany(ctx, []interface{}{
+		bson.M{"_id": "fiction", "user_id": "user1", "name": "Fiction", "created_at": added},
+		bson.M{"_id": "fiction2", "user_id": "user1", "name": "Fiction (2)", "created_at": added},
+		bson.M{"_id": "again", "user_id": "user1", "name": "Fiction", "created_at": added.Add(time.Minute)},
+		bson.M{"_id": "other", "user_id": "user2", "name": "Fiction", "created_at": added},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, Migrate(ctx, db, log))
+
+	books := NewBookRepo(db, log, BooksCollection)
+	first, err := books.GetByID(ctx, "first")
+	require.NoError(t, err)
+	assert.Equal(t, "9785446120581", first.ISBN, "ISBNs are normalized")
+	assert.Equal(t, []string{"shelf1"}, first.BookshelfIDs, "the book added first stays")
+	again, err := books.GetByID(ctx, "again")
+	require.NoError(t, err)
+	assert.Empty(t, again.BookshelfIDs, "the duplicate stays in the library")
+	elsewhere, err := books.GetByID(ctx, "elsewhere")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shelf2"}, elsewhere.BookshelfIDs)
+
+	shelves := NewBookshelfRepo(db, log)
+	for id, name := range map[string]string{"fiction": "Fiction", "fiction2": "Fiction (2)", "again": "Fiction (3)", "other": "Fiction"} {
+		shelf, err := shelves.GetByID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, name, shelf.Name, id)
+	}
+}
+
+func TestMigrateShelves(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	db := testDatabase(t, connect(t))
+
+	_, err := db.Collection(BooksCollection).InsertMany(ctx, []interface{}{
+		bson.M{"_id": "shelved", "user_id": "user1", "bookshelf_id": "shelf1", "isbn": "9785446120581"},
+		bson.M{"_id": "unshelved", "user_id": "user1", "bookshelf_id": "", "isbn": "9785446120581"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, MigrateShelves(ctx, db, log))
+	require.NoError(t, MigrateShelves(ctx, db, log), "migrating twice is a no-op")
+
+	books := NewBookRepo(db, log, BooksCollection)
+	got, err := books.GetByID(ctx, "shelved")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shelf1"}, got.BookshelfIDs)
+	got, err = books.GetByID(ctx, "unshelved")
+	require.NoError(t, err)
+	assert.Empty(t, got.BookshelfIDs)
+
+	legacy, err := db.Collection(BooksCollection).CountDocuments(ctx, bson.M{"bookshelf_id": bson.M{"$exists": true}})
+	require.NoError(t, err)
+	assert.Zero(t, legacy)
+}
+
+func TestMigrateNesting(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	db := testDatabase(t, connect(t))
+
+	_, err := db.Collection("bookshelf").InsertOne(ctx, bson.M{"_id": "legacy", "user_id": "user1", "name": "Fiction"})
+	require.NoError(t, err)
+
+	require.NoError(t, MigrateNesting(ctx, db, log))
+	require.NoError(t, MigrateNesting(ctx, db, log), "migrating twice is a no-op")
+
+	shelves := NewBookshelfRepo(db, log)
+	exists, err := shelves.ExistsByNameAndParent(ctx, "Fiction", "user1", "")
+	require.NoError(t, err)
+	assert.True(t, exists, "legacy bookshelves are at the top level")
+	assert.ErrorIs(t, shelves.Create(ctx, &models.Bookshelf{UserID: "user1", Name: "Fiction"}), repository.ErrBookshelfAlreadyExists)
+}
+
+func TestMigratePositions(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	db := testDatabase(t, connect(t))
+
+	added := time.Now().Add(-time.Hour)
+	_, err := db.Collection(BooksCollection).InsertMany(ctx, []interface{}{
+		bson.M{"_id": "second", "user_id": "user1", "bookshelf_ids": bson.A{"shelf1"}, "created_at": added.Add(time.Minute)},
+		bson.M{"_id": "first", "user_id": "user1", "bookshelf_ids": bson.A{"shelf1"}, "created_at": added},
+	})
+	require.NoError(t, err)
+	_, err = db.Collection("bookshelf").InsertMany(ctx, []interface{}{
+		bson.M{"_id": "poetry", "user_id": "user1", "parent_id": "", "name": "Poetry", "created_at": added.Add(time.Minute)},
+		bson.M{"_id": "fiction", "user_id": "user1", "parent_id": "", "name": "Fiction", "created_at": added},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, MigratePositions(ctx, db, log))
+	require.NoError(t, MigratePositions(ctx, db, log), "migrating twice is a no-op")
+
+	books, err := NewBookRepo(db, log, BooksCollection).Positions(ctx, "shelf1")
+	require.NoError(t, err)
+	require.Len(t, books, 2)
+	assert.Equal(t, []string{"first", "second"}, []string{books[0].ID, books[1].ID}, "books keep the order they were added in")
+
+	shelves, err := NewBookshelfRepo(db, log).Positions(ctx, "user1", "")
+	require.NoError(t, err)
+	require.Len(t, shelves, 2)
+	assert.Equal(t, []string{"fiction", "poetry"}, []string{shelves[0].ID, shelves[1].ID})
+	assert.NotEmpty(t, shelves[0].Key)
+}
+
+func TestMigrateCatalog(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	db := testDatabase(t, connect(t))
+
+	_, err := db.Collection(CatalogCollection).InsertOne(ctx, bson.M{
+		"_id": "entry1", "isbn13": "9785446120581", "title": "Catalog Title",
+		"contributors": bson.A{bson.M{"name": "Author", "role": models.RoleAuthor}},
+	})
+	require.NoError(t, err)
+	_, err = db.Collection(BooksCollection).InsertOne(ctx, bson.M{
+		"_id": "legacy", "user_id": "user1", "isbn": "978-5-4461-2058-1", "title": "Own Title", "author": "Author",
+	})
+	require.NoError(t, err)
+
+	_, err = MigrateCatalog(ctx, db, log)
+	require.NoError(t, err)
+	_, err = MigrateCatalog(ctx, db, log)
+	require.NoError(t, err, "migrating twice is a no-op")
+
+	var stored models.Book
+	require.NoError(t, db.Collection(BooksCollection).FindOne(ctx, bson.M{"_id": "legacy"}).Decode(&stored))
+	assert.Equal(t, "entry1", stored.CatalogID)
+	assert.Equal(t, "Own Title", stored.Title)
+	assert.Equal(t, "Author", stored.Author)
+	assert.Equal(t, []string{models.FieldTitle}, stored.Overrides, "the values that differ are overrides")
+}
+
+// connect connects to the MongoDB server at MONGO_TEST_URI or skips the test.
+func connect(t *testing.T) *mongo.Client {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("failed to connect to mongodb: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(ctx) })
+	return client
+}
+
+// testDatabase returns a migrated database of its own that is dropped after
+// the test.
+func testDatabase(t *testing.T, client *mongo.Client) *mongo.Database {
+	ctx := context.Background()
+	db := emptyDatabase(t, client)
+
+	if err := Migrate(ctx, db, slog.New(slog.NewTextHandler(os.Stdout, nil))); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+// emptyDatabase returns a database of its own, not migrated, that is dropped
+// after the test.
+func emptyDatabase(t *testing.T, client *mongo.Client) *mongo.Database {
+	ctx := context.Background()
+	db := client.Database("librakeeper_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() { _ = db.Drop(ctx) })
+	return db
+}
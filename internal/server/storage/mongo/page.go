@@ -0,0 +1,47 @@
+package mongo
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sortSpec sorts by the given field with _id as a tie-breaker, so pages are stable.
+func sortSpec(field string, order models.SortOrder) bson.D {
+	return bson.D{
+		{Key: field, Value: int(order)},
+		{Key: "_id", Value: int(order)},
+	}
+}
+
+// pageQuery builds the query and find options for one page. Offset pagination
+// uses $skip; keyset pagination seeks past the (sort field, _id) position and
+// fetches one extra document to detect whether more follow. Backward pages are
+// read in reverse order and must be reversed by the caller.
+func pageQuery(filter bson.M, field string, order models.SortOrder, page, limit int64, position *models.CursorPosition) (bson.M, *options.FindOptions) {
+	findOptions := options.Find()
+
+	if position == nil {
+		findOptions.SetSort(sortSpec(field, order))
+		findOptions.SetSkip((page - 1) * limit)
+		findOptions.SetLimit(limit)
+		return filter, findOptions
+	}
+
+	if position.Backward {
+		order = -order
+	}
+	op := "$gt"
+	if order == models.SortDesc {
+		op = "$lt"
+	}
+
+	seek := bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: position.Value}},
+		bson.M{field: position.Value, "_id": bson.M{op: position.ID}},
+	}}
+
+	findOptions.SetSort(sortSpec(field, order))
+	findOptions.SetLimit(limit + 1)
+	return bson.M{"$and": bson.A{filter, seek}}, findOptions
+}
@@ -0,0 +1,148 @@
+// Package boltdb opens the single-file bbolt databases of the embedded
+// storage backends. It applies their schema migrations and provides the BSON
+// document and index helpers they share.
+package boltdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// migrationsBucket records the applied migrations: version -> name.
+const migrationsBucket = "_migrations"
+
+// ErrUnknownSchema occurs when a database was migrated by a newer build.
+var ErrUnknownSchema = errors.New("database schema is newer than this build")
+
+// Migration changes the schema of a database, e.g. creates a bucket or
+// builds an index. Each migration runs once, in its own transaction.
+type Migration struct {
+	Name string
+	Up   func(tx *bbolt.Tx) error
+}
+
+// Open opens the database file, creating it and its directory if needed, and
+// applies the pending migrations. Only one process can open a file at a time.
+func Open(path string, migrations []Migration, log *slog.Logger) (*bbolt.DB, error) {
+	const op = "boltdb.Open"
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	if errors.Is(err, bbolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s: %s is locked by another process", op, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := Migrate(db, migrations, log); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return db, nil
+}
+
+// Migrate applies the migrations the database has not seen yet. A migration
+// is identified by its position in the list, so new migrations are appended.
+func Migrate(db *bbolt.DB, migrations []Migration, log *slog.Logger) error {
+	const op = "boltdb.Migrate"
+
+	var version int
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(migrationsBucket))
+		if err != nil {
+			return err
+		}
+		if key, _ := b.Cursor().Last(); key != nil {
+			version = int(binary.BigEndian.Uint64(key))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("%s: %w: version %d, known %d", op, ErrUnknownSchema, version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		migration := migrations[i]
+		err := db.Update(func(tx *bbolt.Tx) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			key := binary.BigEndian.AppendUint64(nil, uint64(i+1))
+			return tx.Bucket([]byte(migrationsBucket)).Put(key, []byte(migration.Name))
+		})
+		if err != nil {
+			return fmt.Errorf("%s: migration %d %q: %w", op, i+1, migration.Name, err)
+		}
+		log.Info("applied migration", slog.Int("version", i+1), slog.String("name", migration.Name))
+	}
+
+	return nil
+}
+
+// CreateBuckets returns a migration step that creates the buckets.
+func CreateBuckets(names ...string) func(tx *bbolt.Tx) error {
+	return func(tx *bbolt.Tx) error {
+		for _, name := range names {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Get decodes the document stored under the key into doc. It reports false
+// when there is no such document.
+func Get(b *bbolt.Bucket, key string, doc interface{}) (bool, error) {
+	data := b.Get([]byte(key))
+	if data == nil {
+		return false, nil
+	}
+	if err := bson.Unmarshal(data, doc); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Put stores doc under the key as BSON.
+func Put(b *bbolt.Bucket, key string, doc interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	return b.Put([]byte(key), data)
+}
+
+// IndexKey is the key of a document in an index bucket. Keys sort by the
+// indexed value first and by the document _id within a value.
+func IndexKey(value, id string) []byte {
+	return []byte(value + "\x00" + id)
+}
+
+// ScanIndex calls fn with the _id of every document indexed under the value,
+// in _id order, until fn returns false.
+func ScanIndex(b *bbolt.Bucket, value string, fn func(id string) bool) {
+	prefix := []byte(value + "\x00")
+	c := b.Cursor()
+	for key, _ := c.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = c.Next() {
+		if !fn(string(key[len(prefix):])) {
+			return
+		}
+	}
+}
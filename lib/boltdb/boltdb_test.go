@@ -0,0 +1,73 @@
+package boltdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "data", "test.db")
+
+	runs := map[string]int{}
+	migration := func(name string) Migration {
+		return Migration{Name: name, Up: func(tx *bbolt.Tx) error {
+			runs[name]++
+			return CreateBuckets(name)(tx)
+		}}
+	}
+	first := []Migration{migration("books")}
+	second := append(first, migration("shelves"))
+
+	db, err := Open(path, first, log)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = Open(path, second, log)
+	require.NoError(t, err)
+	err = db.View(func(tx *bbolt.Tx) error {
+		assert.NotNil(t, tx.Bucket([]byte("books")))
+		assert.NotNil(t, tx.Bucket([]byte("shelves")))
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	assert.Equal(t, map[string]int{"books": 1, "shelves": 1}, runs, "migrations run once")
+
+	_, err = Open(path, first, log)
+	assert.ErrorIs(t, err, ErrUnknownSchema)
+}
+
+func TestScanIndex(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"), []Migration{{Name: "index", Up: CreateBuckets("index")}}, log)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("index"))
+		for _, key := range [][]byte{IndexKey("user", "2"), IndexKey("user", "1"), IndexKey("user1", "3"), IndexKey("use", "4")} {
+			if err := b.Put(key, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	var ids []string
+	err = db.View(func(tx *bbolt.Tx) error {
+		ScanIndex(tx.Bucket([]byte("index")), "user", func(id string) bool {
+			ids = append(ids, id)
+			return true
+		})
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids, "only exact values, in _id order")
+}
@@ -0,0 +1,207 @@
+// Package fracindex generates fractional index keys: strings that sort in the
+// order of the items they position, so that an item can be placed between two
+// others without renumbering the rest of the list.
+//
+// Keys are made of base-62 digits (0-9, A-Z, a-z) and compare as plain
+// strings. A key never ends with the zero digit, which leaves room below it.
+package fracindex
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ErrInvalidKey occurs when a key is empty, ends with the zero digit or has a
+// character that is not a base-62 digit.
+var ErrInvalidKey = errors.New("fracindex: invalid key")
+
+// ErrInvalidRange occurs when the lower bound does not sort before the upper.
+var ErrInvalidRange = errors.New("fracindex: lower bound is not before upper bound")
+
+// Validate checks that key can be used as a bound.
+func Validate(key string) error {
+	if key == "" || key[len(key)-1] == digits[0] {
+		return ErrInvalidKey
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(digits, key[i]) < 0 {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// Between returns a key that sorts after a and before b. An empty a stands
+// for the start of the list and an empty b for its end.
+func Between(a, b string) (string, error) {
+	if err := bounds(a, b); err != nil {
+		return "", err
+	}
+	return midpoint(a, b), nil
+}
+
+// Sequence returns n increasing keys between a and b, bisecting the range so
+// that they stay short.
+func Sequence(a, b string, n int) ([]string, error) {
+	if err := bounds(a, b); err != nil {
+		return nil, err
+	}
+	return spread(a, b, n, make([]string, 0, n)), nil
+}
+
+// Fill returns keys with the empty ones replaced by new keys that sort after
+// the largest given key, in the order they appear.
+func Fill(keys []string) ([]string, error) {
+	last, missing := "", 0
+	for _, key := range keys {
+		if key == "" {
+			missing++
+			continue
+		}
+		if err := Validate(key); err != nil {
+			return nil, err
+		}
+		last = max(last, key)
+	}
+
+	fresh := spread(last, "", missing, make([]string, 0, missing))
+	filled := make([]string, len(keys))
+	for i, key := range keys {
+		if key == "" {
+			key, fresh = fresh[0], fresh[1:]
+		}
+		filled[i] = key
+	}
+	return filled, nil
+}
+
+// Rekey returns strictly increasing keys for items listed in their new order
+// with their current keys. It keeps the longest increasing run of current
+// keys and generates new ones only for the rest, so moving one item changes
+// one key. Empty and invalid keys are always replaced.
+func Rekey(keys []string) []string {
+	keep := increasing(keys)
+	result := make([]string, len(keys))
+
+	lower := ""
+	for i := 0; i < len(keys); {
+		if keep[i] {
+			result[i], lower = keys[i], keys[i]
+			i++
+			continue
+		}
+		j := i
+		for j < len(keys) && !keep[j] {
+			j++
+		}
+		upper := ""
+		if j < len(keys) {
+			upper = keys[j]
+		}
+		copy(result[i:j], spread(lower, upper, j-i, make([]string, 0, j-i)))
+		i = j
+	}
+	return result
+}
+
+func bounds(a, b string) error {
+	for _, key := range []string{a, b} {
+		if key == "" {
+			continue
+		}
+		if err := Validate(key); err != nil {
+			return err
+		}
+	}
+	if a != "" && b != "" && a >= b {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+// increasing marks a longest strictly increasing subsequence of the valid
+// keys.
+func increasing(keys []string) []bool {
+	var tails []int
+	prev := make([]int, len(keys))
+	for i, key := range keys {
+		if Validate(key) != nil {
+			continue
+		}
+		j := sort.Search(len(tails), func(j int) bool { return keys[tails[j]] >= key })
+		prev[i] = -1
+		if j > 0 {
+			prev[i] = tails[j-1]
+		}
+		if j == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[j] = i
+		}
+	}
+
+	keep := make([]bool, len(keys))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			keep[i] = true
+		}
+	}
+	return keep
+}
+
+func spread(a, b string, n int, keys []string) []string {
+	if n == 0 {
+		return keys
+	}
+	mid := midpoint(a, b)
+	left := (n - 1) / 2
+	keys = spread(a, mid, left, keys)
+	keys = append(keys, mid)
+	return spread(mid, b, n-1-left, keys)
+}
+
+// midpoint returns a key between valid keys a < b, either of which may be
+// empty.
+func midpoint(a, b string) string {
+	if b != "" {
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + midpoint(tail(a, n), b[n:])
+		}
+	}
+
+	lo, hi := 0, len(digits)
+	if a != "" {
+		lo = strings.IndexByte(digits, a[0])
+	}
+	if b != "" {
+		hi = strings.IndexByte(digits, b[0])
+	}
+	if hi-lo > 1 {
+		return string(digits[(lo+hi)/2])
+	}
+	if len(b) > 1 {
+		return b[:1]
+	}
+	return string(digits[lo]) + midpoint(tail(a, 1), "")
+}
+
+func digitAt(key string, i int) byte {
+	if i < len(key) {
+		return key[i]
+	}
+	return digits[0]
+}
+
+func tail(key string, n int) string {
+	if n < len(key) {
+		return key[n:]
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package fracindex
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", "V"},
+		{"V", "", "k"},
+		{"", "V", "F"},
+		{"z", "", "zV"},
+		{"", "1", "0V"},
+		{"A", "B", "AV"},
+		{"A", "B1", "B"},
+		{"AV", "B", "Ak"},
+		{"A1", "A2", "A1V"},
+		{"A", "A01", "A00V"},
+	}
+
+	for _, tt := range tests {
+		got, err := Between(tt.a, tt.b)
+		require.NoError(t, err, "%q..%q", tt.a, tt.b)
+		assert.Equal(t, tt.want, got, "%q..%q", tt.a, tt.b)
+		assert.NoError(t, Validate(got))
+	}
+}
+
+func TestBetween_Errors(t *testing.T) {
+	_, err := Between("B", "A")
+	assert.ErrorIs(t, err, ErrInvalidRange)
+	_, err = Between("A", "A")
+	assert.ErrorIs(t, err, ErrInvalidRange)
+	_, err = Between("A0", "")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = Between("", "a-b")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestBetween_Repeated(t *testing.T) {
+	// Inserting again and again at the same place keeps the keys ordered.
+	lo, hi := "", ""
+	for i := 0; i < 200; i++ {
+		key, err := Between(lo, hi)
+		require.NoError(t, err)
+		if lo != "" {
+			require.Greater(t, key, lo)
+		}
+		if hi != "" {
+			require.Less(t, key, hi)
+		}
+		if i%2 == 0 {
+			hi = key
+		} else {
+			lo = key
+		}
+	}
+}
+
+func TestSequence(t *testing.T) {
+	keys, err := Sequence("", "", 1000)
+	require.NoError(t, err)
+	require.Len(t, keys, 1000)
+	for i := range keys {
+		require.NoError(t, Validate(keys[i]))
+		require.LessOrEqual(t, len(keys[i]), 3)
+		if i > 0 {
+			require.Less(t, keys[i-1], keys[i])
+		}
+	}
+
+	keys, err = Sequence("A", "B", 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"AF", "AV", "Ak"}, keys)
+
+	_, err = Sequence("B", "A", 1)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func TestFill(t *testing.T) {
+	keys, err := Fill([]string{"", "k", "", "V"})
+	require.NoError(t, err)
+	assert.Equal(t, "k", keys[1])
+	assert.Equal(t, "V", keys[3])
+	assert.Greater(t, keys[0], "k")
+	assert.Greater(t, keys[2], keys[0])
+
+	_, err = Fill([]string{"k0"})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestRekey(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		changed int
+	}{
+		{"ordered", []string{"F", "V", "k"}, 0},
+		{"moved to front", []string{"k", "F", "V"}, 1},
+		{"moved to back", []string{"V", "k", "F"}, 1},
+		{"swapped", []string{"F", "k", "V", "s"}, 1},
+		{"reversed", []string{"k", "V", "F"}, 2},
+		{"missing", []string{"F", "", "V", "x0"}, 2},
+		{"duplicate", []string{"V", "V"}, 1},
+		{"empty", []string{"", ""}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Rekey(tt.keys)
+			require.Len(t, got, len(tt.keys))
+
+			changed := 0
+			for i := range got {
+				require.NoError(t, Validate(got[i]))
+				if i > 0 {
+					require.Less(t, got[i-1], got[i])
+				}
+				if got[i] != tt.keys[i] {
+					changed++
+				}
+			}
+			assert.Equal(t, tt.changed, changed)
+		})
+	}
+}
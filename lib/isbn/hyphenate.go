@@ -0,0 +1,109 @@
+package isbn
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownRange occurs when the embedded range data does not cover an ISBN.
+var ErrUnknownRange = errors.New("isbn: no range data for this ISBN")
+
+//go:embed ranges.txt
+var rangeData string
+
+// rangeRule gives the length of the next ISBN element for 7-digit values in [from, to].
+type rangeRule struct {
+	from, to int
+	length   int
+}
+
+var (
+	rulesOnce sync.Once
+	rules     map[string][]rangeRule // keyed by "978" or "978-5"
+)
+
+// loadRules parses the embedded range data. The data is part of the binary,
+// so a malformed file is a programming error.
+func loadRules() {
+	rules = make(map[string][]rangeRule)
+
+	scanner := bufio.NewScanner(strings.NewReader(rangeData))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var prefix, span string
+		var length int
+		if _, err := fmt.Sscan(line, &prefix, &span, &length); err != nil {
+			panic(fmt.Sprintf("isbn: malformed range line %q: %v", line, err))
+		}
+		fromStr, toStr, ok := strings.Cut(span, "-")
+		from, errFrom := strconv.Atoi(fromStr)
+		to, errTo := strconv.Atoi(toStr)
+		if !ok || errFrom != nil || errTo != nil {
+			panic(fmt.Sprintf("isbn: malformed range line %q", line))
+		}
+
+		rules[prefix] = append(rules[prefix], rangeRule{from: from, to: to, length: length})
+	}
+}
+
+// lookup returns the length of the element that starts the digits following prefix.
+func lookup(prefix, digits string) (int, error) {
+	rulesOnce.Do(loadRules)
+
+	value, err := strconv.Atoi((digits + "0000000")[:7])
+	if err != nil {
+		return 0, ErrInvalidCharacter
+	}
+
+	for _, r := range rules[prefix] {
+		if value >= r.from && value <= r.to {
+			if r.length == 0 {
+				return 0, ErrUnknownRange
+			}
+			return r.length, nil
+		}
+	}
+	return 0, ErrUnknownRange
+}
+
+// Hyphenate validates an ISBN and returns it split into its elements, keeping
+// its form: "9785446120581" becomes "978-5-4461-2058-1" and "517118366X"
+// becomes "5-17-118366-X".
+func Hyphenate(s string) (string, error) {
+	isbn13, err := To13(s)
+	if err != nil {
+		return "", err
+	}
+
+	prefix, rest := isbn13[:3], isbn13[3:12]
+
+	groupLength, err := lookup(prefix, rest)
+	if err != nil {
+		return "", err
+	}
+	group := rest[:groupLength]
+
+	registrantLength, err := lookup(prefix+"-"+group, rest[groupLength:])
+	if err != nil {
+		return "", err
+	}
+	if groupLength+registrantLength >= len(rest) {
+		return "", ErrUnknownRange
+	}
+	registrant := rest[groupLength : groupLength+registrantLength]
+	publication := rest[groupLength+registrantLength:]
+
+	if clean := Clean(s); len(clean) == 10 {
+		return strings.Join([]string{group, registrant, publication, clean[9:]}, "-"), nil
+	}
+	return strings.Join([]string{prefix, group, registrant, publication, isbn13[12:]}, "-"), nil
+}
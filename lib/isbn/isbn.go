@@ -0,0 +1,159 @@
+// Package isbn validates, converts and formats International Standard Book Numbers.
+//
+// The canonical form used as a storage key is the ISBN-13 without hyphens,
+// as returned by Normalize.
+package isbn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalid is wrapped by every validation error.
+var ErrInvalid = errors.New("invalid isbn")
+
+// Custom Error Types:
+var (
+	ErrInvalidLength    = fmt.Errorf("%w: must have 10 or 13 digits", ErrInvalid)
+	ErrInvalidCharacter = fmt.Errorf("%w: unexpected character", ErrInvalid)
+	ErrInvalidChecksum  = fmt.Errorf("%w: wrong check digit", ErrInvalid)
+	ErrInvalidPrefix    = fmt.Errorf("%w: ISBN-13 must start with 978 or 979", ErrInvalid)
+	ErrNoISBN10         = errors.New("isbn: 979 ISBNs have no ISBN-10 form")
+)
+
+// Clean removes hyphens and spaces and upper-cases the ISBN-10 check digit 'x'.
+// It does not validate the result.
+func Clean(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r == '-' || r == ' ':
+		case r == 'x':
+			b.WriteRune('X')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Validate checks the length, characters and check digit of an ISBN-10 or
+// ISBN-13. Hyphens and spaces are ignored.
+func Validate(s string) error {
+	s = Clean(s)
+
+	switch len(s) {
+	case 10:
+		if !digits(s[:9]) || !(digits(s[9:]) || s[9] == 'X') {
+			return ErrInvalidCharacter
+		}
+	case 13:
+		if !digits(s) {
+			return ErrInvalidCharacter
+		}
+		if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+			return ErrInvalidPrefix
+		}
+	default:
+		return ErrInvalidLength
+	}
+
+	check, err := CheckDigit(s[:len(s)-1])
+	if err != nil {
+		return err
+	}
+	if check != s[len(s)-1] {
+		return ErrInvalidChecksum
+	}
+	return nil
+}
+
+// Valid reports whether s is a valid ISBN-10 or ISBN-13.
+func Valid(s string) bool {
+	return Validate(s) == nil
+}
+
+// Normalize validates an ISBN and returns its canonical form: the ISBN-13
+// without hyphens.
+func Normalize(s string) (string, error) {
+	return To13(s)
+}
+
+// To13 validates an ISBN and converts it to an ISBN-13 without hyphens.
+func To13(s string) (string, error) {
+	if err := Validate(s); err != nil {
+		return "", err
+	}
+
+	s = Clean(s)
+	if len(s) == 13 {
+		return s, nil
+	}
+
+	body := "978" + s[:9]
+	check, _ := CheckDigit(body)
+	return body + string(check), nil
+}
+
+// To10 validates an ISBN and converts it to an ISBN-10 without hyphens.
+// ISBN-13s with the 979 prefix have no ISBN-10 form.
+func To10(s string) (string, error) {
+	if err := Validate(s); err != nil {
+		return "", err
+	}
+
+	s = Clean(s)
+	if len(s) == 10 {
+		return s, nil
+	}
+	if !strings.HasPrefix(s, "978") {
+		return "", ErrNoISBN10
+	}
+
+	body := s[3:12]
+	check, _ := CheckDigit(body)
+	return body + string(check), nil
+}
+
+// CheckDigit computes the check digit for the first 9 digits of an ISBN-10
+// or the first 12 digits of an ISBN-13.
+func CheckDigit(body string) (byte, error) {
+	if !digits(body) {
+		return 0, ErrInvalidCharacter
+	}
+
+	sum := 0
+	switch len(body) {
+	case 9:
+		for i := range body {
+			sum += (10 - i) * int(body[i]-'0')
+		}
+		check := (11 - sum%11) % 11
+		if check == 10 {
+			return 'X', nil
+		}
+		return byte('0' + check), nil
+	case 12:
+		for i := range body {
+			d := int(body[i] - '0')
+			if i%2 == 1 {
+				d *= 3
+			}
+			sum += d
+		}
+		return byte('0' + (10-sum%10)%10), nil
+	default:
+		return 0, ErrInvalidLength
+	}
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package isbn
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		isbn string
+		err  error
+	}{
+		{"9785446120581", nil},
+		{"978-5-4461-2058-1", nil},
+		{"5-17-118366-X", nil},
+		{"517118366x", nil},
+		{"9791032705469", nil},
+		{"9785446120582", ErrInvalidChecksum},
+		{"5171183660", ErrInvalidChecksum},
+		{"97854461205", ErrInvalidLength},
+		{"", ErrInvalidLength},
+		{"97854461X0581", ErrInvalidCharacter},
+		{"X171183660", ErrInvalidCharacter},
+		{"1234567890123", ErrInvalidPrefix},
+	}
+
+	for _, tt := range tests {
+		err := Validate(tt.isbn)
+		if tt.err == nil {
+			assert.NoError(t, err, tt.isbn)
+			continue
+		}
+		assert.ErrorIs(t, err, tt.err, tt.isbn)
+		assert.ErrorIs(t, err, ErrInvalid, tt.isbn)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	isbn13, err := To13("5-17-118366-X")
+	assert.NoError(t, err)
+	assert.Equal(t, "9785171183660", isbn13)
+
+	isbn10, err := To10("978-5-17-118366-0")
+	assert.NoError(t, err)
+	assert.Equal(t, "517118366X", isbn10)
+
+	_, err = To10("9791032705469")
+	assert.ErrorIs(t, err, ErrNoISBN10)
+
+	normalized, err := Normalize("978-5-4461-2058-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "9785446120581", normalized)
+}
+
+func TestHyphenate(t *testing.T) {
+	tests := []struct {
+		isbn string
+		want string
+	}{
+		{"9785446120581", "978-5-4461-2058-1"},
+		{"517118366X", "5-17-118366-X"},
+		{"9780306406157", "978-0-306-40615-7"},
+		{"9783161484100", "978-3-16-148410-0"},
+		{"9791032705469", "979-10-327-0546-9"},
+	}
+
+	for _, tt := range tests {
+		got, err := Hyphenate(tt.isbn)
+		assert.NoError(t, err, tt.isbn)
+		assert.Equal(t, tt.want, got)
+	}
+
+	_, err := Hyphenate("9786000000004")
+	assert.ErrorIs(t, err, ErrUnknownRange)
+}
@@ -0,0 +1,105 @@
+// Package mongomigrate applies versioned schema migrations, e.g. index
+// builds, to a MongoDB database and records the applied ones in a collection.
+package mongomigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+	"time"
+)
+
+// ErrUnknownSchema occurs when a database was migrated by a newer build.
+var ErrUnknownSchema = errors.New("database schema is newer than this build")
+
+// Migration changes the schema or the data of a database. Migrations are not
+// transactional and two processes starting at once may both run one, so a
+// migration must be safe to run again.
+type Migration struct {
+	Name string
+	Up   func(ctx context.Context, db *mongo.Database, log *slog.Logger) error
+}
+
+// record is an applied migration in the tracking collection.
+type record struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Migrate applies the migrations the database has not seen yet and records
+// them in the collection. A migration is identified by its position in the
+// list, so new migrations are appended.
+func Migrate(ctx context.Context, db *mongo.Database, collection string, migrations []Migration, log *slog.Logger) error {
+	const op = "mongomigrate.Migrate"
+	log = log.With(slog.String("op", op), slog.String("collection", collection))
+
+	applied := db.Collection(collection)
+	version, err := Version(ctx, db, collection)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("%s: %w: version %d, known %d", op, ErrUnknownSchema, version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		migration := migrations[i]
+		if err := migration.Up(ctx, db, log); err != nil {
+			return fmt.Errorf("%s: migration %d %q: %w", op, i+1, migration.Name, err)
+		}
+
+		_, err := applied.InsertOne(ctx, record{Version: i + 1, Name: migration.Name, AppliedAt: time.Now()})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("%s: failed to record migration %d: %w", op, i+1, err)
+		}
+		log.Info("applied migration", slog.Int("version", i+1), slog.String("name", migration.Name))
+	}
+
+	return nil
+}
+
+// Version returns the number of the last migration applied to the database.
+func Version(ctx context.Context, db *mongo.Database, collection string) (int, error) {
+	opts := options.FindOne().SetSort(bson.M{"_id": -1})
+
+	var last record
+	err := db.Collection(collection).FindOne(ctx, bson.M{}, opts).Decode(&last)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	return last.Version, nil
+}
+
+// CreateIndexes returns a migration step that creates the indexes on the
+// collection. Creating an index that already exists is a no-op.
+func CreateIndexes(collection string, indexes ...mongo.IndexModel) func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+	return func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+		names, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes)
+		if err != nil {
+			return fmt.Errorf("failed to create indexes on %s: %w", collection, err)
+		}
+		log.Info("created indexes", slog.String("collection", collection), slog.Any("indexes", names))
+		return nil
+	}
+}
+
+// Steps returns a migration step that runs the steps in order and stops at
+// the first error, e.g. to clean up data before creating a unique index.
+func Steps(steps ...func(ctx context.Context, db *mongo.Database, log *slog.Logger) error) func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+	return func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+		for _, step := range steps {
+			if err := step(ctx, db, log); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
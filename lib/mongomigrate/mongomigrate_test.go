@@ -0,0 +1,70 @@
+package mongomigrate
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestSteps(t *testing.T) {
+	var ran []string
+	step := func(name string, err error) func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+		return func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+			ran = append(ran, name)
+			return err
+		}
+	}
+	failed := errors.New("failed")
+
+	err := Steps(step("first", nil), step("second", failed), step("third", nil))(context.Background(), nil, nil)
+
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, []string{"first", "second"}, ran, "steps after a failed one are skipped")
+}
+
+// TestMigrate runs against the MongoDB server at MONGO_TEST_URI.
+func TestMigrate(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Disconnect(ctx) })
+
+	db := client.Database("librakeeper_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() { _ = db.Drop(ctx) })
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	var applied []string
+	migration := func(name string) Migration {
+		return Migration{Name: name, Up: func(ctx context.Context, db *mongo.Database, log *slog.Logger) error {
+			applied = append(applied, name)
+			return nil
+		}}
+	}
+
+	migrations := []Migration{migration("first"), migration("second")}
+	require.NoError(t, Migrate(ctx, db, "migrations", migrations, log))
+	assert.Equal(t, []string{"first", "second"}, applied)
+
+	migrations = append(migrations, migration("third"))
+	require.NoError(t, Migrate(ctx, db, "migrations", migrations, log))
+	assert.Equal(t, []string{"first", "second", "third"}, applied, "applied migrations are skipped")
+
+	version, err := Version(ctx, db, "migrations")
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	err = Migrate(ctx, db, "migrations", migrations[:1], log)
+	assert.ErrorIs(t, err, ErrUnknownSchema)
+}
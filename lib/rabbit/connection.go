@@ -0,0 +1,334 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrClosed occurs when the connection manager has been closed.
+var ErrClosed = errors.New("rabbit connection is closed")
+
+// ErrNotConfirmed occurs when the broker refuses to take a published message.
+var ErrNotConfirmed = errors.New("message not confirmed by the broker")
+
+// State is the state of a managed connection.
+type State int
+
+const (
+	Disconnected State = iota
+	Connected
+)
+
+func (s State) String() string {
+	if s == Connected {
+		return "connected"
+	}
+	return "disconnected"
+}
+
+// SetupFunc prepares a new channel: declares topology, sets QoS or confirm
+// mode. It runs after every (re)connect.
+type SetupFunc func(ch *amqp.Channel) error
+
+// Options tune a managed connection.
+type Options struct {
+	// Setup runs on every new channel.
+	Setup SetupFunc
+	// OnStateChange is called whenever the connection goes up or down.
+	OnStateChange func(State)
+	// MinBackoff and MaxBackoff bound the delay between reconnect attempts.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Connection keeps one AMQP connection and channel open. It watches
+// NotifyClose and redials with exponential backoff, running Setup again on
+// each new channel, until Close is called.
+type Connection struct {
+	url  string
+	log  *slog.Logger
+	opts Options
+
+	mu    sync.RWMutex
+	conn  *amqp.Connection
+	ch    *amqp.Channel
+	ready chan struct{} // closed while connected
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Dial starts connecting in the background and returns at once. Use Channel
+// to wait for the connection.
+func Dial(url string, log *slog.Logger, opts Options) *Connection {
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 500 * time.Millisecond
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = 30 * time.Second
+	}
+
+	c := &Connection{
+		url:    url,
+		log:    log.With(slog.String("component", "rabbit")),
+		opts:   opts,
+		ready:  make(chan struct{}),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.supervise()
+	return c
+}
+
+// State reports whether the connection is currently up.
+func (c *Connection) State() State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.ch != nil {
+		return Connected
+	}
+	return Disconnected
+}
+
+// Channel returns the current channel, waiting until the connection is up.
+// The channel is replaced after a reconnect, so callers should not keep it.
+func (c *Connection) Channel(ctx context.Context) (*amqp.Channel, error) {
+	for {
+		c.mu.RLock()
+		ch, ready := c.ch, c.ready
+		c.mu.RUnlock()
+		if ch != nil {
+			return ch, nil
+		}
+
+		select {
+		case <-ready:
+		case <-c.closed:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close stops reconnecting and closes the connection.
+func (c *Connection) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	<-c.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.ch = nil, nil
+	return err
+}
+
+// Publish sends a persistent message to a queue through the default exchange
+// and waits until the broker confirms it. Setup must put the channel in
+// confirm mode.
+func (c *Connection) Publish(ctx context.Context, queue string, body []byte) error {
+	ch, err := c.Channel(ctx)
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		"",    // exchange
+		queue, // routing key
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:  "application/x-protobuf",
+			DeliveryMode: amqp.Persistent,
+			Body:         body,
+		})
+	if err != nil {
+		return err
+	}
+
+	// The broker acks a persistent message once it is written to disk.
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrNotConfirmed
+	}
+	return nil
+}
+
+// supervise connects, waits for the connection to drop and reconnects.
+func (c *Connection) supervise() {
+	defer close(c.done)
+
+	backoff := c.opts.MinBackoff
+	for {
+		notify, err := c.connect()
+		if err != nil {
+			c.log.Error("failed to connect to RabbitMQ",
+				slog.Any("error", err),
+				slog.Duration("retry_in", backoff),
+			)
+			select {
+			case <-time.After(backoff):
+			case <-c.closed:
+				return
+			}
+			backoff = min(backoff*2, c.opts.MaxBackoff)
+			continue
+		}
+		backoff = c.opts.MinBackoff
+
+		select {
+		case err := <-notify:
+			c.log.Warn("RabbitMQ connection lost", slog.Any("error", err))
+			c.setDisconnected()
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// connect dials, opens a channel and runs Setup. It returns a channel that
+// receives an error when either the connection or the channel closes.
+func (c *Connection) connect() (<-chan *amqp.Error, error) {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+
+	if c.opts.Setup != nil {
+		if err := c.opts.Setup(ch); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to set up the channel: %w", err)
+		}
+	}
+
+	// A channel can close on its own after a protocol error, so watch both.
+	notify := make(chan *amqp.Error, 1)
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		var err *amqp.Error
+		select {
+		case err = <-connClosed:
+		case err = <-chClosed:
+			conn.Close()
+		}
+		notify <- err
+	}()
+
+	c.mu.Lock()
+	c.conn, c.ch = conn, ch
+	close(c.ready)
+	c.mu.Unlock()
+
+	c.log.Info("connected to RabbitMQ")
+	c.stateChanged(Connected)
+	return notify, nil
+}
+
+func (c *Connection) setDisconnected() {
+	c.mu.Lock()
+	c.conn, c.ch = nil, nil
+	c.ready = make(chan struct{})
+	c.mu.Unlock()
+
+	c.stateChanged(Disconnected)
+}
+
+func (c *Connection) stateChanged(state State) {
+	if c.opts.OnStateChange != nil {
+		c.opts.OnStateChange(state)
+	}
+}
+
+// Consume returns a stream of deliveries from a queue that survives
+// reconnects: after the connection comes back, consuming resumes on the new
+// channel. Deliveries received before a reconnect can no longer be acked;
+// the broker redelivers them. The stream is closed when ctx is done or the
+// connection manager is closed.
+func (c *Connection) Consume(ctx context.Context, queue string) <-chan amqp.Delivery {
+	out := make(chan amqp.Delivery)
+	go func() {
+		defer close(out)
+		for {
+			ch, err := c.Channel(ctx)
+			if err != nil {
+				return
+			}
+
+			msgs, err := ch.Consume(
+				queue, // queue
+				"",    // consumer
+				false, // auto-ack
+				false, // exclusive
+				false, // no-local
+				false, // no-wait
+				nil,   // args
+			)
+			if err != nil {
+				c.log.Error("failed to register a consumer", slog.Any("error", err))
+				select {
+				case <-time.After(c.opts.MinBackoff):
+					continue
+				case <-ctx.Done():
+					return
+				case <-c.closed:
+					return
+				}
+			}
+
+			if !forward(ctx, msgs, out) {
+				return
+			}
+
+			// The channel closed; wait until the supervisor notices and reconnects.
+			c.log.Info("consumer stopped, waiting for reconnect", slog.String("queue", queue))
+			select {
+			case <-time.After(c.opts.MinBackoff):
+			case <-ctx.Done():
+				return
+			case <-c.closed:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// forward passes deliveries on until msgs closes, which it reports with true,
+// or ctx is done.
+func forward(ctx context.Context, msgs <-chan amqp.Delivery, out chan<- amqp.Delivery) bool {
+	for {
+		select {
+		case d, ok := <-msgs:
+			if !ok {
+				return true
+			}
+			select {
+			case out <- d:
+			case <-ctx.Done():
+				return false
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
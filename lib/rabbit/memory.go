@@ -0,0 +1,201 @@
+package rabbit
+
+import (
+	"context"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"slices"
+	"sync"
+)
+
+// MemoryBroker is an in-process stand-in for RabbitMQ with the same delivery
+// contract as a Connection: Publish enqueues a message, Consume streams
+// deliveries that must be acked, and a nacked delivery is either requeued as
+// redelivered or moved to the dead letters of its queue. Queues are created on
+// first use. Nothing survives the process.
+type MemoryBroker struct {
+	mu      sync.Mutex
+	queues  map[string]*memoryQueue
+	unacked map[uint64]memoryUnacked
+	lastTag uint64
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type memoryQueue struct {
+	messages []memoryMessage
+	dead     [][]byte
+	ready    chan struct{} // signalled when a message is added
+}
+
+type memoryMessage struct {
+	body        []byte
+	redelivered bool
+}
+
+type memoryUnacked struct {
+	queue   string
+	message memoryMessage
+}
+
+// NewMemoryBroker creates an empty broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		queues:  map[string]*memoryQueue{},
+		unacked: map[uint64]memoryUnacked{},
+		closed:  make(chan struct{}),
+	}
+}
+
+// queue returns a queue, declaring it on first use. The caller must hold the lock.
+func (b *MemoryBroker) queue(name string) *memoryQueue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memoryQueue{ready: make(chan struct{}, 1)}
+		b.queues[name] = q
+	}
+	return q
+}
+
+// push adds a message to a queue and wakes a consumer. The caller must hold the lock.
+func (b *MemoryBroker) push(name string, message memoryMessage) {
+	q := b.queue(name)
+	q.messages = append(q.messages, message)
+	q.signal()
+}
+
+func (q *memoryQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Publish adds a message to a queue.
+func (b *MemoryBroker) Publish(ctx context.Context, queue string, body []byte) error {
+	select {
+	case <-b.closed:
+		return ErrClosed
+	default:
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.push(queue, memoryMessage{body: slices.Clone(body)})
+	return nil
+}
+
+// Consume streams the messages of a queue until ctx is done or the broker is
+// closed. Several consumers of one queue share its messages.
+func (b *MemoryBroker) Consume(ctx context.Context, queue string) <-chan amqp.Delivery {
+	out := make(chan amqp.Delivery)
+	go func() {
+		defer close(out)
+		for {
+			d, ok := b.next(queue)
+			if !ok {
+				b.mu.Lock()
+				ready := b.queue(queue).ready
+				b.mu.Unlock()
+
+				select {
+				case <-ready:
+					continue
+				case <-ctx.Done():
+					return
+				case <-b.closed:
+					return
+				}
+			}
+
+			select {
+			case out <- d:
+			case <-ctx.Done():
+				// Nobody took the delivery; put it back for other consumers.
+				_ = b.Reject(d.DeliveryTag, true)
+				return
+			case <-b.closed:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// next takes the first message of a queue and records it as unacked.
+func (b *MemoryBroker) next(queue string) (amqp.Delivery, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q := b.queue(queue)
+	if len(q.messages) == 0 {
+		return amqp.Delivery{}, false
+	}
+	message := q.messages[0]
+	q.messages = q.messages[1:]
+	if len(q.messages) > 0 {
+		// Wake the next consumer too.
+		q.signal()
+	}
+
+	b.lastTag++
+	b.unacked[b.lastTag] = memoryUnacked{queue: queue, message: message}
+	return amqp.Delivery{
+		Acknowledger: b,
+		ContentType:  "application/x-protobuf",
+		DeliveryMode: amqp.Persistent,
+		DeliveryTag:  b.lastTag,
+		Redelivered:  message.redelivered,
+		RoutingKey:   queue,
+		Body:         message.body,
+	}, true
+}
+
+// Ack implements amqp.Acknowledger. Multiple acks are not supported; only the
+// given delivery is acked.
+func (b *MemoryBroker) Ack(tag uint64, multiple bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.unacked, tag)
+	return nil
+}
+
+// Nack implements amqp.Acknowledger. A requeued message goes to the end of its
+// queue; otherwise it is dead-lettered. Only the given delivery is nacked.
+func (b *MemoryBroker) Nack(tag uint64, multiple bool, requeue bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	u, ok := b.unacked[tag]
+	if !ok {
+		return nil
+	}
+	delete(b.unacked, tag)
+
+	if requeue {
+		u.message.redelivered = true
+		b.push(u.queue, u.message)
+		return nil
+	}
+	q := b.queue(u.queue)
+	q.dead = append(q.dead, u.message.body)
+	return nil
+}
+
+// Reject implements amqp.Acknowledger.
+func (b *MemoryBroker) Reject(tag uint64, requeue bool) error {
+	return b.Nack(tag, false, requeue)
+}
+
+// DeadLetters returns the bodies of the messages dead-lettered from a queue.
+func (b *MemoryBroker) DeadLetters(queue string) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.queue(queue).dead)
+}
+
+// Close stops all consumers. Messages still queued are dropped.
+func (b *MemoryBroker) Close() error {
+	b.closeOnce.Do(func() { close(b.closed) })
+	return nil
+}
@@ -0,0 +1,73 @@
+// Package rabbit holds the RabbitMQ topology shared by the searcher, which
+// publishes ISBN jobs, and the searcher-agent, which consumes them.
+package rabbit
+
+import (
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetterExchange returns the name of the exchange that receives the
+// messages rejected from a queue.
+func DeadLetterExchange(queue string) string {
+	return queue + ".dlx"
+}
+
+// DeadLetterQueue returns the name of the queue that keeps the messages
+// rejected from a queue for inspection.
+func DeadLetterQueue(queue string) string {
+	return queue + ".dead"
+}
+
+// DeclareQueue declares a durable work queue along with its dead-letter
+// exchange and queue. Both sides declare the same topology, so either may
+// start first.
+//
+// Queues declared by older versions were not durable. RabbitMQ refuses to
+// redeclare a queue with other arguments, so such a queue has to be deleted
+// once before upgrading.
+func DeclareQueue(ch *amqp.Channel, queue string) (amqp.Queue, error) {
+	dlx := DeadLetterExchange(queue)
+
+	if err := ch.ExchangeDeclare(
+		dlx,      // name
+		"fanout", // kind
+		true,     // durable
+		false,    // auto-delete
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	); err != nil {
+		return amqp.Queue{}, fmt.Errorf("failed to declare dead-letter exchange: %w", err)
+	}
+
+	dead, err := ch.QueueDeclare(
+		DeadLetterQueue(queue), // name
+		true,                   // durable
+		false,                  // delete when unused
+		false,                  // exclusive
+		false,                  // no-wait
+		nil,                    // arguments
+	)
+	if err != nil {
+		return amqp.Queue{}, fmt.Errorf("failed to declare dead-letter queue: %w", err)
+	}
+
+	if err := ch.QueueBind(dead.Name, "", dlx, false, nil); err != nil {
+		return amqp.Queue{}, fmt.Errorf("failed to bind dead-letter queue: %w", err)
+	}
+
+	q, err := ch.QueueDeclare(
+		queue, // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		amqp.Table{"x-dead-letter-exchange": dlx},
+	)
+	if err != nil {
+		return amqp.Queue{}, fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	return q, nil
+}
@@ -0,0 +1,93 @@
+package e2e
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/tests/e2e/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestMoveBooks(t *testing.T) {
+	_, st := suite.New(t)
+
+	var first, second, foreign models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "First"}, http.StatusCreated, &first)
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Second"}, http.StatusCreated, &second)
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", "stranger", models.Bookshelf{Name: "Foreign"}, http.StatusCreated, &foreign)
+
+	var a, b, c models.Book
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{ISBN: isbn13, BookshelfIDs: []string{first.ID}, Title: "A", Author: "Author"}, http.StatusCreated, &a)
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{BookshelfIDs: []string{first.ID}, Title: "B", Author: "Author"}, http.StatusCreated, &b)
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{ISBN: isbn13, BookshelfIDs: []string{second.ID}, Title: "C", Author: "Author"}, http.StatusCreated, &c)
+
+	rec := st.Do(http.MethodPost, "/api/books/"+a.ID+"/move", userID, map[string]string{"bookshelf_id": foreign.ID})
+	assert.Equal(t, http.StatusNotFound, rec.Code, "another user's bookshelf is not found")
+	rec = st.Do(http.MethodPut, "/api/books/"+a.ID, userID, map[string][]string{"bookshelf_ids": {foreign.ID}})
+	assert.Equal(t, http.StatusNotFound, rec.Code, "updates are checked like moves")
+	rec = st.Do(http.MethodPost, "/api/books/"+a.ID+"/move", userID, map[string]string{"bookshelf_id": second.ID})
+	assert.Equal(t, http.StatusConflict, rec.Code, "the bookshelf already holds the ISBN")
+	rec = st.Do(http.MethodPost, "/api/books/"+a.ID+"/move", "stranger", map[string]string{"bookshelf_id": foreign.ID})
+	assert.Equal(t, http.StatusNotFound, rec.Code, "another user's book is not found")
+
+	var moved models.Book
+	st.DoJSON(http.MethodPost, "/api/books/"+b.ID+"/move", userID, map[string]string{"bookshelf_id": second.ID}, http.StatusOK, &moved)
+	assert.Equal(t, []string{second.ID}, moved.BookshelfIDs)
+	require.Len(t, moved.History, 1)
+	assert.Equal(t, models.BookEvent{Type: models.BookEventMoved, FromBookshelfID: first.ID, ToBookshelfID: second.ID, At: moved.History[0].At}, moved.History[0])
+
+	var result models.BookMoveResult
+	st.DoJSON(http.MethodPost, "/api/books/move", userID, models.BookMove{BookIDs: []string{a.ID, b.ID, c.ID}}, http.StatusOK, &result)
+	assert.Equal(t, models.BookMoveResult{Moved: []string{a.ID, b.ID, c.ID}, Unchanged: []string{}}, result)
+
+	st.DoJSON(http.MethodPost, "/api/books/move", userID, models.BookMove{BookIDs: []string{b.ID, a.ID}, BookshelfID: first.ID}, http.StatusOK, &result)
+	assert.Equal(t, []string{b.ID, a.ID}, result.Moved)
+
+	rec = st.Do(http.MethodPost, "/api/books/move", userID, models.BookMove{BookIDs: []string{c.ID, b.ID}, BookshelfID: first.ID})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = st.Do(http.MethodPost, "/api/books/move", userID, models.BookMove{BookshelfID: first.ID})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	st.DoJSON(http.MethodPut, "/api/books/"+c.ID, userID, map[string][]string{"bookshelf_ids": {second.ID}}, http.StatusOK, nil)
+	st.DoJSON(http.MethodGet, "/api/books/"+c.ID, userID, nil, http.StatusOK, &moved)
+	assert.Equal(t, []string{second.ID}, moved.BookshelfIDs)
+	require.Len(t, moved.History, 2, "an update of the bookshelves is recorded")
+	assert.Equal(t, models.BookEventAdded, moved.History[1].Type)
+}
+
+func TestBookOnSeveralBookshelves(t *testing.T) {
+	_, st := suite.New(t)
+
+	var first, second models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "First"}, http.StatusCreated, &first)
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Second"}, http.StatusCreated, &second)
+
+	var book models.Book
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{ISBN: isbn13, BookshelfIDs: []string{first.ID}, Title: "A", Author: "Author"}, http.StatusCreated, &book)
+	st.DoJSON(http.MethodPut, "/api/books/"+book.ID+"/bookshelves/"+second.ID, userID, nil, http.StatusOK, &book)
+	assert.Equal(t, []string{first.ID, second.ID}, book.BookshelfIDs)
+	st.DoJSON(http.MethodPut, "/api/books/"+book.ID+"/bookshelves/"+second.ID, userID, nil, http.StatusOK, &book)
+	assert.Len(t, book.History, 1, "adding a book to its own bookshelf changes nothing")
+
+	var page models.PaginatedBookResponse
+	for _, shelf := range []string{first.ID, second.ID} {
+		st.DoJSON(http.MethodGet, "/api/books/bookshelf/"+shelf, userID, nil, http.StatusOK, &page)
+		assert.Len(t, page.Books, 1)
+	}
+
+	rec := st.Do(http.MethodPost, "/api/books/"+book.ID+"/move", userID, map[string]string{"bookshelf_id": second.ID})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "the bookshelf to move from is ambiguous")
+
+	st.DoJSON(http.MethodDelete, "/api/books/"+book.ID+"/bookshelves/"+first.ID, userID, nil, http.StatusOK, &book)
+	assert.Equal(t, []string{second.ID}, book.BookshelfIDs)
+	rec = st.Do(http.MethodDelete, "/api/books/"+book.ID+"/bookshelves/"+first.ID, userID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	var result models.BookshelfDeleteResult
+	st.DoJSON(http.MethodPut, "/api/books/"+book.ID+"/bookshelves/"+first.ID, userID, nil, http.StatusOK, nil)
+	st.DoJSON(http.MethodDelete, "/api/bookshelves/"+first.ID+"?mode=cascade", userID, nil, http.StatusOK, &result)
+	assert.Equal(t, models.BookshelfDeleteResult{BookshelfID: first.ID, Mode: models.DeleteModeCascade, BooksKept: 1}, result)
+	st.DoJSON(http.MethodGet, "/api/books/"+book.ID, userID, nil, http.StatusOK, &book)
+	assert.Equal(t, []string{second.ID}, book.BookshelfIDs)
+}
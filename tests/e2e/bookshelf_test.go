@@ -0,0 +1,216 @@
+package e2e
+
+import (
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/tests/e2e/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestDeleteBookshelfWithBooks(t *testing.T) {
+	_, st := suite.New(t)
+
+	var old, target models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Old"}, http.StatusCreated, &old)
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Target"}, http.StatusCreated, &target)
+	for _, shelf := range []string{old.ID, target.ID} {
+		st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{ISBN: isbn13, BookshelfIDs: []string{shelf}, Title: "Title", Author: "Author"}, http.StatusCreated, nil)
+	}
+
+	rec := st.Do(http.MethodDelete, "/api/bookshelves/"+old.ID, userID, nil)
+	assert.Equal(t, http.StatusConflict, rec.Code, "a bookshelf with books is kept by default")
+
+	rec = st.Do(http.MethodDelete, "/api/bookshelves/"+old.ID+"?mode=move&target="+target.ID, userID, nil)
+	assert.Equal(t, http.StatusConflict, rec.Code, "the target already holds the ISBN")
+
+	var result models.BookshelfDeleteResult
+	st.DoJSON(http.MethodDelete, "/api/bookshelves/"+old.ID+"?mode=move", userID, nil, http.StatusOK, &result)
+	assert.Equal(t, models.BookshelfDeleteResult{BookshelfID: old.ID, Mode: models.DeleteModeMove, BooksMoved: 1}, result)
+
+	var page models.PaginatedBookResponse
+	st.DoJSON(http.MethodGet, "/api/books/", userID, nil, http.StatusOK, &page)
+	require.Len(t, page.Books, 2, "unshelved books stay in the library")
+
+	st.DoJSON(http.MethodDelete, "/api/bookshelves/"+target.ID+"?mode=cascade", userID, nil, http.StatusOK, &result)
+	assert.Equal(t, 1, result.BooksDeleted)
+	st.DoJSON(http.MethodGet, "/api/books/", userID, nil, http.StatusOK, &page)
+	require.Len(t, page.Books, 1)
+	assert.Empty(t, page.Books[0].BookshelfIDs)
+}
+
+func TestNestedBookshelves(t *testing.T) {
+	_, st := suite.New(t)
+
+	var room, bookcase, shelf, hall models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Living room"}, http.StatusCreated, &room)
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Bookcase", ParentID: room.ID}, http.StatusCreated, &bookcase)
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Top shelf", ParentID: bookcase.ID}, http.StatusCreated, &shelf)
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Bookcase"}, http.StatusCreated, &hall)
+
+	rec := st.Do(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Bookcase", ParentID: room.ID})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "names are unique per parent")
+	rec = st.Do(http.MethodPost, "/api/bookshelves/add", "stranger", models.Bookshelf{Name: "Shelf", ParentID: room.ID})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "another user's bookshelf is no parent")
+
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{ISBN: isbn13, BookshelfIDs: []string{shelf.ID}, Title: "A", Author: "Author"}, http.StatusCreated, nil)
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{BookshelfIDs: []string{bookcase.ID, shelf.ID}, Title: "B", Author: "Author"}, http.StatusCreated, nil)
+
+	var details models.BookshelfDetails
+	st.DoJSON(http.MethodGet, "/api/bookshelves/"+shelf.ID, userID, nil, http.StatusOK, &details)
+	assert.Equal(t, []models.BookshelfRef{{ID: room.ID, Name: "Living room"}, {ID: bookcase.ID, Name: "Bookcase"}}, details.Breadcrumbs)
+	assert.Equal(t, 2, details.Books)
+	st.DoJSON(http.MethodGet, "/api/bookshelves/"+room.ID, userID, nil, http.StatusOK, &details)
+	assert.Empty(t, details.Breadcrumbs)
+	assert.Equal(t, []models.BookshelfChild{{BookshelfRef: models.BookshelfRef{ID: bookcase.ID, Name: "Bookcase"}, SubtreeBooks: 2}}, details.Children)
+	assert.Zero(t, details.Books)
+	assert.Equal(t, 2, details.SubtreeBooks, "a book on two bookshelves of the subtree counts once")
+
+	var page models.PaginatedBookResponse
+	st.DoJSON(http.MethodGet, "/api/books/bookshelf/"+room.ID+"?recursive=true", userID, nil, http.StatusOK, &page)
+	assert.Len(t, page.Books, 2, "everything in the living room")
+	st.DoJSON(http.MethodGet, "/api/books/bookshelf/"+room.ID, userID, nil, http.StatusOK, &page)
+	assert.Empty(t, page.Books)
+
+	rec = st.Do(http.MethodPost, "/api/bookshelves/"+room.ID+"/move", userID, models.BookshelfMove{ParentID: shelf.ID})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a bookshelf cannot be nested in its own subtree")
+	rec = st.Do(http.MethodPost, "/api/bookshelves/"+bookcase.ID+"/move", userID, models.BookshelfMove{})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "the top level has a Bookcase already")
+	rec = st.Do(http.MethodDelete, "/api/bookshelves/"+bookcase.ID+"?mode=cascade", userID, nil)
+	assert.Equal(t, http.StatusConflict, rec.Code, "a bookshelf with nested ones is kept")
+
+	var moved models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/"+bookcase.ID+"/move", userID, models.BookshelfMove{ParentID: hall.ID}, http.StatusOK, &moved)
+	assert.Equal(t, hall.ID, moved.ParentID)
+	st.DoJSON(http.MethodGet, "/api/bookshelves/"+shelf.ID, userID, nil, http.StatusOK, &details)
+	assert.Equal(t, []models.BookshelfRef{{ID: hall.ID, Name: "Bookcase"}, {ID: bookcase.ID, Name: "Bookcase"}}, details.Breadcrumbs, "the subtree moved along")
+	st.DoJSON(http.MethodGet, "/api/books/bookshelf/"+room.ID+"?recursive=true", userID, nil, http.StatusOK, &page)
+	assert.Empty(t, page.Books)
+}
+
+func TestManualOrder(t *testing.T) {
+	_, st := suite.New(t)
+
+	var shelf, foreign models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Shelf"}, http.StatusCreated, &shelf)
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", "stranger", models.Bookshelf{Name: "Foreign"}, http.StatusCreated, &foreign)
+
+	var a, b, c models.Book
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{BookshelfIDs: []string{shelf.ID}, Title: "A", Author: "Author"}, http.StatusCreated, &a)
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{BookshelfIDs: []string{shelf.ID}, Title: "B", Author: "Author"}, http.StatusCreated, &b)
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{BookshelfIDs: []string{shelf.ID}, Title: "C", Author: "Author"}, http.StatusCreated, &c)
+
+	order := func() []string {
+		var page models.PaginatedBookResponse
+		st.DoJSON(http.MethodGet, "/api/books/bookshelf/"+shelf.ID+"?sort=position", userID, nil, http.StatusOK, &page)
+		var ids []string
+		for _, book := range page.Books {
+			ids = append(ids, book.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{a.ID, b.ID, c.ID}, order(), "new books go to the end")
+
+	st.DoJSON(http.MethodPut, "/api/books/bookshelf/"+shelf.ID+"/order", userID, models.Reorder{ID: c.ID, Before: a.ID}, http.StatusOK, nil)
+	assert.Equal(t, []string{c.ID, a.ID, b.ID}, order())
+	st.DoJSON(http.MethodPut, "/api/books/bookshelf/"+shelf.ID+"/order", userID, models.Reorder{IDs: []string{b.ID, a.ID, c.ID}}, http.StatusOK, nil)
+	assert.Equal(t, []string{b.ID, a.ID, c.ID}, order())
+
+	rec := st.Do(http.MethodPut, "/api/books/bookshelf/"+shelf.ID+"/order", userID, models.Reorder{IDs: []string{a.ID, b.ID}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "the full list names every book")
+	rec = st.Do(http.MethodPut, "/api/books/bookshelf/"+foreign.ID+"/order", userID, models.Reorder{ID: a.ID, After: b.ID})
+	assert.Equal(t, http.StatusNotFound, rec.Code, "another user's bookshelf is not found")
+	rec = st.Do(http.MethodGet, "/api/books/bookshelf/"+shelf.ID+"?sort=position&recursive=true", userID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a subtree has no manual order")
+
+	var first, second models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "First", ParentID: shelf.ID}, http.StatusCreated, &first)
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Second", ParentID: shelf.ID}, http.StatusCreated, &second)
+	st.DoJSON(http.MethodPut, "/api/bookshelves/"+shelf.ID+"/order", userID, models.Reorder{ID: second.ID, Before: first.ID}, http.StatusOK, nil)
+
+	var shelves models.PaginatedBookshelfResponse
+	st.DoJSON(http.MethodGet, "/api/bookshelves/?sort=position&parent_id="+shelf.ID, userID, nil, http.StatusOK, &shelves)
+	require.Len(t, shelves.Bookshelves, 2)
+	assert.Equal(t, second.ID, shelves.Bookshelves[0].ID)
+	assert.Equal(t, first.ID, shelves.Bookshelves[1].ID)
+
+	var details models.BookshelfDetails
+	st.DoJSON(http.MethodGet, "/api/bookshelves/"+shelf.ID, userID, nil, http.StatusOK, &details)
+	require.Len(t, details.Children, 2)
+	assert.Equal(t, second.ID, details.Children[0].ID, "children follow the manual order")
+
+	var top models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Top"}, http.StatusCreated, &top)
+	st.DoJSON(http.MethodPut, "/api/bookshelves/order", userID, models.Reorder{IDs: []string{top.ID, shelf.ID}}, http.StatusOK, nil)
+	st.DoJSON(http.MethodGet, "/api/bookshelves/?sort=position&parent_id=", userID, nil, http.StatusOK, &shelves)
+	require.Len(t, shelves.Bookshelves, 2, "only the top level")
+	assert.Equal(t, top.ID, shelves.Bookshelves[0].ID)
+}
+
+func TestSmartBookshelves(t *testing.T) {
+	_, st := suite.New(t)
+
+	var shelf models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Shelf"}, http.StatusCreated, &shelf)
+	var a, b, c models.Book
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{BookshelfIDs: []string{shelf.ID}, Title: "A", Author: "Leo Tolstoy", CoverImage: "a.jpg", Tags: []string{"gift"}}, http.StatusCreated, &a)
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{Title: "B", Author: "Fyodor Dostoevsky"}, http.StatusCreated, &b)
+	st.DoJSON(http.MethodPost, "/api/books/add", userID, models.Book{Title: "C", Author: "Anton Chekhov", Tags: []string{"gift", "short"}}, http.StatusCreated, &c)
+	st.DoJSON(http.MethodPost, "/api/books/add", "stranger", models.Book{Title: "D", Author: "Author", Tags: []string{"gift"}}, http.StatusCreated, nil)
+
+	rec := st.Do(http.MethodPost, "/api/bookshelves/add", userID, map[string]any{"name": "Empty", "filter": map[string]any{}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a filter needs a condition")
+	rec = st.Do(http.MethodPost, "/api/bookshelves/add", userID, map[string]any{"name": "Typo", "filter": map[string]any{"tags": "gift"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "unknown conditions are rejected")
+
+	var smart models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Gifts", Filter: &models.SmartFilter{Tag: "gift", AddedWithinDays: 30}}, http.StatusCreated, &smart)
+
+	var shelves models.PaginatedBookshelfResponse
+	st.DoJSON(http.MethodGet, "/api/bookshelves/?sort=name", userID, nil, http.StatusOK, &shelves)
+	require.Len(t, shelves.Bookshelves, 2, "smart bookshelves are listed with the others")
+	assert.Equal(t, smart.ID, shelves.Bookshelves[0].ID)
+	assert.Equal(t, &models.SmartFilter{Tag: "gift", AddedWithinDays: 30}, shelves.Bookshelves[0].Filter)
+
+	titles := func(query string) []string {
+		var page models.PaginatedBookResponse
+		st.DoJSON(http.MethodGet, "/api/books/bookshelf/"+smart.ID+"?sort=title"+query, userID, nil, http.StatusOK, &page)
+		var titles []string
+		for _, book := range page.Books {
+			titles = append(titles, book.Title)
+		}
+		return titles
+	}
+	assert.Equal(t, []string{"A", "C"}, titles(""), "the user's books with the tag")
+	assert.Equal(t, []string{"C"}, titles("&author=chekhov"), "list filters narrow the smart bookshelf")
+
+	var page models.PaginatedBookResponse
+	st.DoJSON(http.MethodGet, "/api/books/bookshelf/"+smart.ID+"?sort=title&limit=1", userID, nil, http.StatusOK, &page)
+	require.NotEmpty(t, page.NextCursor)
+	st.DoJSON(http.MethodGet, "/api/books/bookshelf/"+smart.ID+"?cursor="+page.NextCursor, userID, nil, http.StatusOK, &page)
+	require.Len(t, page.Books, 1)
+	assert.Equal(t, "C", page.Books[0].Title)
+
+	st.DoJSON(http.MethodPut, "/api/books/"+b.ID, userID, map[string][]string{"tags": {"gift"}}, http.StatusOK, nil)
+	assert.Equal(t, []string{"A", "B", "C"}, titles(""), "the contents follow the books")
+
+	noCover := false
+	st.DoJSON(http.MethodPut, "/api/bookshelves/"+smart.ID, userID, models.BookshelfUpdate{Filter: &models.SmartFilter{HasCover: &noCover}}, http.StatusOK, nil)
+	assert.Equal(t, []string{"B", "C"}, titles(""), "the filter was replaced")
+
+	rec = st.Do(http.MethodPost, "/api/books/"+a.ID+"/move", userID, map[string]string{"bookshelf_id": smart.ID})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "books cannot be put on a smart bookshelf")
+	rec = st.Do(http.MethodPut, "/api/books/bookshelf/"+smart.ID+"/order", userID, models.Reorder{IDs: []string{b.ID, c.ID}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a smart bookshelf has no manual order")
+	rec = st.Do(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Nested", ParentID: smart.ID})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "nothing is nested in a smart bookshelf")
+	rec = st.Do(http.MethodPut, "/api/bookshelves/"+shelf.ID, userID, models.BookshelfUpdate{Filter: &models.SmartFilter{Tag: "gift"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a bookshelf does not become smart")
+	rec = st.Do(http.MethodGet, "/api/books/bookshelf/"+smart.ID, "stranger", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	st.DoJSON(http.MethodDelete, "/api/bookshelves/"+smart.ID, userID, nil, http.StatusOK, nil)
+	st.DoJSON(http.MethodGet, "/api/books/", userID, nil, http.StatusOK, &page)
+	assert.Len(t, page.Books, 3, "deleting a smart bookshelf keeps the books")
+}
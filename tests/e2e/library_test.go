@@ -0,0 +1,107 @@
+package e2e
+
+import (
+	"errors"
+	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/searchrpc"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/tests/e2e/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+const (
+	isbn13 = "9785446120581"
+	isbn10 = "5-4461-2058-2"
+	userID = "reader"
+)
+
+func TestAdvancedSearchAddToLibrary(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	st.Provider.Add(isbn13,
+		&bookModels.BookInShop{
+			Title:      "Грокаем алгоритмы",
+			Author:     "Адитья Бхаргава",
+			Publishing: "Питер",
+			ImgUrl:     "https://shop.example/cover.jpg",
+			ShopName:   "Shop A",
+		},
+		&bookModels.BookInShop{
+			Title:    "Грокаем алгоритмы",
+			Author:   "Адитья Бхаргава",
+			ShopName: "Shop B",
+		},
+	)
+
+	var shelf models.Bookshelf
+	st.DoJSON(http.MethodPost, "/api/bookshelves/add", userID, models.Bookshelf{Name: "Programming"}, http.StatusCreated, &shelf)
+	require.NotEmpty(t, shelf.ID)
+
+	first := st.Search(userID, isbn10, false)
+	assert.Equal(t, searcherv1.SearchByISBNResponse_PROCESSING, first.Status)
+
+	resp := st.AwaitSearch(ctx, userID, isbn13)
+	require.Equal(t, searcherv1.SearchByISBNResponse_SUCCESS, resp.Status)
+	require.Len(t, resp.Books, 2)
+	assert.Equal(t, isbn13, resp.Books[0].ISBN)
+	assert.Equal(t, "Shop A", resp.Books[0].ShopName)
+	assert.Equal(t, 1, st.Provider.Calls(isbn13), "both spellings share one search")
+
+	query := url.Values{"isbn": {isbn10}, "bookshelf_id": {shelf.ID}, "index": {"0"}}
+	var added models.Book
+	st.DoJSON(http.MethodPost, "/api/books/add/advanced?"+query.Encode(), userID, nil, http.StatusCreated, &added)
+	assert.Equal(t, []string{shelf.ID}, added.BookshelfIDs)
+	assert.NotEmpty(t, added.CatalogID)
+
+	var page models.PaginatedBookResponse
+	st.DoJSON(http.MethodGet, "/api/books/", userID, nil, http.StatusOK, &page)
+	require.Len(t, page.Books, 1)
+	assert.Equal(t, isbn13, page.Books[0].ISBN)
+	assert.Equal(t, "Грокаем алгоритмы", page.Books[0].Title)
+	assert.Equal(t, "Адитья Бхаргава", page.Books[0].Author)
+	assert.Equal(t, "Питер", page.Books[0].Publishing)
+	assert.Equal(t, "Shop A", page.Books[0].ShopName)
+
+	// The same ISBN cannot go on the shelf twice.
+	rec := st.Do(http.MethodPost, "/api/books/add/advanced?"+query.Encode(), userID, nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestFailedSearchRetry(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	st.Provider.Fail(isbn13, errors.New("shop is unavailable"))
+
+	resp := st.AwaitSearch(ctx, userID, isbn13)
+	require.Equal(t, searchrpc.StatusFailed, resp.Status)
+	assert.Contains(t, resp.Reason, "shop is unavailable")
+
+	// The retry budget is spent, so polling does not search again.
+	resp = st.Search(userID, isbn13, false)
+	assert.Equal(t, searchrpc.StatusFailed, resp.Status)
+	assert.Equal(t, 1, st.Provider.Calls(isbn13))
+
+	st.Provider.Add(isbn13, &bookModels.BookInShop{Title: "Грокаем алгоритмы", ShopName: "Shop A"})
+
+	resp = st.Search(userID, isbn13, true)
+	assert.Equal(t, searcherv1.SearchByISBNResponse_PROCESSING, resp.Status)
+
+	resp = st.AwaitSearch(ctx, userID, isbn13)
+	require.Equal(t, searcherv1.SearchByISBNResponse_SUCCESS, resp.Status)
+	require.Len(t, resp.Books, 1)
+	assert.Empty(t, resp.Reason)
+	assert.Equal(t, 2, st.Provider.Calls(isbn13))
+}
+
+func TestRequestsWithoutTokenAreRejected(t *testing.T) {
+	_, st := suite.New(t)
+
+	rec := st.Do(http.MethodGet, "/api/search/advanced?isbn="+isbn13, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Zero(t, st.Provider.Calls(isbn13))
+}
@@ -0,0 +1,310 @@
+// Package suite boots the server, the searcher and the searcher-agent in one
+// process for end-to-end tests. MongoDB, RabbitMQ, Firebase and the shops are
+// replaced by in-memory stand-ins, so the tests need no running services.
+package suite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
+	app_rabbit "github.com/getz-devs/librakeeper-server/internal/searcher-agent/app/rabbit"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-agent/providers"
+	"github.com/getz-devs/librakeeper-server/internal/searcher-shared/domain/bookModels"
+	memorystorage "github.com/getz-devs/librakeeper-server/internal/searcher-shared/storage/memory"
+	grpcapp "github.com/getz-devs/librakeeper-server/internal/searcher/app/grpc"
+	"github.com/getz-devs/librakeeper-server/internal/searcher/rabbitProvider"
+	searcher_service "github.com/getz-devs/librakeeper-server/internal/searcher/services/searcher"
+	"github.com/getz-devs/librakeeper-server/internal/server"
+	"github.com/getz-devs/librakeeper-server/internal/server/config"
+	"github.com/getz-devs/librakeeper-server/internal/server/models"
+	"github.com/getz-devs/librakeeper-server/internal/server/services/search"
+	"github.com/getz-devs/librakeeper-server/internal/server/storage/memory"
+	"github.com/getz-devs/librakeeper-server/lib/rabbit"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	queueName = "searcher"
+	// tokenPrefix marks the bearer tokens accepted by the fake verifier.
+	tokenPrefix = "test-token:"
+)
+
+type Suite struct {
+	*testing.T
+	Router   *gin.Engine
+	Provider *FixtureProvider
+	Broker   *rabbit.MemoryBroker
+	Requests *memorystorage.Storage
+	DB       *memory.DB
+}
+
+// Options tune the processes started by New.
+type Options struct {
+	RetryPolicy searcher_service.RetryPolicy
+	Freshness   searcher_service.FreshnessPolicy
+	Workers     int
+	JobTimeout  time.Duration
+}
+
+// DefaultOptions retry a failed search only when asked to and keep results
+// fresh for the whole test.
+func DefaultOptions() Options {
+	return Options{
+		RetryPolicy: searcher_service.RetryPolicy{MaxAttempts: 1},
+		Freshness:   searcher_service.FreshnessPolicy{TTL: time.Hour, RefreshTimeout: time.Minute},
+		Workers:     2,
+		JobTimeout:  5 * time.Second,
+	}
+}
+
+// New starts the services with the default options and stops them when the
+// test ends.
+func New(t *testing.T) (context.Context, *Suite) {
+	return NewWithOptions(t, DefaultOptions())
+}
+
+func NewWithOptions(t *testing.T, opts Options) (context.Context, *Suite) {
+	t.Helper()
+	t.Parallel()
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 30*time.Second)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	gin.SetMode(gin.TestMode)
+
+	broker := rabbit.NewMemoryBroker()
+	requests := memorystorage.New()
+	provider := NewFixtureProvider()
+
+	// Searcher, served over an in-process listener.
+	executor := rabbitProvider.NewWithPublisher(broker, queueName, log)
+	searcherService := searcher_service.New(log, requests, executor, opts.RetryPolicy, opts.Freshness)
+	grpcApp := grpcapp.New(log, searcherService, health.NewServer(), 0)
+	listener := bufconn.Listen(1 << 20)
+	go func() {
+		if err := grpcApp.Serve(listener); err != nil {
+			t.Errorf("searcher stopped: %v", err)
+		}
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc client creation failed %v", err)
+	}
+
+	// Agent, consuming the jobs the searcher enqueues.
+	agent := app_rabbit.NewWithBroker(broker, queueName, app_rabbit.WorkerConfig{
+		Workers:    opts.Workers,
+		JobTimeout: opts.JobTimeout,
+	}, log, requests, []providers.Provider{provider})
+	go agent.MustRun()
+
+	// Server.
+	db := memory.NewDB()
+	cfg := &config.Config{Env: "test"}
+	cfg.Server.AllowedOrigins = []string{"http://localhost"}
+	cfg.Pagination.CursorSecret = "e2e"
+	router, err := server.NewRouter(cfg, server.Dependencies{
+		Books:       memory.NewBookRepo(db, log, memory.BooksCollection),
+		Bookshelves: memory.NewBookshelfRepo(db, log),
+		Catalog:     memory.NewCatalogRepo(db, log),
+		Searcher:    search.NewSearcherClient(conn, log),
+		Verifier:    TokenVerifier{},
+	}, log)
+	if err != nil {
+		t.Fatalf("server creation failed %v", err)
+	}
+
+	t.Cleanup(func() {
+		t.Helper()
+		cancelCtx()
+		_ = conn.Close()
+		grpcApp.Stop()
+		agent.Close()
+	})
+
+	return ctx, &Suite{
+		T:        t,
+		Router:   router,
+		Provider: provider,
+		Broker:   broker,
+		Requests: requests,
+		DB:       db,
+	}
+}
+
+// Token returns a bearer token the server accepts for the user.
+func Token(userID string) string {
+	return tokenPrefix + userID
+}
+
+// TokenVerifier stands in for Firebase: it accepts the tokens made by Token.
+type TokenVerifier struct{}
+
+func (TokenVerifier) VerifyIDToken(ctx context.Context, idToken string) (string, error) {
+	userID, ok := strings.CutPrefix(idToken, tokenPrefix)
+	if !ok || userID == "" {
+		return "", errors.New("invalid test token")
+	}
+	return userID, nil
+}
+
+// Do sends a request to the API as the user, or anonymously when userID is
+// empty. A non-nil body is sent as JSON.
+func (s *Suite) Do(method, path, userID string, body interface{}) *httptest.ResponseRecorder {
+	s.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.Fatalf("failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if userID != "" {
+		req.Header.Set("Authorization", "Bearer "+Token(userID))
+	}
+
+	rec := httptest.NewRecorder()
+	s.Router.ServeHTTP(rec, req)
+	return rec
+}
+
+// DoJSON sends a request like Do, checks the status code and decodes the response into out.
+func (s *Suite) DoJSON(method, path, userID string, body interface{}, status int, out interface{}) {
+	s.Helper()
+
+	rec := s.Do(method, path, userID, body)
+	if rec.Code != status {
+		s.Fatalf("%s %s: got status %d, want %d: %s", method, path, rec.Code, status, rec.Body.String())
+	}
+	if out == nil {
+		return
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		s.Fatalf("%s %s: failed to decode response: %v", method, path, err)
+	}
+}
+
+// Search runs an advanced search as the user, retrying a failed one when retry is set.
+func (s *Suite) Search(userID, isbn string, retry bool) models.SearchResponse {
+	s.Helper()
+
+	path := "/api/search/advanced?isbn=" + url.QueryEscape(isbn)
+	if retry {
+		path += "&retry=true"
+	}
+	var resp models.SearchResponse
+	s.DoJSON(http.MethodGet, path, userID, nil, http.StatusOK, &resp)
+	return resp
+}
+
+// AwaitSearch polls an advanced search until it leaves PROCESSING.
+func (s *Suite) AwaitSearch(ctx context.Context, userID, isbn string) models.SearchResponse {
+	s.Helper()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		resp := s.Search(userID, isbn, false)
+		if resp.Status != searcherv1.SearchByISBNResponse_PROCESSING {
+			return resp
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.Fatalf("search for %s did not finish: %v", isbn, ctx.Err())
+		}
+	}
+}
+
+// FixtureProvider stands in for the shops: it returns the offers added for
+// an ISBN, or the error it was told to fail with.
+type FixtureProvider struct {
+	mu       sync.Mutex
+	books    map[string][]*bookModels.BookInShop
+	failures map[string]error
+	calls    map[string]int
+}
+
+func NewFixtureProvider() *FixtureProvider {
+	return &FixtureProvider{
+		books:    map[string][]*bookModels.BookInShop{},
+		failures: map[string]error{},
+		calls:    map[string]int{},
+	}
+}
+
+// Add makes the provider return the offers for an ISBN-13.
+func (p *FixtureProvider) Add(isbn string, books ...*bookModels.BookInShop) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.books[isbn] = append(p.books[isbn], books...)
+	delete(p.failures, isbn)
+}
+
+// Fail makes the provider fail for an ISBN-13 until Add is called for it.
+func (p *FixtureProvider) Fail(isbn string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures[isbn] = err
+}
+
+// Calls returns how many times an ISBN-13 was searched.
+func (p *FixtureProvider) Calls(isbn string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[isbn]
+}
+
+func (p *FixtureProvider) Name() string {
+	return "fixture"
+}
+
+func (p *FixtureProvider) Capabilities() providers.Capabilities {
+	return providers.Capabilities{CoverImages: true, ShopNames: true}
+}
+
+func (p *FixtureProvider) SearchByISBN(ctx context.Context, isbn string) ([]*bookModels.BookInShop, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls[isbn]++
+	if err := p.failures[isbn]; err != nil {
+		return nil, fmt.Errorf("fixture: %w", err)
+	}
+
+	books := make([]*bookModels.BookInShop, 0, len(p.books[isbn]))
+	for _, book := range p.books[isbn] {
+		b := *book
+		books = append(books, &b)
+	}
+	return books, nil
+}
@@ -2,6 +2,7 @@ package tests
 
 import (
 	searcherv1 "github.com/getz-devs/librakeeper-protos/gen/go/searcher"
+	"github.com/getz-devs/librakeeper-server/lib/isbn"
 	"github.com/getz-devs/librakeeper-server/tests/integration/searcher/suite"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -43,13 +44,17 @@ func TestRealIsbn(t *testing.T) {
 }
 
 func GenerateRandomIsbn() string {
-	// Generate a random 10-digit ISBN
-	isbn := make([]byte, 10)
-	for i := 0; i < 9; i++ {
-		isbn[i] = byte(rand.Intn(10) + '0')
+	// Generate a random ISBN-13 with a valid check digit
+	body := make([]byte, 12)
+	copy(body, "978")
+	for i := 3; i < 12; i++ {
+		body[i] = byte(rand.Intn(10) + '0')
 	}
-	isbn[9] = 'X'
 
-	// Convert the byte slice to a string
-	return string(isbn)
+	check, err := isbn.CheckDigit(string(body))
+	if err != nil {
+		panic(err)
+	}
+
+	return string(append(body, check))
 }